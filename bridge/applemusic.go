@@ -0,0 +1,249 @@
+package bridge
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fakelag/streaming-music-bot/utils"
+)
+
+const appleMusicDefaultAPIURL = "https://api.music.apple.com"
+
+// Size of the artwork of tracks
+const appleMusicArtworkSize = 600
+
+type AppleMusicOptions struct {
+	// Developer token signed with a MusicKit key. Required
+	DeveloperToken string
+	// Defaults to the Apple Music API
+	APIURL string
+	// Defaults to a client with a 10 second timeout
+	HTTPClient *http.Client
+}
+
+// Reads songs, albums & playlists from the Apple Music API. Implements MetadataClient
+type AppleMusicClient struct {
+	developerToken string
+	apiURL         string
+	httpClient     *http.Client
+}
+
+type appleMusicSong struct {
+	ID         string `json:"id"`
+	Type       string `json:"type"`
+	Attributes struct {
+		Name             string `json:"name"`
+		ArtistName       string `json:"artistName"`
+		AlbumName        string `json:"albumName"`
+		DurationInMillis int64  `json:"durationInMillis"`
+		ISRC             string `json:"isrc"`
+		URL              string `json:"url"`
+		Artwork          struct {
+			// Template with {w} & {h} placeholders for the size
+			URL string `json:"url"`
+		} `json:"artwork"`
+	} `json:"attributes"`
+}
+
+type appleMusicTracks struct {
+	Data []appleMusicSong `json:"data"`
+	// Path of the next page, empty on the last page
+	Next string `json:"next"`
+}
+
+type appleMusicCollection struct {
+	ID         string `json:"id"`
+	Attributes struct {
+		Name string `json:"name"`
+		URL  string `json:"url"`
+	} `json:"attributes"`
+	Relationships struct {
+		Tracks *appleMusicTracks `json:"tracks"`
+	} `json:"relationships"`
+}
+
+func NewAppleMusicClient(options *AppleMusicOptions) *AppleMusicClient {
+	client := &AppleMusicClient{
+		developerToken: options.DeveloperToken,
+		apiURL:         options.APIURL,
+		httpClient:     options.HTTPClient,
+	}
+
+	if client.apiURL == "" {
+		client.apiURL = appleMusicDefaultAPIURL
+	}
+
+	if client.httpClient == nil {
+		client.httpClient = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	return client
+}
+
+func (client *AppleMusicClient) Name() string {
+	return "applemusic"
+}
+
+func (client *AppleMusicClient) Matches(inputUrl *url.URL) bool {
+	_, _, _, err := parseAppleMusicUrl(inputUrl)
+	return err == nil
+}
+
+func (client *AppleMusicClient) GetTracks(ctx context.Context, link string) (*TrackList, error) {
+	inputUrl, err := url.Parse(link)
+
+	if err != nil {
+		return nil, ErrorUnsupportedLink
+	}
+
+	storefront, kind, id, err := parseAppleMusicUrl(inputUrl)
+
+	if err != nil {
+		return nil, err
+	}
+
+	path := "/v1/catalog/" + url.PathEscape(storefront) + "/" + kind + "/" + url.PathEscape(id)
+
+	if kind == "songs" {
+		var response struct {
+			Data []appleMusicSong `json:"data"`
+		}
+
+		if err := client.get(ctx, path, &response); err != nil {
+			return nil, err
+		}
+
+		if len(response.Data) == 0 {
+			return nil, ErrorNotFound
+		}
+
+		return &TrackList{
+			Title:  response.Data[0].Attributes.Name,
+			Link:   link,
+			Tracks: []*Track{appleMusicToTrack(&response.Data[0])},
+		}, nil
+	}
+
+	var response struct {
+		Data []appleMusicCollection `json:"data"`
+	}
+
+	if err := client.get(ctx, path, &response); err != nil {
+		return nil, err
+	}
+
+	if len(response.Data) == 0 {
+		return nil, ErrorNotFound
+	}
+
+	collection := &response.Data[0]
+
+	trackList := &TrackList{
+		Title:        collection.Attributes.Name,
+		Link:         collection.Attributes.URL,
+		IsCollection: true,
+		Tracks:       make([]*Track, 0),
+	}
+
+	if trackList.Link == "" {
+		trackList.Link = link
+	}
+
+	page := collection.Relationships.Tracks
+
+	for page != nil && len(trackList.Tracks) < maxCollectionTracks {
+		for index := range page.Data {
+			// Music videos can not be matched to songs reliably
+			if page.Data[index].Type != "songs" || len(trackList.Tracks) >= maxCollectionTracks {
+				continue
+			}
+
+			trackList.Tracks = append(trackList.Tracks, appleMusicToTrack(&page.Data[index]))
+		}
+
+		if page.Next == "" {
+			break
+		}
+
+		nextPage := &appleMusicTracks{}
+
+		if err := client.get(ctx, page.Next, nextPage); err != nil {
+			return nil, err
+		}
+
+		page = nextPage
+	}
+
+	return trackList, nil
+}
+
+// Gets a path of the api, such as /v1/catalog/us/songs/1
+func (client *AppleMusicClient) get(ctx context.Context, path string, target any) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, client.apiURL+path, nil)
+
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("Authorization", "Bearer "+client.developerToken)
+
+	return doJsonRequest(client.httpClient, request, target)
+}
+
+// Returns the storefront, kind ("songs", "albums" or "playlists") & id of an Apple Music link
+func parseAppleMusicUrl(inputUrl *url.URL) (string, string, string, error) {
+	if strings.ToLower(inputUrl.Hostname()) != "music.apple.com" {
+		return "", "", "", ErrorUnsupportedLink
+	}
+
+	// Links are /<storefront>/<kind>/<name>/<id>, the name is missing from some links
+	segments := utils.PathSegments(inputUrl)
+
+	if len(segments) < 3 || len(segments) > 4 {
+		return "", "", "", ErrorUnsupportedLink
+	}
+
+	storefront := segments[0]
+	id := segments[len(segments)-1]
+
+	switch segments[1] {
+	case "song":
+		return storefront, "songs", id, nil
+	case "album":
+		// Links to a song of an album have the id of the song in the query
+		if songID := inputUrl.Query().Get("i"); songID != "" {
+			return storefront, "songs", songID, nil
+		}
+
+		return storefront, "albums", id, nil
+	case "playlist":
+		return storefront, "playlists", id, nil
+	default:
+		return "", "", "", ErrorUnsupportedLink
+	}
+}
+
+func appleMusicToTrack(song *appleMusicSong) *Track {
+	attributes := &song.Attributes
+	size := strconv.Itoa(appleMusicArtworkSize)
+
+	track := &Track{
+		Title:        attributes.Name,
+		Artists:      make([]string, 0),
+		Album:        attributes.AlbumName,
+		Duration:     time.Duration(attributes.DurationInMillis) * time.Millisecond,
+		ISRC:         attributes.ISRC,
+		Link:         attributes.URL,
+		ThumbnailURL: strings.NewReplacer("{w}", size, "{h}", size).Replace(attributes.Artwork.URL),
+	}
+
+	if attributes.ArtistName != "" {
+		track.Artists = append(track.Artists, attributes.ArtistName)
+	}
+
+	return track
+}
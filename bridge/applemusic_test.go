@@ -0,0 +1,101 @@
+package bridge_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/fakelag/streaming-music-bot/bridge"
+)
+
+func makeAppleMusicSongJson(id string, songType string) string {
+	return fmt.Sprintf(
+		`{"id": "%s", "type": "%s", "attributes": {"name": "Song %s", "artistName": "Artist", "albumName": "Album", `+
+			`"durationInMillis": 180000, "isrc": "ISRC%s", "url": "https://music.apple.com/us/song/%s", `+
+			`"artwork": {"url": "https://artwork.example.com/{w}x{h}bb.jpg"}}}`,
+		id, songType, id, id, id,
+	)
+}
+
+var _ = Describe("Apple Music", func() {
+	var server *httptest.Server
+	var client *bridge.AppleMusicClient
+
+	BeforeEach(func() {
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.Header.Get("Authorization")).To(Equal("Bearer developer-token"))
+
+			switch r.URL.RequestURI() {
+			case "/v1/catalog/us/songs/1":
+				fmt.Fprintf(w, `{"data": [%s]}`, makeAppleMusicSongJson("1", "songs"))
+			case "/v1/catalog/fi/albums/2":
+				fmt.Fprintf(w, `{"data": [{"id": "2", "attributes": {"name": "Album", "url": "https://music.apple.com/fi/album/2"}, `+
+					`"relationships": {"tracks": {"data": [%s, %s], "next": "/v1/catalog/fi/albums/2/tracks?offset=2"}}}]}`,
+					makeAppleMusicSongJson("1", "songs"), makeAppleMusicSongJson("v", "music-videos"),
+				)
+			case "/v1/catalog/fi/albums/2/tracks?offset=2":
+				fmt.Fprintf(w, `{"data": [%s]}`, makeAppleMusicSongJson("3", "songs"))
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+
+		client = bridge.NewAppleMusicClient(&bridge.AppleMusicOptions{
+			DeveloperToken: "developer-token",
+			APIURL:         server.URL,
+		})
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	DescribeTable("Matches Apple Music links", func(link string, expectMatch bool) {
+		inputUrl, err := url.Parse(link)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(client.Matches(inputUrl)).To(Equal(expectMatch))
+	},
+		Entry("Song", "https://music.apple.com/us/song/name/1", true),
+		Entry("Song of an album", "https://music.apple.com/us/album/name/2?i=1", true),
+		Entry("Playlist", "https://music.apple.com/us/playlist/name/pl.123", true),
+		Entry("Artist", "https://music.apple.com/us/artist/name/4", false),
+		Entry("Other site", "https://example.com/us/song/name/1", false),
+	)
+
+	It("Reads a song linked within an album", func() {
+		trackList, err := client.GetTracks(context.Background(), "https://music.apple.com/us/album/name/2?i=1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(trackList.IsCollection).To(BeFalse())
+		Expect(trackList.Tracks).To(HaveLen(1))
+
+		track := trackList.Tracks[0]
+		Expect(track.Title).To(Equal("Song 1"))
+		Expect(track.Artists).To(Equal([]string{"Artist"}))
+		Expect(track.Album).To(Equal("Album"))
+		Expect(track.Duration).To(Equal(3 * time.Minute))
+		Expect(track.ISRC).To(Equal("ISRC1"))
+		Expect(track.Link).To(Equal("https://music.apple.com/us/song/1"))
+		Expect(track.ThumbnailURL).To(Equal("https://artwork.example.com/600x600bb.jpg"))
+	})
+
+	It("Reads all pages of an album, skipping music videos", func() {
+		trackList, err := client.GetTracks(context.Background(), "https://music.apple.com/fi/album/name/2")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(trackList.IsCollection).To(BeTrue())
+		Expect(trackList.Title).To(Equal("Album"))
+		Expect(trackList.Tracks).To(HaveLen(2))
+		Expect(trackList.Tracks[0].Title).To(Equal("Song 1"))
+		Expect(trackList.Tracks[1].Title).To(Equal("Song 3"))
+	})
+
+	It("Returns an error for missing playlists", func() {
+		_, err := client.GetTracks(context.Background(), "https://music.apple.com/us/playlist/name/pl.404")
+		Expect(err).To(MatchError(bridge.ErrorNotFound))
+	})
+})
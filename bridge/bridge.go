@@ -0,0 +1,209 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math/rand"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fakelag/streaming-music-bot/resolver"
+	"github.com/fakelag/streaming-music-bot/utils"
+	"github.com/fakelag/streaming-music-bot/youtubeapi"
+)
+
+var (
+	ErrorUnsupportedLink  = errors.New("unsupported link")
+	ErrorNotFound         = errors.New("track, album or playlist not found")
+	ErrorUnexpectedStatus = errors.New("unexpected metadata api status")
+	ErrorNoTracks         = errors.New("no tracks found")
+	ErrorNoMatch          = errors.New("no matching youtube video found")
+)
+
+// Tracks of albums & playlists beyond this are not read
+const maxCollectionTracks = 1000
+
+// Track read from a streaming service that can not be played directly
+type Track struct {
+	Title   string
+	Artists []string
+	Album   string
+	// Zero if unknown
+	Duration time.Duration
+	// International Standard Recording Code, empty if unknown
+	ISRC         string
+	Link         string
+	ThumbnailURL string
+}
+
+// Track, album or playlist read from a link
+type TrackList struct {
+	Title string
+	Link  string
+	// True for albums & playlists, false for a link to a single track
+	IsCollection bool
+	Tracks       []*Track
+}
+
+// Reads track metadata from the links of a streaming service, such as Spotify
+type MetadataClient interface {
+	// Name of the service, such as "spotify"
+	Name() string
+	// Returns true if the url is a track, album or playlist link of the service
+	Matches(inputUrl *url.URL) bool
+	GetTracks(ctx context.Context, link string) (*TrackList, error)
+}
+
+type BridgeOptions struct {
+	// Clients reading the links bridged. Required
+	Clients []MetadataClient
+	// Number of YouTube search results scored for each track. Defaults to 5
+	SearchResults int
+	// Minimum score, between 0 & 1, of a search result matching a track. Defaults to 0.5
+	MinMatchScore float64
+	// Logs matched tracks. Defaults to no logging
+	Logger *slog.Logger
+}
+
+// Plays tracks of streaming services like Spotify & Apple Music by matching them to YouTube
+// videos. Implements resolver.MediaResolver, so it can be registered in a resolver.Registry
+type Bridge struct {
+	mutex         sync.RWMutex
+	yt            *youtubeapi.Youtube
+	clients       []MetadataClient
+	searchResults int
+	minMatchScore float64
+	logger        *slog.Logger
+	// Links of the videos matched to tracks by ISRC, or by track link if the ISRC is unknown
+	matchedLinks map[string]string
+}
+
+func NewBridge(yt *youtubeapi.Youtube, options *BridgeOptions) *Bridge {
+	searchResults := options.SearchResults
+
+	if searchResults <= 0 {
+		searchResults = 5
+	}
+
+	minMatchScore := options.MinMatchScore
+
+	if minMatchScore <= 0 {
+		minMatchScore = 0.5
+	}
+
+	logger := options.Logger
+
+	if logger == nil {
+		logger = utils.NewDiscardLogger()
+	}
+
+	return &Bridge{
+		yt:            yt,
+		logger:        logger,
+		clients:       options.Clients,
+		searchResults: searchResults,
+		minMatchScore: minMatchScore,
+		matchedLinks:  make(map[string]string),
+	}
+}
+
+func (bridge *Bridge) Name() string {
+	return "bridge"
+}
+
+func (bridge *Bridge) Matches(inputUrl *url.URL) bool {
+	return bridge.clientForUrl(inputUrl) != nil
+}
+
+// Resolves a track link into media matched right away, and album & playlist
+// links into a playlist matching each track as it is played
+func (bridge *Bridge) Resolve(ctx context.Context, input string) (*resolver.Result, error) {
+	inputUrl, err := url.Parse(strings.TrimSpace(input))
+
+	if err != nil {
+		return nil, ErrorUnsupportedLink
+	}
+
+	client := bridge.clientForUrl(inputUrl)
+
+	if client == nil {
+		return nil, ErrorUnsupportedLink
+	}
+
+	trackList, err := client.GetTracks(ctx, input)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(trackList.Tracks) == 0 {
+		return nil, ErrorNoTracks
+	}
+
+	if trackList.IsCollection {
+		rng := rand.New(rand.NewSource(time.Now().Unix()))
+		playlist := NewBridgedPlaylist(bridge, trackList, rng)
+		return &resolver.Result{Playlist: playlist, Resolver: client.Name()}, nil
+	}
+
+	media := NewBridgedMedia(bridge, trackList.Tracks[0])
+
+	if err := media.EnsureLoaded(ctx); err != nil {
+		return nil, err
+	}
+
+	return &resolver.Result{Media: media, Resolver: client.Name()}, nil
+}
+
+func (bridge *Bridge) clientForUrl(inputUrl *url.URL) MetadataClient {
+	for _, client := range bridge.clients {
+		if client.Matches(inputUrl) {
+			return client
+		}
+	}
+
+	return nil
+}
+
+func (bridge *Bridge) getMatchedLink(track *Track) string {
+	key := trackKey(track)
+
+	if key == "" {
+		return ""
+	}
+
+	bridge.mutex.RLock()
+	defer bridge.mutex.RUnlock()
+	return bridge.matchedLinks[key]
+}
+
+func (bridge *Bridge) setMatchedLink(track *Track, link string) {
+	key := trackKey(track)
+
+	if key == "" {
+		return
+	}
+
+	bridge.mutex.Lock()
+	defer bridge.mutex.Unlock()
+	bridge.matchedLinks[key] = link
+}
+
+// Returns an empty key for tracks that can not be identified
+func trackKey(track *Track) string {
+	if track.ISRC != "" {
+		return "isrc:" + strings.ToUpper(track.ISRC)
+	}
+
+	if track.Link != "" {
+		return "link:" + track.Link
+	}
+
+	return ""
+}
+
+// Verify implements resolver.MediaResolver
+var _ resolver.MediaResolver = (*Bridge)(nil)
@@ -0,0 +1,183 @@
+package bridge_test
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/fakelag/streaming-music-bot/bridge"
+	"github.com/fakelag/streaming-music-bot/entities"
+	"github.com/fakelag/streaming-music-bot/resolver"
+	"github.com/fakelag/streaming-music-bot/testutils"
+	"github.com/fakelag/streaming-music-bot/youtubeapi"
+)
+
+func makeMockSearchResult(id string, title string, channel string, durationSeconds int) string {
+	return fmt.Sprintf(
+		`https://streamurl.example.com/%s`+"\n"+
+			`{"_type": "video", "id": "%s", "fulltitle": "%s", "channel": "%s", "duration": %d, "extractor_key": "Youtube"}`,
+		id, id, title, channel, durationSeconds,
+	)
+}
+
+func countSearches(executor *testutils.MockCommandExecutor) int {
+	searches := 0
+
+	for _, args := range executor.RecordedArgs() {
+		if strings.HasPrefix(args[0], "ytsearch") {
+			searches += 1
+		}
+	}
+
+	return searches
+}
+
+type MockMetadataClient struct {
+	trackList *bridge.TrackList
+}
+
+func (client *MockMetadataClient) Name() string {
+	return "mock"
+}
+
+func (client *MockMetadataClient) Matches(inputUrl *url.URL) bool {
+	return inputUrl.Hostname() == "music.example.com"
+}
+
+func (client *MockMetadataClient) GetTracks(ctx context.Context, link string) (*bridge.TrackList, error) {
+	return client.trackList, nil
+}
+
+var _ = Describe("Bridge", func() {
+	track := &bridge.Track{
+		Title:    "Never Gonna Give You Up",
+		Artists:  []string{"Rick Astley"},
+		Duration: 213 * time.Second,
+		ISRC:     "GBARL9300135",
+		Link:     "https://music.example.com/track/1",
+	}
+
+	DescribeTable("Scores search results", func(title string, channel string, duration time.Duration, expectMatch bool) {
+		media := &youtubeapi.YoutubeMedia{VideoTitle: title, ChannelName: channel, VideoDuration: duration}
+		score := bridge.MatchScore(track, media)
+
+		if expectMatch {
+			Expect(score).To(BeNumerically(">=", 0.8))
+		} else {
+			Expect(score).To(BeNumerically("<", 0.5))
+		}
+	},
+		Entry("Official video", "Rick Astley - Never Gonna Give You Up (Official Music Video)", "Rick Astley", 212*time.Second, true),
+		Entry("Artist in the channel name", "Never Gonna Give You Up", "Rick Astley", 214*time.Second, true),
+		Entry("Cover", "Never Gonna Give You Up (Cover)", "Some Band", 213*time.Second, false),
+		Entry("Live version", "Rick Astley - Never Gonna Give You Up (Live)", "Rick Astley", 260*time.Second, false),
+		Entry("Different song", "Rick Astley - Together Forever", "Rick Astley", 200*time.Second, false),
+	)
+
+	It("Picks the best scoring search result", func() {
+		executor := &testutils.MockCommandExecutor{
+			MockStdoutResult: strings.Join([]string{
+				makeMockSearchResult("cover", "Never Gonna Give You Up (Cover)", "Some Band", 213),
+				makeMockSearchResult("original", "Rick Astley - Never Gonna Give You Up", "Rick Astley", 213),
+			}, "\n"),
+		}
+
+		yt := youtubeapi.NewYoutubeAPI()
+		yt.SetCmdExecutor(executor)
+
+		media, err := bridge.NewBridge(yt, &bridge.BridgeOptions{}).MatchTrack(context.Background(), track)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(media.ID).To(Equal("original"))
+		Expect(executor.RecordedArgs()[0][0]).To(Equal("ytsearch5:Rick Astley - Never Gonna Give You Up"))
+	})
+
+	It("Returns an error if no search result matches", func() {
+		executor := &testutils.MockCommandExecutor{
+			MockStdoutResult: makeMockSearchResult("other", "Another Song", "Another Artist", 100),
+		}
+
+		yt := youtubeapi.NewYoutubeAPI()
+		yt.SetCmdExecutor(executor)
+
+		_, err := bridge.NewBridge(yt, &bridge.BridgeOptions{}).MatchTrack(context.Background(), track)
+		Expect(err).To(MatchError(bridge.ErrorNoMatch))
+	})
+
+	It("Matches the tracks of a playlist as they are loaded", func() {
+		executor := &testutils.MockCommandExecutor{
+			MockStdoutResult: makeMockSearchResult("original", "Rick Astley - Never Gonna Give You Up", "Rick Astley", 213),
+		}
+
+		yt := youtubeapi.NewYoutubeAPI()
+		yt.SetCmdExecutor(executor)
+
+		otherTrack := *track
+		otherTrack.Link = "https://music.example.com/track/2"
+
+		client := &MockMetadataClient{trackList: &bridge.TrackList{
+			Title:        "Mock Playlist",
+			Link:         "https://music.example.com/playlist/1",
+			IsCollection: true,
+			Tracks:       []*bridge.Track{track, &otherTrack},
+		}}
+
+		registry := resolver.NewRegistry()
+		registry.Register(bridge.NewBridge(yt, &bridge.BridgeOptions{Clients: []bridge.MetadataClient{client}}))
+
+		result, err := registry.Resolve(context.Background(), "https://music.example.com/playlist/1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Resolver).To(Equal("mock"))
+		Expect(result.Media).To(BeNil())
+		Expect(result.Playlist.Title()).To(Equal("Mock Playlist"))
+		Expect(result.Playlist.GetMediaCount()).To(Equal(2))
+		Expect(executor.RecordedArgs()).To(BeEmpty())
+
+		media, err := result.Playlist.ConsumeNextMedia()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(media.Title()).To(Equal("Never Gonna Give You Up"))
+		Expect(media.Link()).To(Equal("https://music.example.com/track/1"))
+		Expect(media.FileURL()).To(Equal(""))
+		Expect(executor.RecordedArgs()).To(BeEmpty())
+
+		Expect(media.EnsureLoaded(context.Background())).To(Succeed())
+		Expect(media.FileURL()).To(Equal("https://streamurl.example.com/original"))
+		Expect(media.Link()).To(Equal("https://www.youtube.com/watch?v=original"))
+		Expect(media.(entities.MediaMetadata).Artist()).To(Equal("Rick Astley"))
+		Expect(countSearches(executor)).To(Equal(1))
+
+		// Tracks with the same ISRC are not searched again
+		media, err = result.Playlist.ConsumeNextMedia()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(media.EnsureLoaded(context.Background())).To(Succeed())
+		Expect(media.FileURL()).To(Equal("https://streamurl.example.com/original"))
+		Expect(countSearches(executor)).To(Equal(1))
+	})
+
+	It("Matches single tracks right away", func() {
+		executor := &testutils.MockCommandExecutor{
+			MockStdoutResult: makeMockSearchResult("original", "Rick Astley - Never Gonna Give You Up", "Rick Astley", 213),
+		}
+
+		yt := youtubeapi.NewYoutubeAPI()
+		yt.SetCmdExecutor(executor)
+
+		client := &MockMetadataClient{trackList: &bridge.TrackList{
+			Title:  track.Title,
+			Link:   track.Link,
+			Tracks: []*bridge.Track{track},
+		}}
+
+		bridgeResolver := bridge.NewBridge(yt, &bridge.BridgeOptions{Clients: []bridge.MetadataClient{client}})
+		Expect(bridgeResolver.Matches(&url.URL{Scheme: "https", Host: "example.com"})).To(BeFalse())
+
+		result, err := bridgeResolver.Resolve(context.Background(), track.Link)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Playlist).To(BeNil())
+		Expect(result.Media.FileURL()).To(Equal("https://streamurl.example.com/original"))
+	})
+})
@@ -0,0 +1,166 @@
+package bridge
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/fakelag/streaming-music-bot/entities"
+	"github.com/fakelag/streaming-music-bot/youtubeapi"
+)
+
+const (
+	titleScoreWeight    = 0.45
+	artistScoreWeight   = 0.25
+	durationScoreWeight = 0.3
+	// Durations within this are a perfect match, the score falls to 0 at maxDurationDiff
+	durationTolerance = 2 * time.Second
+	maxDurationDiff   = 30 * time.Second
+	// Subtracted for each version keyword in a video title but not in the track title
+	versionPenalty = 0.3
+)
+
+// Words in video titles that do not describe the song
+var fillerWords = map[string]bool{
+	"official": true, "video": true, "audio": true, "lyrics": true, "lyric": true, "music": true,
+	"hd": true, "hq": true, "4k": true, "mv": true, "ft": true, "feat": true, "visualizer": true,
+	"topic": true, "the": true, "a": true, "and": true,
+}
+
+// Words marking a different version of a song, such as a cover or a live performance
+var versionWords = []string{
+	"live", "cover", "remix", "karaoke", "instrumental", "acoustic", "nightcore", "slowed", "sped", "8d", "reverb",
+}
+
+// Searches YouTube for the track & returns the best scoring result. Matches are remembered,
+// so that the same track is not searched again
+func (bridge *Bridge) MatchTrack(ctx context.Context, track *Track) (*youtubeapi.YoutubeMedia, error) {
+	if link := bridge.getMatchedLink(track); link != "" {
+		return bridge.yt.GetYoutubeMedia(ctx, link)
+	}
+
+	results, err := bridge.yt.SearchYoutubeMedia(ctx, bridge.searchResults, searchQuery(track))
+
+	if err != nil {
+		return nil, err
+	}
+
+	var bestMatch *youtubeapi.YoutubeMedia
+	bestScore := 0.0
+
+	for _, media := range results {
+		if score := MatchScore(track, media); score > bestScore {
+			bestMatch = media
+			bestScore = score
+		}
+	}
+
+	if bestMatch == nil || bestScore < bridge.minMatchScore {
+		return nil, fmt.Errorf("%w: %s", ErrorNoMatch, searchQuery(track))
+	}
+
+	bridge.logger.Debug(
+		"matched track",
+		slog.String("track", searchQuery(track)),
+		slog.String("media_id", bestMatch.ID),
+		slog.Float64("score", bestScore),
+	)
+
+	bridge.setMatchedLink(track, bestMatch.Link())
+	return bestMatch, nil
+}
+
+// Scores how likely media is the track, from 0 to 1. Titles are compared word by word,
+// ignoring words like "official" & "video", and penalising covers, remixes & live versions
+func MatchScore(track *Track, media entities.Media) float64 {
+	mediaTitleWords := words(media.Title())
+	trackTitle := strings.ToLower(track.Title)
+
+	// Songs uploaded by artists often have only the song title in the video title
+	mediaWords := mediaTitleWords
+
+	if metadata, ok := media.(entities.MediaMetadata); ok {
+		mediaWords = append(mediaWords, words(metadata.Artist())...)
+	}
+
+	titleScore := wordCoverage(words(track.Title), mediaWords)
+	artistScore := 1.0
+
+	if len(track.Artists) > 0 {
+		artistScore = wordCoverage(words(track.Artists[0]), mediaWords)
+	}
+
+	score := titleScoreWeight*titleScore + artistScoreWeight*artistScore + durationScoreWeight*durationScore(track, media)
+
+	for _, versionWord := range versionWords {
+		if slices.Contains(mediaTitleWords, versionWord) && !strings.Contains(trackTitle, versionWord) {
+			score -= versionPenalty
+		}
+	}
+
+	return max(score, 0)
+}
+
+func searchQuery(track *Track) string {
+	if len(track.Artists) == 0 {
+		return track.Title
+	}
+
+	return track.Artists[0] + " - " + track.Title
+}
+
+func durationScore(track *Track, media entities.Media) float64 {
+	mediaDuration := media.Duration()
+
+	if track.Duration <= 0 || mediaDuration == nil || *mediaDuration <= 0 {
+		// Unknown durations neither count for nor against a match
+		return 0.5
+	}
+
+	diff := track.Duration - *mediaDuration
+
+	if diff < 0 {
+		diff = -diff
+	}
+
+	if diff <= durationTolerance {
+		return 1
+	}
+
+	return max(0, 1-float64(diff-durationTolerance)/float64(maxDurationDiff-durationTolerance))
+}
+
+// Fraction of expected words found in words. Filler words are not expected
+func wordCoverage(expected []string, words []string) float64 {
+	found := 0
+	total := 0
+
+	for _, word := range expected {
+		if fillerWords[word] {
+			continue
+		}
+
+		total += 1
+
+		if slices.Contains(words, word) {
+			found += 1
+		}
+	}
+
+	if total == 0 {
+		return 1
+	}
+
+	return float64(found) / float64(total)
+}
+
+// Lowercase words of text without punctuation
+func words(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
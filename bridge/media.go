@@ -0,0 +1,155 @@
+package bridge
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fakelag/streaming-music-bot/entities"
+	"github.com/fakelag/streaming-music-bot/youtubeapi"
+)
+
+// Track played from the YouTube video matched to it. The video is searched for in
+// EnsureLoaded, so that tracks of a playlist are matched only as they are played
+type BridgedMedia struct {
+	mutex  sync.RWMutex
+	Track  *Track
+	bridge *Bridge
+	match  *youtubeapi.YoutubeMedia
+}
+
+func NewBridgedMedia(bridge *Bridge, track *Track) *BridgedMedia {
+	return &BridgedMedia{
+		Track:  track,
+		bridge: bridge,
+	}
+}
+
+// YouTube video matched to the track, nil until it has been loaded
+func (bm *BridgedMedia) Match() *youtubeapi.YoutubeMedia {
+	bm.mutex.RLock()
+	defer bm.mutex.RUnlock()
+	return bm.match
+}
+
+func (bm *BridgedMedia) EnsureLoaded(ctx context.Context) error {
+	match := bm.Match()
+
+	if match == nil {
+		var err error
+		match, err = bm.bridge.MatchTrack(ctx, bm.Track)
+
+		if err != nil {
+			return err
+		}
+
+		bm.mutex.Lock()
+		bm.match = match
+		bm.mutex.Unlock()
+	}
+
+	return match.EnsureLoaded(ctx)
+}
+
+func (bm *BridgedMedia) FileURL() string {
+	if match := bm.Match(); match != nil {
+		return match.FileURL()
+	}
+
+	return ""
+}
+
+func (bm *BridgedMedia) FileURLExpiresAt() *time.Time {
+	if match := bm.Match(); match != nil {
+		return match.FileURLExpiresAt()
+	}
+
+	return nil
+}
+
+func (bm *BridgedMedia) InvalidateFileURL() {
+	if match := bm.Match(); match != nil {
+		match.InvalidateFileURL()
+	}
+}
+
+func (bm *BridgedMedia) FileAudioFormat() (codec string, container string) {
+	if match := bm.Match(); match != nil {
+		return match.FileAudioFormat()
+	}
+
+	return "", ""
+}
+
+// Title of the track, as video titles often have extra details like "(Official Video)"
+func (bm *BridgedMedia) Title() string {
+	return bm.Track.Title
+}
+
+// Link of the matched video, or of the track until it has been matched
+func (bm *BridgedMedia) Link() string {
+	if match := bm.Match(); match != nil {
+		return match.Link()
+	}
+
+	return bm.Track.Link
+}
+
+func (bm *BridgedMedia) Thumbnail() string {
+	if bm.Track.ThumbnailURL != "" {
+		return bm.Track.ThumbnailURL
+	}
+
+	if match := bm.Match(); match != nil {
+		return match.Thumbnail()
+	}
+
+	return ""
+}
+
+func (bm *BridgedMedia) CanJumpToTimeStamp() bool {
+	return true
+}
+
+func (bm *BridgedMedia) IsLiveStream() bool {
+	return false
+}
+
+func (bm *BridgedMedia) Duration() *time.Duration {
+	if match := bm.Match(); match != nil {
+		return match.Duration()
+	}
+
+	if bm.Track.Duration <= 0 {
+		return nil
+	}
+
+	duration := bm.Track.Duration
+	return &duration
+}
+
+func (bm *BridgedMedia) Artist() string {
+	return strings.Join(bm.Track.Artists, ", ")
+}
+
+func (bm *BridgedMedia) Album() string {
+	return bm.Track.Album
+}
+
+func (bm *BridgedMedia) Chapters() []entities.Chapter {
+	if match := bm.Match(); match != nil {
+		return match.Chapters()
+	}
+
+	return nil
+}
+
+// Verify implements entities.InvalidatableMedia
+var _ entities.InvalidatableMedia = (*BridgedMedia)(nil)
+
+// Verify implements entities.AudioFormatMedia
+var _ entities.AudioFormatMedia = (*BridgedMedia)(nil)
+
+// Verify implements entities.MediaMetadata
+var _ entities.MediaMetadata = (*BridgedMedia)(nil)
@@ -0,0 +1,129 @@
+package bridge
+
+import (
+	"math/rand"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/fakelag/streaming-music-bot/entities"
+)
+
+// Album or playlist of a streaming service. Tracks are matched to YouTube videos as they are played
+type BridgedPlaylist struct {
+	sync.RWMutex
+
+	PlaylistTitle string
+	PlaylistLink  string
+
+	removeMediaOnConsume bool
+	consumeOrder         entities.PlaylistConsumeOrder
+	mediaList            []*BridgedMedia
+	nextMediaIndex       int
+
+	// mutex needs to be write-locked for picker
+	picker *entities.ConsumeOrderPicker[*BridgedMedia]
+}
+
+func NewBridgedPlaylist(bridge *Bridge, trackList *TrackList, rng *rand.Rand) *BridgedPlaylist {
+	mediaList := make([]*BridgedMedia, len(trackList.Tracks))
+
+	for index, track := range trackList.Tracks {
+		mediaList[index] = NewBridgedMedia(bridge, track)
+	}
+
+	return &BridgedPlaylist{
+		PlaylistTitle:        trackList.Title,
+		PlaylistLink:         trackList.Link,
+		removeMediaOnConsume: true,
+		consumeOrder:         entities.ConsumeOrderFromStart,
+		mediaList:            mediaList,
+		picker:               entities.NewConsumeOrderPicker[*BridgedMedia](rng),
+	}
+}
+
+func (bpl *BridgedPlaylist) Title() string {
+	return bpl.PlaylistTitle
+}
+
+func (bpl *BridgedPlaylist) Link() string {
+	return bpl.PlaylistLink
+}
+
+func (bpl *BridgedPlaylist) ConsumeNextMedia() (entities.Media, error) {
+	bpl.Lock()
+	defer bpl.Unlock()
+
+	if len(bpl.mediaList) == 0 {
+		return nil, entities.ErrorPlaylistEmpty
+	}
+
+	mediaIndex := bpl.picker.PickIndex(bpl.consumeOrder, bpl.mediaList, &bpl.nextMediaIndex, bpl.removeMediaOnConsume)
+
+	selectedMedia := bpl.mediaList[mediaIndex]
+
+	if bpl.removeMediaOnConsume {
+		bpl.mediaList = append(bpl.mediaList[:mediaIndex:mediaIndex], bpl.mediaList[mediaIndex+1:]...)
+		bpl.picker.Remove(selectedMedia)
+	}
+
+	return selectedMedia, nil
+}
+
+func (bpl *BridgedPlaylist) SetConsumeOrder(order entities.PlaylistConsumeOrder) error {
+	if !slices.Contains(bpl.GetAvailableConsumeOrders(), order) {
+		return entities.ErrorConsumeOrderNotSupported
+	}
+
+	bpl.Lock()
+	defer bpl.Unlock()
+	bpl.consumeOrder = order
+	return nil
+}
+
+func (bpl *BridgedPlaylist) SetRemoveOnConsume(removeMediaOnConsume bool) {
+	bpl.Lock()
+	defer bpl.Unlock()
+	bpl.removeMediaOnConsume = removeMediaOnConsume
+}
+
+func (bpl *BridgedPlaylist) GetAvailableConsumeOrders() []entities.PlaylistConsumeOrder {
+	return entities.PickerConsumeOrders()
+}
+
+func (bpl *BridgedPlaylist) GetMediaCount() int {
+	bpl.RLock()
+	defer bpl.RUnlock()
+	return len(bpl.mediaList)
+}
+
+func (bpl *BridgedPlaylist) GetRemoveOnConsume() bool {
+	bpl.RLock()
+	defer bpl.RUnlock()
+	return bpl.removeMediaOnConsume
+}
+
+func (bpl *BridgedPlaylist) GetConsumeOrder() entities.PlaylistConsumeOrder {
+	bpl.RLock()
+	defer bpl.RUnlock()
+	return bpl.consumeOrder
+}
+
+func (bpl *BridgedPlaylist) GetDurationLeft() *time.Duration {
+	bpl.RLock()
+	defer bpl.RUnlock()
+
+	durationLeft := time.Duration(0)
+	for _, media := range bpl.mediaList {
+		mediaDuration := media.Duration()
+
+		if mediaDuration != nil {
+			durationLeft += *mediaDuration
+		}
+	}
+
+	return &durationLeft
+}
+
+// Verify implements entities.Playlist
+var _ entities.Playlist = (*BridgedPlaylist)(nil)
@@ -0,0 +1,422 @@
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fakelag/streaming-music-bot/utils"
+)
+
+const (
+	spotifyDefaultAPIURL      = "https://api.spotify.com"
+	spotifyDefaultAccountsURL = "https://accounts.spotify.com"
+	// Max ids in a single request for several tracks
+	spotifyTracksBatchSize = 50
+)
+
+type SpotifyOptions struct {
+	// Credentials of a Spotify app, used with the client credentials flow. Required
+	ClientID     string
+	ClientSecret string
+	// Country code of the catalog used. Defaults to "US"
+	Market string
+	// Defaults to the Spotify Web API
+	APIURL      string
+	AccountsURL string
+	// Defaults to a client with a 10 second timeout
+	HTTPClient *http.Client
+}
+
+// Reads tracks, albums & playlists from the Spotify Web API. Implements MetadataClient
+type SpotifyClient struct {
+	mutex          sync.Mutex
+	clientID       string
+	clientSecret   string
+	market         string
+	apiURL         string
+	accountsURL    string
+	httpClient     *http.Client
+	accessToken    string
+	tokenExpiresAt time.Time
+}
+
+type spotifyExternalURLs struct {
+	Spotify string `json:"spotify"`
+}
+
+type spotifyImage struct {
+	URL   string `json:"url"`
+	Width int    `json:"width"`
+}
+
+type spotifyArtist struct {
+	Name string `json:"name"`
+}
+
+type spotifyTrack struct {
+	ID          string          `json:"id"`
+	Type        string          `json:"type"`
+	Name        string          `json:"name"`
+	Artists     []spotifyArtist `json:"artists"`
+	Album       *spotifyAlbum   `json:"album"`
+	DurationMs  int64           `json:"duration_ms"`
+	ExternalIDs struct {
+		ISRC string `json:"isrc"`
+	} `json:"external_ids"`
+	ExternalURLs spotifyExternalURLs `json:"external_urls"`
+}
+
+type spotifyPage[T any] struct {
+	Items []T `json:"items"`
+	// Url of the next page, empty on the last page
+	Next string `json:"next"`
+}
+
+type spotifyAlbum struct {
+	Name         string                     `json:"name"`
+	Images       []spotifyImage             `json:"images"`
+	ExternalURLs spotifyExternalURLs        `json:"external_urls"`
+	Tracks       *spotifyPage[spotifyTrack] `json:"tracks"`
+}
+
+type spotifyPlaylistItem struct {
+	// Nil for tracks that are no longer available
+	Track *spotifyTrack `json:"track"`
+}
+
+type spotifyPlaylist struct {
+	Name         string                            `json:"name"`
+	Images       []spotifyImage                    `json:"images"`
+	ExternalURLs spotifyExternalURLs               `json:"external_urls"`
+	Tracks       *spotifyPage[spotifyPlaylistItem] `json:"tracks"`
+}
+
+func NewSpotifyClient(options *SpotifyOptions) *SpotifyClient {
+	client := &SpotifyClient{
+		clientID:     options.ClientID,
+		clientSecret: options.ClientSecret,
+		market:       options.Market,
+		apiURL:       options.APIURL,
+		accountsURL:  options.AccountsURL,
+		httpClient:   options.HTTPClient,
+	}
+
+	if client.market == "" {
+		client.market = "US"
+	}
+
+	if client.apiURL == "" {
+		client.apiURL = spotifyDefaultAPIURL
+	}
+
+	if client.accountsURL == "" {
+		client.accountsURL = spotifyDefaultAccountsURL
+	}
+
+	if client.httpClient == nil {
+		client.httpClient = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	return client
+}
+
+func (client *SpotifyClient) Name() string {
+	return "spotify"
+}
+
+func (client *SpotifyClient) Matches(inputUrl *url.URL) bool {
+	_, _, err := parseSpotifyUrl(inputUrl)
+	return err == nil
+}
+
+func (client *SpotifyClient) GetTracks(ctx context.Context, link string) (*TrackList, error) {
+	inputUrl, err := url.Parse(link)
+
+	if err != nil {
+		return nil, ErrorUnsupportedLink
+	}
+
+	kind, id, err := parseSpotifyUrl(inputUrl)
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch kind {
+	case "track":
+		var track spotifyTrack
+		if err := client.get(ctx, client.apiPath("/v1/tracks/"+url.PathEscape(id)), &track); err != nil {
+			return nil, err
+		}
+
+		return &TrackList{
+			Title:  track.Name,
+			Link:   link,
+			Tracks: []*Track{spotifyToTrack(&track, track.Album)},
+		}, nil
+	case "album":
+		return client.getAlbum(ctx, id, link)
+	default:
+		return client.getPlaylist(ctx, id, link)
+	}
+}
+
+func (client *SpotifyClient) getAlbum(ctx context.Context, id string, link string) (*TrackList, error) {
+	var album spotifyAlbum
+	if err := client.get(ctx, client.apiPath("/v1/albums/"+url.PathEscape(id)), &album); err != nil {
+		return nil, err
+	}
+
+	// Tracks of albums are missing their ISRC, which is read with the full tracks
+	trackIDs := make([]string, 0)
+
+	err := readSpotifyPages(ctx, client, album.Tracks, func(track spotifyTrack) {
+		trackIDs = append(trackIDs, track.ID)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	trackList := &TrackList{
+		Title:        album.Name,
+		Link:         spotifyLink(album.ExternalURLs, link),
+		IsCollection: true,
+		Tracks:       make([]*Track, 0, len(trackIDs)),
+	}
+
+	for start := 0; start < len(trackIDs); start += spotifyTracksBatchSize {
+		end := min(start+spotifyTracksBatchSize, len(trackIDs))
+
+		var response struct {
+			Tracks []*spotifyTrack `json:"tracks"`
+		}
+
+		query := "&ids=" + url.QueryEscape(strings.Join(trackIDs[start:end], ","))
+
+		if err := client.get(ctx, client.apiPath("/v1/tracks")+query, &response); err != nil {
+			return nil, err
+		}
+
+		for _, track := range response.Tracks {
+			if track != nil {
+				trackList.Tracks = append(trackList.Tracks, spotifyToTrack(track, &album))
+			}
+		}
+	}
+
+	return trackList, nil
+}
+
+func (client *SpotifyClient) getPlaylist(ctx context.Context, id string, link string) (*TrackList, error) {
+	var playlist spotifyPlaylist
+	if err := client.get(ctx, client.apiPath("/v1/playlists/"+url.PathEscape(id)), &playlist); err != nil {
+		return nil, err
+	}
+
+	trackList := &TrackList{
+		Title:        playlist.Name,
+		Link:         spotifyLink(playlist.ExternalURLs, link),
+		IsCollection: true,
+		Tracks:       make([]*Track, 0),
+	}
+
+	err := readSpotifyPages(ctx, client, playlist.Tracks, func(item spotifyPlaylistItem) {
+		// Podcast episodes can not be matched to songs
+		if item.Track != nil && item.Track.Type == "track" {
+			trackList.Tracks = append(trackList.Tracks, spotifyToTrack(item.Track, item.Track.Album))
+		}
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return trackList, nil
+}
+
+// Calls onItem for the items of page & the pages after it, up to maxCollectionTracks items
+func readSpotifyPages[T any](ctx context.Context, client *SpotifyClient, page *spotifyPage[T], onItem func(item T)) error {
+	numItems := 0
+
+	for page != nil {
+		for _, item := range page.Items {
+			if numItems >= maxCollectionTracks {
+				return nil
+			}
+
+			onItem(item)
+			numItems += 1
+		}
+
+		if page.Next == "" {
+			return nil
+		}
+
+		nextPage := &spotifyPage[T]{}
+
+		if err := client.get(ctx, page.Next, nextPage); err != nil {
+			return err
+		}
+
+		page = nextPage
+	}
+
+	return nil
+}
+
+func (client *SpotifyClient) apiPath(path string) string {
+	return client.apiURL + path + "?market=" + url.QueryEscape(client.market)
+}
+
+func (client *SpotifyClient) get(ctx context.Context, requestUrl string, target any) error {
+	accessToken, err := client.getAccessToken(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, requestUrl, nil)
+
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("Authorization", "Bearer "+accessToken)
+
+	return doJsonRequest(client.httpClient, request, target)
+}
+
+// Returns the current access token, requesting a new one if it is about to expire
+func (client *SpotifyClient) getAccessToken(ctx context.Context) (string, error) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	if client.accessToken != "" && time.Until(client.tokenExpiresAt) > time.Minute {
+		return client.accessToken, nil
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, client.accountsURL+"/api/token", strings.NewReader(form.Encode()))
+
+	if err != nil {
+		return "", err
+	}
+
+	request.SetBasicAuth(client.clientID, client.clientSecret)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var response struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+
+	if err := doJsonRequest(client.httpClient, request, &response); err != nil {
+		return "", err
+	}
+
+	client.accessToken = response.AccessToken
+	client.tokenExpiresAt = time.Now().Add(time.Duration(response.ExpiresIn) * time.Second)
+
+	return client.accessToken, nil
+}
+
+// Returns the kind ("track", "album" or "playlist") & id of a Spotify link
+func parseSpotifyUrl(inputUrl *url.URL) (string, string, error) {
+	if strings.ToLower(inputUrl.Hostname()) != "open.spotify.com" {
+		return "", "", ErrorUnsupportedLink
+	}
+
+	segments := utils.PathSegments(inputUrl)
+
+	// Localised links, such as /intl-de/track/<id>
+	if len(segments) > 0 && strings.HasPrefix(segments[0], "intl-") {
+		segments = segments[1:]
+	}
+
+	if len(segments) != 2 || segments[1] == "" {
+		return "", "", ErrorUnsupportedLink
+	}
+
+	switch segments[0] {
+	case "track", "album", "playlist":
+		return segments[0], segments[1], nil
+	default:
+		return "", "", ErrorUnsupportedLink
+	}
+}
+
+func spotifyToTrack(track *spotifyTrack, album *spotifyAlbum) *Track {
+	result := &Track{
+		Title:    track.Name,
+		Artists:  make([]string, 0, len(track.Artists)),
+		Duration: time.Duration(track.DurationMs) * time.Millisecond,
+		ISRC:     track.ExternalIDs.ISRC,
+		Link:     track.ExternalURLs.Spotify,
+	}
+
+	if result.Link == "" && track.ID != "" {
+		result.Link = "https://open.spotify.com/track/" + track.ID
+	}
+
+	for _, artist := range track.Artists {
+		result.Artists = append(result.Artists, artist.Name)
+	}
+
+	if album != nil {
+		result.Album = album.Name
+		result.ThumbnailURL = largestSpotifyImage(album.Images)
+	}
+
+	return result
+}
+
+func largestSpotifyImage(images []spotifyImage) string {
+	imageUrl := ""
+	imageWidth := -1
+
+	for _, image := range images {
+		if image.Width > imageWidth {
+			imageUrl = image.URL
+			imageWidth = image.Width
+		}
+	}
+
+	return imageUrl
+}
+
+func spotifyLink(externalURLs spotifyExternalURLs, link string) string {
+	if externalURLs.Spotify != "" {
+		return externalURLs.Spotify
+	}
+
+	return link
+}
+
+// Sends the request & decodes a json response into target
+func doJsonRequest(httpClient *http.Client, request *http.Request, target any) error {
+	response, err := httpClient.Do(request)
+
+	if err != nil {
+		return err
+	}
+
+	defer response.Body.Close()
+
+	switch {
+	case response.StatusCode == http.StatusNotFound:
+		return ErrorNotFound
+	case response.StatusCode < 200 || response.StatusCode > 299:
+		return fmt.Errorf("%w: %s", ErrorUnexpectedStatus, response.Status)
+	}
+
+	return json.NewDecoder(response.Body).Decode(target)
+}
@@ -0,0 +1,161 @@
+package bridge_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/fakelag/streaming-music-bot/bridge"
+)
+
+func makeSpotifyTrackJson(id string, isrc string) string {
+	return fmt.Sprintf(
+		`{"id": "%s", "type": "track", "name": "Track %s", "artists": [{"name": "Artist"}, {"name": "Featured"}], `+
+			`"duration_ms": 200500, "external_ids": {"isrc": "%s"}, "external_urls": {"spotify": "https://open.spotify.com/track/%s"}, `+
+			`"album": {"name": "Album", "images": [{"url": "small.jpg", "width": 64}, {"url": "large.jpg", "width": 640}]}}`,
+		id, id, isrc, id,
+	)
+}
+
+var _ = Describe("Spotify", func() {
+	var server *httptest.Server
+	var tokenRequests int
+	var client *bridge.SpotifyClient
+
+	BeforeEach(func() {
+		tokenRequests = 0
+		mux := http.NewServeMux()
+
+		mux.HandleFunc("POST /api/token", func(w http.ResponseWriter, r *http.Request) {
+			clientID, clientSecret, _ := r.BasicAuth()
+			Expect(clientID).To(Equal("id"))
+			Expect(clientSecret).To(Equal("secret"))
+			Expect(r.FormValue("grant_type")).To(Equal("client_credentials"))
+
+			tokenRequests += 1
+			fmt.Fprint(w, `{"access_token": "token", "expires_in": 3600}`)
+		})
+
+		mux.HandleFunc("POST /unauthorized/api/token", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusUnauthorized)
+		})
+
+		mux.HandleFunc("GET /v1/", func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.Header.Get("Authorization")).To(Equal("Bearer token"))
+			Expect(r.URL.Query().Get("market")).To(Equal("FI"))
+
+			switch r.URL.Path {
+			case "/v1/tracks/1":
+				fmt.Fprint(w, makeSpotifyTrackJson("1", "ISRC1"))
+			case "/v1/albums/2":
+				fmt.Fprint(w, `{"name": "Album", "external_urls": {"spotify": "https://open.spotify.com/album/2"}, "images": [], `+
+					`"tracks": {"items": [{"id": "1"}, {"id": "2"}], "next": null}}`)
+			case "/v1/tracks":
+				Expect(r.URL.Query().Get("ids")).To(Equal("1,2"))
+				fmt.Fprintf(w, `{"tracks": [%s, %s]}`, makeSpotifyTrackJson("1", "ISRC1"), makeSpotifyTrackJson("2", "ISRC2"))
+			case "/v1/playlists/3":
+				fmt.Fprintf(w, `{"name": "Playlist", "external_urls": {"spotify": "https://open.spotify.com/playlist/3"}, `+
+					`"tracks": {"items": [{"track": %s}, {"track": null}, {"track": {"id": "e", "type": "episode"}}], `+
+					`"next": "%s/v1/playlists/3/tracks?market=FI&offset=3"}}`,
+					makeSpotifyTrackJson("1", "ISRC1"), "http://"+r.Host,
+				)
+			case "/v1/playlists/3/tracks":
+				fmt.Fprintf(w, `{"items": [{"track": %s}], "next": null}`, makeSpotifyTrackJson("2", "ISRC2"))
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		})
+
+		server = httptest.NewServer(mux)
+
+		client = bridge.NewSpotifyClient(&bridge.SpotifyOptions{
+			ClientID:     "id",
+			ClientSecret: "secret",
+			Market:       "FI",
+			APIURL:       server.URL,
+			AccountsURL:  server.URL,
+		})
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	DescribeTable("Matches Spotify links", func(link string, expectMatch bool) {
+		inputUrl, err := url.Parse(link)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(client.Matches(inputUrl)).To(Equal(expectMatch))
+	},
+		Entry("Track", "https://open.spotify.com/track/1?si=abc", true),
+		Entry("Localised album", "https://open.spotify.com/intl-de/album/2", true),
+		Entry("Playlist", "https://open.spotify.com/playlist/3", true),
+		Entry("Artist", "https://open.spotify.com/artist/4", false),
+		Entry("Other site", "https://example.com/track/1", false),
+	)
+
+	It("Reads a track", func() {
+		trackList, err := client.GetTracks(context.Background(), "https://open.spotify.com/track/1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(trackList.IsCollection).To(BeFalse())
+		Expect(trackList.Tracks).To(HaveLen(1))
+
+		track := trackList.Tracks[0]
+		Expect(track.Title).To(Equal("Track 1"))
+		Expect(track.Artists).To(Equal([]string{"Artist", "Featured"}))
+		Expect(track.Album).To(Equal("Album"))
+		Expect(track.Duration).To(Equal(200500 * time.Millisecond))
+		Expect(track.ISRC).To(Equal("ISRC1"))
+		Expect(track.Link).To(Equal("https://open.spotify.com/track/1"))
+		Expect(track.ThumbnailURL).To(Equal("large.jpg"))
+	})
+
+	It("Reads the ISRC of album tracks", func() {
+		trackList, err := client.GetTracks(context.Background(), "https://open.spotify.com/album/2")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(trackList.IsCollection).To(BeTrue())
+		Expect(trackList.Title).To(Equal("Album"))
+		Expect(trackList.Tracks).To(HaveLen(2))
+		Expect(trackList.Tracks[1].ISRC).To(Equal("ISRC2"))
+	})
+
+	It("Reads all pages of a playlist, skipping unavailable tracks & episodes", func() {
+		trackList, err := client.GetTracks(context.Background(), "https://open.spotify.com/playlist/3")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(trackList.Title).To(Equal("Playlist"))
+		Expect(trackList.Link).To(Equal("https://open.spotify.com/playlist/3"))
+		Expect(trackList.Tracks).To(HaveLen(2))
+		Expect(trackList.Tracks[0].Title).To(Equal("Track 1"))
+		Expect(trackList.Tracks[1].Title).To(Equal("Track 2"))
+
+		// The access token is reused
+		Expect(tokenRequests).To(Equal(1))
+	})
+
+	It("Returns an error for missing tracks", func() {
+		_, err := client.GetTracks(context.Background(), "https://open.spotify.com/track/404")
+		Expect(err).To(MatchError(bridge.ErrorNotFound))
+
+		_, err = client.GetTracks(context.Background(), "https://open.spotify.com/artist/4")
+		Expect(err).To(MatchError(bridge.ErrorUnsupportedLink))
+
+		// Escaped characters stay in the id instead of changing the request
+		_, err = client.GetTracks(context.Background(), "https://open.spotify.com/track/1%3Fids=2")
+		Expect(err).To(MatchError(bridge.ErrorNotFound))
+	})
+
+	It("Returns an error if authentication fails", func() {
+		client = bridge.NewSpotifyClient(&bridge.SpotifyOptions{
+			APIURL:      server.URL,
+			AccountsURL: server.URL + "/unauthorized",
+		})
+
+		_, err := client.GetTracks(context.Background(), "https://open.spotify.com/track/1")
+		Expect(err).To(MatchError(bridge.ErrorUnexpectedStatus))
+	})
+})
@@ -1,51 +1,178 @@
 package cmd
 
 import (
+	"bufio"
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os/exec"
-	"strings"
 	"time"
 )
 
+var (
+	ErrorCommandTimeout = errors.New("operation timed out")
+)
+
+const (
+	// Time to wait for output pipes to close after the process has exited or been killed
+	commandWaitDelay = 5 * time.Second
+	// Longest stdout line read in streaming mode. yt-dlp prints a JSON document per
+	// line, which can be several megabytes for videos with many formats
+	maxStdoutLineSize = 64 * 1024 * 1024
+)
+
+// Returned when a command exits with a non-zero exit code or fails to start
+type CommandError struct {
+	// -1 if the command did not exit normally
+	ExitCode int
+	Stderr   string
+	Err      error
+}
+
+func (ce *CommandError) Error() string {
+	return ce.Err.Error()
+}
+
+func (ce *CommandError) Unwrap() error {
+	return ce.Err
+}
+
+type CommandResult struct {
+	Stdout   string
+	Stderr   string
+	ExitCode int
+}
+
 type CommandExecutor interface {
-	RunCommandWithTimeout(executable string, timeout time.Duration, args ...string) (chan *string, chan error)
+	// Runs the executable until it exits or ctx is done. The process and any processes
+	// it has spawned are killed when ctx is done, in which case the returned error wraps ctx.Err().
+	// Context deadlines are additionally reported as ErrorCommandTimeout
+	RunCommand(ctx context.Context, executable string, args ...string) (*CommandResult, error)
+	// Like RunCommand, but calls onStdoutLine for each line of stdout as it is printed instead of
+	// buffering it. The command is killed if onStdoutLine returns an error, which is then returned.
+	// Stdout of the returned result is always empty
+	RunCommandStreaming(
+		ctx context.Context,
+		onStdoutLine func(line string) error,
+		executable string,
+		args ...string,
+	) (*CommandResult, error)
 }
 
 type DefaultCommandExecutor struct{}
 
-func (command *DefaultCommandExecutor) RunCommandWithTimeout(
+func (command *DefaultCommandExecutor) RunCommand(
+	ctx context.Context,
+	executable string,
+	args ...string,
+) (*CommandResult, error) {
+	var stdout, stderr bytes.Buffer
+
+	cmd := newCommand(ctx, executable, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+
+	return commandResult(ctx, cmd, err, stdout.String(), stderr.String())
+}
+
+func (command *DefaultCommandExecutor) RunCommandStreaming(
+	ctx context.Context,
+	onStdoutLine func(line string) error,
 	executable string,
-	timeout time.Duration,
 	args ...string,
-) (chan *string, chan error) {
-	cmd := exec.Command(executable, args...)
+) (*CommandResult, error) {
+	var stderr bytes.Buffer
+
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	cmd := newCommand(runCtx, executable, args...)
+	cmd.Stderr = &stderr
 
-	resultChannel := make(chan *string, 1)
-	errorChannel := make(chan error, 1)
+	stdoutPipe, err := cmd.StdoutPipe()
 
-	go func() {
-		time.Sleep(timeout)
+	if err != nil {
+		return nil, err
+	}
 
-		errorChannel <- errors.New(fmt.Sprintf("operation timed out after %d seconds", int(timeout.Seconds())))
+	if err := cmd.Start(); err != nil {
+		return commandResult(ctx, cmd, err, "", "")
+	}
 
-		if cmd.Process != nil {
-			cmd.Process.Kill()
+	var lineErr error
+	scanner := bufio.NewScanner(stdoutPipe)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxStdoutLineSize)
+
+	for scanner.Scan() {
+		if lineErr = onStdoutLine(scanner.Text()); lineErr != nil {
+			cancel()
+			break
 		}
-	}()
+	}
+
+	if lineErr == nil {
+		lineErr = scanner.Err()
+	}
+
+	if lineErr != nil {
+		// Kill the command if the scanner failed, and drain stdout so that it doesn't block on a full pipe
+		cancel()
+		_, _ = io.Copy(io.Discard, stdoutPipe)
+	}
+
+	err = cmd.Wait()
+
+	result, err := commandResult(ctx, cmd, err, "", stderr.String())
+
+	if lineErr != nil && ctx.Err() == nil {
+		return result, lineErr
+	}
 
-	go func() {
-		stdout, err := cmd.Output()
+	return result, err
+}
+
+func newCommand(ctx context.Context, executable string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, executable, args...)
+	cmd.WaitDelay = commandWaitDelay
+
+	setProcessGroup(cmd)
+	cmd.Cancel = func() error {
+		return killProcessGroup(cmd)
+	}
+
+	return cmd
+}
 
-		if err != nil && !strings.Contains(err.Error(), "exit status 101") {
-			errorChannel <- err
-		} else {
-			stdoutString := string(stdout)
-			resultChannel <- &stdoutString
+func commandResult(ctx context.Context, cmd *exec.Cmd, err error, stdout string, stderr string) (*CommandResult, error) {
+	result := &CommandResult{
+		Stdout:   stdout,
+		Stderr:   stderr,
+		ExitCode: cmd.ProcessState.ExitCode(),
+	}
+
+	if ctxErr := ctx.Err(); ctxErr != nil && err != nil {
+		if errors.Is(ctxErr, context.DeadlineExceeded) {
+			return result, fmt.Errorf("%w: %w", ErrorCommandTimeout, ctxErr)
 		}
 
-		close(resultChannel)
-	}()
+		return result, ctxErr
+	}
+
+	var exitErr *exec.ExitError
+	isExitError := errors.As(err, &exitErr)
+
+	// yt-dlp exits with 101 when --max-downloads is reached
+	if err != nil && !(isExitError && exitErr.ExitCode() == 101) {
+		return result, &CommandError{
+			ExitCode: result.ExitCode,
+			Stderr:   result.Stderr,
+			Err:      err,
+		}
+	}
 
-	return resultChannel, errorChannel
+	return result, nil
 }
@@ -1,6 +1,10 @@
 package cmd_test
 
 import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
 	"runtime"
 	"strings"
 	"time"
@@ -22,18 +26,13 @@ var _ = Describe("Command Executor", func() {
 			args = []string{"/C", "echo foo"}
 		}
 
-		resChan, errChan := executor.RunCommandWithTimeout(cmd, 2*time.Second, args...)
-
-		select {
-		case res := <-resChan:
-			Expect(res).NotTo(BeNil())
-			Expect(strings.TrimSpace(*res)).To(Equal("foo"))
-		case err := <-errChan:
-			Expect(err).To(BeNil())
-		}
+		result, err := executor.RunCommand(context.Background(), cmd, args...)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(strings.TrimSpace(result.Stdout)).To(Equal("foo"))
+		Expect(result.ExitCode).To(Equal(0))
 	})
 
-	It("Timeouts execution after timeout duration", func() {
+	It("Timeouts execution after context deadline", func() {
 		executor := &cmd.DefaultCommandExecutor{}
 
 		cmd := "sleep"
@@ -44,14 +43,96 @@ var _ = Describe("Command Executor", func() {
 			args = []string{"/C", "ping 127.0.0.1 -t"}
 		}
 
-		resChan, errChan := executor.RunCommandWithTimeout(cmd, 2*time.Second, args...)
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+
+		startedAt := time.Now()
+		_, err := executor.RunCommand(ctx, cmd, args...)
+		Expect(err).To(MatchError(ContainSubstring("operation timed out")))
+		Expect(errors.Is(err, context.DeadlineExceeded)).To(BeTrue())
+		Expect(time.Since(startedAt)).To(BeNumerically("<", 10*time.Second))
+	})
+
+	It("Kills spawned processes when the context is cancelled", func() {
+		if runtime.GOOS == "windows" {
+			Skip("requires sh")
+		}
+
+		executor := &cmd.DefaultCommandExecutor{}
+		markerFile := filepath.Join(GinkgoT().TempDir(), "marker")
+
+		ctx, cancel := context.WithCancel(context.Background())
+
+		go func() {
+			time.Sleep(500 * time.Millisecond)
+			cancel()
+		}()
+
+		// The child process would create the marker file if it outlived its parent
+		_, err := executor.RunCommand(ctx, "sh", "-c", "(sleep 2; touch "+markerFile+") & wait")
+		Expect(err).To(MatchError(context.Canceled))
+		Expect(errors.Is(err, cmd.ErrorCommandTimeout)).To(BeFalse())
+
+		Consistently(func() bool {
+			_, statErr := os.Stat(markerFile)
+			return os.IsNotExist(statErr)
+		}, 3*time.Second, 250*time.Millisecond).Should(BeTrue())
+	})
+
+	It("Returns exit code and stderr of a failed executable", func() {
+		if runtime.GOOS == "windows" {
+			Skip("requires sh")
+		}
+
+		executor := &cmd.DefaultCommandExecutor{}
+
+		result, err := executor.RunCommand(context.Background(), "sh", "-c", "echo foo; echo bar >&2; exit 3")
+		Expect(err).To(MatchError("exit status 3"))
+		Expect(strings.TrimSpace(result.Stdout)).To(Equal("foo"))
+		Expect(result.ExitCode).To(Equal(3))
+
+		var commandErr *cmd.CommandError
+		Expect(errors.As(err, &commandErr)).To(BeTrue())
+		Expect(commandErr.ExitCode).To(Equal(3))
+		Expect(strings.TrimSpace(commandErr.Stderr)).To(Equal("bar"))
+	})
+
+	It("Streams stdout lines as they are printed", func() {
+		if runtime.GOOS == "windows" {
+			Skip("requires sh")
+		}
+
+		executor := &cmd.DefaultCommandExecutor{}
 
-		select {
-		case <-resChan:
-			// Should not be reached
-			Expect(false).To(BeTrue())
-		case err := <-errChan:
-			Expect(err.Error()).To(ContainSubstring("operation timed out after"))
+		lines := make([]string, 0)
+		lineTimes := make([]time.Time, 0)
+
+		result, err := executor.RunCommandStreaming(context.Background(), func(line string) error {
+			lines = append(lines, line)
+			lineTimes = append(lineTimes, time.Now())
+			return nil
+		}, "sh", "-c", "echo foo; sleep 1; echo bar")
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Stdout).To(Equal(""))
+		Expect(lines).To(Equal([]string{"foo", "bar"}))
+		Expect(lineTimes[1].Sub(lineTimes[0])).To(BeNumerically(">", 500*time.Millisecond))
+	})
+
+	It("Kills a streaming command when the line callback returns an error", func() {
+		if runtime.GOOS == "windows" {
+			Skip("requires sh")
 		}
+
+		executor := &cmd.DefaultCommandExecutor{}
+		errStop := errors.New("stop")
+
+		startedAt := time.Now()
+		_, err := executor.RunCommandStreaming(context.Background(), func(line string) error {
+			return errStop
+		}, "sh", "-c", "echo foo; sleep 20; echo bar")
+
+		Expect(err).To(MatchError(errStop))
+		Expect(time.Since(startedAt)).To(BeNumerically("<", 10*time.Second))
 	})
 })
@@ -0,0 +1,21 @@
+//go:build windows
+
+package cmd
+
+import (
+	"os/exec"
+	"strconv"
+)
+
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// Kills the process tree with taskkill, falling back to killing the process itself
+func killProcessGroup(cmd *exec.Cmd) error {
+	pid := strconv.Itoa(cmd.Process.Pid)
+
+	if err := exec.Command("taskkill", "/T", "/F", "/PID", pid).Run(); err != nil {
+		return cmd.Process.Kill()
+	}
+
+	return nil
+}
@@ -0,0 +1,215 @@
+package discordplayer
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/fakelag/streaming-music-bot/entities"
+)
+
+const (
+	// How often the playback position is compared to chapter boundaries
+	chapterCheckInterval = 500 * time.Millisecond
+	// PreviousChapter restarts the current chapter if it has played longer than this
+	previousChapterRestartThreshold = 3 * time.Second
+)
+
+// Returns the chapter being played & its index. The chapter is nil if playback
+// is before the first chapter. Returns ErrorNoChapters if the media has no chapters
+func (dms *DiscordMusicSession) CurrentChapter() (*entities.Chapter, int, error) {
+	chapters, err := dms.currentMediaChapters()
+
+	if err != nil {
+		return nil, -1, err
+	}
+
+	index := chapterIndexAt(chapters, dms.CurrentPlaybackPosition())
+
+	if index == -1 {
+		return nil, -1, nil
+	}
+
+	return &chapters[index], index, nil
+}
+
+// Jumps to the start of the chapter after the current one
+func (dms *DiscordMusicSession) NextChapter() error {
+	chapters, err := dms.currentMediaChapters()
+
+	if err != nil {
+		return err
+	}
+
+	index := chapterIndexAt(chapters, dms.CurrentPlaybackPosition()) + 1
+
+	if index >= len(chapters) {
+		return ErrorChapterNotFound
+	}
+
+	return dms.Jump(chapters[index].Start)
+}
+
+// Jumps to the start of the previous chapter. Like in most players, the current
+// chapter is restarted instead if it has been playing for more than a few seconds
+func (dms *DiscordMusicSession) PreviousChapter() error {
+	chapters, err := dms.currentMediaChapters()
+
+	if err != nil {
+		return err
+	}
+
+	position := dms.CurrentPlaybackPosition()
+	index := chapterIndexAt(chapters, position)
+
+	if index == -1 {
+		return ErrorChapterNotFound
+	}
+
+	if position-chapters[index].Start <= previousChapterRestartThreshold && index > 0 {
+		index -= 1
+	}
+
+	return dms.Jump(chapters[index].Start)
+}
+
+// Jumps to the start of a chapter by its index, starting from 0
+func (dms *DiscordMusicSession) JumpToChapter(index int) error {
+	chapters, err := dms.currentMediaChapters()
+
+	if err != nil {
+		return err
+	}
+
+	if index < 0 || index >= len(chapters) {
+		return ErrorChapterNotFound
+	}
+
+	return dms.Jump(chapters[index].Start)
+}
+
+// Jumps to the start of a chapter by its title. Titles are matched case-insensitively,
+// preferring an exact match over the first title containing name
+func (dms *DiscordMusicSession) JumpToChapterByName(name string) error {
+	chapters, err := dms.currentMediaChapters()
+
+	if err != nil {
+		return err
+	}
+
+	index := findChapterByName(chapters, name)
+
+	if index == -1 {
+		return ErrorChapterNotFound
+	}
+
+	return dms.Jump(chapters[index].Start)
+}
+
+func (dms *DiscordMusicSession) currentMediaChapters() ([]entities.Chapter, error) {
+	currentMedia := dms.GetCurrentlyPlayingMedia()
+
+	if currentMedia == nil {
+		return nil, ErrorNoMediaFound
+	}
+
+	chapters := mediaChapters(currentMedia)
+
+	if len(chapters) == 0 {
+		return nil, ErrorNoChapters
+	}
+
+	return chapters, nil
+}
+
+// Dispatches EventChapterChanged whenever the playback position moves to another chapter
+func (dms *DiscordMusicSession) watchChapterChanges(
+	ctx context.Context,
+	mediaFile entities.Media,
+	chapters []entities.Chapter,
+	session *DcaMediaSession,
+) {
+	for {
+		index := chapterIndexAt(chapters, session.playbackPosition())
+
+		dms.mutex.Lock()
+
+		if ctx.Err() != nil {
+			dms.mutex.Unlock()
+			return
+		}
+
+		if index != dms.currentChapterIndex {
+			dms.currentChapterIndex = index
+
+			if index != -1 {
+				dms.dispatchEvent(&SessionEvent{
+					Type:         EventChapterChanged,
+					Media:        mediaFile,
+					Chapter:      &chapters[index],
+					ChapterIndex: index,
+				})
+			}
+		}
+
+		dms.mutex.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(chapterCheckInterval):
+			break
+		}
+	}
+}
+
+func (dms *DiscordMusicSession) resetCurrentChapter() {
+	dms.mutex.Lock()
+	defer dms.mutex.Unlock()
+	dms.currentChapterIndex = -1
+}
+
+func mediaChapters(media entities.Media) []entities.Chapter {
+	if metadata, ok := media.(entities.MediaMetadata); ok {
+		return metadata.Chapters()
+	}
+
+	return nil
+}
+
+// Returns the index of the last chapter starting at or before position, or -1 if there is none
+func chapterIndexAt(chapters []entities.Chapter, position time.Duration) int {
+	index := -1
+
+	for chapterIndex, chapter := range chapters {
+		if chapter.Start > position {
+			break
+		}
+
+		index = chapterIndex
+	}
+
+	return index
+}
+
+func findChapterByName(chapters []entities.Chapter, name string) int {
+	name = strings.ToLower(strings.TrimSpace(name))
+
+	if name == "" {
+		return -1
+	}
+
+	for index, chapter := range chapters {
+		if strings.ToLower(chapter.Title) == name {
+			return index
+		}
+	}
+
+	for index, chapter := range chapters {
+		if strings.Contains(strings.ToLower(chapter.Title), name) {
+			return index
+		}
+	}
+
+	return -1
+}
@@ -3,10 +3,14 @@ package discordplayer
 import (
 	"context"
 	"errors"
+	"log/slog"
+	"slices"
 	"sync"
 	"time"
 
 	"github.com/fakelag/streaming-music-bot/entities"
+	"github.com/fakelag/streaming-music-bot/metrics"
+	"github.com/fakelag/streaming-music-bot/utils"
 
 	. "github.com/fakelag/streaming-music-bot/discordplayer/interfaces"
 
@@ -25,6 +29,11 @@ var (
 	ErrorInvalidArgument         = errors.New("invalid argument")
 	ErrorNoVoiceChannelSet       = errors.New("no voice channel set")
 	ErrorWaitingForWorkerTimeout = errors.New("timed out waiting for worker")
+	ErrorNoChapters              = errors.New("media has no chapters")
+	ErrorChapterNotFound         = errors.New("chapter not found")
+	ErrorPlaylistNotFound        = errors.New("playlist not found")
+	// Returned from EnqueuePlaylist with the number of media enqueued when media is left in the playlist
+	ErrorPlaylistPartiallyEnqueued = errors.New("playlist partially enqueued")
 )
 
 type NextMediaCallback = func(session *DiscordMusicSession, mediaFile entities.Media, isReload bool)
@@ -40,6 +49,10 @@ type DiscordMusicSession struct {
 	leaveAfterChannelEmptyTime time.Duration
 	leaveAfterCheckInterval    time.Duration
 	parentCtx                  context.Context
+	metrics                    metrics.Metrics
+	logger                     *slog.Logger
+	opusPassthrough            bool
+	segmentProvider            entities.SegmentProvider
 
 	// Worker fields, unlocked access in worker goroutine
 	dca             DiscordAudio
@@ -52,10 +65,25 @@ type DiscordMusicSession struct {
 	lastCompletedMedia    entities.Media
 	mediaQueue            []entities.Media
 	mediaQueueMaxSize     int
-	currentPlaylist       entities.Playlist
+	// Max size of the media queue when enqueueing playlists with EnqueuePlaylist
+	playlistQueueMaxSize int
+	// Playlists in the order they are played. Media is consumed from the first playlist
+	// until it is empty, or from each playlist in turn with PlaylistModeInterleaved
+	playlists []*queuedPlaylist
+	// Index of the playlist consumed next with PlaylistModeInterleaved
+	nextPlaylistIndex int
+	playlistMode      PlaylistMode
+	// Index of the chapter of the currently playing media, -1 if none
+	currentChapterIndex   int
+	skipSegmentCategories []string
+	// Segments of the currently playing media, kept over reloads
+	segmentsMedia entities.Media
+	segments      []entities.Segment
 
 	nextMediaCallbacks []NextMediaCallback
 	errorCallbacks     []ErrorCallback
+	eventCallbacks     []EventCallback
+	events             eventQueue
 
 	workerActive      bool
 	chanLeaveCommand  chan bool
@@ -70,12 +98,32 @@ type DiscordMusicSessionOptions struct {
 	// Max number of media that is able to be queued up. Default 100
 	// Does not apply to playlists
 	MediaQueueMaxSize int
+	// Max number of media in the queue when flattening playlists into it with
+	// EnqueuePlaylist. Default 1000
+	PlaylistQueueMaxSize int
 	// Amount of time before automatically exiting if the current voice channel
 	// is empty. Members are checked every 10 seconds. Pass 0 to stay forever. Defaults to 0
 	LeaveAfterChannelEmptyTime time.Duration
 	// Amount of time before automatically exiting when the bot has not been playing.
 	// Checked every 10s. Pass 0 to stay forever. Defaults to 0
 	LeaveAfterEmptyQueueTime time.Duration
+	// Receives playback, voice & queue measurements. Defaults to no metrics
+	Metrics metrics.Metrics
+	// Logger for worker lifecycle, voice & playback errors. Records are logged with
+	// a guild_id attribute. Defaults to no logging
+	Logger *slog.Logger
+	// Always re-encode media. By default media that is already Opus in a WebM or Ogg container
+	// (entities.AudioFormatMedia) is sent as is when played from the start
+	DisableOpusPassthrough bool
+	// Provides segments of media, such as sponsor messages, that are skipped automatically
+	// if their category is in SkipSegmentCategories. Defaults to none
+	SegmentProvider entities.SegmentProvider
+	// Categories of segments to skip, for example "sponsor" & "music_offtopic" with
+	// sponsorblock.SponsorBlock. Defaults to none, can be changed with SetSkipSegmentCategories
+	SkipSegmentCategories []string
+	// How media is consumed when multiple playlists are added. Defaults to
+	// PlaylistModeSequential, can be changed with SetPlaylistMode
+	PlaylistMode PlaylistMode
 }
 
 func NewDiscordMusicSession(
@@ -105,6 +153,30 @@ func NewDiscordMusicSessionEx(
 		queueMaxSize = 100
 	}
 
+	playlistQueueMaxSize := options.PlaylistQueueMaxSize
+
+	if playlistQueueMaxSize == 0 {
+		playlistQueueMaxSize = 1000
+	}
+
+	sessionMetrics := options.Metrics
+
+	if sessionMetrics == nil {
+		sessionMetrics = &metrics.NoopMetrics{}
+	}
+
+	logger := options.Logger
+
+	if logger == nil {
+		logger = utils.NewDiscardLogger()
+	}
+
+	playlistMode := options.PlaylistMode
+
+	if playlistMode == "" {
+		playlistMode = PlaylistModeSequential
+	}
+
 	dms := &DiscordMusicSession{
 		guildID:                    options.GuildID,
 		voiceChannelID:             options.VoiceChannelID,
@@ -116,10 +188,20 @@ func NewDiscordMusicSessionEx(
 		dca:                        dca,
 		workerCtx:                  nil,
 		parentCtx:                  ctx,
+		metrics:                    sessionMetrics,
+		logger:                     logger.With(slog.String("guild_id", options.GuildID)),
+		opusPassthrough:            !options.DisableOpusPassthrough,
+		segmentProvider:            options.SegmentProvider,
+		skipSegmentCategories:      slices.Clone(options.SkipSegmentCategories),
 		mediaQueue:                 make([]entities.Media, 0),
-		mediaQueueMaxSize:          options.MediaQueueMaxSize,
+		playlists:                  make([]*queuedPlaylist, 0),
+		playlistMode:               playlistMode,
+		mediaQueueMaxSize:          queueMaxSize,
+		playlistQueueMaxSize:       playlistQueueMaxSize,
 		nextMediaCallbacks:         make([]NextMediaCallback, 0),
 		errorCallbacks:             make([]ErrorCallback, 0),
+		eventCallbacks:             make([]EventCallback, 0),
+		currentChapterIndex:        -1,
 	}
 
 	return dms, nil
@@ -133,18 +215,29 @@ func (dms *DiscordMusicSession) EnqueueMedia(media entities.Media) error {
 		return ErrorInvalidMedia
 	}
 
-	if len(dms.mediaQueue) == dms.mediaQueueMaxSize {
+	// Playlists enqueued with EnqueuePlaylist may grow the queue past its max size
+	if len(dms.mediaQueue) >= dms.mediaQueueMaxSize {
 		return ErrorMediaQueueFull
 	}
 
 	dms.mediaQueue = append(dms.mediaQueue, media)
+	dms.onMediaQueueChanged()
 	return nil
 }
 
+// Replaces all playlists with the given playlist. Use AddPlaylist to play it after the current playlists
 func (dms *DiscordMusicSession) SetPlaylist(playlist entities.Playlist) {
 	dms.mutex.Lock()
 	defer dms.mutex.Unlock()
-	dms.currentPlaylist = playlist
+
+	dms.playlists = make([]*queuedPlaylist, 0)
+	dms.nextPlaylistIndex = 0
+
+	if playlist != nil {
+		dms.playlists = append(dms.playlists, &queuedPlaylist{playlist: playlist})
+	}
+
+	dms.onPlaylistsChanged()
 }
 
 // Starts voice worker, returns an error if the worker is already active
@@ -204,16 +297,30 @@ func (dms *DiscordMusicSession) SetVoiceChannelID(voiceChannelID string) (worker
 	return isWorkerActive, nil
 }
 
+// Removes all playlists
 func (dms *DiscordMusicSession) ClearPlaylist() {
 	dms.mutex.Lock()
 	defer dms.mutex.Unlock()
-	dms.currentPlaylist = nil
+
+	if len(dms.playlists) == 0 {
+		return
+	}
+
+	dms.playlists = make([]*queuedPlaylist, 0)
+	dms.nextPlaylistIndex = 0
+	dms.onPlaylistsChanged()
 }
 
+// First of the playlists, which media is consumed from with PlaylistModeSequential. Nil if there are no playlists
 func (dms *DiscordMusicSession) GetCurrentPlaylist() entities.Playlist {
 	dms.mutex.RLock()
 	defer dms.mutex.RUnlock()
-	return dms.currentPlaylist
+
+	if len(dms.playlists) == 0 {
+		return nil
+	}
+
+	return dms.playlists[0].playlist
 }
 
 func (dms *DiscordMusicSession) ClearMediaQueue() bool {
@@ -225,6 +332,7 @@ func (dms *DiscordMusicSession) ClearMediaQueue() bool {
 	}
 
 	dms.mediaQueue = make([]entities.Media, 0)
+	dms.onMediaQueueChanged()
 	return true
 }
 
@@ -268,6 +376,13 @@ func (dms *DiscordMusicSession) SetPaused(paused bool) error {
 	}
 
 	dms.currentMediaSession.streamingSession.SetPaused(paused)
+
+	if paused {
+		dms.dispatchEvent(&SessionEvent{Type: EventPaused, Media: dms.currentlyPlayingMedia})
+	} else {
+		dms.dispatchEvent(&SessionEvent{Type: EventResumed, Media: dms.currentlyPlayingMedia})
+	}
+
 	return nil
 }
 
@@ -345,6 +460,7 @@ func (dms *DiscordMusicSession) GetCurrentlyPlayingMedia() entities.Media {
 	return dms.currentlyPlayingMedia
 }
 
+// Position of playback in the current media, also after jumping within it
 func (dms *DiscordMusicSession) CurrentPlaybackPosition() time.Duration {
 	dms.mutex.RLock()
 	defer dms.mutex.RUnlock()
@@ -353,7 +469,7 @@ func (dms *DiscordMusicSession) CurrentPlaybackPosition() time.Duration {
 		return time.Duration(0)
 	}
 
-	return dms.currentMediaSession.streamingSession.PlaybackPosition()
+	return dms.currentMediaSession.playbackPosition()
 }
 
 func (dms *DiscordMusicSession) AddNextMediaCallback(cb NextMediaCallback) {
@@ -386,6 +502,12 @@ func (dms *DiscordMusicSession) IsWorkerActive() bool {
 	return dms.workerActive
 }
 
+// onMediaQueueChanged requires dms.mutex to be write-locked by the caller
+func (dms *DiscordMusicSession) onMediaQueueChanged() {
+	dms.metrics.QueueLength(dms.guildID, len(dms.mediaQueue))
+	dms.dispatchEvent(&SessionEvent{Type: EventQueueChanged})
+}
+
 func (dms *DiscordMusicSession) sendCommand(command chan bool) error {
 	dms.mutex.Lock()
 	defer dms.mutex.Unlock()
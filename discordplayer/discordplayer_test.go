@@ -3,7 +3,9 @@ package discordplayer_test
 import (
 	"context"
 	"errors"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/fakelag/dca"
@@ -15,6 +17,8 @@ import (
 	discordinterface "github.com/fakelag/streaming-music-bot/discordplayer/interfaces"
 	. "github.com/fakelag/streaming-music-bot/discordplayer/mocks"
 	"github.com/fakelag/streaming-music-bot/entities"
+	"github.com/fakelag/streaming-music-bot/opusdemux"
+	"github.com/fakelag/streaming-music-bot/youtubeapi"
 )
 
 var (
@@ -67,7 +71,7 @@ func (mm *MockMedia) Duration() *time.Duration {
 	return &oneMinute
 }
 
-func (mm *MockMedia) EnsureLoaded() error {
+func (mm *MockMedia) EnsureLoaded(ctx context.Context) error {
 	return nil
 }
 
@@ -83,6 +87,64 @@ func (mm *MockMedia) IsLiveStream() bool {
 	return false
 }
 
+type MockOpusMedia struct {
+	*MockMedia
+	MockCodec     string
+	MockContainer string
+}
+
+func (mom *MockOpusMedia) FileAudioFormat() (string, string) {
+	return mom.MockCodec, mom.MockContainer
+}
+
+type MockFailingMedia struct {
+	*MockMedia
+}
+
+func (mfm *MockFailingMedia) EnsureLoaded(ctx context.Context) error {
+	return errors.New("mock load error")
+}
+
+// Loads until the load is cancelled. loading is closed once loading has started
+type MockSlowMedia struct {
+	*MockMedia
+	loading chan struct{}
+}
+
+func (msm *MockSlowMedia) EnsureLoaded(ctx context.Context) error {
+	close(msm.loading)
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+type MockChapterMedia struct {
+	*MockMedia
+	MockChapters []entities.Chapter
+}
+
+func (mcm *MockChapterMedia) Artist() string {
+	return ""
+}
+
+func (mcm *MockChapterMedia) Album() string {
+	return ""
+}
+
+func (mcm *MockChapterMedia) Chapters() []entities.Chapter {
+	return mcm.MockChapters
+}
+
+type MockSegmentProvider struct {
+	MockSegments []entities.Segment
+	MockError    error
+	calls        atomic.Int32
+}
+
+func (msp *MockSegmentProvider) Segments(ctx context.Context, media entities.Media) ([]entities.Segment, error) {
+	msp.calls.Add(1)
+	return msp.MockSegments, msp.MockError
+}
+
 func (mp *MockPlaylist) Title() string {
 	return "Mock Playlist"
 }
@@ -144,6 +206,21 @@ func (mp *MockPlaylist) GetDurationLeft() *time.Duration {
 	return nil
 }
 
+// Playlist with more media being loaded once the loaded media is consumed
+type LoadingPlaylist struct {
+	*youtubeapi.YoutubePlaylist
+}
+
+func (lp *LoadingPlaylist) ConsumeNextMedia() (entities.Media, error) {
+	media, err := lp.YoutubePlaylist.ConsumeNextMedia()
+
+	if errors.Is(err, entities.ErrorPlaylistEmpty) {
+		return nil, entities.ErrorPlaylistLoading
+	}
+
+	return media, err
+}
+
 type JoinVoiceAndPlayContext struct {
 	mockVoiceConnection *MockDiscordVoiceConnection
 	mockDiscordSession  *MockDiscordSession
@@ -230,6 +307,86 @@ func JoinMockVoiceChannelAndPlay(
 	return JoinMockVoiceChannelAndPlayEx(context.TODO(), ctrl, currentMediaDone, true, mockDcaStreamingSession)
 }
 
+type PositionPlayerContext struct {
+	dms      *discordplayer.DiscordMusicSession
+	ctx      context.Context
+	position *atomic.Int64
+	jumps    chan time.Duration
+	events   chan *discordplayer.SessionEvent
+}
+
+// Plays media with a playback position set by the test. Like with dca, the position is relative
+// to the start of the encode session & restarts from 0 after a jump. Jumps are sent to the jumps
+// channel & events of eventType to the events channel
+func StartMockMediaWithPosition(
+	ctrl *gomock.Controller,
+	mockMedia entities.Media,
+	options *discordplayer.DiscordMusicSessionOptions,
+	eventType discordplayer.SessionEventType,
+) *PositionPlayerContext {
+	mockDca := NewMockDiscordAudio(ctrl)
+	mockDiscordSession := NewMockDiscordSession(ctrl)
+	mockVoiceConnection := NewMockDiscordVoiceConnection(ctrl)
+	mockDcaStreamingSession := NewMockDcaStreamingSession(ctrl)
+
+	playerContext := &PositionPlayerContext{
+		position: &atomic.Int64{},
+		jumps:    make(chan time.Duration, 10),
+		events:   make(chan *discordplayer.SessionEvent, 32),
+	}
+
+	mockDiscordSession.EXPECT().ChannelVoiceJoin(gID, cID, false, false).Return(mockVoiceConnection, nil).AnyTimes()
+	mockVoiceConnection.EXPECT().Speaking(gomock.Any()).AnyTimes()
+	mockVoiceConnection.EXPECT().IsReady().Return(true).AnyTimes()
+	mockVoiceConnection.EXPECT().Disconnect().AnyTimes()
+	mockDca.EXPECT().NewStream(nil, mockVoiceConnection, gomock.Any()).Return(mockDcaStreamingSession).AnyTimes()
+	mockDca.EXPECT().EncodeFile(gomock.Any(), gomock.Any()).Return(nil, nil).AnyTimes().
+		Do(func(path string, encodeOptions *dca.EncodeOptions) {
+			playerContext.position.Store(0)
+			playerContext.jumps <- time.Duration(encodeOptions.StartTime) * time.Second
+		})
+	mockDcaStreamingSession.EXPECT().PlaybackPosition().AnyTimes().DoAndReturn(func() time.Duration {
+		return time.Duration(playerContext.position.Load())
+	})
+
+	options.GuildID = gID
+	options.VoiceChannelID = cID
+	options.MediaQueueMaxSize = 10
+
+	dms, err := discordplayer.NewDiscordMusicSessionEx(context.TODO(), mockDca, mockDiscordSession, 100*time.Millisecond, options)
+	Expect(err).NotTo(HaveOccurred())
+
+	dms.AddEventCallback(func(_ *discordplayer.DiscordMusicSession, event *discordplayer.SessionEvent) {
+		if event.Type == eventType {
+			playerContext.events <- event
+		}
+	})
+
+	Expect(dms.EnqueueMedia(mockMedia)).To(Succeed())
+
+	playerContext.ctx, err = dms.Start()
+	Expect(err).NotTo(HaveOccurred())
+	playerContext.dms = dms
+
+	Eventually(playerContext.jumps).WithTimeout(failTimeout).Should(Receive(Equal(time.Duration(0))))
+	Eventually(dms.GetCurrentlyPlayingMedia).WithTimeout(failTimeout).ShouldNot(BeNil())
+	return playerContext
+}
+
+// Skips the playing media & waits for the media titled title to start
+func skipToMedia(dms *discordplayer.DiscordMusicSession, title string) {
+	Expect(dms.Skip()).To(Succeed())
+	Eventually(func() string {
+		media := dms.GetCurrentlyPlayingMedia()
+
+		if media == nil {
+			return ""
+		}
+
+		return media.Title()
+	}).WithTimeout(failTimeout).WithPolling(50 * time.Millisecond).Should(Equal(title))
+}
+
 var _ = Describe("Discord Player", func() {
 	It("Creates a music session and starts playing media after enqueueing it", func() {
 		ctrl := gomock.NewController(GinkgoT())
@@ -270,6 +427,11 @@ var _ = Describe("Discord Player", func() {
 			// Leave() will call Speaking(false) if leaving during playing
 			playerContext.mockVoiceConnection.EXPECT().Speaking(false).MaxTimes(1)
 
+			// Leaving during the load would cancel it before playback
+			Eventually(func() entities.Media {
+				return playerContext.dms.GetCurrentlyPlayingMedia()
+			}).WithTimeout(failTimeout).WithPolling(50 * time.Millisecond).ShouldNot(BeNil())
+
 			c := make(chan struct{})
 
 			var wg sync.WaitGroup
@@ -313,6 +475,10 @@ var _ = Describe("Discord Player", func() {
 			_, err := playerContext.dms.Start()
 			Expect(err).NotTo(HaveOccurred())
 
+			Eventually(func() entities.Media {
+				return playerContext.dms.GetCurrentlyPlayingMedia()
+			}).WithTimeout(failTimeout).WithPolling(50 * time.Millisecond).ShouldNot(BeNil())
+
 			go func() {
 				Expect(playerContext.dms.Leave()).To(Succeed())
 
@@ -991,6 +1157,205 @@ var _ = Describe("Discord Player", func() {
 				Fail("Voice worker timed out")
 			}
 		})
+
+		It("Plays stacked playlists in sequence & dispatches playlist events", func() {
+			ctrl := gomock.NewController(GinkgoT())
+			playerContext := StartMockMediaWithPosition(ctrl, NewMockMedia("Queue Media", "queueurl"), &discordplayer.DiscordMusicSessionOptions{}, discordplayer.EventPlaylistFinished)
+
+			startedPlaylists := make(chan entities.Playlist, 10)
+			playerContext.dms.AddEventCallback(func(_ *discordplayer.DiscordMusicSession, event *discordplayer.SessionEvent) {
+				if event.Type == discordplayer.EventPlaylistStarted {
+					startedPlaylists <- event.Playlist
+				}
+			})
+
+			firstPlaylist := NewMockPlaylist()
+			firstPlaylist.AddMedia(NewMockMedia("A1", "a1url"))
+			firstPlaylist.AddMedia(NewMockMedia("A2", "a2url"))
+			secondPlaylist := NewMockPlaylist()
+			secondPlaylist.AddMedia(NewMockMedia("B1", "b1url"))
+
+			Expect(playerContext.dms.AddPlaylist(firstPlaylist)).To(Succeed())
+			Expect(playerContext.dms.AddPlaylist(secondPlaylist)).To(Succeed())
+			Expect(playerContext.dms.GetCurrentPlaylist()).To(Equal(firstPlaylist))
+
+			for _, title := range []string{"A1", "A2", "B1"} {
+				skipToMedia(playerContext.dms, title)
+			}
+
+			Eventually(startedPlaylists).WithTimeout(failTimeout).Should(Receive(Equal(firstPlaylist)))
+			Eventually(startedPlaylists).WithTimeout(failTimeout).Should(Receive(Equal(secondPlaylist)))
+			Eventually(playerContext.events).WithTimeout(failTimeout).Should(Receive(HaveField("Playlist", firstPlaylist)))
+			Expect(playerContext.dms.GetPlaylists()).To(Equal([]entities.Playlist{secondPlaylist}))
+
+			Expect(playerContext.dms.Skip()).To(Succeed())
+			Eventually(playerContext.events).WithTimeout(failTimeout).Should(Receive(HaveField("Playlist", secondPlaylist)))
+			Eventually(playerContext.dms.GetPlaylists).WithTimeout(failTimeout).Should(BeEmpty())
+
+			Expect(playerContext.dms.Leave()).To(Succeed())
+			Eventually(playerContext.ctx.Done()).WithTimeout(failTimeout).Should(BeClosed())
+		})
+
+		It("Consumes media from each playlist in turn when interleaving", func() {
+			ctrl := gomock.NewController(GinkgoT())
+			playerContext := StartMockMediaWithPosition(ctrl, NewMockMedia("Queue Media", "queueurl"), &discordplayer.DiscordMusicSessionOptions{
+				PlaylistMode: discordplayer.PlaylistModeInterleaved,
+			}, discordplayer.EventPlaylistFinished)
+
+			firstPlaylist := NewMockPlaylist()
+			firstPlaylist.AddMedia(NewMockMedia("A1", "a1url"))
+			firstPlaylist.AddMedia(NewMockMedia("A2", "a2url"))
+			secondPlaylist := NewMockPlaylist()
+			secondPlaylist.AddMedia(NewMockMedia("B1", "b1url"))
+			secondPlaylist.AddMedia(NewMockMedia("B2", "b2url"))
+			secondPlaylist.AddMedia(NewMockMedia("B3", "b3url"))
+
+			Expect(playerContext.dms.AddPlaylist(firstPlaylist)).To(Succeed())
+			Expect(playerContext.dms.AddPlaylist(secondPlaylist)).To(Succeed())
+
+			for _, title := range []string{"A1", "B1", "A2", "B2", "B3"} {
+				skipToMedia(playerContext.dms, title)
+			}
+
+			Expect(playerContext.dms.Leave()).To(Succeed())
+			Eventually(playerContext.ctx.Done()).WithTimeout(failTimeout).Should(BeClosed())
+		})
+
+		It("Lists, removes & reorders playlists", func() {
+			ctrl := gomock.NewController(GinkgoT())
+			dms, err := discordplayer.NewDiscordMusicSessionEx(context.TODO(), NewMockDiscordAudio(ctrl), NewMockDiscordSession(ctrl), time.Second, &discordplayer.DiscordMusicSessionOptions{
+				GuildID:        gID,
+				VoiceChannelID: cID,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			playlists := []entities.Playlist{NewMockPlaylist(), NewMockPlaylist(), NewMockPlaylist()}
+
+			for _, playlist := range playlists {
+				Expect(dms.AddPlaylist(playlist)).To(Succeed())
+			}
+
+			Expect(dms.GetPlaylists()).To(Equal(playlists))
+
+			Expect(dms.MovePlaylist(2, 0)).To(Succeed())
+			Expect(dms.GetPlaylists()).To(Equal([]entities.Playlist{playlists[2], playlists[0], playlists[1]}))
+
+			removed, err := dms.RemovePlaylist(1)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(removed).To(Equal(playlists[0]))
+			Expect(dms.GetPlaylists()).To(Equal([]entities.Playlist{playlists[2], playlists[1]}))
+
+			_, err = dms.RemovePlaylist(2)
+			Expect(err).To(MatchError(discordplayer.ErrorPlaylistNotFound))
+			Expect(dms.MovePlaylist(0, 2)).To(MatchError(discordplayer.ErrorPlaylistNotFound))
+			Expect(dms.AddPlaylist(nil)).To(MatchError(discordplayer.ErrorInvalidArgument))
+
+			dms.SetPlaylist(playlists[0])
+			Expect(dms.GetPlaylists()).To(Equal([]entities.Playlist{playlists[0]}))
+
+			dms.ClearPlaylist()
+			Expect(dms.GetPlaylists()).To(BeEmpty())
+			Expect(dms.GetCurrentPlaylist()).To(BeNil())
+
+			Expect(dms.GetPlaylistMode()).To(Equal(discordplayer.PlaylistModeSequential))
+			Expect(dms.SetPlaylistMode(discordplayer.PlaylistModeInterleaved)).To(Succeed())
+			Expect(dms.GetPlaylistMode()).To(Equal(discordplayer.PlaylistModeInterleaved))
+			Expect(dms.SetPlaylistMode("random")).To(MatchError(discordplayer.ErrorInvalidArgument))
+		})
+
+		It("Enqueues the media of a playlist in the given order up to the playlist queue limit", func() {
+			ctrl := gomock.NewController(GinkgoT())
+			dms, err := discordplayer.NewDiscordMusicSessionEx(context.TODO(), NewMockDiscordAudio(ctrl), NewMockDiscordSession(ctrl), time.Second, &discordplayer.DiscordMusicSessionOptions{
+				GuildID:              gID,
+				VoiceChannelID:       cID,
+				MediaQueueMaxSize:    2,
+				PlaylistQueueMaxSize: 4,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			mediaList := make([]*youtubeapi.YoutubeMedia, 0)
+
+			for _, id := range []string{"1", "2", "3", "4"} {
+				mediaList = append(mediaList, &youtubeapi.YoutubeMedia{ID: id, VideoTitle: "Media " + id})
+			}
+
+			playlist := youtubeapi.NewYoutubePlaylist("1", "Mock Playlist", "listurl", nil, len(mediaList), mediaList...)
+			playlist.SetRemoveOnConsume(false)
+
+			Expect(dms.EnqueueMedia(NewMockMedia("Queue Media", "queueurl"))).To(Succeed())
+
+			_, err = dms.EnqueuePlaylist(playlist, "nonexistent_consume_order")
+			Expect(err).To(MatchError(entities.ErrorConsumeOrderNotSupported))
+
+			numEnqueued, err := dms.EnqueuePlaylist(playlist, entities.ConsumeOrderReverse)
+			Expect(err).To(MatchError(discordplayer.ErrorPlaylistPartiallyEnqueued))
+			Expect(numEnqueued).To(Equal(3))
+			Expect(playlist.GetMediaCount()).To(Equal(1))
+
+			// Settings of the playlist are left as they were
+			Expect(playlist.GetConsumeOrder()).To(Equal(entities.ConsumeOrderFromStart))
+			Expect(playlist.GetRemoveOnConsume()).To(BeFalse())
+
+			titles := make([]string, 0)
+
+			for _, media := range dms.GetMediaQueue() {
+				titles = append(titles, media.Title())
+			}
+
+			Expect(titles).To(Equal([]string{"Queue Media", "Media 4", "Media 3", "Media 2"}))
+
+			// Both limits are reached
+			Expect(dms.EnqueueMedia(NewMockMedia("Queue Media", "queueurl"))).To(MatchError(discordplayer.ErrorMediaQueueFull))
+			_, err = dms.EnqueuePlaylist(playlist, "")
+			Expect(err).To(MatchError(discordplayer.ErrorMediaQueueFull))
+
+			Expect(dms.ClearMediaQueue()).To(BeTrue())
+
+			numEnqueued, err = dms.EnqueuePlaylist(playlist, "")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(numEnqueued).To(Equal(1))
+			Expect(dms.GetMediaQueue()[0].Title()).To(Equal("Media 1"))
+
+			_, err = dms.EnqueuePlaylist(playlist, "")
+			Expect(err).To(MatchError(discordplayer.ErrorNoMediaFound))
+			_, err = dms.EnqueuePlaylist(nil, "")
+			Expect(err).To(MatchError(discordplayer.ErrorInvalidArgument))
+		})
+
+		It("Returns the count of media enqueued from a playlist that is still loading", func() {
+			ctrl := gomock.NewController(GinkgoT())
+			dms, err := discordplayer.NewDiscordMusicSessionEx(context.TODO(), NewMockDiscordAudio(ctrl), NewMockDiscordSession(ctrl), time.Second, &discordplayer.DiscordMusicSessionOptions{
+				GuildID:        gID,
+				VoiceChannelID: cID,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			mediaList := []*youtubeapi.YoutubeMedia{{ID: "1", VideoTitle: "Media 1"}, {ID: "2", VideoTitle: "Media 2"}}
+			playlist := &LoadingPlaylist{YoutubePlaylist: youtubeapi.NewYoutubePlaylist("1", "Mock Playlist", "listurl", nil, len(mediaList), mediaList...)}
+
+			numEnqueued, err := dms.EnqueuePlaylist(playlist, "")
+			Expect(err).To(MatchError(discordplayer.ErrorPlaylistPartiallyEnqueued))
+			Expect(numEnqueued).To(Equal(2))
+			Expect(dms.GetMediaQueue()).To(HaveLen(2))
+
+			_, err = dms.EnqueuePlaylist(playlist, "")
+			Expect(err).To(MatchError(entities.ErrorPlaylistLoading))
+		})
+
+		It("Defaults the max size of the media queue", func() {
+			ctrl := gomock.NewController(GinkgoT())
+			dms, err := discordplayer.NewDiscordMusicSessionEx(context.TODO(), NewMockDiscordAudio(ctrl), NewMockDiscordSession(ctrl), time.Second, &discordplayer.DiscordMusicSessionOptions{
+				GuildID:        gID,
+				VoiceChannelID: cID,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			for range 100 {
+				Expect(dms.EnqueueMedia(NewMockMedia("Queue Media", "queueurl"))).To(Succeed())
+			}
+
+			Expect(dms.EnqueueMedia(NewMockMedia("Queue Media", "queueurl"))).To(MatchError(discordplayer.ErrorMediaQueueFull))
+		})
 	})
 
 	When("Discord voice connection has a network error", func() {
@@ -1347,6 +1712,10 @@ var _ = Describe("Discord Player", func() {
 			Expect(nilWorkerCtx).To(BeNil())
 			Expect(err).To(MatchError(discordplayer.ErrorWorkerAlreadyActive))
 
+			Eventually(func() entities.Media {
+				return playerContext.dms.GetCurrentlyPlayingMedia()
+			}).WithTimeout(failTimeout).WithPolling(50 * time.Millisecond).ShouldNot(BeNil())
+
 			Expect(playerContext.dms.Leave()).To(Succeed())
 
 			select {
@@ -1443,6 +1812,170 @@ var _ = Describe("Discord Player", func() {
 				Fail("Voice worker timed out")
 			}
 		})
+
+		It("Invokes event callbacks as expected", func() {
+			ctrl := gomock.NewController(GinkgoT())
+
+			currentMediaDone := make(chan error)
+			mockDcaStreamingSession := NewMockDcaStreamingSession(ctrl)
+			playerContext := JoinMockVoiceChannelAndPlayEx(context.TODO(), ctrl, currentMediaDone, false, mockDcaStreamingSession)
+
+			events := make(chan *discordplayer.SessionEvent, 32)
+			playerContext.dms.AddEventCallback(func(_ *discordplayer.DiscordMusicSession, event *discordplayer.SessionEvent) {
+				events <- event
+			})
+
+			// Callbacks are invoked in goroutines, so events may arrive out of order
+			unmatchedEvents := make([]*discordplayer.SessionEvent, 0)
+
+			waitForEvent := func(eventType discordplayer.SessionEventType) *discordplayer.SessionEvent {
+				for index, event := range unmatchedEvents {
+					if event.Type == eventType {
+						unmatchedEvents = append(unmatchedEvents[:index], unmatchedEvents[index+1:]...)
+						return event
+					}
+				}
+
+				for {
+					select {
+					case event := <-events:
+						if event.Type == eventType {
+							return event
+						}
+						unmatchedEvents = append(unmatchedEvents, event)
+					case <-time.After(failTimeout):
+						Fail("Timed out waiting for event " + eventType)
+						return nil
+					}
+				}
+			}
+
+			c := make(chan struct{})
+			mockDcaStreamingSession.EXPECT().SetPaused(gomock.Any()).Times(2)
+			playerContext.mockVoiceConnection.EXPECT().Speaking(gomock.Any()).AnyTimes()
+			playerContext.mockVoiceConnection.EXPECT().Disconnect().Do(func() {
+				close(c)
+			})
+
+			Expect(playerContext.dms.EnqueueMedia(playerContext.mockMedia)).To(Succeed())
+			Expect(waitForEvent(discordplayer.EventQueueChanged)).NotTo(BeNil())
+
+			_, err := playerContext.dms.Start()
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(waitForEvent(discordplayer.EventVoiceConnected)).NotTo(BeNil())
+
+			startedEvent := waitForEvent(discordplayer.EventMediaStarted)
+			Expect(startedEvent.Media).To(Equal(playerContext.mockMedia))
+			Expect(startedEvent.IsReload).To(BeFalse())
+
+			Eventually(func() entities.Media {
+				return playerContext.dms.GetCurrentlyPlayingMedia()
+			}).WithTimeout(failTimeout).WithPolling(50 * time.Millisecond).ShouldNot(BeNil())
+
+			Expect(playerContext.dms.SetPaused(true)).To(Succeed())
+			Expect(waitForEvent(discordplayer.EventPaused).Media).To(Equal(playerContext.mockMedia))
+
+			Expect(playerContext.dms.SetPaused(false)).To(Succeed())
+			Expect(waitForEvent(discordplayer.EventResumed).Media).To(Equal(playerContext.mockMedia))
+
+			currentMediaDone <- nil
+			Expect(waitForEvent(discordplayer.EventMediaEnded).Media).To(Equal(playerContext.mockMedia))
+
+			Expect(playerContext.dms.Leave()).To(Succeed())
+			Expect(waitForEvent(discordplayer.EventVoiceDisconnected)).NotTo(BeNil())
+
+			select {
+			case <-c:
+				close(currentMediaDone)
+				return
+			case <-time.After(20 * time.Second):
+				Fail("Voice worker timed out")
+			}
+		})
+
+		It("Delivers events in the order they happen", func() {
+			ctrl := gomock.NewController(GinkgoT())
+			dms, err := discordplayer.NewDiscordMusicSessionEx(context.TODO(), NewMockDiscordAudio(ctrl), NewMockDiscordSession(ctrl), time.Second, &discordplayer.DiscordMusicSessionOptions{
+				GuildID:        gID,
+				VoiceChannelID: cID,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			var mutex sync.Mutex
+			eventTypes := make([]discordplayer.SessionEventType, 0)
+
+			dms.AddEventCallback(func(_ *discordplayer.DiscordMusicSession, event *discordplayer.SessionEvent) {
+				mutex.Lock()
+				defer mutex.Unlock()
+				eventTypes = append(eventTypes, event.Type)
+			})
+
+			expectedTypes := make([]discordplayer.SessionEventType, 0)
+
+			for range 20 {
+				Expect(dms.EnqueueMedia(NewMockMedia("Mock Media", "mockurl"))).To(Succeed())
+				Expect(dms.AddPlaylist(NewMockPlaylist())).To(Succeed())
+				Expect(dms.ClearMediaQueue()).To(BeTrue())
+				dms.ClearPlaylist()
+
+				expectedTypes = append(
+					expectedTypes,
+					discordplayer.EventQueueChanged,
+					discordplayer.EventPlaylistsChanged,
+					discordplayer.EventQueueChanged,
+					discordplayer.EventPlaylistsChanged,
+				)
+			}
+
+			Eventually(func() []discordplayer.SessionEventType {
+				mutex.Lock()
+				defer mutex.Unlock()
+				return slices.Clone(eventTypes)
+			}).WithTimeout(failTimeout).Should(Equal(expectedTypes))
+		})
+
+		It("Skips media that is still loading right away", func() {
+			ctrl := gomock.NewController(GinkgoT())
+			playerContext := StartMockMediaWithPosition(ctrl, NewMockMedia("Mock Media", "mockurl"), &discordplayer.DiscordMusicSessionOptions{}, discordplayer.EventMediaStarted)
+
+			Eventually(playerContext.events).WithTimeout(failTimeout).Should(Receive(HaveField("Media.MockMediaTitle", "Mock Media")))
+
+			slowMedia := &MockSlowMedia{MockMedia: NewMockMedia("Slow Media", "slowurl"), loading: make(chan struct{})}
+			nextMedia := NewMockMedia("Next Media", "nexturl")
+			Expect(playerContext.dms.EnqueueMedia(slowMedia)).To(Succeed())
+			Expect(playerContext.dms.EnqueueMedia(nextMedia)).To(Succeed())
+			Expect(playerContext.dms.Skip()).To(Succeed())
+
+			Eventually(slowMedia.loading).WithTimeout(failTimeout).Should(BeClosed())
+			Expect(playerContext.dms.Skip()).To(Succeed())
+
+			var event *discordplayer.SessionEvent
+			Eventually(playerContext.events).WithTimeout(time.Second).Should(Receive(&event))
+			Expect(event.Media).To(Equal(nextMedia))
+
+			Expect(playerContext.dms.Leave()).To(Succeed())
+			Eventually(playerContext.ctx.Done()).WithTimeout(failTimeout).Should(BeClosed())
+		})
+
+		It("Dispatches media started only for media that loads", func() {
+			ctrl := gomock.NewController(GinkgoT())
+			playerContext := StartMockMediaWithPosition(ctrl, NewMockMedia("Mock Media", "mockurl"), &discordplayer.DiscordMusicSessionOptions{}, discordplayer.EventMediaStarted)
+
+			Eventually(playerContext.events).WithTimeout(failTimeout).Should(Receive(HaveField("Media.MockMediaTitle", "Mock Media")))
+
+			nextMedia := NewMockMedia("Next Media", "nexturl")
+			Expect(playerContext.dms.EnqueueMedia(&MockFailingMedia{MockMedia: NewMockMedia("Failing Media", "failingurl")})).To(Succeed())
+			Expect(playerContext.dms.EnqueueMedia(nextMedia)).To(Succeed())
+			Expect(playerContext.dms.Skip()).To(Succeed())
+
+			var event *discordplayer.SessionEvent
+			Eventually(playerContext.events).WithTimeout(failTimeout).Should(Receive(&event))
+			Expect(event.Media).To(Equal(nextMedia))
+
+			Expect(playerContext.dms.Leave()).To(Succeed())
+			Eventually(playerContext.ctx.Done()).WithTimeout(failTimeout).Should(BeClosed())
+		})
 	})
 
 	When("Changing the channel on a DiscordMusicSession", func() {
@@ -1671,6 +2204,313 @@ var _ = Describe("Discord Player", func() {
 		)
 	})
 
+	When("Media is already Opus", func() {
+		DescribeTable("Passes Opus through without re-encoding when possible", func(
+			codec string,
+			container string,
+			options discordplayer.DiscordMusicSessionOptions,
+			demuxErr error,
+			expectPassthrough bool,
+		) {
+			ctrl := gomock.NewController(GinkgoT())
+
+			mockDca := NewMockDiscordAudio(ctrl)
+			mockDiscordSession := NewMockDiscordSession(ctrl)
+			mockVoiceConnection := NewMockDiscordVoiceConnection(ctrl)
+			mockMedia := &MockOpusMedia{MockMedia: NewMockMedia("Mock Media", "mockurl"), MockCodec: codec, MockContainer: container}
+
+			mockDiscordSession.EXPECT().ChannelVoiceJoin(gID, cID, false, false).Return(mockVoiceConnection, nil).AnyTimes()
+			mockVoiceConnection.EXPECT().Speaking(gomock.Any()).AnyTimes()
+			mockVoiceConnection.EXPECT().IsReady().Return(true).AnyTimes()
+			mockVoiceConnection.EXPECT().Disconnect().AnyTimes()
+			mockDca.EXPECT().NewStream(nil, mockVoiceConnection, gomock.Any()).Return(nil).Times(1)
+
+			if opusdemux.IsSupportedContainer(container) && codec == "opus" && !options.DisableOpusPassthrough {
+				mockDca.EXPECT().DemuxFile(gomock.Any(), mockMedia.FileURL(), container).Return(nil, demuxErr).Times(1)
+			}
+
+			if expectPassthrough {
+				mockDca.EXPECT().EncodeFile(gomock.Any(), gomock.Any()).Times(0)
+			} else {
+				mockDca.EXPECT().EncodeFile(mockMedia.FileURL(), gomock.Any()).Return(nil, nil).Times(1)
+			}
+
+			options.GuildID = gID
+			options.VoiceChannelID = cID
+			options.MediaQueueMaxSize = 10
+
+			dms, err := discordplayer.NewDiscordMusicSessionEx(context.TODO(), mockDca, mockDiscordSession, 100*time.Millisecond, &options)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(dms.EnqueueMedia(mockMedia)).To(Succeed())
+
+			ctx, err := dms.Start()
+			Expect(err).NotTo(HaveOccurred())
+
+			Eventually(dms.GetCurrentlyPlayingMedia).WithTimeout(failTimeout).ShouldNot(BeNil())
+			Expect(dms.Leave()).To(Succeed())
+			Eventually(ctx.Done()).WithTimeout(failTimeout).Should(BeClosed())
+		},
+			Entry("Opus in WebM", "opus", "webm", discordplayer.DiscordMusicSessionOptions{}, nil, true),
+			Entry("Opus in Ogg", "opus", "ogg", discordplayer.DiscordMusicSessionOptions{}, nil, true),
+			Entry("AAC in M4A", "mp4a.40.2", "m4a", discordplayer.DiscordMusicSessionOptions{}, nil, false),
+			Entry("Opus in an unsupported container", "opus", "mkv", discordplayer.DiscordMusicSessionOptions{}, nil, false),
+			Entry("Passthrough is disabled", "opus", "webm", discordplayer.DiscordMusicSessionOptions{DisableOpusPassthrough: true}, nil, false),
+			Entry("Demuxing fails", "opus", "webm", discordplayer.DiscordMusicSessionOptions{}, opusdemux.ErrorUnsupportedFrameDuration, false),
+		)
+
+		It("Leaves while opening a stalled file for passthrough", func() {
+			ctrl := gomock.NewController(GinkgoT())
+
+			mockDca := NewMockDiscordAudio(ctrl)
+			mockDiscordSession := NewMockDiscordSession(ctrl)
+			mockVoiceConnection := NewMockDiscordVoiceConnection(ctrl)
+			mockMedia := &MockOpusMedia{MockMedia: NewMockMedia("Mock Media", "mockurl"), MockCodec: "opus", MockContainer: "webm"}
+			demuxStarted := make(chan struct{})
+
+			mockDiscordSession.EXPECT().ChannelVoiceJoin(gID, cID, false, false).Return(mockVoiceConnection, nil).AnyTimes()
+			mockVoiceConnection.EXPECT().Speaking(gomock.Any()).AnyTimes()
+			mockVoiceConnection.EXPECT().IsReady().Return(true).AnyTimes()
+			mockVoiceConnection.EXPECT().Disconnect().AnyTimes()
+			mockDca.EXPECT().DemuxFile(gomock.Any(), mockMedia.FileURL(), "webm").Times(1).
+				DoAndReturn(func(ctx context.Context, path string, container string) (*opusdemux.DemuxSession, error) {
+					close(demuxStarted)
+					<-ctx.Done()
+					return nil, ctx.Err()
+				})
+			mockDca.EXPECT().EncodeFile(gomock.Any(), gomock.Any()).Times(0)
+			mockDca.EXPECT().NewStream(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+
+			dms, err := discordplayer.NewDiscordMusicSessionEx(context.TODO(), mockDca, mockDiscordSession, 100*time.Millisecond, &discordplayer.DiscordMusicSessionOptions{
+				GuildID:           gID,
+				VoiceChannelID:    cID,
+				MediaQueueMaxSize: 10,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(dms.EnqueueMedia(mockMedia)).To(Succeed())
+
+			ctx, err := dms.Start()
+			Expect(err).NotTo(HaveOccurred())
+
+			Eventually(demuxStarted).WithTimeout(failTimeout).Should(BeClosed())
+			Expect(dms.Leave()).To(Succeed())
+			Eventually(ctx.Done()).WithTimeout(failTimeout).Should(BeClosed())
+		})
+	})
+
+	When("Media has chapters", func() {
+		chapters := []entities.Chapter{
+			{Title: "Intro", Start: 0, End: 10 * time.Second},
+			{Title: "First Song", Start: 10 * time.Second, End: 30 * time.Second},
+			{Title: "Second Song", Start: 30 * time.Second, End: time.Minute},
+		}
+
+		It("Navigates between chapters", func() {
+			ctrl := gomock.NewController(GinkgoT())
+			playerContext := StartMockMediaWithPosition(ctrl, &MockChapterMedia{MockMedia: NewMockMedia("Mock Mix", "mockurl"), MockChapters: chapters}, &discordplayer.DiscordMusicSessionOptions{}, discordplayer.EventChapterChanged)
+			dms := playerContext.dms
+
+			// Media is reloaded after each jump
+			expectJumpTo := func(position time.Duration) {
+				Eventually(playerContext.jumps).WithTimeout(failTimeout).Should(Receive(Equal(position)))
+				Eventually(dms.GetCurrentlyPlayingMedia).WithTimeout(failTimeout).ShouldNot(BeNil())
+			}
+
+			chapter, index, err := dms.CurrentChapter()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(index).To(Equal(0))
+			Expect(chapter.Title).To(Equal("Intro"))
+
+			Expect(dms.NextChapter()).To(Succeed())
+			expectJumpTo(10 * time.Second)
+			Eventually(func() int {
+				_, index, _ := dms.CurrentChapter()
+				return index
+			}).WithTimeout(failTimeout).Should(Equal(1))
+
+			Expect(dms.JumpToChapterByName("second")).To(Succeed())
+			expectJumpTo(30 * time.Second)
+
+			Expect(dms.NextChapter()).To(MatchError(discordplayer.ErrorChapterNotFound))
+			Expect(dms.JumpToChapter(3)).To(MatchError(discordplayer.ErrorChapterNotFound))
+			Expect(dms.JumpToChapterByName("outro")).To(MatchError(discordplayer.ErrorChapterNotFound))
+
+			// Restarts the current chapter after a few seconds, goes to the previous one before that.
+			// Playback is 15s into the session started from 30s
+			playerContext.position.Store(int64(15 * time.Second))
+			Expect(dms.PreviousChapter()).To(Succeed())
+			expectJumpTo(30 * time.Second)
+
+			Expect(dms.PreviousChapter()).To(Succeed())
+			expectJumpTo(10 * time.Second)
+
+			Expect(dms.JumpToChapter(0)).To(Succeed())
+			expectJumpTo(time.Duration(0))
+
+			Expect(dms.Leave()).To(Succeed())
+			Eventually(playerContext.ctx.Done()).WithTimeout(failTimeout).Should(BeClosed())
+		})
+
+		It("Moves to the next chapter from a chapter that was jumped to", func() {
+			ctrl := gomock.NewController(GinkgoT())
+			playerContext := StartMockMediaWithPosition(ctrl, &MockChapterMedia{MockMedia: NewMockMedia("Mock Mix", "mockurl"), MockChapters: chapters}, &discordplayer.DiscordMusicSessionOptions{}, discordplayer.EventChapterChanged)
+			dms := playerContext.dms
+
+			Expect(dms.NextChapter()).To(Succeed())
+			Eventually(playerContext.jumps).WithTimeout(failTimeout).Should(Receive(Equal(10 * time.Second)))
+			Eventually(func() int {
+				_, index, _ := dms.CurrentChapter()
+				return index
+			}).WithTimeout(failTimeout).Should(Equal(1))
+			Expect(dms.CurrentPlaybackPosition()).To(Equal(10 * time.Second))
+
+			Expect(dms.NextChapter()).To(Succeed())
+			Eventually(playerContext.jumps).WithTimeout(failTimeout).Should(Receive(Equal(30 * time.Second)))
+			Eventually(func() int {
+				_, index, _ := dms.CurrentChapter()
+				return index
+			}).WithTimeout(failTimeout).Should(Equal(2))
+
+			Expect(dms.Leave()).To(Succeed())
+			Eventually(playerContext.ctx.Done()).WithTimeout(failTimeout).Should(BeClosed())
+		})
+
+		It("Dispatches chapter changed events as playback crosses chapter boundaries", func() {
+			ctrl := gomock.NewController(GinkgoT())
+			mockMedia := &MockChapterMedia{MockMedia: NewMockMedia("Mock Mix", "mockurl"), MockChapters: chapters}
+			playerContext := StartMockMediaWithPosition(ctrl, mockMedia, &discordplayer.DiscordMusicSessionOptions{}, discordplayer.EventChapterChanged)
+
+			var event *discordplayer.SessionEvent
+			Eventually(playerContext.events).WithTimeout(failTimeout).Should(Receive(&event))
+			Expect(event.Media).To(Equal(mockMedia))
+			Expect(event.ChapterIndex).To(Equal(0))
+			Expect(event.Chapter.Title).To(Equal("Intro"))
+
+			playerContext.position.Store(int64(12 * time.Second))
+			Eventually(playerContext.events).WithTimeout(failTimeout).Should(Receive(&event))
+			Expect(event.ChapterIndex).To(Equal(1))
+			Expect(event.Chapter.Title).To(Equal("First Song"))
+
+			// No event while staying within the chapter
+			playerContext.position.Store(int64(20 * time.Second))
+			Consistently(playerContext.events).WithTimeout(time.Second).ShouldNot(Receive())
+
+			Expect(playerContext.dms.JumpToChapter(2)).To(Succeed())
+			Eventually(playerContext.events).WithTimeout(failTimeout).Should(Receive(&event))
+			Expect(event.ChapterIndex).To(Equal(2))
+
+			Expect(playerContext.dms.Leave()).To(Succeed())
+			Eventually(playerContext.ctx.Done()).WithTimeout(failTimeout).Should(BeClosed())
+		})
+
+		It("Returns sensible errors for media without chapters", func() {
+			ctrl := gomock.NewController(GinkgoT())
+			playerContext := StartMockMediaWithPosition(ctrl, NewMockMedia("Mock Media", "mockurl"), &discordplayer.DiscordMusicSessionOptions{}, discordplayer.EventChapterChanged)
+
+			_, _, err := playerContext.dms.CurrentChapter()
+			Expect(err).To(MatchError(discordplayer.ErrorNoChapters))
+			Expect(playerContext.dms.NextChapter()).To(MatchError(discordplayer.ErrorNoChapters))
+			Expect(playerContext.dms.PreviousChapter()).To(MatchError(discordplayer.ErrorNoChapters))
+			Expect(playerContext.dms.JumpToChapter(0)).To(MatchError(discordplayer.ErrorNoChapters))
+
+			Expect(playerContext.dms.Leave()).To(Succeed())
+			Eventually(playerContext.ctx.Done()).WithTimeout(failTimeout).Should(BeClosed())
+
+			_, _, err = playerContext.dms.CurrentChapter()
+			Expect(err).To(MatchError(discordplayer.ErrorNoMediaFound))
+		})
+	})
+
+	When("A segment provider is set", func() {
+		segments := []entities.Segment{
+			{Category: "intro", Start: 0, End: 5 * time.Second},
+			{Category: "sponsor", Start: 20 * time.Second, End: 30 * time.Second},
+			{Category: "outro", Start: 55 * time.Second, End: time.Minute},
+		}
+
+		It("Jumps over segments of enabled categories", func() {
+			ctrl := gomock.NewController(GinkgoT())
+			provider := &MockSegmentProvider{MockSegments: segments}
+			mockMedia := NewMockMedia("Mock Media", "mockurl")
+
+			playerContext := StartMockMediaWithPosition(ctrl, mockMedia, &discordplayer.DiscordMusicSessionOptions{
+				SegmentProvider:       provider,
+				SkipSegmentCategories: []string{"intro", "outro"},
+			}, discordplayer.EventSegmentSkipped)
+			dms := playerContext.dms
+
+			Eventually(playerContext.jumps).WithTimeout(failTimeout).Should(Receive(Equal(5 * time.Second)))
+
+			var event *discordplayer.SessionEvent
+			Eventually(playerContext.events).WithTimeout(failTimeout).Should(Receive(&event))
+			Expect(event.Media).To(Equal(mockMedia))
+			Expect(event.Segment.Category).To(Equal("intro"))
+
+			// Sponsor segment is not enabled. Playback is 16s into the session started from 5s
+			Eventually(dms.GetCurrentlyPlayingMedia).WithTimeout(failTimeout).ShouldNot(BeNil())
+			playerContext.position.Store(int64(16 * time.Second))
+			Consistently(playerContext.jumps).WithTimeout(time.Second).ShouldNot(Receive())
+
+			dms.SetSkipSegmentCategories([]string{"sponsor", "outro"})
+			Expect(dms.GetSkipSegmentCategories()).To(Equal([]string{"sponsor", "outro"}))
+			Eventually(playerContext.jumps).WithTimeout(failTimeout).Should(Receive(Equal(30 * time.Second)))
+			Eventually(playerContext.events).WithTimeout(failTimeout).Should(Receive(&event))
+			Expect(event.Segment.Category).To(Equal("sponsor"))
+
+			// Segments are loaded once per media, not after each jump
+			Expect(provider.calls.Load()).To(Equal(int32(1)))
+
+			// Outro runs to the end of the media, which is skipped instead. Playback is 26s into
+			// the session started from 30s
+			Eventually(dms.GetCurrentlyPlayingMedia).WithTimeout(failTimeout).ShouldNot(BeNil())
+			playerContext.position.Store(int64(26 * time.Second))
+			Eventually(playerContext.events).WithTimeout(failTimeout).Should(Receive(&event))
+			Expect(event.Segment.Category).To(Equal("outro"))
+			Eventually(dms.GetCurrentlyPlayingMedia).WithTimeout(failTimeout).Should(BeNil())
+			Expect(playerContext.jumps).NotTo(Receive())
+
+			Expect(dms.Leave()).To(Succeed())
+			Eventually(playerContext.ctx.Done()).WithTimeout(failTimeout).Should(BeClosed())
+		})
+
+		It("Jumps past an intro segment once", func() {
+			ctrl := gomock.NewController(GinkgoT())
+			provider := &MockSegmentProvider{MockSegments: segments}
+
+			playerContext := StartMockMediaWithPosition(ctrl, NewMockMedia("Mock Media", "mockurl"), &discordplayer.DiscordMusicSessionOptions{
+				SegmentProvider:       provider,
+				SkipSegmentCategories: []string{"intro"},
+			}, discordplayer.EventSegmentSkipped)
+
+			Eventually(playerContext.jumps).WithTimeout(failTimeout).Should(Receive(Equal(5 * time.Second)))
+			Eventually(playerContext.events).WithTimeout(failTimeout).Should(Receive())
+
+			// The session started from 5s is past the intro although its position starts from 0
+			Consistently(playerContext.jumps).WithTimeout(time.Second).ShouldNot(Receive())
+			Expect(playerContext.events).To(BeEmpty())
+
+			Expect(playerContext.dms.Leave()).To(Succeed())
+			Eventually(playerContext.ctx.Done()).WithTimeout(failTimeout).Should(BeClosed())
+		})
+
+		It("Keeps playing if segments can not be loaded", func() {
+			ctrl := gomock.NewController(GinkgoT())
+			provider := &MockSegmentProvider{MockSegments: segments, MockError: errors.New("api unavailable")}
+
+			playerContext := StartMockMediaWithPosition(ctrl, NewMockMedia("Mock Media", "mockurl"), &discordplayer.DiscordMusicSessionOptions{
+				SegmentProvider:       provider,
+				SkipSegmentCategories: []string{"intro"},
+			}, discordplayer.EventSegmentSkipped)
+
+			Consistently(playerContext.jumps).WithTimeout(time.Second).ShouldNot(Receive())
+			Expect(playerContext.events).To(BeEmpty())
+			Expect(provider.calls.Load()).To(Equal(int32(1)))
+			Expect(playerContext.dms.GetCurrentlyPlayingMedia()).NotTo(BeNil())
+
+			Expect(playerContext.dms.Leave()).To(Succeed())
+			Eventually(playerContext.ctx.Done()).WithTimeout(failTimeout).Should(BeClosed())
+		})
+	})
+
 	When("Using the API invalidly", func() {
 		It("Returns a sensible error if attempting to Start() without a voice channel", func() {
 			dms, err := discordplayer.NewDiscordMusicSession(context.TODO(), nil, &discordplayer.DiscordMusicSessionOptions{
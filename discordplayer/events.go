@@ -0,0 +1,123 @@
+package discordplayer
+
+import (
+	"slices"
+	"sync"
+
+	"github.com/fakelag/streaming-music-bot/entities"
+)
+
+type SessionEventType = string
+
+const (
+	// Media started playing. IsReload is set if the same media is restarted,
+	// for example after a jump or a voice reconnect
+	EventMediaStarted SessionEventType = "media_started"
+	// Media stopped playing, either finished, skipped or reloading
+	EventMediaEnded        SessionEventType = "media_ended"
+	EventPaused            SessionEventType = "paused"
+	EventResumed           SessionEventType = "resumed"
+	EventQueueChanged      SessionEventType = "queue_changed"
+	EventVoiceConnected    SessionEventType = "voice_connected"
+	EventVoiceDisconnected SessionEventType = "voice_disconnected"
+	// Playback crossed into another chapter, including the first chapter when media starts
+	EventChapterChanged SessionEventType = "chapter_changed"
+	// A segment of the playing media was skipped automatically
+	EventSegmentSkipped SessionEventType = "segment_skipped"
+	// The first media of a playlist was consumed
+	EventPlaylistStarted SessionEventType = "playlist_started"
+	// A playlist ran out of media & was removed from the playlists
+	EventPlaylistFinished SessionEventType = "playlist_finished"
+	// Playlists were added, removed, reordered or finished
+	EventPlaylistsChanged SessionEventType = "playlists_changed"
+)
+
+type SessionEvent struct {
+	Type SessionEventType
+	// Media related to the event, nil for events not related to a media
+	Media    entities.Media
+	IsReload bool
+	// Chapter started, set for EventChapterChanged
+	Chapter      *entities.Chapter
+	ChapterIndex int
+	// Segment skipped, set for EventSegmentSkipped
+	Segment *entities.Segment
+	// Playlist started or finished, set for EventPlaylistStarted & EventPlaylistFinished
+	Playlist entities.Playlist
+}
+
+// Called for each event in the order the events happen. Callbacks of a session are called
+// one at a time, so a callback should not block for long
+type EventCallback = func(session *DiscordMusicSession, event *SessionEvent)
+
+func (dms *DiscordMusicSession) AddEventCallback(cb EventCallback) {
+	dms.mutex.Lock()
+	defer dms.mutex.Unlock()
+
+	dms.eventCallbacks = append(dms.eventCallbacks, cb)
+}
+
+func (dms *DiscordMusicSession) invokeEventCallbacks(event *SessionEvent) {
+	dms.mutex.RLock()
+	defer dms.mutex.RUnlock()
+
+	dms.dispatchEvent(event)
+}
+
+// dispatchEvent requires dms.mutex to be held by the caller
+func (dms *DiscordMusicSession) dispatchEvent(event *SessionEvent) {
+	if len(dms.eventCallbacks) == 0 {
+		return
+	}
+
+	dms.events.push(dms, event, dms.eventCallbacks)
+}
+
+// Delivers events to callbacks in the order they were dispatched, one at a time
+type eventQueue struct {
+	mutex   sync.Mutex
+	pending []queuedEvent
+	// Set while a goroutine is delivering the pending events
+	draining bool
+}
+
+type queuedEvent struct {
+	event     *SessionEvent
+	callbacks []EventCallback
+}
+
+func (queue *eventQueue) push(dms *DiscordMusicSession, event *SessionEvent, callbacks []EventCallback) {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+
+	// Callbacks added later do not receive the event
+	queue.pending = append(queue.pending, queuedEvent{event: event, callbacks: slices.Clone(callbacks)})
+
+	if !queue.draining {
+		queue.draining = true
+		go queue.drain(dms)
+	}
+}
+
+// Delivers pending events until there are none left. Callbacks are called without
+// dms.mutex held, so they may call the session
+func (queue *eventQueue) drain(dms *DiscordMusicSession) {
+	for {
+		queue.mutex.Lock()
+
+		if len(queue.pending) == 0 {
+			queue.draining = false
+			queue.mutex.Unlock()
+			return
+		}
+
+		next := queue.pending[0]
+		queue.pending[0] = queuedEvent{}
+		queue.pending = queue.pending[1:]
+		queue.mutex.Unlock()
+
+		for _, cb := range next.callbacks {
+			cb(dms, next.event)
+		}
+	}
+}
@@ -1,12 +1,16 @@
 package discordinterface
 
 import (
+	"context"
+
 	"github.com/fakelag/dca"
+	"github.com/fakelag/streaming-music-bot/opusdemux"
 )
 
 type DiscordAudio interface {
 	NewStream(source dca.OpusReader, vc DiscordVoiceConnection, done chan error) DcaStreamingSession
 	EncodeFile(path string, options *dca.EncodeOptions) (session *dca.EncodeSession, err error)
+	DemuxFile(ctx context.Context, path string, container string) (session *opusdemux.DemuxSession, err error)
 }
 
 type DefaultDiscordAudio struct {
@@ -21,6 +25,10 @@ func (dda *DefaultDiscordAudio) EncodeFile(path string, options *dca.EncodeOptio
 	return dca.EncodeFile(path, options)
 }
 
+func (dda *DefaultDiscordAudio) DemuxFile(ctx context.Context, path string, container string) (session *opusdemux.DemuxSession, err error) {
+	return opusdemux.DemuxFile(ctx, path, container)
+}
+
 func NewDiscordAudio() DiscordAudio {
 	dca := &DefaultDiscordAudio{}
 	return dca
@@ -3,17 +3,19 @@
 //
 // Generated by this command:
 //
-//	mockgen -source=discordplayer/interfaces/dcainterface.go -destination discordplayer/mocks/dcainterface_mock.go \
+//	mockgen -source=discordplayer/interfaces/dcainterface.go -destination discordplayer/mocks/dcainterface_mock.go
 //
 
 // Package mock_discordinterface is a generated GoMock package.
 package mock_discordinterface
 
 import (
+	context "context"
 	reflect "reflect"
 
 	dca "github.com/fakelag/dca"
 	discordinterface "github.com/fakelag/streaming-music-bot/discordplayer/interfaces"
+	opusdemux "github.com/fakelag/streaming-music-bot/opusdemux"
 	gomock "go.uber.org/mock/gomock"
 )
 
@@ -40,6 +42,21 @@ func (m *MockDiscordAudio) EXPECT() *MockDiscordAudioMockRecorder {
 	return m.recorder
 }
 
+// DemuxFile mocks base method.
+func (m *MockDiscordAudio) DemuxFile(ctx context.Context, path, container string) (*opusdemux.DemuxSession, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DemuxFile", ctx, path, container)
+	ret0, _ := ret[0].(*opusdemux.DemuxSession)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DemuxFile indicates an expected call of DemuxFile.
+func (mr *MockDiscordAudioMockRecorder) DemuxFile(ctx, path, container any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DemuxFile", reflect.TypeOf((*MockDiscordAudio)(nil).DemuxFile), ctx, path, container)
+}
+
 // EncodeFile mocks base method.
 func (m *MockDiscordAudio) EncodeFile(path string, options *dca.EncodeOptions) (*dca.EncodeSession, error) {
 	m.ctrl.T.Helper()
@@ -0,0 +1,173 @@
+package discordplayer
+
+import (
+	"errors"
+	"slices"
+
+	"github.com/fakelag/streaming-music-bot/entities"
+)
+
+type PlaylistMode = string
+
+const (
+	// Playlists are played one after another in the order they were added
+	PlaylistModeSequential PlaylistMode = "sequential"
+	// Media is consumed from each playlist in turn
+	PlaylistModeInterleaved PlaylistMode = "interleaved"
+)
+
+type queuedPlaylist struct {
+	playlist entities.Playlist
+	// Set once media has been consumed from the playlist
+	started bool
+}
+
+// Adds a playlist to be played after the current playlists
+func (dms *DiscordMusicSession) AddPlaylist(playlist entities.Playlist) error {
+	dms.mutex.Lock()
+	defer dms.mutex.Unlock()
+
+	if playlist == nil {
+		return ErrorInvalidArgument
+	}
+
+	dms.playlists = append(dms.playlists, &queuedPlaylist{playlist: playlist})
+	dms.onPlaylistsChanged()
+	return nil
+}
+
+// Consumes the media of a playlist into the media queue, so that it can be edited like media
+// enqueued one by one. An empty order keeps the consume order of the playlist. Enqueued media is
+// removed from the playlist, its consume order & remove on consume setting are left as they were.
+// Returns the number of media enqueued. If media is left in the playlist, because it does not fit
+// into PlaylistQueueMaxSize or is still being loaded, ErrorPlaylistPartiallyEnqueued is returned
+// with the count, and the rest can be enqueued or added with AddPlaylist later
+func (dms *DiscordMusicSession) EnqueuePlaylist(playlist entities.Playlist, order entities.PlaylistConsumeOrder) (int, error) {
+	if playlist == nil {
+		return 0, ErrorInvalidArgument
+	}
+
+	previousOrder := playlist.GetConsumeOrder()
+	previousRemoveOnConsume := playlist.GetRemoveOnConsume()
+
+	if order != "" {
+		if err := playlist.SetConsumeOrder(order); err != nil {
+			return 0, err
+		}
+	}
+
+	// Consuming without removal would never empty the playlist
+	playlist.SetRemoveOnConsume(true)
+
+	defer func() {
+		_ = playlist.SetConsumeOrder(previousOrder)
+		playlist.SetRemoveOnConsume(previousRemoveOnConsume)
+	}()
+
+	dms.mutex.Lock()
+	defer dms.mutex.Unlock()
+
+	numEnqueued := 0
+	var err error
+
+	for len(dms.mediaQueue) < dms.playlistQueueMaxSize {
+		var media entities.Media
+		media, err = playlist.ConsumeNextMedia()
+
+		if err != nil {
+			break
+		}
+
+		dms.mediaQueue = append(dms.mediaQueue, media)
+		numEnqueued += 1
+	}
+
+	if numEnqueued > 0 {
+		dms.onMediaQueueChanged()
+	}
+
+	switch {
+	case err == nil && numEnqueued == 0:
+		return 0, ErrorMediaQueueFull
+	case errors.Is(err, entities.ErrorPlaylistEmpty) && numEnqueued == 0:
+		return 0, ErrorNoMediaFound
+	case errors.Is(err, entities.ErrorPlaylistEmpty):
+		return numEnqueued, nil
+	case err == nil && playlist.GetMediaCount() == 0:
+		return numEnqueued, nil
+	case err == nil, errors.Is(err, entities.ErrorPlaylistLoading) && numEnqueued > 0:
+		return numEnqueued, ErrorPlaylistPartiallyEnqueued
+	}
+
+	return numEnqueued, err
+}
+
+// Playlists in the order they are played, the current playlist first
+func (dms *DiscordMusicSession) GetPlaylists() []entities.Playlist {
+	dms.mutex.RLock()
+	defer dms.mutex.RUnlock()
+
+	playlists := make([]entities.Playlist, len(dms.playlists))
+
+	for index, queued := range dms.playlists {
+		playlists[index] = queued.playlist
+	}
+
+	return playlists
+}
+
+func (dms *DiscordMusicSession) RemovePlaylist(index int) (entities.Playlist, error) {
+	dms.mutex.Lock()
+	defer dms.mutex.Unlock()
+
+	if index < 0 || index >= len(dms.playlists) {
+		return nil, ErrorPlaylistNotFound
+	}
+
+	removed := dms.playlists[index]
+	dms.playlists = slices.Delete(dms.playlists, index, index+1)
+
+	if index < dms.nextPlaylistIndex {
+		dms.nextPlaylistIndex -= 1
+	}
+
+	dms.onPlaylistsChanged()
+	return removed.playlist, nil
+}
+
+// Moves the playlist at from to index to of the playlists after the move
+func (dms *DiscordMusicSession) MovePlaylist(from int, to int) error {
+	dms.mutex.Lock()
+	defer dms.mutex.Unlock()
+
+	if from < 0 || from >= len(dms.playlists) || to < 0 || to >= len(dms.playlists) {
+		return ErrorPlaylistNotFound
+	}
+
+	moved := dms.playlists[from]
+	dms.playlists = slices.Insert(slices.Delete(dms.playlists, from, from+1), to, moved)
+	dms.onPlaylistsChanged()
+	return nil
+}
+
+func (dms *DiscordMusicSession) SetPlaylistMode(mode PlaylistMode) error {
+	if mode != PlaylistModeSequential && mode != PlaylistModeInterleaved {
+		return ErrorInvalidArgument
+	}
+
+	dms.mutex.Lock()
+	defer dms.mutex.Unlock()
+	dms.playlistMode = mode
+	return nil
+}
+
+func (dms *DiscordMusicSession) GetPlaylistMode() PlaylistMode {
+	dms.mutex.RLock()
+	defer dms.mutex.RUnlock()
+	return dms.playlistMode
+}
+
+// onPlaylistsChanged requires dms.mutex to be write-locked by the caller
+func (dms *DiscordMusicSession) onPlaylistsChanged() {
+	dms.dispatchEvent(&SessionEvent{Type: EventPlaylistsChanged})
+}
@@ -0,0 +1,136 @@
+package discordplayer
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/fakelag/streaming-music-bot/entities"
+)
+
+const (
+	// How often the playback position is compared to skippable segments
+	segmentCheckInterval = 250 * time.Millisecond
+	// Segments are not skipped if less than this of them is left, and segments ending this
+	// close to the end of the media skip the media
+	segmentEndMargin = time.Second
+)
+
+// Sets the categories of segments skipped automatically, replacing the previous ones.
+// Pass nil to stop skipping segments
+func (dms *DiscordMusicSession) SetSkipSegmentCategories(categories []string) {
+	dms.mutex.Lock()
+	defer dms.mutex.Unlock()
+	dms.skipSegmentCategories = slices.Clone(categories)
+}
+
+func (dms *DiscordMusicSession) GetSkipSegmentCategories() []string {
+	dms.mutex.RLock()
+	defer dms.mutex.RUnlock()
+	return slices.Clone(dms.skipSegmentCategories)
+}
+
+// Jumps over segments of enabled categories as playback enters them. Segments running
+// to the end of the media skip it. Returns after a jump, as the media is then reloaded
+func (dms *DiscordMusicSession) skipSegments(ctx context.Context, mediaFile entities.Media, session *DcaMediaSession) {
+	segments, err := dms.loadSegments(ctx, mediaFile)
+
+	if err != nil {
+		if ctx.Err() == nil {
+			dms.logger.Warn("failed to load media segments", mediaLogAttr(mediaFile), slog.Any("error", err))
+		}
+		return
+	}
+
+	if len(segments) == 0 {
+		return
+	}
+
+	for {
+		position := session.playbackPosition()
+
+		if segment := dms.segmentToSkip(segments, position); segment != nil && ctx.Err() == nil {
+			if dms.skipSegment(mediaFile, segment) == nil {
+				return
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(segmentCheckInterval):
+			break
+		}
+	}
+}
+
+// Returns the segments of media, loading them from the segment provider unless the
+// media is being reloaded
+func (dms *DiscordMusicSession) loadSegments(ctx context.Context, mediaFile entities.Media) ([]entities.Segment, error) {
+	dms.mutex.RLock()
+	if dms.segmentsMedia == mediaFile {
+		segments := dms.segments
+		dms.mutex.RUnlock()
+		return segments, nil
+	}
+	dms.mutex.RUnlock()
+
+	segments, err := dms.segmentProvider.Segments(ctx, mediaFile)
+
+	if err != nil {
+		return nil, err
+	}
+
+	dms.mutex.Lock()
+	defer dms.mutex.Unlock()
+
+	dms.segmentsMedia = mediaFile
+	dms.segments = segments
+
+	return segments, nil
+}
+
+// Returns the segment of an enabled category playing at position, or nil
+func (dms *DiscordMusicSession) segmentToSkip(segments []entities.Segment, position time.Duration) *entities.Segment {
+	dms.mutex.RLock()
+	defer dms.mutex.RUnlock()
+
+	for index, segment := range segments {
+		if position < segment.Start || position >= segment.End-segmentEndMargin {
+			continue
+		}
+
+		if slices.Contains(dms.skipSegmentCategories, segment.Category) {
+			return &segments[index]
+		}
+	}
+
+	return nil
+}
+
+func (dms *DiscordMusicSession) skipSegment(mediaFile entities.Media, segment *entities.Segment) error {
+	var err error
+	duration := mediaFile.Duration()
+
+	if duration != nil && segment.End >= *duration-segmentEndMargin {
+		err = dms.Skip()
+	} else {
+		err = dms.Jump(segment.End)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	dms.logger.Info(
+		"skipping media segment",
+		mediaLogAttr(mediaFile),
+		slog.String("category", segment.Category),
+		slog.Duration("start", segment.Start),
+		slog.Duration("end", segment.End),
+	)
+
+	dms.invokeEventCallbacks(&SessionEvent{Type: EventSegmentSkipped, Media: mediaFile, Segment: segment})
+	return nil
+}
@@ -4,24 +4,44 @@ import (
 	"context"
 	"errors"
 	"io"
+	"log/slog"
+	"slices"
 	"strings"
 	"time"
 
 	discordinterface "github.com/fakelag/streaming-music-bot/discordplayer/interfaces"
 	"github.com/fakelag/streaming-music-bot/entities"
+	"github.com/fakelag/streaming-music-bot/metrics"
+	"github.com/fakelag/streaming-music-bot/opusdemux"
 
 	"github.com/fakelag/dca"
 	// . "github.com/onsi/ginkgo/v2"
 )
 
 type DcaMediaSession struct {
-	encodingSession  *dca.EncodeSession
+	encodingSession *dca.EncodeSession
+	// Set instead of encodingSession when Opus audio is passed through without re-encoding
+	demuxSession     *opusdemux.DemuxSession
 	streamingSession discordinterface.DcaStreamingSession
 	done             chan error
+	// Position in the media the session started from. The playback position of the
+	// streaming session starts from 0 with each session, such as after a jump
+	startOffset time.Duration
+}
+
+// Position of playback in the media
+func (session *DcaMediaSession) playbackPosition() time.Duration {
+	return session.startOffset + session.streamingSession.PlaybackPosition()
 }
 
 func (dms *DiscordMusicSession) voiceWorker(done context.CancelFunc) {
 	defer done()
+
+	dms.logger.Info("voice worker started", slog.String("voice_channel_id", dms.GetVoiceChannelID()))
+	defer dms.logger.Info("voice worker exited")
+
+	dms.metrics.SessionStarted(dms.guildID)
+	defer dms.metrics.SessionEnded(dms.guildID)
 	defer dms.disconnectAndExitWorker()
 
 	ctx, cancel := dms.voiceWorkerContext()
@@ -49,11 +69,13 @@ workerloop:
 					ctx,
 					mediaFile,
 					keepPlayingCurrentMediaFrom,
+					isReload,
 				)
 
 				isReload = true
 
 				if err != nil {
+					dms.logger.Warn("media playback failed", mediaLogAttr(mediaFile), slog.Any("error", err))
 					dms.invokeErrorCallbacks(mediaFile, err)
 				}
 
@@ -90,6 +112,7 @@ func (dms *DiscordMusicSession) playMediaFile(
 	ctx context.Context,
 	mediaFile entities.Media,
 	startPlaybackAt time.Duration,
+	isReload bool,
 ) (
 	err error,
 	exitWorker bool,
@@ -105,27 +128,58 @@ func (dms *DiscordMusicSession) playMediaFile(
 	err = dms.checkDiscordVoiceConnection()
 
 	if err != nil {
+		dms.logger.Error("failed to join voice channel", slog.Any("error", err))
+		dms.metrics.PlaybackError(dms.guildID, metrics.PlaybackErrorVoice)
 		return
 	}
 
-	err = mediaFile.EnsureLoaded()
+	err, exitWorker, skipped := dms.loadMediaFile(playMediaCtx, mediaFile)
+
+	if exitWorker || skipped {
+		return
+	}
 
 	if err != nil {
+		dms.logger.Error("failed to load media", mediaLogAttr(mediaFile), slog.Any("error", err))
+		dms.metrics.PlaybackError(dms.guildID, metrics.PlaybackErrorLoad)
 		return
 	}
 
 	_ = dms.voiceConnection.Speaking(true)
 
-	session, err := dms.playUrlInDiscord(mediaFile.FileURL(), startPlaybackAt)
+	session, err, exitWorker, skipped := dms.playMediaInDiscord(playMediaCtx, mediaFile, startPlaybackAt)
+
+	if exitWorker || skipped {
+		return
+	}
 
 	if err != nil {
+		dms.logger.Error("failed to start encoding session", mediaLogAttr(mediaFile), slog.Any("error", err))
+		dms.metrics.PlaybackError(dms.guildID, metrics.PlaybackErrorEncode)
+		invalidateMediaFileURL(mediaFile)
 		return
 	}
 
+	if !isReload {
+		dms.metrics.TrackPlayed(dms.guildID)
+	}
+
+	dms.logger.Info(
+		"media playback started",
+		mediaLogAttr(mediaFile),
+		slog.Bool("is_reload", isReload),
+		slog.Duration("start_at", startPlaybackAt),
+		slog.Bool("opus_passthrough", session.demuxSession != nil),
+	)
+
 	dms.setCurrentlyPlayingMediaAndSession(mediaFile, session)
 	defer dms.setCurrentlyPlayingMediaAndSession(nil, nil)
 	defer dms.setLastCompletedMedia(mediaFile)
 
+	// Dispatched once the media has loaded & playback has started
+	dms.invokeEventCallbacks(&SessionEvent{Type: EventMediaStarted, Media: mediaFile, IsReload: isReload})
+	defer dms.invokeEventCallbacks(&SessionEvent{Type: EventMediaEnded, Media: mediaFile})
+
 	fileUrlExpiresAt := mediaFile.FileURLExpiresAt()
 	reloadChan := make(chan bool, 1)
 
@@ -133,23 +187,44 @@ func (dms *DiscordMusicSession) playMediaFile(
 		go dms.checkForMediaFileExpiration(playMediaCtx, fileUrlExpiresAt, reloadChan)
 	}
 
+	if !isReload {
+		dms.resetCurrentChapter()
+	}
+
+	if chapters := mediaChapters(mediaFile); len(chapters) > 0 {
+		go dms.watchChapterChanges(playMediaCtx, mediaFile, chapters, session)
+	}
+
+	if dms.segmentProvider != nil && mediaFile.CanJumpToTimeStamp() && !mediaFile.IsLiveStream() {
+		go dms.skipSegments(playMediaCtx, mediaFile, session)
+	}
+
 	select {
 	case err = <-session.done:
-		dms.cleanupEncodingAndVoiceSession(session.encodingSession, dms.voiceConnection)
+		dms.cleanupMediaAndVoiceSession(session, dms.voiceConnection)
 
 		if err == nil || err == io.EOF {
 			err = nil
 			return
 		}
 
+		dms.metrics.PlaybackError(dms.guildID, metrics.PlaybackErrorStream)
+
 		if !strings.Contains(err.Error(), "Voice connection closed") {
+			invalidateMediaFileURL(mediaFile)
 			return
 		}
 
+		dms.logger.Warn(
+			"voice connection closed during playback",
+			mediaLogAttr(mediaFile),
+			slog.Duration("position", session.playbackPosition()),
+		)
+
 		mediaFileDuration := mediaFile.Duration()
 
 		if mediaFileDuration != nil {
-			mediaDurationLeft := *mediaFileDuration - session.streamingSession.PlaybackPosition()
+			mediaDurationLeft := *mediaFileDuration - session.playbackPosition()
 
 			if mediaDurationLeft.Seconds() < 2 {
 				// No more content to play, done
@@ -160,42 +235,186 @@ func (dms *DiscordMusicSession) playMediaFile(
 		keepPlayingCurrentMedia = true
 
 		if mediaFile.CanJumpToTimeStamp() {
-			keepPlayingCurrentMediaFrom = session.streamingSession.PlaybackPosition()
+			keepPlayingCurrentMediaFrom = session.playbackPosition()
 		}
 
 		return
 	case <-dms.chanLeaveCommand:
-		dms.cleanupEncodingAndVoiceSession(session.encodingSession, dms.voiceConnection)
+		dms.cleanupMediaAndVoiceSession(session, dms.voiceConnection)
 
 		exitWorker = true
 		return
 	case jumpTo := <-dms.chanJumpCommand:
-		dms.cleanupEncodingAndVoiceSession(session.encodingSession, dms.voiceConnection)
+		dms.cleanupMediaAndVoiceSession(session, dms.voiceConnection)
 
 		keepPlayingCurrentMedia = true
 		keepPlayingCurrentMediaFrom = jumpTo
 		return
 	case <-dms.chanSkipCommand:
-		dms.cleanupEncodingAndVoiceSession(session.encodingSession, dms.voiceConnection)
+		dms.cleanupMediaAndVoiceSession(session, dms.voiceConnection)
 		return
 	case <-reloadChan:
-		dms.cleanupEncodingAndVoiceSession(session.encodingSession, dms.voiceConnection)
+		dms.cleanupMediaAndVoiceSession(session, dms.voiceConnection)
+		dms.metrics.StreamURLReload(dms.guildID)
+		dms.logger.Info("reloading media before its file url expires", mediaLogAttr(mediaFile))
 
 		keepPlayingCurrentMedia = true
 
 		if mediaFile.CanJumpToTimeStamp() {
-			keepPlayingCurrentMediaFrom = session.streamingSession.PlaybackPosition()
+			keepPlayingCurrentMediaFrom = session.playbackPosition()
 		}
 
 		return
 	case <-playMediaCtx.Done():
-		dms.cleanupEncodingAndVoiceSession(session.encodingSession, dms.voiceConnection)
+		dms.cleanupMediaAndVoiceSession(session, dms.voiceConnection)
 
 		exitWorker = true
 		return
 	}
 }
 
+// Loads media while waiting for leave & skip commands, which cancel the load.
+// Cancelling kills any yt-dlp process still resolving the media
+func (dms *DiscordMusicSession) loadMediaFile(
+	ctx context.Context,
+	mediaFile entities.Media,
+) (err error, exitWorker bool, skipped bool) {
+	err, exitWorker, skipped = dms.runUntilCommand(ctx, mediaFile.EnsureLoaded)
+
+	if exitWorker || skipped {
+		dms.logger.Debug("media load cancelled", mediaLogAttr(mediaFile), slog.Bool("exit_worker", exitWorker))
+	}
+
+	return err, exitWorker, skipped
+}
+
+// Runs load while waiting for leave & skip commands, which cancel the context of load
+func (dms *DiscordMusicSession) runUntilCommand(
+	ctx context.Context,
+	load func(ctx context.Context) error,
+) (err error, exitWorker bool, skipped bool) {
+	loadCtx, cancelLoad := context.WithCancel(ctx)
+	defer cancelLoad()
+
+	loadDone := make(chan error, 1)
+
+	go func() {
+		loadDone <- load(loadCtx)
+	}()
+
+	var command chan bool
+
+	select {
+	case err = <-loadDone:
+		return dms.loadMediaFileResult(ctx, err)
+	case <-dms.chanLeaveCommand:
+		command, exitWorker = dms.chanLeaveCommand, true
+	case <-dms.chanSkipCommand:
+		command, skipped = dms.chanSkipCommand, true
+	}
+
+	select {
+	case err = <-loadDone:
+		// Loading finished as well, the command is handled during playback instead
+		select {
+		case command <- true:
+		default:
+			// The same command has been sent again
+		}
+
+		return dms.loadMediaFileResult(ctx, err)
+	default:
+		break
+	}
+
+	cancelLoad()
+	<-loadDone
+
+	return nil, exitWorker, skipped
+}
+
+func (dms *DiscordMusicSession) loadMediaFileResult(ctx context.Context, err error) (error, bool, bool) {
+	if err != nil && ctx.Err() != nil {
+		// Worker context was cancelled during the load
+		return nil, true, false
+	}
+
+	return err, false, false
+}
+
+// Passes Opus audio through to the voice connection when possible, falling back to encoding.
+// Opening media for passthrough reads from the network, so it is cancelled by leave & skip
+// commands like loading the media
+func (dms *DiscordMusicSession) playMediaInDiscord(
+	ctx context.Context,
+	mediaFile entities.Media,
+	startPlaybackAt time.Duration,
+) (session *DcaMediaSession, err error, exitWorker bool, skipped bool) {
+	if container, ok := dms.opusPassthroughContainer(mediaFile, startPlaybackAt); ok {
+		var demuxSession *opusdemux.DemuxSession
+		demuxStartedAt := time.Now()
+
+		err, exitWorker, skipped = dms.runUntilCommand(ctx, func(ctx context.Context) error {
+			var err error
+			demuxSession, err = dms.dca.DemuxFile(ctx, mediaFile.FileURL(), container)
+			return err
+		})
+
+		if exitWorker || skipped {
+			if demuxSession != nil {
+				// Opened concurrently with the command
+				demuxSession.Cleanup()
+			}
+
+			dms.logger.Debug("opus passthrough cancelled", mediaLogAttr(mediaFile), slog.Bool("exit_worker", exitWorker))
+			return nil, nil, exitWorker, skipped
+		}
+
+		if err == nil {
+			return dms.passthroughInDiscord(demuxSession, demuxStartedAt), nil, false, false
+		}
+
+		dms.logger.Info("opus passthrough failed, encoding instead", mediaLogAttr(mediaFile), slog.Any("error", err))
+	}
+
+	session, err = dms.playUrlInDiscord(mediaFile.FileURL(), startPlaybackAt)
+	return session, err, false, false
+}
+
+// Returns the container of media that can be played without re-encoding. Seeking requires encoding
+func (dms *DiscordMusicSession) opusPassthroughContainer(mediaFile entities.Media, startPlaybackAt time.Duration) (string, bool) {
+	if !dms.opusPassthrough || startPlaybackAt != 0 {
+		return "", false
+	}
+
+	audioFormatMedia, ok := mediaFile.(entities.AudioFormatMedia)
+
+	if !ok {
+		return "", false
+	}
+
+	codec, container := audioFormatMedia.FileAudioFormat()
+
+	if codec != "opus" || !opusdemux.IsSupportedContainer(container) {
+		return "", false
+	}
+
+	return container, true
+}
+
+func (dms *DiscordMusicSession) passthroughInDiscord(demuxSession *opusdemux.DemuxSession, demuxStartedAt time.Time) *DcaMediaSession {
+	done := make(chan error)
+
+	streamingSession := dms.dca.NewStream(demuxSession, dms.voiceConnection, done)
+	dms.metrics.EncodeStartup(dms.guildID, time.Since(demuxStartedAt))
+
+	return &DcaMediaSession{
+		demuxSession:     demuxSession,
+		streamingSession: streamingSession,
+		done:             done,
+	}
+}
+
 func (dms *DiscordMusicSession) playUrlInDiscord(url string, startPlaybackAt time.Duration) (*DcaMediaSession, error) {
 	options := dca.StdEncodeOptions
 	options.RawOutput = true
@@ -203,6 +422,7 @@ func (dms *DiscordMusicSession) playUrlInDiscord(url string, startPlaybackAt tim
 	options.Application = "lowdelay"
 	options.StartTime = int(startPlaybackAt.Seconds())
 
+	encodeStartedAt := time.Now()
 	encodingSession, err := dms.dca.EncodeFile(url, options)
 
 	if err != nil {
@@ -213,11 +433,13 @@ func (dms *DiscordMusicSession) playUrlInDiscord(url string, startPlaybackAt tim
 
 	time.Sleep(250 * time.Millisecond)
 	streamingSession := dms.dca.NewStream(encodingSession, dms.voiceConnection, done)
+	dms.metrics.EncodeStartup(dms.guildID, time.Since(encodeStartedAt))
 
 	return &DcaMediaSession{
 		encodingSession:  encodingSession,
 		streamingSession: streamingSession,
 		done:             done,
+		startOffset:      time.Duration(options.StartTime) * time.Second,
 	}, nil
 }
 
@@ -233,32 +455,63 @@ func (dms *DiscordMusicSession) consumeNextMediaFromQueue() entities.Media {
 
 	// Queue is resized when consuming media
 	nextMediaFile, dms.mediaQueue = dms.mediaQueue[0], dms.mediaQueue[1:]
+	dms.onMediaQueueChanged()
 
 	return nextMediaFile
 }
 
 func (dms *DiscordMusicSession) consumeNextMediaFromPlaylist() entities.Media {
-	dms.mutex.RLock()
+	dms.mutex.Lock()
+	defer dms.mutex.Unlock()
 
-	if dms.currentPlaylist == nil {
-		dms.mutex.RUnlock()
-		return nil
-	}
+	// Playlists that are still loading are skipped when interleaving
+	numLoadingPlaylists := 0
 
-	media, err := dms.currentPlaylist.ConsumeNextMedia()
+	for numLoadingPlaylists < len(dms.playlists) {
+		playlistIndex := 0
 
-	dms.mutex.RUnlock()
+		if dms.playlistMode == PlaylistModeInterleaved {
+			playlistIndex = dms.nextPlaylistIndex % len(dms.playlists)
+		}
+
+		queued := dms.playlists[playlistIndex]
+		media, err := queued.playlist.ConsumeNextMedia()
+
+		if err == nil {
+			dms.nextPlaylistIndex = playlistIndex + 1
+
+			if !queued.started {
+				queued.started = true
+				dms.dispatchEvent(&SessionEvent{Type: EventPlaylistStarted, Playlist: queued.playlist})
+			}
+
+			return media
+		}
 
-	if err != nil {
 		if errors.Is(err, entities.ErrorPlaylistEmpty) {
-			dms.ClearPlaylist()
-			return nil
+			// The playlist after the finished one moves to its index
+			dms.playlists = slices.Delete(dms.playlists, playlistIndex, playlistIndex+1)
+			dms.nextPlaylistIndex = playlistIndex
+			dms.dispatchEvent(&SessionEvent{Type: EventPlaylistFinished, Playlist: queued.playlist})
+			dms.onPlaylistsChanged()
+			continue
+		}
+
+		if errors.Is(err, entities.ErrorPlaylistLoading) {
+			if dms.playlistMode != PlaylistModeInterleaved {
+				return nil
+			}
+
+			dms.nextPlaylistIndex = playlistIndex + 1
+			numLoadingPlaylists += 1
+			continue
 		}
-		// TODO: log error
+
+		dms.logger.Error("failed to consume media from playlist", slog.Any("error", err))
 		return nil
 	}
 
-	return media
+	return nil
 }
 
 func (dms *DiscordMusicSession) checkDiscordVoiceConnection() error {
@@ -267,7 +520,10 @@ func (dms *DiscordMusicSession) checkDiscordVoiceConnection() error {
 	}
 
 	if dms.voiceConnection != nil {
+		dms.logger.Warn("voice connection not ready, reconnecting")
 		_ = dms.voiceConnection.Disconnect()
+		dms.metrics.VoiceReconnect(dms.guildID)
+		dms.invokeEventCallbacks(&SessionEvent{Type: EventVoiceDisconnected})
 	}
 
 	dms.mutex.RLock()
@@ -281,6 +537,8 @@ func (dms *DiscordMusicSession) checkDiscordVoiceConnection() error {
 	}
 
 	dms.voiceConnection = newVoiceConnection
+	dms.logger.Info("joined voice channel", slog.String("voice_channel_id", voiceChannelID))
+	dms.invokeEventCallbacks(&SessionEvent{Type: EventVoiceConnected})
 	return nil
 }
 
@@ -311,6 +569,7 @@ func (dms *DiscordMusicSession) voiceWorkerContext() (ctx context.Context, cance
 				if currentMedia != nil {
 					queueNotEmptyAt = time.Now()
 				} else if time.Since(queueNotEmptyAt) >= dms.leaveAfterEmptyQueueTime {
+					dms.logger.Info("leaving voice after the queue has been empty", slog.Duration("empty_for", dms.leaveAfterEmptyQueueTime))
 					cancel()
 					return
 				}
@@ -322,6 +581,7 @@ func (dms *DiscordMusicSession) voiceWorkerContext() (ctx context.Context, cance
 				if err != nil || hasNonBotMembers {
 					channelNotEmptyAt = time.Now()
 				} else if time.Since(channelNotEmptyAt) >= dms.leaveAfterChannelEmptyTime {
+					dms.logger.Info("leaving voice after the channel has been empty", slog.Duration("empty_for", dms.leaveAfterChannelEmptyTime))
 					cancel()
 					return
 				}
@@ -385,12 +645,22 @@ func (dms *DiscordMusicSession) disconnectAndExitWorker() {
 
 	dms.workerActive = false
 	dms.currentlyPlayingMedia = nil
-	dms.mediaQueue = make([]entities.Media, 0)
-	dms.currentPlaylist = nil
+
+	if len(dms.playlists) > 0 {
+		dms.playlists = make([]*queuedPlaylist, 0)
+		dms.nextPlaylistIndex = 0
+		dms.onPlaylistsChanged()
+	}
+
+	if len(dms.mediaQueue) > 0 {
+		dms.mediaQueue = make([]entities.Media, 0)
+		dms.onMediaQueueChanged()
+	}
 
 	if dms.voiceConnection != nil {
 		dms.voiceConnection.Disconnect()
 		dms.voiceConnection = nil
+		dms.dispatchEvent(&SessionEvent{Type: EventVoiceDisconnected})
 	}
 }
 
@@ -407,12 +677,16 @@ func (dms *DiscordMusicSession) setLastCompletedMedia(media entities.Media) {
 	dms.lastCompletedMedia = media
 }
 
-func (dms *DiscordMusicSession) cleanupEncodingAndVoiceSession(
-	encodingSession *dca.EncodeSession,
+func (dms *DiscordMusicSession) cleanupMediaAndVoiceSession(
+	session *DcaMediaSession,
 	voiceConnection discordinterface.DiscordVoiceConnection,
 ) {
-	if encodingSession != nil {
-		encodingSession.Cleanup()
+	if session.encodingSession != nil {
+		session.encodingSession.Cleanup()
+	}
+
+	if session.demuxSession != nil {
+		session.demuxSession.Cleanup()
 	}
 
 	_ = voiceConnection.Speaking(false)
@@ -455,3 +729,19 @@ func (dms *DiscordMusicSession) invokeErrorCallbacks(mediaFile entities.Media, e
 		go cb(dms, mediaFile, err)
 	}
 }
+
+// Media implementing slog.LogValuer, such as youtubeapi.YoutubeMedia, log their own attributes
+func mediaLogAttr(media entities.Media) slog.Attr {
+	if logValuer, ok := media.(slog.LogValuer); ok {
+		return slog.Any("media", logValuer)
+	}
+
+	return slog.Group("media", slog.String("title", media.Title()), slog.String("link", media.Link()))
+}
+
+// Stream & encoding errors may be caused by a stale url, so a cached url is not reused
+func invalidateMediaFileURL(mediaFile entities.Media) {
+	if invalidatableMedia, ok := mediaFile.(entities.InvalidatableMedia); ok {
+		invalidatableMedia.InvalidateFileURL()
+	}
+}
@@ -0,0 +1,203 @@
+package entities
+
+import (
+	"math/rand"
+	"slices"
+)
+
+// Consume orders picked with a ConsumeOrderPicker
+var PickedConsumeOrders = []PlaylistConsumeOrder{
+	ConsumeOrderShuffleNoRepeat,
+	ConsumeOrderArtistSpread,
+	ConsumeOrderWeightedRandom,
+}
+
+// Consume orders supported by a ConsumeOrderPicker
+func PickerConsumeOrders() []PlaylistConsumeOrder {
+	return append(
+		[]PlaylistConsumeOrder{ConsumeOrderFromStart, ConsumeOrderShuffle, ConsumeOrderReverse},
+		PickedConsumeOrders...,
+	)
+}
+
+// Picks the next media of a playlist by its consume order, keeping track of what has been
+// consumed before for orders such as ConsumeOrderShuffleNoRepeat. Not thread safe
+type ConsumeOrderPicker[T interface {
+	Media
+	comparable
+}] struct {
+	rng *rand.Rand
+	// Media not yet consumed in the current round of a no-repeat shuffle, next last
+	bag []T
+	// Index of each media in bag
+	bagIndex   map[T]int
+	playCounts map[T]int
+	lastPicked T
+	lastArtist string
+}
+
+func NewConsumeOrderPicker[T interface {
+	Media
+	comparable
+}](rng *rand.Rand) *ConsumeOrderPicker[T] {
+	return &ConsumeOrderPicker[T]{
+		rng:        rng,
+		bag:        make([]T, 0),
+		bagIndex:   make(map[T]int),
+		playCounts: make(map[T]int),
+	}
+}
+
+// Returns the index of the media in mediaList to consume next, or -1 if mediaList is empty
+// or order is not one of PickerConsumeOrders. nextMediaIndex counts the media consumed from
+// the start or in reverse, and is advanced unless removeOnConsume is set, as removing the
+// media moves the next one to the same index
+func (picker *ConsumeOrderPicker[T]) PickIndex(
+	order PlaylistConsumeOrder,
+	mediaList []T,
+	nextMediaIndex *int,
+	removeOnConsume bool,
+) int {
+	if len(mediaList) == 0 {
+		return -1
+	}
+
+	switch order {
+	case ConsumeOrderFromStart, ConsumeOrderReverse:
+		index := *nextMediaIndex % len(mediaList)
+
+		if order == ConsumeOrderReverse {
+			index = len(mediaList) - 1 - index
+		}
+
+		if !removeOnConsume {
+			*nextMediaIndex += 1
+		}
+
+		return index
+	case ConsumeOrderShuffle:
+		return picker.rng.Intn(len(mediaList))
+	}
+
+	for {
+		var media T
+
+		switch order {
+		case ConsumeOrderShuffleNoRepeat:
+			media = picker.pickFromBag(mediaList, false)
+		case ConsumeOrderArtistSpread:
+			media = picker.pickFromBag(mediaList, true)
+		case ConsumeOrderWeightedRandom:
+			media = picker.pickWeighted(mediaList)
+		default:
+			return -1
+		}
+
+		index := slices.Index(mediaList, media)
+
+		if index == -1 {
+			// Removed from the playlist without calling Remove
+			picker.Remove(media)
+			continue
+		}
+
+		picker.playCounts[media] += 1
+		picker.lastPicked = media
+		picker.lastArtist = mediaArtist(media)
+
+		return index
+	}
+}
+
+// Forgets media removed from the playlist
+func (picker *ConsumeOrderPicker[T]) Remove(media T) {
+	delete(picker.playCounts, media)
+
+	if index, ok := picker.bagIndex[media]; ok {
+		picker.removeFromBag(index)
+	}
+}
+
+// Takes the next media from the bag, refilling it with all of mediaList in a random
+// order when it runs out. With spreadArtists, the first media by an artist other than
+// the previous one is taken
+func (picker *ConsumeOrderPicker[T]) pickFromBag(mediaList []T, spreadArtists bool) T {
+	if len(picker.bag) == 0 {
+		picker.bag = slices.Clone(mediaList)
+
+		// Fisher-Yates
+		picker.rng.Shuffle(len(picker.bag), func(i int, j int) {
+			picker.bag[i], picker.bag[j] = picker.bag[j], picker.bag[i]
+		})
+
+		if last := len(picker.bag) - 1; last > 0 && picker.bag[last] == picker.lastPicked {
+			// The last media of the previous round would be picked again right away
+			picker.bag[0], picker.bag[last] = picker.bag[last], picker.bag[0]
+		}
+
+		clear(picker.bagIndex)
+
+		for index, media := range picker.bag {
+			picker.bagIndex[media] = index
+		}
+	}
+
+	index := len(picker.bag) - 1
+
+	if spreadArtists && picker.lastArtist != "" {
+		for candidate := len(picker.bag) - 1; candidate >= 0; candidate-- {
+			if mediaArtist(picker.bag[candidate]) != picker.lastArtist {
+				index = candidate
+				break
+			}
+		}
+	}
+
+	media := picker.bag[index]
+	picker.removeFromBag(index)
+	return media
+}
+
+// Removes the media at index by moving the last media of the bag in its place. The
+// bag is in a random order, so the order of the rest does not matter
+func (picker *ConsumeOrderPicker[T]) removeFromBag(index int) {
+	last := len(picker.bag) - 1
+	delete(picker.bagIndex, picker.bag[index])
+
+	if index != last {
+		picker.bag[index] = picker.bag[last]
+		picker.bagIndex[picker.bag[index]] = index
+	}
+
+	picker.bag = picker.bag[:last]
+}
+
+// Picks media with a weight of 1 / (1 + times consumed)
+func (picker *ConsumeOrderPicker[T]) pickWeighted(mediaList []T) T {
+	totalWeight := 0.0
+
+	for _, media := range mediaList {
+		totalWeight += 1 / float64(1+picker.playCounts[media])
+	}
+
+	target := picker.rng.Float64() * totalWeight
+
+	for _, media := range mediaList {
+		target -= 1 / float64(1+picker.playCounts[media])
+
+		if target < 0 {
+			return media
+		}
+	}
+
+	return mediaList[len(mediaList)-1]
+}
+
+// Artist of media implementing MediaMetadata, empty otherwise
+func mediaArtist(media Media) string {
+	if metadata, ok := media.(MediaMetadata); ok {
+		return metadata.Artist()
+	}
+
+	return ""
+}
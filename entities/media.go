@@ -1,6 +1,9 @@
 package entities
 
-import "time"
+import (
+	"context"
+	"time"
+)
 
 type Media interface {
 	// URL passed to ffmpeg. Could be a local opus file or a remote url
@@ -9,8 +12,9 @@ type Media interface {
 	// about to expire and start a new encoding session with the FileURL() afterwards. Return nil
 	// for no expiration (such as with a local file)
 	FileURLExpiresAt() *time.Time
-	// Ensure that the current FileURL() is valid. Called before starting an encoding session
-	EnsureLoaded() error
+	// Ensure that the current FileURL() is valid. Called before starting an encoding session.
+	// ctx is cancelled when the voice worker exits or skips the media
+	EnsureLoaded(ctx context.Context) error
 
 	Title() string
 	Link() string
@@ -19,3 +23,36 @@ type Media interface {
 	IsLiveStream() bool
 	Duration() *time.Duration
 }
+
+// Optionally implemented by media whose FileURL() may become invalid before it expires.
+// The voice worker calls InvalidateFileURL after a playback error that suggests a stale url,
+// so that the next EnsureLoaded loads a new one
+type InvalidatableMedia interface {
+	Media
+	InvalidateFileURL()
+}
+
+// Optionally implemented by media that knows the format of its FileURL(). Opus audio in a
+// WebM or Ogg container is sent to the voice connection without re-encoding
+type AudioFormatMedia interface {
+	Media
+	// Codec & container of the file, such as "opus" & "webm". Empty if unknown
+	FileAudioFormat() (codec string, container string)
+}
+
+// Section of media, such as a song of a mix
+type Chapter struct {
+	Title string        `json:"title"`
+	Start time.Duration `json:"start"`
+	End   time.Duration `json:"end"`
+}
+
+// Optionally implemented by media with details beyond its title, for displaying in UIs.
+// Details that are unknown are returned empty
+type MediaMetadata interface {
+	Media
+	Artist() string
+	Album() string
+	// Chapters in playback order
+	Chapters() []Chapter
+}
@@ -10,11 +10,25 @@ type PlaylistConsumeOrder = string
 const (
 	ConsumeOrderFromStart PlaylistConsumeOrder = "start"
 	ConsumeOrderShuffle   PlaylistConsumeOrder = "shuffle"
+	// From the end to the start
+	ConsumeOrderReverse PlaylistConsumeOrder = "reverse"
+	// Shuffle consuming every media once before any media is repeated
+	ConsumeOrderShuffleNoRepeat PlaylistConsumeOrder = "shuffle_no_repeat"
+	// Like ConsumeOrderShuffleNoRepeat, but avoids consuming media of the same artist in a row
+	ConsumeOrderArtistSpread PlaylistConsumeOrder = "artist_spread"
+	// Random, favouring media consumed fewer times
+	ConsumeOrderWeightedRandom PlaylistConsumeOrder = "weighted_random"
 )
 
 var (
 	ErrorConsumeOrderNotSupported = errors.New("order not supported")
 	ErrorPlaylistEmpty            = errors.New("playlist is empty")
+	// Returned from ConsumeNextMedia when the playlist has no media yet, but more is being loaded
+	ErrorPlaylistLoading = errors.New("playlist is loading")
+	// Returned when editing a playlist with an index outside of its media
+	ErrorPlaylistIndexOutOfRange = errors.New("playlist index out of range")
+	// Returned when inserting media of a type the playlist can not hold
+	ErrorPlaylistMediaNotSupported = errors.New("media not supported by playlist")
 )
 
 type Playlist interface {
@@ -29,3 +43,22 @@ type Playlist interface {
 	GetRemoveOnConsume() bool
 	GetConsumeOrder() PlaylistConsumeOrder
 }
+
+// Optionally implemented by playlists whose media can be listed & edited. Indexes are
+// positions in the playlist, regardless of the consume order
+type EditablePlaylist interface {
+	Playlist
+	// Up to n media in the order they will be consumed. Nil if the order is not known
+	// in advance, such as with the random consume orders
+	Peek(n int) []Media
+	// Up to limit media in playlist order, starting from offset
+	List(offset int, limit int) []Media
+	RemoveAt(index int) (Media, error)
+	// Inserts media before index. Media inserted at Position() is consumed next when
+	// consuming from the start, and media inserted after it when consuming in reverse
+	Insert(index int, media ...Media) error
+	// Moves the media at from to index to of the playlist after the move
+	Move(from int, to int) error
+	// Index of the media consumed next, or -1 if it is not known in advance
+	Position() int
+}
@@ -0,0 +1,20 @@
+package entities
+
+import (
+	"context"
+	"time"
+)
+
+// Section of media that may be skipped, such as a sponsor message or a non-music intro
+type Segment struct {
+	// Kind of the segment, such as "sponsor" or "intro". Categories are defined by the provider
+	Category string
+	Start    time.Duration
+	End      time.Duration
+}
+
+type SegmentProvider interface {
+	// Returns the skippable segments of media in playback order. Returns an empty
+	// list without an error if the provider has no segments for the media
+	Segments(ctx context.Context, media Media) ([]Segment, error)
+}
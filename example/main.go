@@ -47,7 +47,7 @@ func main() {
 	defer discord.Close()
 
 	yt := youtubeapi.NewYoutubeAPI()
-	media, err := yt.GetYoutubeMedia(ytSearchTerm)
+	media, err := yt.GetYoutubeMedia(context.Background(), ytSearchTerm)
 
 	if err != nil {
 		panic(err)
@@ -0,0 +1,406 @@
+package httpapi
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fakelag/streaming-music-bot/discordplayer"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// Feed message type sent on connect & subscribe with the full session state
+	FeedMessageSnapshot = "snapshot"
+	// Feed message type sent periodically with the playback position while playing
+	FeedMessagePosition = "position"
+
+	feedWriteTimeout = 10 * time.Second
+	feedPongTimeout  = 60 * time.Second
+	feedPingInterval = 50 * time.Second
+)
+
+// Message pushed to feed clients. Type is either FeedMessageSnapshot, FeedMessagePosition
+// or one of discordplayer session event types
+type FeedMessage struct {
+	Type    string `json:"type"`
+	GuildID string `json:"guild_id"`
+	// Session state at the time of the message. Omitted from position messages
+	Session         *SessionResponse `json:"session,omitempty"`
+	PositionSeconds *float64         `json:"position_seconds,omitempty"`
+	Paused          *bool            `json:"paused,omitempty"`
+}
+
+// Message read from feed clients to change guild subscriptions
+type FeedSubscribeRequest struct {
+	Subscribe   []string `json:"subscribe"`
+	Unsubscribe []string `json:"unsubscribe"`
+}
+
+type feedClient struct {
+	mutex  sync.RWMutex
+	conn   *websocket.Conn
+	send   chan []byte
+	closed bool
+	// Close frame written after the send channel is closed
+	closeMessage []byte
+	// Subscribed guild ids. Empty subscribes to all guilds
+	guildIDs map[string]bool
+}
+
+type feedHub struct {
+	mutex        sync.RWMutex
+	server       *Server
+	tickInterval time.Duration
+	bufferSize   int
+	upgrader     websocket.Upgrader
+	clients      map[*feedClient]bool
+	// Sessions added to the feed
+	sessions map[*discordplayer.DiscordMusicSession]*feedSubscription
+	running  bool
+}
+
+// Event callbacks can't be removed from a session, so the callback of a removed
+// session is deactivated instead
+type feedSubscription struct {
+	active atomic.Bool
+}
+
+func newFeedHub(server *Server, tickInterval time.Duration, bufferSize int) *feedHub {
+	return &feedHub{
+		server:       server,
+		tickInterval: tickInterval,
+		bufferSize:   bufferSize,
+		upgrader: websocket.Upgrader{
+			// Clients are authenticated with the api token
+			CheckOrigin: func(r *http.Request) bool { return true },
+		},
+		clients:  make(map[*feedClient]bool),
+		sessions: make(map[*discordplayer.DiscordMusicSession]*feedSubscription),
+	}
+}
+
+// Browsers are unable to set headers for websocket requests, so the
+// feed also accepts the token as a query parameter
+func (server *Server) withFeedAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if token := r.URL.Query().Get("token"); token != "" &&
+			subtle.ConstantTimeCompare([]byte(token), server.token) == 1 {
+			next(w, r)
+			return
+		}
+
+		server.withAuth(next)(w, r)
+	}
+}
+
+func (hub *feedHub) handleFeed(w http.ResponseWriter, r *http.Request) {
+	conn, err := hub.upgrader.Upgrade(w, r, nil)
+
+	if err != nil {
+		// Upgrade has already written an error response
+		return
+	}
+
+	client := &feedClient{
+		conn:     conn,
+		send:     make(chan []byte, hub.bufferSize),
+		guildIDs: make(map[string]bool),
+	}
+
+	for _, value := range r.URL.Query()["guild"] {
+		for _, guildID := range parseFeedGuildIDs(value) {
+			client.guildIDs[guildID] = true
+		}
+	}
+
+	hub.addClient(client)
+
+	go hub.writeLoop(client)
+	go hub.readLoop(client)
+
+	hub.sendSnapshots(client)
+}
+
+func (hub *feedHub) addClient(client *feedClient) {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	hub.clients[client] = true
+
+	if !hub.running {
+		hub.running = true
+		go hub.tickLoop()
+	}
+}
+
+func (hub *feedHub) removeClient(client *feedClient) {
+	hub.mutex.Lock()
+	delete(hub.clients, client)
+	hub.mutex.Unlock()
+
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	if !client.closed {
+		client.closed = true
+		client.closeMessage = websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+		close(client.send)
+	}
+}
+
+func (hub *feedHub) readLoop(client *feedClient) {
+	defer hub.removeClient(client)
+
+	client.conn.SetReadLimit(4096)
+	_ = client.conn.SetReadDeadline(time.Now().Add(feedPongTimeout))
+	client.conn.SetPongHandler(func(string) error {
+		return client.conn.SetReadDeadline(time.Now().Add(feedPongTimeout))
+	})
+
+	for {
+		_, message, err := client.conn.ReadMessage()
+
+		if err != nil {
+			return
+		}
+
+		var request FeedSubscribeRequest
+		if err := json.Unmarshal(message, &request); err != nil {
+			continue
+		}
+
+		client.mutex.Lock()
+		for _, guildID := range request.Subscribe {
+			client.guildIDs[guildID] = true
+		}
+		for _, guildID := range request.Unsubscribe {
+			delete(client.guildIDs, guildID)
+		}
+		client.mutex.Unlock()
+
+		if len(request.Subscribe) > 0 {
+			hub.sendSnapshots(client)
+		}
+	}
+}
+
+func (hub *feedHub) writeLoop(client *feedClient) {
+	pingTicker := time.NewTicker(feedPingInterval)
+
+	defer func() {
+		pingTicker.Stop()
+		client.conn.Close()
+	}()
+
+	for {
+		select {
+		case message, ok := <-client.send:
+			_ = client.conn.SetWriteDeadline(time.Now().Add(feedWriteTimeout))
+
+			if !ok {
+				_ = client.conn.WriteMessage(websocket.CloseMessage, client.closeMessage)
+				return
+			}
+
+			if err := client.conn.WriteMessage(websocket.TextMessage, message); err != nil {
+				return
+			}
+		case <-pingTicker.C:
+			_ = client.conn.SetWriteDeadline(time.Now().Add(feedWriteTimeout))
+
+			if err := client.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// Position messages are dropped when the client's send buffer is full. Clients that can't keep up
+// with any other messages are disconnected, as they would otherwise miss state changes
+func (hub *feedHub) sendToClient(client *feedClient, message []byte, droppable bool) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	if client.closed {
+		return
+	}
+
+	select {
+	case client.send <- message:
+		return
+	default:
+		break
+	}
+
+	if droppable {
+		return
+	}
+
+	client.closed = true
+	client.closeMessage = websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "slow consumer")
+	close(client.send)
+
+	go func() {
+		hub.mutex.Lock()
+		delete(hub.clients, client)
+		hub.mutex.Unlock()
+	}()
+}
+
+func (client *feedClient) isSubscribed(guildID string) bool {
+	client.mutex.RLock()
+	defer client.mutex.RUnlock()
+	return len(client.guildIDs) == 0 || client.guildIDs[guildID]
+}
+
+func (hub *feedHub) broadcast(guildID string, message *FeedMessage, droppable bool) {
+	messageBytes, err := json.Marshal(message)
+
+	if err != nil {
+		return
+	}
+
+	hub.mutex.RLock()
+	clients := make([]*feedClient, 0, len(hub.clients))
+	for client := range hub.clients {
+		clients = append(clients, client)
+	}
+	hub.mutex.RUnlock()
+
+	for _, client := range clients {
+		if client.isSubscribed(guildID) {
+			hub.sendToClient(client, messageBytes, droppable)
+		}
+	}
+}
+
+func (hub *feedHub) sendSnapshots(client *feedClient) {
+	for _, session := range hub.getSessions() {
+		if !client.isSubscribed(session.GetGuildID()) {
+			continue
+		}
+
+		messageBytes, err := json.Marshal(&FeedMessage{
+			Type:    FeedMessageSnapshot,
+			GuildID: session.GetGuildID(),
+			Session: newSessionResponse(session),
+		})
+
+		if err != nil {
+			continue
+		}
+
+		hub.sendToClient(client, messageBytes, false)
+	}
+}
+
+// Adds a session to the feed. Call when the session is created so that feed
+// clients receive all of its events
+func (server *Server) AddMusicSession(session *discordplayer.DiscordMusicSession) {
+	server.feed.addSession(session)
+}
+
+// Removes a destroyed session from the feed
+func (server *Server) RemoveMusicSession(session *discordplayer.DiscordMusicSession) {
+	server.feed.removeSession(session)
+}
+
+func (hub *feedHub) addSession(session *discordplayer.DiscordMusicSession) {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	if session == nil || hub.sessions[session] != nil {
+		return
+	}
+
+	subscription := &feedSubscription{}
+	subscription.active.Store(true)
+	hub.sessions[session] = subscription
+
+	session.AddEventCallback(func(session *discordplayer.DiscordMusicSession, event *discordplayer.SessionEvent) {
+		if subscription.active.Load() {
+			hub.onSessionEvent(session, event)
+		}
+	})
+}
+
+func (hub *feedHub) removeSession(session *discordplayer.DiscordMusicSession) {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	if subscription := hub.sessions[session]; subscription != nil {
+		subscription.active.Store(false)
+		delete(hub.sessions, session)
+	}
+}
+
+// Sessions added to the feed
+func (hub *feedHub) getSessions() []*discordplayer.DiscordMusicSession {
+	hub.mutex.RLock()
+	defer hub.mutex.RUnlock()
+
+	sessions := make([]*discordplayer.DiscordMusicSession, 0, len(hub.sessions))
+
+	for session := range hub.sessions {
+		sessions = append(sessions, session)
+	}
+
+	return sessions
+}
+
+func (hub *feedHub) onSessionEvent(session *discordplayer.DiscordMusicSession, event *discordplayer.SessionEvent) {
+	hub.broadcast(session.GetGuildID(), &FeedMessage{
+		Type:    event.Type,
+		GuildID: session.GetGuildID(),
+		Session: newSessionResponse(session),
+	}, false)
+}
+
+// Sends position messages while there are clients connected
+func (hub *feedHub) tickLoop() {
+	ticker := time.NewTicker(hub.tickInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		hub.mutex.Lock()
+		if len(hub.clients) == 0 {
+			hub.running = false
+			hub.mutex.Unlock()
+			return
+		}
+		hub.mutex.Unlock()
+
+		for _, session := range hub.getSessions() {
+			if session.GetCurrentlyPlayingMedia() == nil {
+				continue
+			}
+
+			positionSeconds := session.CurrentPlaybackPosition().Seconds()
+			isPaused, _ := session.IsPaused()
+
+			hub.broadcast(session.GetGuildID(), &FeedMessage{
+				Type:            FeedMessagePosition,
+				GuildID:         session.GetGuildID(),
+				PositionSeconds: &positionSeconds,
+				Paused:          &isPaused,
+			}, true)
+		}
+	}
+}
+
+func parseFeedGuildIDs(value string) []string {
+	guildIDs := make([]string, 0)
+
+	for _, guildID := range strings.Split(value, ",") {
+		if guildID = strings.TrimSpace(guildID); guildID != "" {
+			guildIDs = append(guildIDs, guildID)
+		}
+	}
+
+	return guildIDs
+}
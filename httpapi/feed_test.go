@@ -0,0 +1,151 @@
+package httpapi_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/mock/gomock"
+
+	"github.com/fakelag/streaming-music-bot/discordplayer"
+	. "github.com/fakelag/streaming-music-bot/discordplayer/mocks"
+	"github.com/fakelag/streaming-music-bot/httpapi"
+)
+
+func DialFeed(apiContext *ApiTestContext, query string, header http.Header) (*websocket.Conn, *http.Response, error) {
+	feedURL := "ws" + strings.TrimPrefix(apiContext.server.URL, "http") + "/feed" + query
+	conn, resp, err := websocket.DefaultDialer.Dial(feedURL, header)
+
+	if conn != nil {
+		DeferCleanup(conn.Close)
+	}
+
+	return conn, resp, err
+}
+
+func ReadFeedMessage(conn *websocket.Conn, timeout time.Duration) (*httpapi.FeedMessage, error) {
+	Expect(conn.SetReadDeadline(time.Now().Add(timeout))).To(Succeed())
+
+	var message httpapi.FeedMessage
+	if err := conn.ReadJSON(&message); err != nil {
+		return nil, err
+	}
+
+	return &message, nil
+}
+
+var _ = Describe("HTTP API Feed", func() {
+	It("Requires an api token to connect to the feed", func() {
+		ctrl := gomock.NewController(GinkgoT())
+		apiContext := NewApiTestContext(ctrl, nil)
+
+		_, resp, err := DialFeed(apiContext, "", nil)
+		Expect(err).To(MatchError(websocket.ErrBadHandshake))
+		Expect(resp.StatusCode).To(Equal(http.StatusUnauthorized))
+
+		_, resp, err = DialFeed(apiContext, "?token=wrong-token", nil)
+		Expect(err).To(MatchError(websocket.ErrBadHandshake))
+		Expect(resp.StatusCode).To(Equal(http.StatusUnauthorized))
+
+		conn, _, err := DialFeed(apiContext, "?token="+apiToken, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		message, err := ReadFeedMessage(conn, 5*time.Second)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(message.Type).To(Equal(httpapi.FeedMessageSnapshot))
+	})
+
+	It("Pushes a snapshot on connect and session events afterwards", func() {
+		ctrl := gomock.NewController(GinkgoT())
+		apiContext := NewApiTestContext(ctrl, nil)
+
+		conn, _, err := DialFeed(apiContext, "", http.Header{"Authorization": []string{"Bearer " + apiToken}})
+		Expect(err).NotTo(HaveOccurred())
+
+		message, err := ReadFeedMessage(conn, 5*time.Second)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(message.Type).To(Equal(httpapi.FeedMessageSnapshot))
+		Expect(message.GuildID).To(Equal(gID))
+		Expect(message.Session).NotTo(BeNil())
+		Expect(message.Session.Queue).To(HaveLen(0))
+
+		Expect(apiContext.dms.EnqueueMedia(NewMockYoutubeMedia("Queued Media"))).To(Succeed())
+
+		message, err = ReadFeedMessage(conn, 5*time.Second)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(message.Type).To(Equal(discordplayer.EventQueueChanged))
+		Expect(message.GuildID).To(Equal(gID))
+		Expect(message.Session).NotTo(BeNil())
+		Expect(message.Session.Queue).To(HaveLen(1))
+		Expect(message.Session.Queue[0].Title).To(Equal("Queued Media"))
+	})
+
+	It("Filters messages by guild subscriptions", func() {
+		ctrl := gomock.NewController(GinkgoT())
+		apiContext := NewApiTestContext(ctrl, nil)
+
+		conn, _, err := DialFeed(apiContext, "?guild=other-guild", http.Header{"Authorization": []string{"Bearer " + apiToken}})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(apiContext.dms.EnqueueMedia(NewMockYoutubeMedia("Queued Media"))).To(Succeed())
+
+		_, err = ReadFeedMessage(conn, 500*time.Millisecond)
+		Expect(err).To(HaveOccurred())
+
+		// Read deadline errors are permanent, reconnect to change subscriptions
+		conn, _, err = DialFeed(apiContext, "?guild=other-guild", http.Header{"Authorization": []string{"Bearer " + apiToken}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(conn.WriteJSON(&httpapi.FeedSubscribeRequest{Subscribe: []string{gID}})).To(Succeed())
+
+		message, err := ReadFeedMessage(conn, 5*time.Second)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(message.Type).To(Equal(httpapi.FeedMessageSnapshot))
+		Expect(message.GuildID).To(Equal(gID))
+		Expect(message.Session.Queue).To(HaveLen(1))
+	})
+	It("Pushes events of sessions added after connecting & stops after removal", func() {
+		ctrl := gomock.NewController(GinkgoT())
+		apiContext := NewApiTestContext(ctrl, nil)
+
+		dms, err := discordplayer.NewDiscordMusicSessionEx(context.TODO(), NewMockDiscordAudio(ctrl), NewMockDiscordSession(ctrl), 100*time.Millisecond, &discordplayer.DiscordMusicSessionOptions{
+			GuildID:           "new-guild",
+			VoiceChannelID:    cID,
+			MediaQueueMaxSize: 10,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		conn, _, err := DialFeed(apiContext, "?guild=new-guild", http.Header{"Authorization": []string{"Bearer " + apiToken}})
+		Expect(err).NotTo(HaveOccurred())
+
+		// Added & enqueued before the next position tick
+		apiContext.api.AddMusicSession(dms)
+		apiContext.api.AddMusicSession(dms)
+		Expect(dms.EnqueueMedia(NewMockYoutubeMedia("Queued Media"))).To(Succeed())
+
+		message, err := ReadFeedMessage(conn, 5*time.Second)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(message.Type).To(Equal(discordplayer.EventQueueChanged))
+		Expect(message.GuildID).To(Equal("new-guild"))
+
+		// Adding twice delivers each event once
+		_, err = ReadFeedMessage(conn, 500*time.Millisecond)
+		Expect(err).To(HaveOccurred())
+
+		conn, _, err = DialFeed(apiContext, "?guild=new-guild", http.Header{"Authorization": []string{"Bearer " + apiToken}})
+		Expect(err).NotTo(HaveOccurred())
+
+		message, err = ReadFeedMessage(conn, 5*time.Second)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(message.Type).To(Equal(httpapi.FeedMessageSnapshot))
+
+		apiContext.api.RemoveMusicSession(dms)
+		Expect(dms.EnqueueMedia(NewMockYoutubeMedia("Queued Media"))).To(Succeed())
+
+		_, err = ReadFeedMessage(conn, 500*time.Millisecond)
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,145 @@
+package httpapi
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/fakelag/streaming-music-bot/discordplayer"
+)
+
+func (server *Server) handleListGuilds(w http.ResponseWriter, r *http.Request) {
+	sessions := server.sessions.GetMusicSessions()
+	guilds := make([]GuildResponse, len(sessions))
+
+	for index, session := range sessions {
+		guilds[index] = newGuildResponse(session)
+	}
+
+	writeJSON(w, http.StatusOK, guilds)
+}
+
+func (server *Server) handleGetSession(w http.ResponseWriter, r *http.Request, session *discordplayer.DiscordMusicSession) {
+	writeJSON(w, http.StatusOK, newSessionResponse(session))
+}
+
+func (server *Server) handleGetNowPlaying(w http.ResponseWriter, r *http.Request, session *discordplayer.DiscordMusicSession) {
+	writeJSON(w, http.StatusOK, newNowPlayingResponse(session))
+}
+
+func (server *Server) handleGetQueue(w http.ResponseWriter, r *http.Request, session *discordplayer.DiscordMusicSession) {
+	writeJSON(w, http.StatusOK, newQueueResponse(session.GetMediaQueue()))
+}
+
+func (server *Server) handleGetPlaylist(w http.ResponseWriter, r *http.Request, session *discordplayer.DiscordMusicSession) {
+	playlist := session.GetCurrentPlaylist()
+
+	if playlist == nil {
+		writeError(w, http.StatusNotFound, discordplayer.ErrorNoMediaFound)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newPlaylistResponse(playlist))
+}
+
+func (server *Server) handleEnqueue(w http.ResponseWriter, r *http.Request, session *discordplayer.DiscordMusicSession) {
+	if server.resolveMedia == nil {
+		writeError(w, http.StatusNotImplemented, errors.New("enqueueing is not enabled"))
+		return
+	}
+
+	var request EnqueueRequest
+	if err := readJSON(w, r, &request); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	query := strings.TrimSpace(request.Query)
+
+	if query == "" {
+		writeError(w, http.StatusBadRequest, ErrorInvalidRequest)
+		return
+	}
+
+	media, err := server.resolveMedia(r.Context(), query)
+
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+
+	if err := session.EnqueueMedia(media); err != nil {
+		writeSessionError(w, err)
+		return
+	}
+
+	if !session.IsWorkerActive() {
+		if _, err := session.Start(); err != nil && !errors.Is(err, discordplayer.ErrorWorkerAlreadyActive) {
+			writeSessionError(w, err)
+			return
+		}
+	}
+
+	writeJSON(w, http.StatusCreated, newMediaResponse(media))
+}
+
+func (server *Server) handleClearQueue(w http.ResponseWriter, r *http.Request, session *discordplayer.DiscordMusicSession) {
+	session.ClearMediaQueue()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (server *Server) handleClearPlaylist(w http.ResponseWriter, r *http.Request, session *discordplayer.DiscordMusicSession) {
+	session.ClearPlaylist()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (server *Server) handleSkip(w http.ResponseWriter, r *http.Request, session *discordplayer.DiscordMusicSession) {
+	if err := session.Skip(); err != nil {
+		writeSessionError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (server *Server) handlePause(w http.ResponseWriter, r *http.Request, session *discordplayer.DiscordMusicSession) {
+	var request PauseRequest
+	if err := readJSON(w, r, &request); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := session.SetPaused(request.Paused); err != nil {
+		writeSessionError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (server *Server) handleJump(w http.ResponseWriter, r *http.Request, session *discordplayer.DiscordMusicSession) {
+	var request JumpRequest
+	if err := readJSON(w, r, &request); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	jumpTo := time.Duration(request.PositionSeconds * float64(time.Second))
+
+	if err := session.Jump(jumpTo); err != nil {
+		writeSessionError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (server *Server) handleLeave(w http.ResponseWriter, r *http.Request, session *discordplayer.DiscordMusicSession) {
+	if err := session.Leave(); err != nil {
+		writeSessionError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
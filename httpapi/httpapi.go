@@ -0,0 +1,186 @@
+package httpapi
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/fakelag/streaming-music-bot/discordplayer"
+	"github.com/fakelag/streaming-music-bot/entities"
+)
+
+var (
+	ErrorMissingToken   = errors.New("missing api token")
+	ErrorGuildNotFound  = errors.New("guild not found")
+	ErrorUnauthorized   = errors.New("unauthorized")
+	ErrorInvalidRequest = errors.New("invalid request")
+)
+
+// Resolves a video url or a search term into playable media. ctx is cancelled
+// if the client disconnects before the media is resolved
+type ResolveMediaFunc = func(ctx context.Context, urlOrSearchTerm string) (entities.Media, error)
+
+type SessionManager interface {
+	// Returns nil if there is no session for the guild
+	GetMusicSession(guildID string) *discordplayer.DiscordMusicSession
+	GetMusicSessions() []*discordplayer.DiscordMusicSession
+}
+
+type ServerOptions struct {
+	// Token required in the Authorization header as "Bearer <Token>". Required
+	Token string
+	// Resolver used to enqueue media by url or search. Enqueueing is
+	// disabled if left empty
+	ResolveMedia ResolveMediaFunc
+	// Prefix for all routes, for example "/api". Defaults to ""
+	PathPrefix string
+	// Interval of playback position messages in the websocket feed. Defaults to 1s
+	FeedPositionInterval time.Duration
+	// Number of messages buffered per feed client. Clients falling further behind
+	// are disconnected. Defaults to 64
+	FeedBufferSize int
+}
+
+type Server struct {
+	sessions     SessionManager
+	resolveMedia ResolveMediaFunc
+	token        []byte
+	mux          *http.ServeMux
+	feed         *feedHub
+}
+
+func NewServer(sessions SessionManager, options *ServerOptions) (*Server, error) {
+	if options.Token == "" {
+		return nil, ErrorMissingToken
+	}
+
+	feedPositionInterval := options.FeedPositionInterval
+
+	if feedPositionInterval == 0 {
+		feedPositionInterval = time.Second
+	}
+
+	feedBufferSize := options.FeedBufferSize
+
+	if feedBufferSize == 0 {
+		feedBufferSize = 64
+	}
+
+	server := &Server{
+		sessions:     sessions,
+		resolveMedia: options.ResolveMedia,
+		token:        []byte(options.Token),
+		mux:          http.NewServeMux(),
+	}
+
+	server.feed = newFeedHub(server, feedPositionInterval, feedBufferSize)
+
+	prefix := strings.TrimSuffix(options.PathPrefix, "/")
+
+	routes := map[string]http.HandlerFunc{
+		"GET /guilds":                       server.handleListGuilds,
+		"GET /guilds/{guildID}":             server.withSession(server.handleGetSession),
+		"GET /guilds/{guildID}/nowplaying":  server.withSession(server.handleGetNowPlaying),
+		"GET /guilds/{guildID}/queue":       server.withSession(server.handleGetQueue),
+		"POST /guilds/{guildID}/queue":      server.withSession(server.handleEnqueue),
+		"DELETE /guilds/{guildID}/queue":    server.withSession(server.handleClearQueue),
+		"GET /guilds/{guildID}/playlist":    server.withSession(server.handleGetPlaylist),
+		"DELETE /guilds/{guildID}/playlist": server.withSession(server.handleClearPlaylist),
+		"POST /guilds/{guildID}/skip":       server.withSession(server.handleSkip),
+		"POST /guilds/{guildID}/pause":      server.withSession(server.handlePause),
+		"POST /guilds/{guildID}/jump":       server.withSession(server.handleJump),
+		"POST /guilds/{guildID}/leave":      server.withSession(server.handleLeave),
+	}
+
+	for pattern, handler := range routes {
+		method, path, _ := strings.Cut(pattern, " ")
+		server.mux.Handle(method+" "+prefix+path, server.withAuth(handler))
+	}
+
+	server.mux.Handle("GET "+prefix+"/feed", server.withFeedAuth(server.feed.handleFeed))
+
+	return server, nil
+}
+
+func (server *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	server.mux.ServeHTTP(w, r)
+}
+
+func (server *Server) withAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+		if !ok || subtle.ConstantTimeCompare([]byte(token), server.token) != 1 {
+			writeError(w, http.StatusUnauthorized, ErrorUnauthorized)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+func (server *Server) withSession(
+	next func(w http.ResponseWriter, r *http.Request, session *discordplayer.DiscordMusicSession),
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session := server.sessions.GetMusicSession(r.PathValue("guildID"))
+
+		if session == nil {
+			writeError(w, http.StatusNotFound, ErrorGuildNotFound)
+			return
+		}
+
+		next(w, r, session)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, &ErrorResponse{Error: err.Error()})
+}
+
+func writeSessionError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+
+	switch {
+	case errors.Is(err, discordplayer.ErrorInvalidArgument),
+		errors.Is(err, discordplayer.ErrorInvalidMedia):
+		status = http.StatusBadRequest
+	case errors.Is(err, discordplayer.ErrorNoMediaFound):
+		status = http.StatusNotFound
+	case errors.Is(err, discordplayer.ErrorMediaUnsupportedFeature):
+		status = http.StatusUnprocessableEntity
+	case errors.Is(err, discordplayer.ErrorWorkerNotActive),
+		errors.Is(err, discordplayer.ErrorWorkerAlreadyActive),
+		errors.Is(err, discordplayer.ErrorNotStreaming),
+		errors.Is(err, discordplayer.ErrorCommandAlreadySent),
+		errors.Is(err, discordplayer.ErrorMediaQueueFull),
+		errors.Is(err, discordplayer.ErrorNoVoiceChannelSet):
+		status = http.StatusConflict
+	}
+
+	writeError(w, status, err)
+}
+
+// Largest request body accepted, bodies are small commands
+const maxRequestBodyBytes = 64 * 1024
+
+func readJSON(w http.ResponseWriter, r *http.Request, body interface{}) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBodyBytes))
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(body); err != nil {
+		return ErrorInvalidRequest
+	}
+
+	return nil
+}
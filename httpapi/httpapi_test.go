@@ -0,0 +1,322 @@
+package httpapi_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/mock/gomock"
+
+	"github.com/fakelag/streaming-music-bot/discordplayer"
+	. "github.com/fakelag/streaming-music-bot/discordplayer/mocks"
+	"github.com/fakelag/streaming-music-bot/entities"
+	"github.com/fakelag/streaming-music-bot/httpapi"
+	"github.com/fakelag/streaming-music-bot/youtubeapi"
+)
+
+const (
+	gID      = "xxx-guild-id"
+	cID      = "xxx-channel-id"
+	apiToken = "secret-token"
+)
+
+type MockSessionManager struct {
+	sync.RWMutex
+	sessions map[string]*discordplayer.DiscordMusicSession
+}
+
+func (msm *MockSessionManager) GetMusicSession(guildID string) *discordplayer.DiscordMusicSession {
+	msm.RLock()
+	defer msm.RUnlock()
+	return msm.sessions[guildID]
+}
+
+func (msm *MockSessionManager) GetMusicSessions() []*discordplayer.DiscordMusicSession {
+	msm.RLock()
+	defer msm.RUnlock()
+
+	sessions := make([]*discordplayer.DiscordMusicSession, 0, len(msm.sessions))
+	for _, session := range msm.sessions {
+		sessions = append(sessions, session)
+	}
+	return sessions
+}
+
+func NewMockYoutubeMedia(title string) *youtubeapi.YoutubeMedia {
+	return &youtubeapi.YoutubeMedia{
+		ID:            "123",
+		VideoTitle:    title,
+		VideoLink:     "https://www.youtube.com/watch?v=123",
+		VideoDuration: 90 * time.Second,
+		StreamURL:     "streamurl",
+	}
+}
+
+type ApiTestContext struct {
+	server             *httptest.Server
+	api                *httpapi.Server
+	dms                *discordplayer.DiscordMusicSession
+	mockDiscordSession *MockDiscordSession
+}
+
+func NewApiTestContext(ctrl *gomock.Controller, resolveMedia httpapi.ResolveMediaFunc) *ApiTestContext {
+	mockDca := NewMockDiscordAudio(ctrl)
+	mockDiscordSession := NewMockDiscordSession(ctrl)
+
+	dms, err := discordplayer.NewDiscordMusicSessionEx(context.TODO(), mockDca, mockDiscordSession, 100*time.Millisecond, &discordplayer.DiscordMusicSessionOptions{
+		GuildID:           gID,
+		VoiceChannelID:    cID,
+		MediaQueueMaxSize: 10,
+	})
+	Expect(err).NotTo(HaveOccurred())
+
+	sessionManager := &MockSessionManager{
+		sessions: map[string]*discordplayer.DiscordMusicSession{gID: dms},
+	}
+
+	api, err := httpapi.NewServer(sessionManager, &httpapi.ServerOptions{
+		Token:        apiToken,
+		ResolveMedia: resolveMedia,
+	})
+	Expect(err).NotTo(HaveOccurred())
+	api.AddMusicSession(dms)
+
+	server := httptest.NewServer(api)
+	DeferCleanup(server.Close)
+
+	return &ApiTestContext{
+		server:             server,
+		api:                api,
+		dms:                dms,
+		mockDiscordSession: mockDiscordSession,
+	}
+}
+
+func (atc *ApiTestContext) Request(method string, path string, body string) (int, string) {
+	var bodyReader io.Reader
+	if body != "" {
+		bodyReader = strings.NewReader(body)
+	}
+
+	req, err := http.NewRequest(method, atc.server.URL+path, bodyReader)
+	Expect(err).NotTo(HaveOccurred())
+	req.Header.Set("Authorization", "Bearer "+apiToken)
+
+	resp, err := http.DefaultClient.Do(req)
+	Expect(err).NotTo(HaveOccurred())
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	Expect(err).NotTo(HaveOccurred())
+
+	return resp.StatusCode, string(respBody)
+}
+
+var _ = Describe("HTTP API", func() {
+	It("Requires an api token", func() {
+		_, err := httpapi.NewServer(&MockSessionManager{}, &httpapi.ServerOptions{})
+		Expect(err).To(MatchError(httpapi.ErrorMissingToken))
+
+		ctrl := gomock.NewController(GinkgoT())
+		apiContext := NewApiTestContext(ctrl, nil)
+
+		resp, err := http.Get(apiContext.server.URL + "/guilds")
+		Expect(err).NotTo(HaveOccurred())
+		resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusUnauthorized))
+
+		req, err := http.NewRequest(http.MethodGet, apiContext.server.URL+"/guilds", nil)
+		Expect(err).NotTo(HaveOccurred())
+		req.Header.Set("Authorization", "Bearer wrong-token")
+
+		resp, err = http.DefaultClient.Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusUnauthorized))
+
+		status, _ := apiContext.Request(http.MethodGet, "/guilds", "")
+		Expect(status).To(Equal(http.StatusOK))
+	})
+
+	It("Lists guilds and returns the state of a session", func() {
+		ctrl := gomock.NewController(GinkgoT())
+		apiContext := NewApiTestContext(ctrl, nil)
+
+		status, body := apiContext.Request(http.MethodGet, "/guilds", "")
+		Expect(status).To(Equal(http.StatusOK))
+
+		var guilds []httpapi.GuildResponse
+		Expect(json.Unmarshal([]byte(body), &guilds)).To(Succeed())
+		Expect(guilds).To(HaveLen(1))
+		Expect(guilds[0].GuildID).To(Equal(gID))
+		Expect(guilds[0].VoiceChannelID).To(Equal(cID))
+		Expect(guilds[0].WorkerActive).To(BeFalse())
+
+		status, _ = apiContext.Request(http.MethodGet, "/guilds/unknown-guild", "")
+		Expect(status).To(Equal(http.StatusNotFound))
+
+		Expect(apiContext.dms.EnqueueMedia(NewMockYoutubeMedia("Queued Media"))).To(Succeed())
+
+		status, body = apiContext.Request(http.MethodGet, "/guilds/"+gID, "")
+		Expect(status).To(Equal(http.StatusOK))
+
+		var session httpapi.SessionResponse
+		Expect(json.Unmarshal([]byte(body), &session)).To(Succeed())
+		Expect(session.GuildID).To(Equal(gID))
+		Expect(session.NowPlaying.Media).To(BeNil())
+		Expect(session.NowPlaying.Paused).To(BeFalse())
+		Expect(session.Playlist).To(BeNil())
+		Expect(session.Queue).To(HaveLen(1))
+		Expect(session.Queue[0].Title).To(Equal("Queued Media"))
+		Expect(session.Queue[0].DurationSeconds).NotTo(BeNil())
+		Expect(*session.Queue[0].DurationSeconds).To(Equal(90.0))
+
+		status, body = apiContext.Request(http.MethodGet, "/guilds/"+gID+"/nowplaying", "")
+		Expect(status).To(Equal(http.StatusOK))
+
+		var nowPlaying httpapi.NowPlayingResponse
+		Expect(json.Unmarshal([]byte(body), &nowPlaying)).To(Succeed())
+		Expect(nowPlaying.Media).To(BeNil())
+		Expect(nowPlaying.PositionSeconds).To(Equal(0.0))
+	})
+
+	It("Returns and clears the queue and the playlist", func() {
+		ctrl := gomock.NewController(GinkgoT())
+		apiContext := NewApiTestContext(ctrl, nil)
+
+		status, _ := apiContext.Request(http.MethodGet, "/guilds/"+gID+"/playlist", "")
+		Expect(status).To(Equal(http.StatusNotFound))
+
+		rng := rand.New(rand.NewSource(GinkgoRandomSeed()))
+		mediaList := []*youtubeapi.YoutubeMedia{NewMockYoutubeMedia("Media 1"), NewMockYoutubeMedia("Media 2")}
+		apiContext.dms.SetPlaylist(youtubeapi.NewYoutubePlaylist("1", "Mock Playlist", "listurl", rng, len(mediaList), mediaList...))
+
+		queuedMedia := NewMockYoutubeMedia("Queued Media 1")
+		queuedMedia.ChannelName = "Mock Artist - Topic"
+		queuedMedia.MusicAlbum = "Mock Album"
+		queuedMedia.VideoChapters = []entities.Chapter{
+			{Title: "Intro", Start: 0, End: 30 * time.Second},
+			{Title: "Outro", Start: 30 * time.Second, End: 90 * time.Second},
+		}
+
+		Expect(apiContext.dms.EnqueueMedia(queuedMedia)).To(Succeed())
+		Expect(apiContext.dms.EnqueueMedia(NewMockYoutubeMedia("Queued Media 2"))).To(Succeed())
+
+		status, body := apiContext.Request(http.MethodGet, "/guilds/"+gID+"/playlist", "")
+		Expect(status).To(Equal(http.StatusOK))
+
+		var playlist httpapi.PlaylistResponse
+		Expect(json.Unmarshal([]byte(body), &playlist)).To(Succeed())
+		Expect(playlist.Title).To(Equal("Mock Playlist"))
+		Expect(playlist.MediaCount).To(Equal(2))
+		Expect(playlist.ConsumeOrder).To(Equal(entities.ConsumeOrderFromStart))
+		Expect(*playlist.DurationLeftSeconds).To(Equal(180.0))
+
+		status, body = apiContext.Request(http.MethodGet, "/guilds/"+gID+"/queue", "")
+		Expect(status).To(Equal(http.StatusOK))
+
+		var queue []httpapi.MediaResponse
+		Expect(json.Unmarshal([]byte(body), &queue)).To(Succeed())
+		Expect(queue).To(HaveLen(2))
+		Expect(queue[0].Title).To(Equal("Queued Media 1"))
+		Expect(queue[1].Title).To(Equal("Queued Media 2"))
+		Expect(queue[0].Artist).To(Equal("Mock Artist"))
+		Expect(queue[0].Album).To(Equal("Mock Album"))
+		Expect(queue[0].Chapters).To(HaveLen(2))
+		Expect(*queue[0].Chapters[1]).To(Equal(httpapi.ChapterResponse{Title: "Outro", StartSeconds: 30, EndSeconds: 90}))
+		Expect(queue[1].Artist).To(BeEmpty())
+		Expect(queue[1].Chapters).To(BeNil())
+
+		status, _ = apiContext.Request(http.MethodDelete, "/guilds/"+gID+"/queue", "")
+		Expect(status).To(Equal(http.StatusNoContent))
+		Expect(apiContext.dms.GetMediaQueue()).To(HaveLen(0))
+
+		status, _ = apiContext.Request(http.MethodDelete, "/guilds/"+gID+"/playlist", "")
+		Expect(status).To(Equal(http.StatusNoContent))
+		Expect(apiContext.dms.GetCurrentPlaylist()).To(BeNil())
+	})
+
+	It("Returns sensible errors for commands when the worker is not active", func() {
+		ctrl := gomock.NewController(GinkgoT())
+		apiContext := NewApiTestContext(ctrl, nil)
+
+		status, body := apiContext.Request(http.MethodPost, "/guilds/"+gID+"/skip", "")
+		Expect(status).To(Equal(http.StatusConflict))
+		Expect(body).To(ContainSubstring(discordplayer.ErrorWorkerNotActive.Error()))
+
+		status, _ = apiContext.Request(http.MethodPost, "/guilds/"+gID+"/leave", "")
+		Expect(status).To(Equal(http.StatusConflict))
+
+		status, _ = apiContext.Request(http.MethodPost, "/guilds/"+gID+"/pause", `{"paused": true}`)
+		Expect(status).To(Equal(http.StatusConflict))
+
+		status, _ = apiContext.Request(http.MethodPost, "/guilds/"+gID+"/pause", `{"foo": true}`)
+		Expect(status).To(Equal(http.StatusBadRequest))
+
+		status, _ = apiContext.Request(http.MethodPost, "/guilds/"+gID+"/jump", `{"position_seconds": 30}`)
+		Expect(status).To(Equal(http.StatusNotFound))
+
+		status, _ = apiContext.Request(http.MethodPost, "/guilds/"+gID+"/jump", `{`)
+		Expect(status).To(Equal(http.StatusBadRequest))
+
+		status, _ = apiContext.Request(http.MethodPost, "/guilds/"+gID+"/queue", `{"query": "foo"}`)
+		Expect(status).To(Equal(http.StatusNotImplemented))
+	})
+
+	It("Enqueues media by url or search and starts the worker", func() {
+		ctrl := gomock.NewController(GinkgoT())
+
+		resolvedQueries := make(chan string, 2)
+		apiContext := NewApiTestContext(ctrl, func(ctx context.Context, urlOrSearchTerm string) (entities.Media, error) {
+			resolvedQueries <- urlOrSearchTerm
+
+			if urlOrSearchTerm == "fail" {
+				return nil, errors.New("resolve failed")
+			}
+
+			return NewMockYoutubeMedia("Resolved Media"), nil
+		})
+
+		apiContext.mockDiscordSession.EXPECT().
+			ChannelVoiceJoin(gID, cID, false, false).
+			Return(nil, errors.New("no voice in tests")).
+			AnyTimes()
+
+		status, _ := apiContext.Request(http.MethodPost, "/guilds/"+gID+"/queue", `{"query": "  "}`)
+		Expect(status).To(Equal(http.StatusBadRequest))
+
+		// Bodies are read up to a limit
+		status, _ = apiContext.Request(http.MethodPost, "/guilds/"+gID+"/queue", `{"query": "`+strings.Repeat("a", 128*1024)+`"}`)
+		Expect(status).To(Equal(http.StatusBadRequest))
+
+		status, body := apiContext.Request(http.MethodPost, "/guilds/"+gID+"/queue", `{"query": "fail"}`)
+		Expect(status).To(Equal(http.StatusBadGateway))
+		Expect(body).To(ContainSubstring("resolve failed"))
+		Expect(<-resolvedQueries).To(Equal("fail"))
+
+		status, body = apiContext.Request(http.MethodPost, "/guilds/"+gID+"/queue", `{"query": "lofi beats"}`)
+		Expect(status).To(Equal(http.StatusCreated))
+		Expect(<-resolvedQueries).To(Equal("lofi beats"))
+
+		var media httpapi.MediaResponse
+		Expect(json.Unmarshal([]byte(body), &media)).To(Succeed())
+		Expect(media.Title).To(Equal("Resolved Media"))
+		Expect(apiContext.dms.IsWorkerActive()).To(BeTrue())
+
+		status, _ = apiContext.Request(http.MethodPost, "/guilds/"+gID+"/leave", "")
+		Expect(status).To(Equal(http.StatusNoContent))
+
+		Eventually(func() bool {
+			return apiContext.dms.IsWorkerActive()
+		}).WithTimeout(5 * time.Second).WithPolling(50 * time.Millisecond).Should(BeFalse())
+	})
+})
@@ -0,0 +1,165 @@
+package httpapi
+
+import (
+	"github.com/fakelag/streaming-music-bot/discordplayer"
+	"github.com/fakelag/streaming-music-bot/entities"
+)
+
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+type MediaResponse struct {
+	Title        string `json:"title"`
+	Link         string `json:"link"`
+	Thumbnail    string `json:"thumbnail"`
+	IsLiveStream bool   `json:"is_live_stream"`
+	// Null for livestreams
+	DurationSeconds *float64 `json:"duration_seconds"`
+	// Omitted if unknown or the media does not implement entities.MediaMetadata
+	Artist   string             `json:"artist,omitempty"`
+	Album    string             `json:"album,omitempty"`
+	Chapters []*ChapterResponse `json:"chapters,omitempty"`
+}
+
+type ChapterResponse struct {
+	Title        string  `json:"title"`
+	StartSeconds float64 `json:"start_seconds"`
+	EndSeconds   float64 `json:"end_seconds"`
+}
+
+type PlaylistResponse struct {
+	Title      string `json:"title"`
+	Link       string `json:"link"`
+	MediaCount int    `json:"media_count"`
+	// Null if the duration is unknown
+	DurationLeftSeconds *float64                      `json:"duration_left_seconds"`
+	ConsumeOrder        entities.PlaylistConsumeOrder `json:"consume_order"`
+	RemoveOnConsume     bool                          `json:"remove_on_consume"`
+}
+
+type NowPlayingResponse struct {
+	// Null if nothing is currently playing
+	Media           *MediaResponse `json:"media"`
+	PositionSeconds float64        `json:"position_seconds"`
+	Paused          bool           `json:"paused"`
+}
+
+type GuildResponse struct {
+	GuildID        string `json:"guild_id"`
+	VoiceChannelID string `json:"voice_channel_id"`
+	WorkerActive   bool   `json:"worker_active"`
+}
+
+type SessionResponse struct {
+	GuildResponse
+	NowPlaying NowPlayingResponse `json:"now_playing"`
+	Queue      []*MediaResponse   `json:"queue"`
+	// Null if no playlist is set
+	Playlist *PlaylistResponse `json:"playlist"`
+}
+
+type EnqueueRequest struct {
+	// Video url or a search term
+	Query string `json:"query"`
+}
+
+type PauseRequest struct {
+	Paused bool `json:"paused"`
+}
+
+type JumpRequest struct {
+	PositionSeconds float64 `json:"position_seconds"`
+}
+
+func newMediaResponse(media entities.Media) *MediaResponse {
+	if media == nil {
+		return nil
+	}
+
+	response := &MediaResponse{
+		Title:        media.Title(),
+		Link:         media.Link(),
+		Thumbnail:    media.Thumbnail(),
+		IsLiveStream: media.IsLiveStream(),
+	}
+
+	if duration := media.Duration(); duration != nil {
+		durationSeconds := duration.Seconds()
+		response.DurationSeconds = &durationSeconds
+	}
+
+	if metadata, ok := media.(entities.MediaMetadata); ok {
+		response.Artist = metadata.Artist()
+		response.Album = metadata.Album()
+
+		for _, chapter := range metadata.Chapters() {
+			response.Chapters = append(response.Chapters, &ChapterResponse{
+				Title:        chapter.Title,
+				StartSeconds: chapter.Start.Seconds(),
+				EndSeconds:   chapter.End.Seconds(),
+			})
+		}
+	}
+
+	return response
+}
+
+func newPlaylistResponse(playlist entities.Playlist) *PlaylistResponse {
+	if playlist == nil {
+		return nil
+	}
+
+	response := &PlaylistResponse{
+		Title:           playlist.Title(),
+		Link:            playlist.Link(),
+		MediaCount:      playlist.GetMediaCount(),
+		ConsumeOrder:    playlist.GetConsumeOrder(),
+		RemoveOnConsume: playlist.GetRemoveOnConsume(),
+	}
+
+	if durationLeft := playlist.GetDurationLeft(); durationLeft != nil {
+		durationLeftSeconds := durationLeft.Seconds()
+		response.DurationLeftSeconds = &durationLeftSeconds
+	}
+
+	return response
+}
+
+func newQueueResponse(mediaQueue []entities.Media) []*MediaResponse {
+	queue := make([]*MediaResponse, len(mediaQueue))
+
+	for index, media := range mediaQueue {
+		queue[index] = newMediaResponse(media)
+	}
+
+	return queue
+}
+
+func newNowPlayingResponse(session *discordplayer.DiscordMusicSession) NowPlayingResponse {
+	// Paused returns an error when not streaming, which is reported as not paused
+	isPaused, _ := session.IsPaused()
+
+	return NowPlayingResponse{
+		Media:           newMediaResponse(session.GetCurrentlyPlayingMedia()),
+		PositionSeconds: session.CurrentPlaybackPosition().Seconds(),
+		Paused:          isPaused,
+	}
+}
+
+func newGuildResponse(session *discordplayer.DiscordMusicSession) GuildResponse {
+	return GuildResponse{
+		GuildID:        session.GetGuildID(),
+		VoiceChannelID: session.GetVoiceChannelID(),
+		WorkerActive:   session.IsWorkerActive(),
+	}
+}
+
+func newSessionResponse(session *discordplayer.DiscordMusicSession) *SessionResponse {
+	return &SessionResponse{
+		GuildResponse: newGuildResponse(session),
+		NowPlaying:    newNowPlayingResponse(session),
+		Queue:         newQueueResponse(session.GetMediaQueue()),
+		Playlist:      newPlaylistResponse(session.GetCurrentPlaylist()),
+	}
+}
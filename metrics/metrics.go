@@ -0,0 +1,60 @@
+package metrics
+
+import "time"
+
+type PlaybackErrorKind = string
+
+const (
+	// Failed to join or reconnect to the voice channel
+	PlaybackErrorVoice PlaybackErrorKind = "voice"
+	// Media failed to load (Media.EnsureLoaded)
+	PlaybackErrorLoad PlaybackErrorKind = "load"
+	// Failed to start the encoding session
+	PlaybackErrorEncode PlaybackErrorKind = "encode"
+	// Streaming ended with an error
+	PlaybackErrorStream PlaybackErrorKind = "stream"
+)
+
+type YtDlpResult = string
+
+const (
+	YtDlpResultSuccess YtDlpResult = "success"
+	YtDlpResultTimeout YtDlpResult = "timeout"
+	YtDlpResultFailure YtDlpResult = "failure"
+)
+
+// Metrics receives measurements from music sessions, voice workers and the youtube api.
+// Implementations must be safe for concurrent use
+type Metrics interface {
+	// Voice worker started in a guild
+	SessionStarted(guildID string)
+	// Voice worker exited in a guild
+	SessionEnded(guildID string)
+	// New media started playing. Not called when the same media is reloaded
+	TrackPlayed(guildID string)
+	PlaybackError(guildID string, kind PlaybackErrorKind)
+	// Voice connection was lost and is being rejoined
+	VoiceReconnect(guildID string)
+	// Media was reloaded because its FileURL was about to expire
+	StreamURLReload(guildID string)
+	// Time taken to start an encoding or Opus passthrough session for media
+	EncodeStartup(guildID string, latency time.Duration)
+	QueueLength(guildID string, length int)
+	// A yt-dlp invocation finished
+	YtDlpCall(latency time.Duration, result YtDlpResult)
+}
+
+type NoopMetrics struct{}
+
+func (nm *NoopMetrics) SessionStarted(guildID string)                        {}
+func (nm *NoopMetrics) SessionEnded(guildID string)                          {}
+func (nm *NoopMetrics) TrackPlayed(guildID string)                           {}
+func (nm *NoopMetrics) PlaybackError(guildID string, kind PlaybackErrorKind) {}
+func (nm *NoopMetrics) VoiceReconnect(guildID string)                        {}
+func (nm *NoopMetrics) StreamURLReload(guildID string)                       {}
+func (nm *NoopMetrics) EncodeStartup(guildID string, latency time.Duration)  {}
+func (nm *NoopMetrics) QueueLength(guildID string, length int)               {}
+func (nm *NoopMetrics) YtDlpCall(latency time.Duration, result YtDlpResult)  {}
+
+// Verify implements Metrics
+var _ Metrics = (*NoopMetrics)(nil)
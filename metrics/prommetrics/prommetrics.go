@@ -0,0 +1,135 @@
+package prommetrics
+
+import (
+	"time"
+
+	"github.com/fakelag/streaming-music-bot/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type PrometheusMetrics struct {
+	activeSessions     prometheus.Gauge
+	tracksPlayed       prometheus.Counter
+	playbackErrors     *prometheus.CounterVec
+	voiceReconnects    prometheus.Counter
+	streamURLReloads   prometheus.Counter
+	encodeStartup      prometheus.Histogram
+	queueLength        *prometheus.GaugeVec
+	ytDlpCalls         *prometheus.CounterVec
+	ytDlpCallDurations *prometheus.HistogramVec
+}
+
+// Creates the collectors and registers them to the given registerer, such as
+// prometheus.DefaultRegisterer. Namespace is prefixed to all metric names
+func NewPrometheusMetrics(registerer prometheus.Registerer, namespace string) (*PrometheusMetrics, error) {
+	pm := &PrometheusMetrics{
+		activeSessions: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "active_sessions",
+			Help:      "Number of music sessions with an active voice worker.",
+		}),
+		tracksPlayed: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "tracks_played_total",
+			Help:      "Number of media started, excluding reloads of the same media.",
+		}),
+		playbackErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "playback_errors_total",
+			Help:      "Number of playback errors by kind.",
+		}, []string{"kind"}),
+		voiceReconnects: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "voice_reconnects_total",
+			Help:      "Number of times a lost voice connection was rejoined.",
+		}),
+		streamURLReloads: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "stream_url_reloads_total",
+			Help:      "Number of media reloads due to an expiring stream url.",
+		}),
+		encodeStartup: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "encode_startup_seconds",
+			Help:      "Time taken to start an encoding session.",
+			Buckets:   []float64{0.1, 0.25, 0.5, 1, 2, 5, 10},
+		}),
+		queueLength: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "queue_length",
+			Help:      "Number of media in the queue of a guild.",
+		}, []string{"guild_id"}),
+		ytDlpCalls: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "ytdlp_calls_total",
+			Help:      "Number of yt-dlp invocations by result.",
+		}, []string{"result"}),
+		ytDlpCallDurations: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "ytdlp_call_duration_seconds",
+			Help:      "Duration of yt-dlp invocations by result.",
+			Buckets:   []float64{0.25, 0.5, 1, 2, 5, 10, 30},
+		}, []string{"result"}),
+	}
+
+	collectors := []prometheus.Collector{
+		pm.activeSessions,
+		pm.tracksPlayed,
+		pm.playbackErrors,
+		pm.voiceReconnects,
+		pm.streamURLReloads,
+		pm.encodeStartup,
+		pm.queueLength,
+		pm.ytDlpCalls,
+		pm.ytDlpCallDurations,
+	}
+
+	for _, collector := range collectors {
+		if err := registerer.Register(collector); err != nil {
+			return nil, err
+		}
+	}
+
+	return pm, nil
+}
+
+func (pm *PrometheusMetrics) SessionStarted(guildID string) {
+	pm.activeSessions.Inc()
+}
+
+func (pm *PrometheusMetrics) SessionEnded(guildID string) {
+	pm.activeSessions.Dec()
+	pm.queueLength.DeleteLabelValues(guildID)
+}
+
+func (pm *PrometheusMetrics) TrackPlayed(guildID string) {
+	pm.tracksPlayed.Inc()
+}
+
+func (pm *PrometheusMetrics) PlaybackError(guildID string, kind metrics.PlaybackErrorKind) {
+	pm.playbackErrors.WithLabelValues(kind).Inc()
+}
+
+func (pm *PrometheusMetrics) VoiceReconnect(guildID string) {
+	pm.voiceReconnects.Inc()
+}
+
+func (pm *PrometheusMetrics) StreamURLReload(guildID string) {
+	pm.streamURLReloads.Inc()
+}
+
+func (pm *PrometheusMetrics) EncodeStartup(guildID string, latency time.Duration) {
+	pm.encodeStartup.Observe(latency.Seconds())
+}
+
+func (pm *PrometheusMetrics) QueueLength(guildID string, length int) {
+	pm.queueLength.WithLabelValues(guildID).Set(float64(length))
+}
+
+func (pm *PrometheusMetrics) YtDlpCall(latency time.Duration, result metrics.YtDlpResult) {
+	pm.ytDlpCalls.WithLabelValues(result).Inc()
+	pm.ytDlpCallDurations.WithLabelValues(result).Observe(latency.Seconds())
+}
+
+// Verify implements metrics.Metrics
+var _ metrics.Metrics = (*PrometheusMetrics)(nil)
@@ -0,0 +1,78 @@
+package prommetrics_test
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/fakelag/streaming-music-bot/metrics"
+	"github.com/fakelag/streaming-music-bot/metrics/prommetrics"
+)
+
+var _ = Describe("Prometheus metrics", func() {
+	It("Records measurements to prometheus collectors", func() {
+		registry := prometheus.NewRegistry()
+
+		pm, err := prommetrics.NewPrometheusMetrics(registry, "musicbot")
+		Expect(err).NotTo(HaveOccurred())
+
+		pm.SessionStarted("guild1")
+		pm.SessionStarted("guild2")
+		pm.TrackPlayed("guild1")
+		pm.PlaybackError("guild1", metrics.PlaybackErrorLoad)
+		pm.PlaybackError("guild2", metrics.PlaybackErrorLoad)
+		pm.VoiceReconnect("guild1")
+		pm.StreamURLReload("guild1")
+		pm.EncodeStartup("guild1", 300*time.Millisecond)
+		pm.QueueLength("guild1", 3)
+		pm.QueueLength("guild2", 5)
+		pm.YtDlpCall(2*time.Second, metrics.YtDlpResultSuccess)
+		pm.YtDlpCall(30*time.Second, metrics.YtDlpResultTimeout)
+
+		Expect(testutil.GatherAndCount(registry, "musicbot_active_sessions")).To(Equal(1))
+		Expect(testutil.GatherAndCount(registry, "musicbot_queue_length")).To(Equal(2))
+		Expect(testutil.GatherAndCount(registry, "musicbot_ytdlp_calls_total")).To(Equal(2))
+		Expect(testutil.GatherAndCount(registry, "musicbot_encode_startup_seconds")).To(Equal(1))
+
+		pm.SessionEnded("guild2")
+
+		Expect(testutil.GatherAndCount(registry, "musicbot_queue_length")).To(Equal(1))
+
+		families, err := registry.Gather()
+		Expect(err).NotTo(HaveOccurred())
+
+		values := make(map[string]float64)
+		for _, family := range families {
+			for _, metric := range family.GetMetric() {
+				if metric.GetCounter() != nil {
+					values[family.GetName()] += metric.GetCounter().GetValue()
+				}
+				if metric.GetGauge() != nil {
+					values[family.GetName()] += metric.GetGauge().GetValue()
+				}
+			}
+		}
+
+		Expect(values).To(HaveKeyWithValue("musicbot_active_sessions", 1.0))
+		Expect(values).To(HaveKeyWithValue("musicbot_tracks_played_total", 1.0))
+		Expect(values).To(HaveKeyWithValue("musicbot_playback_errors_total", 2.0))
+		Expect(values).To(HaveKeyWithValue("musicbot_voice_reconnects_total", 1.0))
+		Expect(values).To(HaveKeyWithValue("musicbot_stream_url_reloads_total", 1.0))
+		Expect(values).To(HaveKeyWithValue("musicbot_queue_length", 3.0))
+		Expect(values).To(HaveKeyWithValue("musicbot_ytdlp_calls_total", 2.0))
+	})
+
+	It("Fails to register the collectors twice", func() {
+		registry := prometheus.NewRegistry()
+
+		_, err := prommetrics.NewPrometheusMetrics(registry, "musicbot")
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = prommetrics.NewPrometheusMetrics(registry, "musicbot")
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,83 @@
+package opusdemux
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+var (
+	ErrorUnsupportedContainer     = errors.New("unsupported container")
+	ErrorNoOpusTrack              = errors.New("no opus track found")
+	ErrorInvalidData              = errors.New("invalid container data")
+	ErrorUnsupportedFrameDuration = errors.New("unsupported opus frame duration")
+)
+
+// Reads Opus packets from a container one at a time, without decoding them
+type PacketReader interface {
+	// Returns io.EOF once all packets have been read
+	ReadPacket() ([]byte, error)
+}
+
+// Returns true if packets can be demuxed from the container, such as "webm" or "ogg"
+func IsSupportedContainer(container string) bool {
+	switch strings.ToLower(container) {
+	case "webm", "ogg", "opus":
+		return true
+	default:
+		return false
+	}
+}
+
+// Returns a reader for the Opus packets of a WebM ("webm") or Ogg ("ogg", "opus") container
+func NewPacketReader(r io.Reader, container string) (PacketReader, error) {
+	switch strings.ToLower(container) {
+	case "webm":
+		return NewWebMReader(r), nil
+	case "ogg", "opus":
+		return NewOggReader(r), nil
+	default:
+		return nil, ErrorUnsupportedContainer
+	}
+}
+
+// Duration of the audio in an Opus packet, decoded from its TOC byte (RFC 6716, section 3.1)
+func PacketDuration(packet []byte) (time.Duration, error) {
+	if len(packet) < 1 {
+		return 0, ErrorInvalidData
+	}
+
+	toc := packet[0]
+	config := toc >> 3
+
+	var frameDuration time.Duration
+
+	switch {
+	case config < 12:
+		// SILK-only: 10, 20, 40 or 60ms
+		frameDuration = []time.Duration{10, 20, 40, 60}[config%4] * time.Millisecond
+	case config < 16:
+		// Hybrid: 10 or 20ms
+		frameDuration = []time.Duration{10, 20}[config%2] * time.Millisecond
+	default:
+		// CELT-only: 2.5, 5, 10 or 20ms
+		frameDuration = []time.Duration{2500 * time.Microsecond, 5 * time.Millisecond, 10 * time.Millisecond, 20 * time.Millisecond}[config%4]
+	}
+
+	var frameCount int
+
+	switch toc & 0x03 {
+	case 0:
+		frameCount = 1
+	case 1, 2:
+		frameCount = 2
+	default:
+		if len(packet) < 2 {
+			return 0, ErrorInvalidData
+		}
+		frameCount = int(packet[1] & 0x3F)
+	}
+
+	return time.Duration(frameCount) * frameDuration, nil
+}
@@ -0,0 +1,130 @@
+package opusdemux
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+)
+
+const (
+	oggHeaderSize     = 27
+	oggHeaderTypeBOS  = 0x02
+	oggOpusHeadMagic  = "OpusHead"
+	oggCapturePattern = "OggS"
+)
+
+// Reads Opus packets from the first Opus stream of an Ogg file (RFC 7845). The OpusHead
+// & OpusTags header packets are skipped, as are the packets of other streams
+type OggReader struct {
+	r *bufio.Reader
+	// Serial number of the Opus stream, set once its OpusHead packet has been read
+	serial       uint32
+	serialFound  bool
+	headersRead  int
+	segmentTable []byte
+	pageSerial   uint32
+	// Packet continuing from the previous segment
+	partialPacket []byte
+}
+
+func NewOggReader(r io.Reader) *OggReader {
+	return &OggReader{
+		r: bufio.NewReader(r),
+	}
+}
+
+func (reader *OggReader) ReadPacket() ([]byte, error) {
+	for {
+		packet, err := reader.nextPacket()
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !reader.serialFound {
+			if !bytes.HasPrefix(packet, []byte(oggOpusHeadMagic)) {
+				continue
+			}
+
+			reader.serial = reader.pageSerial
+			reader.serialFound = true
+		}
+
+		if reader.pageSerial != reader.serial {
+			continue
+		}
+
+		// OpusHead & OpusTags
+		if reader.headersRead < 2 {
+			reader.headersRead += 1
+			continue
+		}
+
+		return packet, nil
+	}
+}
+
+// Returns the next complete packet of any stream
+func (reader *OggReader) nextPacket() ([]byte, error) {
+	for {
+		for len(reader.segmentTable) > 0 {
+			segmentSize := int(reader.segmentTable[0])
+			reader.segmentTable = reader.segmentTable[1:]
+
+			segment := make([]byte, segmentSize)
+
+			if _, err := io.ReadFull(reader.r, segment); err != nil {
+				return nil, unexpectedEOF(err)
+			}
+
+			reader.partialPacket = append(reader.partialPacket, segment...)
+
+			// Segments shorter than 255 bytes end a packet
+			if segmentSize < 255 {
+				packet := reader.partialPacket
+				reader.partialPacket = nil
+				return packet, nil
+			}
+		}
+
+		if err := reader.readPageHeader(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (reader *OggReader) readPageHeader() error {
+	header := make([]byte, oggHeaderSize)
+
+	if _, err := io.ReadFull(reader.r, header); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return err
+		}
+
+		// End of file between pages
+		return io.EOF
+	}
+
+	if string(header[0:4]) != oggCapturePattern || header[4] != 0 {
+		return ErrorInvalidData
+	}
+
+	pageSerial := binary.LittleEndian.Uint32(header[14:18])
+
+	if pageSerial != reader.pageSerial || header[5]&oggHeaderTypeBOS != 0 {
+		// A packet can only continue on a page of the same stream
+		reader.partialPacket = nil
+	}
+
+	reader.pageSerial = pageSerial
+
+	segmentTable := make([]byte, header[26])
+
+	if _, err := io.ReadFull(reader.r, segmentTable); err != nil {
+		return unexpectedEOF(err)
+	}
+
+	reader.segmentTable = segmentTable
+	return nil
+}
@@ -0,0 +1,13 @@
+package opusdemux_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestOpusDemux(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Opus Demux Suite")
+}
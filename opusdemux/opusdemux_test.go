@@ -0,0 +1,349 @@
+package opusdemux_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fakelag/streaming-music-bot/opusdemux"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// CELT-only fullband packets, config 31 is 20ms & config 29 is 5ms
+func makeOpusPacket(payload byte) []byte {
+	return []byte{31 << 3, payload, payload}
+}
+
+func makeShortOpusPacket(payload byte) []byte {
+	return []byte{29 << 3, payload}
+}
+
+func ebmlSize(size int) []byte {
+	if size < 0x7F {
+		return []byte{0x80 | byte(size)}
+	}
+
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, uint64(size))
+	buf[0] = 0x01
+	return buf
+}
+
+func ebmlElement(id []byte, children ...[]byte) []byte {
+	data := bytes.Join(children, nil)
+	return bytes.Join([][]byte{id, ebmlSize(len(data)), data}, nil)
+}
+
+// Master element of unknown size, as used by live streams
+func ebmlUnknownSizeElement(id []byte, children ...[]byte) []byte {
+	return bytes.Join([][]byte{id, {0x01, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}, bytes.Join(children, nil)}, nil)
+}
+
+func webmBlock(id []byte, track byte, flags byte, data ...[]byte) []byte {
+	return ebmlElement(id, []byte{0x80 | track, 0x00, 0x00, flags}, bytes.Join(data, nil))
+}
+
+func webmSimpleBlock(track byte, packet []byte) []byte {
+	return webmBlock([]byte{0xA3}, track, 0x80, packet)
+}
+
+func webmTrackEntry(number byte, codecID string) []byte {
+	return ebmlElement([]byte{0xAE},
+		ebmlElement([]byte{0xD7}, []byte{number}),
+		ebmlElement([]byte{0x86}, []byte(codecID)),
+	)
+}
+
+func makeWebM(clusters ...[]byte) []byte {
+	return bytes.Join([][]byte{
+		ebmlElement([]byte{0x1A, 0x45, 0xDF, 0xA3}, ebmlElement([]byte{0x42, 0x82}, []byte("webm"))),
+		ebmlUnknownSizeElement([]byte{0x18, 0x53, 0x80, 0x67},
+			ebmlElement([]byte{0x15, 0x49, 0xA9, 0x66}, ebmlElement([]byte{0x2A, 0xD7, 0xB1}, []byte{0x0F, 0x42, 0x40})),
+			ebmlElement([]byte{0x16, 0x54, 0xAE, 0x6B},
+				webmTrackEntry(1, "V_VP9"),
+				webmTrackEntry(2, "A_OPUS"),
+			),
+			bytes.Join(clusters, nil),
+			ebmlElement([]byte{0x1C, 0x53, 0xBB, 0x6B}, make([]byte, 300)),
+		),
+	}, nil)
+}
+
+func webmCluster(blocks ...[]byte) []byte {
+	return ebmlElement([]byte{0x1F, 0x43, 0xB6, 0x75}, append([][]byte{ebmlElement([]byte{0xE7}, []byte{0x00})}, blocks...)...)
+}
+
+func makeOggPage(serial uint32, sequence uint32, headerType byte, segments []byte, data []byte) []byte {
+	header := make([]byte, 27)
+	copy(header, "OggS")
+	header[5] = headerType
+	binary.LittleEndian.PutUint32(header[14:], serial)
+	binary.LittleEndian.PutUint32(header[18:], sequence)
+	header[26] = byte(len(segments))
+	return bytes.Join([][]byte{header, segments, data}, nil)
+}
+
+// Page containing complete packets
+func makeOggPacketPage(serial uint32, sequence uint32, headerType byte, packets ...[]byte) []byte {
+	segments := make([]byte, 0)
+
+	for _, packet := range packets {
+		size := len(packet)
+		for size >= 255 {
+			segments = append(segments, 255)
+			size -= 255
+		}
+		segments = append(segments, byte(size))
+	}
+
+	return makeOggPage(serial, sequence, headerType, segments, bytes.Join(packets, nil))
+}
+
+func readAllPackets(reader opusdemux.PacketReader) ([][]byte, error) {
+	packets := make([][]byte, 0)
+
+	for {
+		packet, err := reader.ReadPacket()
+
+		if err == io.EOF {
+			return packets, nil
+		}
+
+		if err != nil {
+			return packets, err
+		}
+
+		packets = append(packets, packet)
+	}
+}
+
+var _ = Describe("Opus Demux", func() {
+	DescribeTable("Decoding the duration of a packet",
+		func(packet []byte, expectedDuration time.Duration) {
+			duration, err := opusdemux.PacketDuration(packet)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(duration).To(Equal(expectedDuration))
+		},
+		Entry("CELT 20ms", []byte{31 << 3}, 20*time.Millisecond),
+		Entry("CELT 2.5ms", []byte{28 << 3}, 2500*time.Microsecond),
+		Entry("SILK 60ms", []byte{3 << 3}, 60*time.Millisecond),
+		Entry("Hybrid 10ms", []byte{12 << 3}, 10*time.Millisecond),
+		Entry("Two 10ms frames", []byte{30<<3 | 1}, 20*time.Millisecond),
+		Entry("Four 5ms frames", []byte{29<<3 | 3, 4}, 20*time.Millisecond),
+	)
+
+	When("Reading WebM", func() {
+		It("Reads packets of the Opus track", func() {
+			webm := makeWebM(
+				webmCluster(
+					webmSimpleBlock(1, []byte{0xDE, 0xAD}),
+					webmSimpleBlock(2, makeOpusPacket(1)),
+					webmSimpleBlock(2, makeOpusPacket(2)),
+				),
+				webmCluster(
+					webmBlock([]byte{0xA3}, 2, 0x82, []byte{2, 3, 3}, makeOpusPacket(3), makeOpusPacket(4), makeOpusPacket(5)),
+					ebmlElement([]byte{0xA0}, webmBlock([]byte{0xA1}, 2, 0x00, makeOpusPacket(6))),
+					webmBlock([]byte{0xA3}, 2, 0x86, []byte{1, 0x83}, makeOpusPacket(7), []byte{31 << 3, 8, 8, 8, 8}),
+					webmBlock([]byte{0xA3}, 2, 0x84, []byte{1}, makeOpusPacket(9), makeOpusPacket(10)),
+				),
+			)
+
+			reader, err := opusdemux.NewPacketReader(bytes.NewReader(webm), "webm")
+			Expect(err).NotTo(HaveOccurred())
+
+			packets, err := readAllPackets(reader)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(packets).To(Equal([][]byte{
+				makeOpusPacket(1),
+				makeOpusPacket(2),
+				makeOpusPacket(3),
+				makeOpusPacket(4),
+				makeOpusPacket(5),
+				makeOpusPacket(6),
+				makeOpusPacket(7),
+				{31 << 3, 8, 8, 8, 8},
+				makeOpusPacket(9),
+				makeOpusPacket(10),
+			}))
+		})
+
+		It("Fails without an Opus track", func() {
+			webm := bytes.Join([][]byte{
+				ebmlElement([]byte{0x16, 0x54, 0xAE, 0x6B}, webmTrackEntry(1, "A_VORBIS")),
+				webmCluster(webmSimpleBlock(1, makeOpusPacket(1))),
+			}, nil)
+
+			_, err := readAllPackets(opusdemux.NewWebMReader(bytes.NewReader(webm)))
+			Expect(err).To(MatchError(opusdemux.ErrorNoOpusTrack))
+		})
+
+		It("Fails on truncated files", func() {
+			webm := makeWebM(webmCluster(webmSimpleBlock(2, makeOpusPacket(1)), webmSimpleBlock(2, makeOpusPacket(2))))
+
+			packets, err := readAllPackets(opusdemux.NewWebMReader(bytes.NewReader(webm[:len(webm)-315])))
+			Expect(err).To(MatchError(io.ErrUnexpectedEOF))
+			Expect(packets).To(HaveLen(1))
+		})
+	})
+
+	When("Reading Ogg", func() {
+		It("Skips headers & packets of other streams", func() {
+			longPacket := append(makeOpusPacket(3), bytes.Repeat([]byte{3}, 300)...)
+
+			ogg := bytes.Join([][]byte{
+				makeOggPacketPage(7, 0, 0x02, []byte("\x01vorbis")),
+				makeOggPacketPage(1, 0, 0x02, []byte("OpusHead\x01\x02")),
+				makeOggPacketPage(1, 1, 0x00, []byte("OpusTags")),
+				makeOggPacketPage(7, 1, 0x00, []byte{0xFF}),
+				makeOggPacketPage(1, 2, 0x00, makeOpusPacket(1), makeOpusPacket(2)),
+				// Packet spanning two pages
+				makeOggPage(1, 3, 0x00, []byte{255}, longPacket[:255]),
+				makeOggPage(1, 4, 0x01, []byte{byte(len(longPacket) - 255), 3}, append(longPacket[255:], makeOpusPacket(4)...)),
+			}, nil)
+
+			reader, err := opusdemux.NewPacketReader(bytes.NewReader(ogg), "ogg")
+			Expect(err).NotTo(HaveOccurred())
+
+			packets, err := readAllPackets(reader)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(packets).To(Equal([][]byte{
+				makeOpusPacket(1),
+				makeOpusPacket(2),
+				longPacket,
+				makeOpusPacket(4),
+			}))
+		})
+
+		It("Fails on invalid pages", func() {
+			_, err := readAllPackets(opusdemux.NewOggReader(bytes.NewReader([]byte("OggX" + string(make([]byte, 30))))))
+			Expect(err).To(MatchError(opusdemux.ErrorInvalidData))
+		})
+	})
+
+	It("Rejects unsupported containers", func() {
+		Expect(opusdemux.IsSupportedContainer("WebM")).To(BeTrue())
+		Expect(opusdemux.IsSupportedContainer("m4a")).To(BeFalse())
+
+		_, err := opusdemux.NewPacketReader(bytes.NewReader(nil), "m4a")
+		Expect(err).To(MatchError(opusdemux.ErrorUnsupportedContainer))
+	})
+
+	When("Demuxing a file", func() {
+		webm := makeWebM(webmCluster(
+			webmSimpleBlock(2, makeOpusPacket(1)),
+			webmSimpleBlock(2, makeOpusPacket(2)),
+			webmSimpleBlock(2, makeOpusPacket(3)),
+		))
+
+		readSession := func(session *opusdemux.DemuxSession) [][]byte {
+			packets := make([][]byte, 0)
+
+			for {
+				packet, err := session.OpusFrame()
+
+				if err == io.EOF {
+					return packets
+				}
+
+				Expect(err).NotTo(HaveOccurred())
+				packets = append(packets, packet)
+			}
+		}
+
+		It("Reads an http url with range requests", func() {
+			rangeRequests := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Range") != "" {
+					rangeRequests += 1
+				}
+				http.ServeContent(w, r, "audio.webm", time.Time{}, bytes.NewReader(webm))
+			}))
+			defer server.Close()
+
+			session, err := opusdemux.DemuxFile(context.Background(), server.URL, "webm")
+			Expect(err).NotTo(HaveOccurred())
+			defer session.Cleanup()
+
+			Expect(session.FrameDuration()).To(Equal(20 * time.Millisecond))
+			Expect(readSession(session)).To(Equal([][]byte{makeOpusPacket(1), makeOpusPacket(2), makeOpusPacket(3)}))
+			Expect(rangeRequests).To(Equal(1))
+		})
+
+		It("Reads servers that ignore range requests", func() {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write(webm)
+			}))
+			defer server.Close()
+
+			session, err := opusdemux.DemuxFile(context.Background(), server.URL, "webm")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(readSession(session)).To(HaveLen(3))
+
+			session.Cleanup()
+			session.Cleanup()
+
+			_, err = session.OpusFrame()
+			Expect(err).To(Equal(io.EOF))
+		})
+
+		It("Fails on http errors", func() {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusForbidden)
+			}))
+			defer server.Close()
+
+			_, err := opusdemux.DemuxFile(context.Background(), server.URL, "webm")
+			Expect(err).To(MatchError(opusdemux.ErrorUnexpectedStatus))
+		})
+
+		It("Stops opening a stalled url when ctx is cancelled", func() {
+			stalled := make(chan struct{})
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Length", "1000")
+				w.WriteHeader(http.StatusOK)
+				_, _ = w.Write(webm[:8])
+				w.(http.Flusher).Flush()
+
+				select {
+				case <-stalled:
+				case <-r.Context().Done():
+				}
+			}))
+			defer server.Close()
+			defer close(stalled)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cancel()
+
+			startedAt := time.Now()
+			_, err := opusdemux.DemuxFile(ctx, server.URL, "webm")
+			Expect(err).To(MatchError(context.DeadlineExceeded))
+			Expect(time.Since(startedAt)).To(BeNumerically("<", 2*time.Second))
+		})
+
+		It("Reads local files & rejects frame durations other than 20ms", func() {
+			path := filepath.Join(GinkgoT().TempDir(), "audio.webm")
+			Expect(os.WriteFile(path, webm, 0o644)).To(Succeed())
+
+			session, err := opusdemux.DemuxFile(context.Background(), path, "webm")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(readSession(session)).To(HaveLen(3))
+			session.Cleanup()
+
+			shortPath := filepath.Join(GinkgoT().TempDir(), "short.webm")
+			Expect(os.WriteFile(shortPath, makeWebM(webmCluster(webmSimpleBlock(2, makeShortOpusPacket(1)))), 0o644)).To(Succeed())
+
+			_, err = opusdemux.DemuxFile(context.Background(), shortPath, "webm")
+			Expect(err).To(MatchError(opusdemux.ErrorUnsupportedFrameDuration))
+		})
+	})
+})
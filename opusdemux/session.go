@@ -0,0 +1,306 @@
+package opusdemux
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	ErrorUnexpectedStatus = errors.New("unexpected http status")
+)
+
+const (
+	// Discord voice connections send one packet every 20ms
+	passthroughFrameDuration = 20 * time.Millisecond
+	// Size of the ranges requested from http servers, larger requests are throttled by YouTube
+	httpChunkSize = 10 * 1024 * 1024
+	// Packets read ahead, 2 seconds of audio
+	bufferedFrames = 100
+	// Time to wait for the response headers of a range request, after which it fails
+	httpResponseHeaderTimeout = 15 * time.Second
+)
+
+// Client of range requests. Reading the body has no timeout, as a range is read as it is played
+var httpClient = newHttpClient()
+
+func newHttpClient() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = httpResponseHeaderTimeout
+
+	return &http.Client{Transport: transport}
+}
+
+// Reads the Opus packets of a file for sending them to a voice connection without
+// re-encoding. Packets are read ahead in the background, so that network stalls shorter
+// than the buffer are not audible. Implements dca.OpusReader
+type DemuxSession struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	source io.ReadCloser
+	reader PacketReader
+	frames chan []byte
+	// Error that ended reading, set before frames is closed
+	err    error
+	closed atomic.Bool
+}
+
+// Opens a local file or an http(s) url, which is read in ranges. Returns ErrorUnsupportedFrameDuration
+// if packets are not 20ms long, in which case the file must be encoded instead. Cancelling ctx
+// stops opening the file & reading its first packet, after which the session is read until Cleanup
+func DemuxFile(ctx context.Context, path string, container string) (*DemuxSession, error) {
+	sessionCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	stopOpening := context.AfterFunc(ctx, cancel)
+
+	var source io.ReadCloser
+
+	if strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") {
+		source = &httpRangeReader{
+			ctx:    sessionCtx,
+			client: httpClient,
+			url:    path,
+			size:   -1,
+		}
+	} else {
+		file, err := os.Open(path)
+
+		if err != nil {
+			stopOpening()
+			cancel()
+			return nil, err
+		}
+
+		source = file
+	}
+
+	session := &DemuxSession{
+		ctx:    sessionCtx,
+		cancel: cancel,
+		source: source,
+		frames: make(chan []byte, bufferedFrames),
+	}
+
+	err := session.start(container)
+
+	// The session is no longer cancelled with ctx once open
+	if !stopOpening() && err == nil {
+		err = ctx.Err()
+	}
+
+	if err != nil {
+		session.Cleanup()
+
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// Reads the first packet to verify that the file can be passed through, then starts reading ahead
+func (session *DemuxSession) start(container string) error {
+	reader, err := NewPacketReader(session.source, container)
+
+	if err != nil {
+		return err
+	}
+
+	firstPacket, err := reader.ReadPacket()
+
+	if err != nil {
+		return err
+	}
+
+	duration, err := PacketDuration(firstPacket)
+
+	if err != nil {
+		return err
+	}
+
+	if duration != passthroughFrameDuration {
+		return fmt.Errorf("%w: %s", ErrorUnsupportedFrameDuration, duration)
+	}
+
+	session.reader = reader
+	session.frames <- firstPacket
+
+	go session.readAhead()
+	return nil
+}
+
+func (session *DemuxSession) readAhead() {
+	defer close(session.frames)
+
+	for {
+		packet, err := session.reader.ReadPacket()
+
+		if err != nil {
+			session.err = err
+			return
+		}
+
+		select {
+		case session.frames <- packet:
+		case <-session.ctx.Done():
+			return
+		}
+	}
+}
+
+// Returns io.EOF after the last packet, or once the session has been cleaned up
+func (session *DemuxSession) OpusFrame() ([]byte, error) {
+	packet, ok := <-session.frames
+
+	if ok {
+		return packet, nil
+	}
+
+	if session.err == nil || session.closed.Load() {
+		return nil, io.EOF
+	}
+
+	return nil, session.err
+}
+
+func (session *DemuxSession) FrameDuration() time.Duration {
+	return passthroughFrameDuration
+}
+
+// Stops reading the file. Safe to call concurrently with OpusFrame & more than once
+func (session *DemuxSession) Cleanup() {
+	if session.closed.Swap(true) {
+		return
+	}
+
+	session.cancel()
+	session.source.Close()
+}
+
+// Reads an http resource sequentially in ranges of httpChunkSize bytes. Servers ignoring
+// the Range header are read in a single request
+type httpRangeReader struct {
+	ctx    context.Context
+	client *http.Client
+	url    string
+	offset int64
+	// Total size of the resource, -1 if unknown
+	size int64
+	// Whether the server responded to the Range header
+	ranged bool
+	body   io.ReadCloser
+}
+
+func (reader *httpRangeReader) Read(p []byte) (int, error) {
+	for {
+		if reader.body == nil {
+			if reader.offset > 0 && reader.size >= 0 && reader.offset >= reader.size {
+				return 0, io.EOF
+			}
+
+			if err := reader.openRange(); err != nil {
+				return 0, err
+			}
+
+			continue
+		}
+
+		n, err := reader.body.Read(p)
+		reader.offset += int64(n)
+
+		if err != nil && err != io.EOF {
+			reader.body.Close()
+			reader.body = nil
+			return n, err
+		}
+
+		if err == nil {
+			return n, nil
+		}
+
+		reader.body.Close()
+		reader.body = nil
+
+		if !reader.ranged {
+			// Entire resource was returned in one response
+			return n, io.EOF
+		}
+
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+func (reader *httpRangeReader) openRange() error {
+	request, err := http.NewRequestWithContext(reader.ctx, http.MethodGet, reader.url, nil)
+
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", reader.offset, reader.offset+httpChunkSize-1))
+
+	response, err := reader.client.Do(request)
+
+	if err != nil {
+		return err
+	}
+
+	switch response.StatusCode {
+	case http.StatusPartialContent:
+		reader.ranged = true
+		reader.size = parseContentRangeSize(response.Header.Get("Content-Range"))
+	case http.StatusOK:
+		if reader.offset > 0 {
+			response.Body.Close()
+			return fmt.Errorf("%w: range request ignored", ErrorUnexpectedStatus)
+		}
+	case http.StatusRequestedRangeNotSatisfiable:
+		response.Body.Close()
+
+		if reader.offset > 0 {
+			// Size of the resource was unknown, all of it has been read
+			return io.EOF
+		}
+
+		return fmt.Errorf("%w: %s", ErrorUnexpectedStatus, response.Status)
+	default:
+		response.Body.Close()
+		return fmt.Errorf("%w: %s", ErrorUnexpectedStatus, response.Status)
+	}
+
+	reader.body = response.Body
+	return nil
+}
+
+// Requests are cancelled through ctx instead, as Close may be called during a Read
+func (reader *httpRangeReader) Close() error {
+	return nil
+}
+
+// Returns the total size from a "bytes 0-1023/4096" header, or -1 if it is unknown
+func parseContentRangeSize(contentRange string) int64 {
+	_, totalSize, found := strings.Cut(contentRange, "/")
+
+	if !found {
+		return -1
+	}
+
+	size, err := strconv.ParseInt(totalSize, 10, 64)
+
+	if err != nil {
+		return -1
+	}
+
+	return size
+}
@@ -0,0 +1,335 @@
+package opusdemux
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/bits"
+)
+
+// Matroska element ids, including their length marker
+const (
+	webmIDSegment     = 0x18538067
+	webmIDTracks      = 0x1654AE6B
+	webmIDTrackEntry  = 0xAE
+	webmIDTrackNumber = 0xD7
+	webmIDCodecID     = 0x86
+	webmIDCluster     = 0x1F43B675
+	webmIDBlockGroup  = 0xA0
+	webmIDBlock       = 0xA1
+	webmIDSimpleBlock = 0xA3
+)
+
+// Leaf elements larger than this are treated as invalid data
+const webmMaxElementSize = 16 * 1024 * 1024
+
+type webmTrack struct {
+	number  uint64
+	codecID string
+}
+
+// Reads Opus packets from the first Opus track of a WebM (Matroska) file. Elements are read
+// sequentially without seeking, so live streams with clusters of unknown size are supported
+type WebMReader struct {
+	r         *bufio.Reader
+	tracks    []*webmTrack
+	opusTrack uint64
+	// Frames of a laced block not yet returned
+	pending [][]byte
+}
+
+func NewWebMReader(r io.Reader) *WebMReader {
+	return &WebMReader{
+		r: bufio.NewReader(r),
+	}
+}
+
+func (reader *WebMReader) ReadPacket() ([]byte, error) {
+	for len(reader.pending) == 0 {
+		if err := reader.readElement(); err != nil {
+			return nil, err
+		}
+	}
+
+	packet := reader.pending[0]
+	reader.pending = reader.pending[1:]
+
+	return packet, nil
+}
+
+// Reads the next element. Master elements containing tracks & blocks are entered
+// by reading their children as if they were top level elements
+func (reader *WebMReader) readElement() error {
+	id, err := reader.readVint(true)
+
+	if err != nil {
+		return err
+	}
+
+	size, unknownSize, err := reader.readSize()
+
+	if err != nil {
+		return unexpectedEOF(err)
+	}
+
+	switch id {
+	case webmIDSegment, webmIDCluster, webmIDTracks, webmIDBlockGroup:
+		return nil
+	case webmIDTrackEntry:
+		reader.tracks = append(reader.tracks, &webmTrack{})
+		return nil
+	}
+
+	if unknownSize || size > webmMaxElementSize {
+		return ErrorInvalidData
+	}
+
+	switch id {
+	case webmIDTrackNumber, webmIDCodecID, webmIDBlock, webmIDSimpleBlock:
+		data := make([]byte, size)
+
+		if _, err := io.ReadFull(reader.r, data); err != nil {
+			return unexpectedEOF(err)
+		}
+
+		return reader.handleElement(id, data)
+	default:
+		// Includes the EBML header, cues, tags & other elements not needed for playback
+		_, err := reader.r.Discard(int(size))
+		return unexpectedEOF(err)
+	}
+}
+
+func (reader *WebMReader) handleElement(id uint64, data []byte) error {
+	if id == webmIDBlock || id == webmIDSimpleBlock {
+		return reader.handleBlock(data)
+	}
+
+	if len(reader.tracks) == 0 {
+		return ErrorInvalidData
+	}
+
+	track := reader.tracks[len(reader.tracks)-1]
+
+	if id == webmIDTrackNumber {
+		if len(data) > 8 {
+			return ErrorInvalidData
+		}
+
+		for _, b := range data {
+			track.number = track.number<<8 | uint64(b)
+		}
+	} else {
+		track.codecID = string(data)
+	}
+
+	return nil
+}
+
+func (reader *WebMReader) handleBlock(data []byte) error {
+	if reader.opusTrack == 0 {
+		for _, track := range reader.tracks {
+			if track.codecID == "A_OPUS" && track.number != 0 {
+				reader.opusTrack = track.number
+				break
+			}
+		}
+
+		if reader.opusTrack == 0 {
+			return ErrorNoOpusTrack
+		}
+	}
+
+	trackNumber, length := parseVint(data, false)
+
+	// Track number, 2 byte timecode & flags
+	if length == 0 || len(data) < length+3 {
+		return ErrorInvalidData
+	}
+
+	if trackNumber != reader.opusTrack {
+		return nil
+	}
+
+	flags := data[length+2]
+	frames, err := unlaceBlock(data[length+3:], (flags>>1)&0x03)
+
+	if err != nil {
+		return err
+	}
+
+	reader.pending = append(reader.pending, frames...)
+	return nil
+}
+
+// Splits the frames of a block using the given lacing (0 none, 1 Xiph, 2 fixed-size, 3 EBML)
+func unlaceBlock(data []byte, lacing byte) ([][]byte, error) {
+	if lacing == 0 {
+		return [][]byte{data}, nil
+	}
+
+	if len(data) < 1 {
+		return nil, ErrorInvalidData
+	}
+
+	frameCount := int(data[0]) + 1
+	data = data[1:]
+	sizes := make([]int, frameCount)
+
+	switch lacing {
+	case 1:
+		for index := 0; index < frameCount-1; index++ {
+			// Sum of bytes up to & including the first byte below 255
+			for {
+				if len(data) < 1 {
+					return nil, ErrorInvalidData
+				}
+
+				value := data[0]
+				data = data[1:]
+				sizes[index] += int(value)
+
+				if value != 255 {
+					break
+				}
+			}
+		}
+	case 2:
+		if len(data)%frameCount != 0 {
+			return nil, ErrorInvalidData
+		}
+
+		for index := range sizes {
+			sizes[index] = len(data) / frameCount
+		}
+
+		return splitFrames(data, sizes)
+	case 3:
+		firstSize, length := parseVint(data, false)
+
+		if length == 0 {
+			return nil, ErrorInvalidData
+		}
+
+		sizes[0] = int(firstSize)
+		data = data[length:]
+
+		for index := 1; index < frameCount-1; index++ {
+			diff, length := parseVint(data, false)
+
+			if length == 0 {
+				return nil, ErrorInvalidData
+			}
+
+			// Signed difference to the previous size, stored with a bias
+			sizes[index] = sizes[index-1] + int(int64(diff)-(int64(1)<<(7*length-1)-1))
+			data = data[length:]
+		}
+	}
+
+	lacedSize := 0
+	for _, size := range sizes[:frameCount-1] {
+		if size < 0 {
+			return nil, ErrorInvalidData
+		}
+		lacedSize += size
+	}
+
+	if lacedSize > len(data) {
+		return nil, ErrorInvalidData
+	}
+
+	sizes[frameCount-1] = len(data) - lacedSize
+
+	return splitFrames(data, sizes)
+}
+
+func splitFrames(data []byte, sizes []int) ([][]byte, error) {
+	frames := make([][]byte, 0, len(sizes))
+
+	for _, size := range sizes {
+		if size > len(data) {
+			return nil, ErrorInvalidData
+		}
+
+		frames = append(frames, data[:size])
+		data = data[size:]
+	}
+
+	return frames, nil
+}
+
+// Reads a variable length integer. Element ids keep their length marker, sizes & values don't
+func (reader *WebMReader) readVint(keepMarker bool) (uint64, error) {
+	first, err := reader.r.ReadByte()
+
+	if err != nil {
+		return 0, err
+	}
+
+	length := bits.LeadingZeros8(first) + 1
+
+	if length > 8 {
+		return 0, ErrorInvalidData
+	}
+
+	buf := make([]byte, length)
+	buf[0] = first
+
+	if _, err := io.ReadFull(reader.r, buf[1:]); err != nil {
+		return 0, unexpectedEOF(err)
+	}
+
+	value, _ := parseVint(buf, keepMarker)
+	return value, nil
+}
+
+func (reader *WebMReader) readSize() (size uint64, unknownSize bool, err error) {
+	first, err := reader.r.Peek(1)
+
+	if err != nil {
+		return 0, false, err
+	}
+
+	length := bits.LeadingZeros8(first[0]) + 1
+	size, err = reader.readVint(false)
+
+	if err != nil {
+		return 0, false, err
+	}
+
+	// All value bits set means the size is unknown
+	return size, size == (uint64(1)<<(7*length))-1, nil
+}
+
+// Parses a variable length integer at the start of data, returning 0 as the length if it is invalid
+func parseVint(data []byte, keepMarker bool) (uint64, int) {
+	if len(data) < 1 {
+		return 0, 0
+	}
+
+	length := bits.LeadingZeros8(data[0]) + 1
+
+	if length > 8 || len(data) < length {
+		return 0, 0
+	}
+
+	buf := make([]byte, 8)
+	copy(buf[8-length:], data[:length])
+
+	if !keepMarker {
+		buf[8-length] &= byte(0xFF >> length)
+	}
+
+	return binary.BigEndian.Uint64(buf), length
+}
+
+// A file ending in the middle of an element is truncated
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+
+	return err
+}
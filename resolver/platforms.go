@@ -0,0 +1,287 @@
+package resolver
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/fakelag/streaming-music-bot/utils"
+	"github.com/fakelag/streaming-music-bot/youtubeapi"
+)
+
+// Resolves urls of a site supported by yt-dlp. Urls for which isPlaylist returns
+// true are loaded as playlists, others as a single media
+type platformResolver struct {
+	name string
+	// Domains of the site, nil matches all urls
+	domains    []string
+	isPlaylist func(inputUrl *url.URL) bool
+	yt         *youtubeapi.Youtube
+}
+
+func (resolver *platformResolver) Name() string {
+	return resolver.name
+}
+
+func (resolver *platformResolver) Matches(inputUrl *url.URL) bool {
+	if resolver.domains == nil {
+		return true
+	}
+
+	return hostMatches(inputUrl, resolver.domains...)
+}
+
+func (resolver *platformResolver) Resolve(ctx context.Context, input string) (*Result, error) {
+	inputUrl := parseHttpUrl(input)
+
+	if inputUrl != nil && resolver.isPlaylist(inputUrl) {
+		playlist, err := resolver.yt.GetYoutubePlaylist(ctx, input)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return &Result{Playlist: playlist, Resolver: resolver.name}, nil
+	}
+
+	media, err := resolver.yt.GetMediaFromURL(ctx, input)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Result{Media: media, Resolver: resolver.name}, nil
+}
+
+// Resolves YouTube videos, playlists, mixes & channel uploads. Input that is not a url is searched on YouTube
+type YoutubeResolver struct {
+	yt *youtubeapi.Youtube
+}
+
+func NewYoutubeResolver(yt *youtubeapi.Youtube) *YoutubeResolver {
+	return &YoutubeResolver{yt: yt}
+}
+
+func (resolver *YoutubeResolver) Name() string {
+	return "youtube"
+}
+
+func (resolver *YoutubeResolver) Matches(inputUrl *url.URL) bool {
+	return hostMatches(inputUrl, "youtube.com", "youtu.be", "youtube-nocookie.com")
+}
+
+func (resolver *YoutubeResolver) Resolve(ctx context.Context, input string) (*Result, error) {
+	inputUrl := parseHttpUrl(input)
+
+	if inputUrl != nil && youtubeapi.IsYoutubeMixUrl(input) {
+		mix, err := resolver.yt.GetYoutubeMix(ctx, input)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return &Result{Playlist: mix, Resolver: resolver.Name()}, nil
+	}
+
+	if inputUrl != nil && youtubeapi.IsYoutubeChannelUrl(input) {
+		uploads, err := resolver.yt.GetYoutubeChannelUploads(ctx, input, &youtubeapi.PlaylistOptions{})
+
+		if err != nil {
+			return nil, err
+		}
+
+		return &Result{Playlist: uploads, Resolver: resolver.Name()}, nil
+	}
+
+	if inputUrl != nil && isYoutubePlaylistUrl(inputUrl) {
+		playlist, err := resolver.yt.GetYoutubePlaylist(ctx, input)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return &Result{Playlist: playlist, Resolver: resolver.Name()}, nil
+	}
+
+	if inputUrl != nil && isYoutubeVideoInPlaylistUrl(inputUrl) {
+		// Plays the playlist from the linked video onwards
+		playlist, err := resolver.yt.GetYoutubePlaylistWithOptions(ctx, input, &youtubeapi.PlaylistOptions{StartFromURLVideo: true})
+
+		if err != nil {
+			return nil, err
+		}
+
+		return &Result{Playlist: playlist, Resolver: resolver.Name()}, nil
+	}
+
+	media, err := resolver.yt.GetYoutubeMedia(ctx, input)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Result{Media: media, Resolver: resolver.Name()}, nil
+}
+
+// Playlist links, excluding links to a video within a playlist
+func isYoutubePlaylistUrl(inputUrl *url.URL) bool {
+	query := inputUrl.Query()
+	return inputUrl.Path == "/playlist" || (query.Has("list") && !query.Has("v") && youtubeapi.GetVideoIDFromURL(inputUrl.String()) == "")
+}
+
+// Links to a video within a playlist, such as watch?v=...&list=...
+func isYoutubeVideoInPlaylistUrl(inputUrl *url.URL) bool {
+	return inputUrl.Query().Get("list") != "" && youtubeapi.GetVideoIDFromURL(inputUrl.String()) != ""
+}
+
+// Resolves SoundCloud tracks, sets & the tracks of users
+func NewSoundCloudResolver(yt *youtubeapi.Youtube) MediaResolver {
+	return &platformResolver{
+		name:    "soundcloud",
+		domains: []string{"soundcloud.com"},
+		isPlaylist: func(inputUrl *url.URL) bool {
+			segments := utils.PathSegments(inputUrl)
+
+			switch {
+			case len(segments) == 1:
+				// User page
+				return !hostMatches(inputUrl, "on.soundcloud.com")
+			case len(segments) >= 2 && segments[1] == "sets":
+				return true
+			case len(segments) == 2:
+				return slices.Contains([]string{"tracks", "albums", "likes", "reposts", "popular-tracks"}, segments[1])
+			default:
+				return false
+			}
+		},
+		yt: yt,
+	}
+}
+
+// Resolves Bandcamp tracks, albums & the discographies of artists
+func NewBandcampResolver(yt *youtubeapi.Youtube) MediaResolver {
+	return &platformResolver{
+		name:    "bandcamp",
+		domains: []string{"bandcamp.com"},
+		isPlaylist: func(inputUrl *url.URL) bool {
+			segments := utils.PathSegments(inputUrl)
+			return len(segments) == 0 || segments[0] == "album" || segments[0] == "music"
+		},
+		yt: yt,
+	}
+}
+
+// Resolves Vimeo videos, showcases, albums & channels
+func NewVimeoResolver(yt *youtubeapi.Youtube) MediaResolver {
+	return &platformResolver{
+		name:    "vimeo",
+		domains: []string{"vimeo.com"},
+		isPlaylist: func(inputUrl *url.URL) bool {
+			segments := utils.PathSegments(inputUrl)
+
+			if len(segments) < 2 || !slices.Contains([]string{"showcase", "album", "channels", "groups"}, segments[0]) {
+				return false
+			}
+
+			// Links to a video within a showcase end in the id of the video
+			return !isNumeric(segments[len(segments)-1]) || len(segments) == 2
+		},
+		yt: yt,
+	}
+}
+
+// Resolves Twitch live streams, past broadcasts, clips & the video lists of channels
+func NewTwitchResolver(yt *youtubeapi.Youtube) MediaResolver {
+	return &platformResolver{
+		name:    "twitch",
+		domains: []string{"twitch.tv"},
+		isPlaylist: func(inputUrl *url.URL) bool {
+			segments := utils.PathSegments(inputUrl)
+			return len(segments) == 2 && segments[1] == "videos"
+		},
+		yt: yt,
+	}
+}
+
+// Looks up the addresses of a host, such as net.DefaultResolver.LookupIPAddr
+type LookupIPFunc = func(ctx context.Context, host string) ([]net.IPAddr, error)
+
+// Resolves urls of any site supported by yt-dlp as a single media. Matches all urls, so it
+// should be registered last. Not part of NewDefaultRegistry: urls of hosts with loopback,
+// private or link-local addresses are rejected, but the host may resolve differently when
+// yt-dlp loads it. Register only if the bot may request any url its users link
+func NewGenericResolver(yt *youtubeapi.Youtube) MediaResolver {
+	return NewGenericResolverEx(yt, net.DefaultResolver.LookupIPAddr)
+}
+
+func NewGenericResolverEx(yt *youtubeapi.Youtube, lookupIP LookupIPFunc) MediaResolver {
+	return &genericResolver{
+		platformResolver: platformResolver{
+			name:    "generic",
+			domains: nil,
+			isPlaylist: func(inputUrl *url.URL) bool {
+				return false
+			},
+			yt: yt,
+		},
+		lookupIP: lookupIP,
+	}
+}
+
+type genericResolver struct {
+	platformResolver
+	lookupIP LookupIPFunc
+}
+
+func (resolver *genericResolver) Resolve(ctx context.Context, input string) (*Result, error) {
+	inputUrl := parseHttpUrl(input)
+
+	if inputUrl == nil {
+		return nil, ErrorUnsupportedInput
+	}
+
+	host := strings.ToLower(inputUrl.Hostname())
+
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return nil, ErrorForbiddenHost
+	}
+
+	addrs := []net.IPAddr{}
+
+	if ip := net.ParseIP(host); ip != nil {
+		addrs = append(addrs, net.IPAddr{IP: ip})
+	} else {
+		var err error
+
+		if addrs, err = resolver.lookupIP(ctx, host); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, addr := range addrs {
+		if !isPublicIP(addr.IP) {
+			return nil, ErrorForbiddenHost
+		}
+	}
+
+	return resolver.platformResolver.Resolve(ctx, input)
+}
+
+func isPublicIP(ip net.IP) bool {
+	return !ip.IsLoopback() &&
+		!ip.IsPrivate() &&
+		!ip.IsLinkLocalUnicast() &&
+		!ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() &&
+		!ip.IsMulticast() &&
+		!ip.IsUnspecified()
+}
+
+func isNumeric(value string) bool {
+	return value != "" && strings.Trim(value, "0123456789") == ""
+}
+
+// Verify implements MediaResolver
+var _ MediaResolver = (*genericResolver)(nil)
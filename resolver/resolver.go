@@ -0,0 +1,151 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/fakelag/streaming-music-bot/entities"
+	"github.com/fakelag/streaming-music-bot/youtubeapi"
+)
+
+var (
+	ErrorEmptyInput       = errors.New("empty input")
+	ErrorUnsupportedInput = errors.New("no resolver for input")
+	// Returned by the generic resolver for urls of hosts that are not public, such as localhost
+	ErrorForbiddenHost = errors.New("host not allowed")
+)
+
+// Media or playlist resolved from user input. Exactly one of Media & Playlist is set
+type Result struct {
+	Media    entities.Media
+	Playlist entities.Playlist
+	// Name of the resolver that resolved the input
+	Resolver string
+}
+
+// Resolves urls of a platform, such as YouTube or SoundCloud, into media or playlists
+type MediaResolver interface {
+	// Name of the platform, such as "youtube"
+	Name() string
+	// Returns true if the url is resolved by this resolver
+	Matches(inputUrl *url.URL) bool
+	Resolve(ctx context.Context, input string) (*Result, error)
+}
+
+// Dispatches user input to the first registered resolver matching its url. Input that is
+// not an http(s) url is passed to the search resolver
+type Registry struct {
+	mutex          sync.RWMutex
+	resolvers      []MediaResolver
+	searchResolver MediaResolver
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		resolvers: make([]MediaResolver, 0),
+	}
+}
+
+// Returns a registry with resolvers for YouTube, SoundCloud, Bandcamp, Vimeo & Twitch. Searches
+// are made on YouTube. Other sites supported by yt-dlp can be enabled by registering NewGenericResolver
+func NewDefaultRegistry(yt *youtubeapi.Youtube) *Registry {
+	registry := NewRegistry()
+	youtubeResolver := NewYoutubeResolver(yt)
+
+	registry.Register(youtubeResolver)
+	registry.Register(NewSoundCloudResolver(yt))
+	registry.Register(NewBandcampResolver(yt))
+	registry.Register(NewVimeoResolver(yt))
+	registry.Register(NewTwitchResolver(yt))
+	registry.SetSearchResolver(youtubeResolver)
+
+	return registry
+}
+
+// Adds a resolver after the ones already registered, which take precedence over it
+func (registry *Registry) Register(resolver MediaResolver) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+	registry.resolvers = append(registry.resolvers, resolver)
+}
+
+// Sets the resolver of input that is not a url. Searching is disabled if nil
+func (registry *Registry) SetSearchResolver(resolver MediaResolver) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+	registry.searchResolver = resolver
+}
+
+// Resolves a url or a search term into media or a playlist. Returns ErrorUnsupportedInput
+// if no resolver matches the url, or if input is not a url and there is no search resolver.
+// Playlists load further entries with ctx as they are played, such as the pages of channel
+// uploads & mixes, so ctx should live as long as the playlist, like the context of the session
+func (registry *Registry) Resolve(ctx context.Context, input string) (*Result, error) {
+	input = strings.TrimSpace(input)
+
+	if input == "" {
+		return nil, ErrorEmptyInput
+	}
+
+	resolver := registry.resolverForInput(input)
+
+	if resolver == nil {
+		return nil, ErrorUnsupportedInput
+	}
+
+	return resolver.Resolve(ctx, input)
+}
+
+func (registry *Registry) resolverForInput(input string) MediaResolver {
+	registry.mutex.RLock()
+	defer registry.mutex.RUnlock()
+
+	inputUrl := parseHttpUrl(input)
+
+	if inputUrl == nil {
+		return registry.searchResolver
+	}
+
+	for _, resolver := range registry.resolvers {
+		if resolver.Matches(inputUrl) {
+			return resolver
+		}
+	}
+
+	return nil
+}
+
+// Returns nil if input is not an absolute http(s) url
+func parseHttpUrl(input string) *url.URL {
+	if strings.ContainsAny(input, " \t\n") {
+		return nil
+	}
+
+	inputUrl, err := url.Parse(input)
+
+	if err != nil || inputUrl.Host == "" {
+		return nil
+	}
+
+	if inputUrl.Scheme != "http" && inputUrl.Scheme != "https" {
+		return nil
+	}
+
+	return inputUrl
+}
+
+// Returns true if the host of the url is one of domains or a subdomain of one
+func hostMatches(inputUrl *url.URL, domains ...string) bool {
+	host := strings.ToLower(inputUrl.Hostname())
+
+	for _, domain := range domains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,252 @@
+package resolver_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"slices"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/fakelag/streaming-music-bot/resolver"
+	"github.com/fakelag/streaming-music-bot/testutils"
+	"github.com/fakelag/streaming-music-bot/youtubeapi"
+)
+
+func makeMockMediaOutput(extractorKey string, webpageURL string) string {
+	return fmt.Sprintf(
+		`https://streamurl.example.com/audio`+"\n"+
+			`{"_type": "video", "id": "123", "fulltitle": "Mock Media", "duration": 200, "extractor_key": "%s", "webpage_url": "%s"}`,
+		extractorKey,
+		webpageURL,
+	)
+}
+
+func makeMockPlaylistOutput(extractorKey string, entryURL string) string {
+	return fmt.Sprintf(
+		`{"_type": "playlist", "id": "456", "title": "Mock Playlist", "webpage_url": "https://example.com/playlist", "entries": [`+
+			`{"_type": "url", "id": "123", "title": "Mock Entry", "duration": 200, "ie_key": "%s", "url": "%s"}]}`,
+		extractorKey,
+		entryURL,
+	)
+}
+
+// Flat playlist entry as printed by yt-dlp when streaming a playlist with --dump-json
+func makeMockPlaylistEntryOutput(extractorKey string, entryURL string) string {
+	return fmt.Sprintf(
+		`{"_type": "url", "id": "123", "title": "Mock Entry", "duration": 200, "ie_key": "%s", "url": "%s", `+
+			`"playlist_id": "456", "playlist_title": "Mock Playlist", "playlist_webpage_url": "https://example.com/playlist"}`,
+		extractorKey,
+		entryURL,
+	)
+}
+
+type MockResolver struct {
+	host string
+}
+
+func (mockResolver *MockResolver) Name() string {
+	return "mock"
+}
+
+func (mockResolver *MockResolver) Matches(inputUrl *url.URL) bool {
+	return inputUrl.Hostname() == mockResolver.host
+}
+
+func (mockResolver *MockResolver) Resolve(ctx context.Context, input string) (*resolver.Result, error) {
+	return &resolver.Result{Resolver: mockResolver.Name()}, nil
+}
+
+var _ = Describe("Resolver", func() {
+	DescribeTable("Dispatches input to the resolver of its platform", func(
+		input string,
+		expectedResolver string,
+		expectPlaylist bool,
+		expectedArg string,
+		extractorKey string,
+		mediaURL string,
+	) {
+		executor := &testutils.MockCommandExecutor{MockStdoutResult: makeMockMediaOutput(extractorKey, mediaURL)}
+
+		if expectPlaylist {
+			executor.MockStdoutFunc = func(args []string) string {
+				switch {
+				case !slices.Contains(args, "--flat-playlist"):
+					// Entries are loaded from their own url before playing
+					return makeMockMediaOutput(extractorKey, mediaURL)
+				case slices.Contains(args, "--dump-single-json"):
+					// Paged playlists such as mixes & channel uploads are loaded a page at a time
+					return makeMockPlaylistOutput(extractorKey, mediaURL)
+				default:
+					return makeMockPlaylistEntryOutput(extractorKey, mediaURL)
+				}
+			}
+		}
+
+		yt := youtubeapi.NewYoutubeAPI()
+		yt.SetCmdExecutor(executor)
+
+		result, err := resolver.NewDefaultRegistry(yt).Resolve(context.Background(), input)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Resolver).To(Equal(expectedResolver))
+
+		recordedArgs := executor.RecordedArgs()
+		Expect(recordedArgs).To(HaveLen(1))
+		Expect(recordedArgs[0][0]).To(Equal(expectedArg))
+
+		if expectPlaylist {
+			Expect(result.Media).To(BeNil())
+			Expect(result.Playlist).NotTo(BeNil())
+			Eventually(result.Playlist.GetMediaCount).Should(Equal(1))
+
+			media, err := result.Playlist.ConsumeNextMedia()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(media.Link()).To(Equal(mediaURL))
+
+			Expect(media.EnsureLoaded(context.Background())).To(Succeed())
+			Expect(media.FileURL()).To(Equal("https://streamurl.example.com/audio"))
+
+			// Mixes may be refilled in the background after consuming
+			Expect(executor.RecordedArgs()).To(ContainElement(
+				WithTransform(func(args []string) string { return args[0] }, Equal(mediaURL)),
+			))
+		} else {
+			Expect(result.Playlist).To(BeNil())
+			Expect(result.Media).NotTo(BeNil())
+			Expect(result.Media.Title()).To(Equal("Mock Media"))
+			Expect(result.Media.Link()).To(Equal(mediaURL))
+		}
+	},
+		Entry("YouTube video", "https://www.youtube.com/watch?v=dQw4w9WgXcQ", "youtube", false,
+			"https://www.youtube.com/watch?v=dQw4w9WgXcQ", "Youtube", "https://www.youtube.com/watch?v=123"),
+		Entry("YouTube video in a playlist", "https://www.youtube.com/watch?v=123&list=PL123", "youtube", true,
+			"https://www.youtube.com/watch?v=123&list=PL123", "Youtube", "https://www.youtube.com/watch?v=123"),
+		Entry("YouTube short link", "https://youtu.be/dQw4w9WgXcQ", "youtube", false,
+			"https://www.youtube.com/watch?v=dQw4w9WgXcQ", "Youtube", "https://www.youtube.com/watch?v=123"),
+		Entry("YouTube playlist", "https://www.youtube.com/playlist?list=PL123", "youtube", true,
+			"https://www.youtube.com/playlist?list=PL123", "Youtube", "https://www.youtube.com/watch?v=123"),
+		Entry("YouTube mix", "https://www.youtube.com/watch?v=dQw4w9WgXcQ&list=RDdQw4w9WgXcQ", "youtube", true,
+			"https://www.youtube.com/watch?v=dQw4w9WgXcQ&list=RDdQw4w9WgXcQ", "Youtube", "https://www.youtube.com/watch?v=123"),
+		Entry("YouTube channel", "https://www.youtube.com/@artist", "youtube", true,
+			"https://www.youtube.com/@artist/videos", "Youtube", "https://www.youtube.com/watch?v=123"),
+		Entry("YouTube search", "never gonna give you up", "youtube", false,
+			"ytsearch:never gonna give you up", "Youtube", "https://www.youtube.com/watch?v=123"),
+		Entry("SoundCloud track", "https://soundcloud.com/artist/track", "soundcloud", false,
+			"https://soundcloud.com/artist/track", "Soundcloud", "https://soundcloud.com/artist/track"),
+		Entry("SoundCloud short link", "https://on.soundcloud.com/AbCdE", "soundcloud", false,
+			"https://on.soundcloud.com/AbCdE", "Soundcloud", "https://soundcloud.com/artist/track"),
+		Entry("SoundCloud set", "https://soundcloud.com/artist/sets/album", "soundcloud", true,
+			"https://soundcloud.com/artist/sets/album", "Soundcloud", "https://soundcloud.com/artist/track"),
+		Entry("SoundCloud user", "https://soundcloud.com/artist", "soundcloud", true,
+			"https://soundcloud.com/artist", "Soundcloud", "https://soundcloud.com/artist/track"),
+		Entry("Bandcamp track", "https://artist.bandcamp.com/track/song", "bandcamp", false,
+			"https://artist.bandcamp.com/track/song", "Bandcamp", "https://artist.bandcamp.com/track/song"),
+		Entry("Bandcamp album", "https://artist.bandcamp.com/album/record", "bandcamp", true,
+			"https://artist.bandcamp.com/album/record", "Bandcamp", "https://artist.bandcamp.com/track/song"),
+		Entry("Vimeo video", "https://vimeo.com/76979871", "vimeo", false,
+			"https://vimeo.com/76979871", "Vimeo", "https://vimeo.com/76979871"),
+		Entry("Vimeo video in a showcase", "https://vimeo.com/showcase/123/video/76979871", "vimeo", false,
+			"https://vimeo.com/showcase/123/video/76979871", "Vimeo", "https://vimeo.com/76979871"),
+		Entry("Vimeo showcase", "https://vimeo.com/showcase/123", "vimeo", true,
+			"https://vimeo.com/showcase/123", "Vimeo", "https://vimeo.com/76979871"),
+		Entry("Twitch live stream", "https://www.twitch.tv/streamer", "twitch", false,
+			"https://www.twitch.tv/streamer", "TwitchStream", "https://www.twitch.tv/streamer"),
+		Entry("Twitch broadcast", "https://www.twitch.tv/videos/123456", "twitch", false,
+			"https://www.twitch.tv/videos/123456", "TwitchVod", "https://www.twitch.tv/videos/123456"),
+		Entry("Twitch videos of a channel", "https://www.twitch.tv/streamer/videos", "twitch", true,
+			"https://www.twitch.tv/streamer/videos", "TwitchVod", "https://www.twitch.tv/videos/123456"),
+	)
+
+	It("Leaves other sites out of the default registry", func() {
+		executor := &testutils.MockCommandExecutor{}
+		yt := youtubeapi.NewYoutubeAPI()
+		yt.SetCmdExecutor(executor)
+
+		_, err := resolver.NewDefaultRegistry(yt).Resolve(context.Background(), "https://example.com/radio/stream")
+		Expect(err).To(MatchError(resolver.ErrorUnsupportedInput))
+		Expect(executor.RecordedArgs()).To(BeEmpty())
+	})
+
+	DescribeTable("Resolving other sites with the generic resolver",
+		func(input string, expectedErr error) {
+			executor := &testutils.MockCommandExecutor{MockStdoutResult: makeMockMediaOutput("Generic", input)}
+			yt := youtubeapi.NewYoutubeAPI()
+			yt.SetCmdExecutor(executor)
+
+			lookupIP := func(ctx context.Context, host string) ([]net.IPAddr, error) {
+				switch host {
+				case "example.com":
+					return []net.IPAddr{{IP: net.ParseIP("93.184.215.14")}}, nil
+				case "internal.example.com":
+					return []net.IPAddr{{IP: net.ParseIP("93.184.215.14")}, {IP: net.ParseIP("10.0.0.5")}}, nil
+				default:
+					return nil, errors.New("no such host")
+				}
+			}
+
+			registry := resolver.NewRegistry()
+			registry.Register(resolver.NewGenericResolverEx(yt, lookupIP))
+
+			result, err := registry.Resolve(context.Background(), input)
+
+			if expectedErr != nil {
+				Expect(err).To(MatchError(expectedErr))
+				Expect(executor.RecordedArgs()).To(BeEmpty())
+				return
+			}
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Resolver).To(Equal("generic"))
+			Expect(result.Media.Link()).To(Equal(input))
+			Expect(executor.RecordedArgs()[0][0]).To(Equal(input))
+		},
+		Entry("Public host", "https://example.com/radio/stream", nil),
+		Entry("Localhost", "http://localhost:8080/admin", resolver.ErrorForbiddenHost),
+		Entry("Loopback address", "http://127.0.0.1/admin", resolver.ErrorForbiddenHost),
+		Entry("Private address", "http://192.168.1.1/", resolver.ErrorForbiddenHost),
+		Entry("Cloud metadata address", "http://169.254.169.254/latest/meta-data/", resolver.ErrorForbiddenHost),
+		Entry("IPv6 loopback address", "http://[::1]/", resolver.ErrorForbiddenHost),
+		Entry("Host with a private address", "https://internal.example.com/stream", resolver.ErrorForbiddenHost),
+	)
+
+	It("Prefers resolvers registered first", func() {
+		registry := resolver.NewRegistry()
+		registry.Register(&MockResolver{host: "example.com"})
+		registry.Register(resolver.NewGenericResolver(youtubeapi.NewYoutubeAPI()))
+
+		result, err := registry.Resolve(context.Background(), "  https://example.com/song  ")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Resolver).To(Equal("mock"))
+	})
+
+	It("Returns sensible errors for input it can not resolve", func() {
+		registry := resolver.NewRegistry()
+		registry.Register(&MockResolver{host: "example.com"})
+
+		_, err := registry.Resolve(context.Background(), " ")
+		Expect(err).To(MatchError(resolver.ErrorEmptyInput))
+
+		_, err = registry.Resolve(context.Background(), "https://soundcloud.com/artist/track")
+		Expect(err).To(MatchError(resolver.ErrorUnsupportedInput))
+
+		// Searching is disabled without a search resolver
+		_, err = registry.Resolve(context.Background(), "example.com song")
+		Expect(err).To(MatchError(resolver.ErrorUnsupportedInput))
+
+		_, err = registry.Resolve(context.Background(), "ftp://example.com/song")
+		Expect(err).To(MatchError(resolver.ErrorUnsupportedInput))
+	})
+
+	It("Returns errors of the resolver", func() {
+		yt := youtubeapi.NewYoutubeAPI()
+		yt.SetCmdExecutor(&testutils.MockCommandExecutor{MockStderrResult: "ERROR: Unsupported URL", MockExitCode: 1})
+
+		result, err := resolver.NewDefaultRegistry(yt).Resolve(context.Background(), "https://vimeo.com/page")
+		Expect(result).To(BeNil())
+		Expect(err).To(HaveOccurred())
+		Expect(errors.Is(err, resolver.ErrorUnsupportedInput)).To(BeFalse())
+	})
+})
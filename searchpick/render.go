@@ -0,0 +1,124 @@
+package searchpick
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/fakelag/streaming-music-bot/utils"
+	"github.com/fakelag/streaming-music-bot/youtubeapi"
+)
+
+const (
+	// Max buttons in an action row
+	maxButtons = 5
+	// Max length of the label of a select menu option
+	maxLabelLength = 100
+)
+
+// Escapes characters formatting Discord markdown, such as "*" & "_"
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "*", `\*`, "_", `\_`, "~", `\~`, "`", "\\`", "|", `\|`,
+	">", `\>`, "#", `\#`, "[", `\[`, "]", `\]`, "(", `\(`, ")", `\)`,
+)
+
+// Escapes text, such as a search term or a video title, for message content
+func escapeMarkdown(text string) string {
+	return markdownEscaper.Replace(text)
+}
+
+// Mentions allowed in messages. None, so that search terms & titles can not ping anyone
+func noMentions() *discordgo.MessageAllowedMentions {
+	return &discordgo.MessageAllowedMentions{}
+}
+
+// Embeds of the results, numbered from 1
+func renderResults(results []*youtubeapi.YoutubeMedia) []*discordgo.MessageEmbed {
+	// Messages have at most 10 embeds, the select menu still lists all results
+	embeds := make([]*discordgo.MessageEmbed, 0, min(len(results), 10))
+
+	for index, media := range results[:min(len(results), 10)] {
+		embeds = append(embeds, renderResult(index, media))
+	}
+
+	return embeds
+}
+
+// Embed of a result. Not numbered if index is negative
+func renderResult(index int, media *youtubeapi.YoutubeMedia) *discordgo.MessageEmbed {
+	title := media.Title()
+
+	if index >= 0 {
+		title = fmt.Sprintf("%d. %s", index+1, title)
+	}
+
+	description := formatDuration(media.Duration())
+
+	if media.ChannelName != "" {
+		description += " · " + media.ChannelName
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title:       title,
+		URL:         media.Link(),
+		Description: description,
+	}
+
+	if thumbnail := media.Thumbnail(); thumbnail != "" {
+		embed.Thumbnail = &discordgo.MessageEmbedThumbnail{URL: thumbnail}
+	}
+
+	return embed
+}
+
+// Numbered buttons for 5 results or less, a select menu otherwise
+func renderComponents(searchID string, results []*youtubeapi.YoutubeMedia) []discordgo.MessageComponent {
+	if len(results) <= maxButtons {
+		buttons := make([]discordgo.MessageComponent, 0, len(results))
+
+		for index := range results {
+			buttons = append(buttons, discordgo.Button{
+				Label:    strconv.Itoa(index + 1),
+				Style:    discordgo.PrimaryButton,
+				CustomID: customIDPrefix + ":" + searchID + ":" + strconv.Itoa(index),
+			})
+		}
+
+		return []discordgo.MessageComponent{discordgo.ActionsRow{Components: buttons}}
+	}
+
+	options := make([]discordgo.SelectMenuOption, 0, len(results))
+
+	for index, media := range results {
+		options = append(options, discordgo.SelectMenuOption{
+			Label:       utils.TruncateString(fmt.Sprintf("%d. %s", index+1, media.Title()), maxLabelLength-3, "..."),
+			Value:       strconv.Itoa(index),
+			Description: formatDuration(media.Duration()),
+		})
+	}
+
+	return []discordgo.MessageComponent{discordgo.ActionsRow{
+		Components: []discordgo.MessageComponent{discordgo.SelectMenu{
+			CustomID:    customIDPrefix + ":" + searchID,
+			Placeholder: "Pick a result",
+			Options:     options,
+		}},
+	}}
+}
+
+// Formats as 3:05 or 1:02:05, or "Live" for media without a duration
+func formatDuration(duration *time.Duration) string {
+	if duration == nil {
+		return "Live"
+	}
+
+	seconds := int(duration.Seconds())
+
+	if seconds >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+	}
+
+	return fmt.Sprintf("%d:%02d", seconds/60, seconds%60)
+}
@@ -0,0 +1,390 @@
+package searchpick
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/fakelag/streaming-music-bot/discordplayer"
+	"github.com/fakelag/streaming-music-bot/youtubeapi"
+)
+
+var (
+	ErrorMissingSessions = errors.New("missing session manager")
+	ErrorMissingSearch   = errors.New("missing search function")
+	ErrorEmptySearch     = errors.New("empty search term")
+	ErrorNoResults       = errors.New("no search results")
+	ErrorSearchExpired   = errors.New("search expired")
+	ErrorNotSearchOwner  = errors.New("search belongs to another user")
+	ErrorInvalidPick     = errors.New("invalid search result picked")
+	ErrorNoSession       = errors.New("no music session in guild")
+)
+
+// Prefix of the custom ids of message components sent by the picker
+const customIDPrefix = "searchpick"
+
+// Max options of a select menu
+const maxResults = 25
+
+// Searches YouTube, such as Youtube.SearchYoutubeMedia
+type SearchFunc = func(ctx context.Context, numResults int, searchTerm string) ([]*youtubeapi.YoutubeMedia, error)
+
+type SessionManager interface {
+	// Returns nil if there is no session for the guild
+	GetMusicSession(guildID string) *discordplayer.DiscordMusicSession
+}
+
+// Responds to interactions, implemented by *discordgo.Session
+type InteractionResponder interface {
+	InteractionRespond(interaction *discordgo.Interaction, resp *discordgo.InteractionResponse, options ...discordgo.RequestOption) error
+	InteractionResponseEdit(interaction *discordgo.Interaction, newresp *discordgo.WebhookEdit, options ...discordgo.RequestOption) (*discordgo.Message, error)
+}
+
+type SearchPickerOptions struct {
+	// Sessions media is enqueued into. Required
+	Sessions SessionManager
+	// Required
+	Search SearchFunc
+	// Number of results shown, at most 25. Results are picked with buttons if there are
+	// 5 results or less, and with a select menu otherwise. Defaults to 5
+	NumResults int
+	// Time the user has to pick a result. Defaults to 60s
+	Timeout time.Duration
+}
+
+// Shows the results of a search command & enqueues the result the user picks
+type SearchPicker struct {
+	mutex      sync.Mutex
+	sessions   SessionManager
+	search     SearchFunc
+	numResults int
+	timeout    time.Duration
+	// Searches waiting for a pick by search id
+	searches map[string]*userSearch
+	// Search id of the search of each user, a user has one search at a time
+	userSearches map[string]string
+}
+
+type userSearch struct {
+	id      string
+	userID  string
+	guildID string
+	// Search command, edited when the search times out
+	interaction *discordgo.Interaction
+	results     []*youtubeapi.YoutubeMedia
+	timer       *time.Timer
+	expiresAt   time.Time
+}
+
+func NewSearchPicker(options *SearchPickerOptions) (*SearchPicker, error) {
+	if options.Sessions == nil {
+		return nil, ErrorMissingSessions
+	}
+
+	if options.Search == nil {
+		return nil, ErrorMissingSearch
+	}
+
+	numResults := options.NumResults
+
+	if numResults <= 0 {
+		numResults = 5
+	}
+
+	timeout := options.Timeout
+
+	if timeout <= 0 {
+		timeout = 60 * time.Second
+	}
+
+	return &SearchPicker{
+		sessions:     options.Sessions,
+		search:       options.Search,
+		numResults:   min(numResults, maxResults),
+		timeout:      timeout,
+		searches:     make(map[string]*userSearch),
+		userSearches: make(map[string]string),
+	}, nil
+}
+
+// Searches for searchTerm & responds to the command interaction with the results. A previous
+// search of the same user is replaced. Returns the error also shown to the user, if any
+func (picker *SearchPicker) HandleSearchCommand(
+	ctx context.Context,
+	responder InteractionResponder,
+	interaction *discordgo.InteractionCreate,
+	searchTerm string,
+) error {
+	searchTerm = strings.TrimSpace(searchTerm)
+
+	if searchTerm == "" {
+		return respondError(responder, interaction.Interaction, ErrorEmptySearch)
+	}
+
+	// Searching takes longer than Discord waits for a response
+	err := responder.InteractionRespond(interaction.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	results, err := picker.search(ctx, picker.numResults, searchTerm)
+
+	if err == nil && len(results) == 0 {
+		err = ErrorNoResults
+	}
+
+	if err != nil {
+		content := "Search failed: " + escapeMarkdown(err.Error())
+		responder.InteractionResponseEdit(interaction.Interaction, &discordgo.WebhookEdit{
+			Content:         &content,
+			AllowedMentions: noMentions(),
+		})
+		return err
+	}
+
+	search := picker.addSearch(responder, interaction, results[:min(len(results), picker.numResults)])
+
+	content := "Results for **" + escapeMarkdown(searchTerm) + "**"
+	embeds := renderResults(search.results)
+	components := renderComponents(search.id, search.results)
+
+	_, err = responder.InteractionResponseEdit(interaction.Interaction, &discordgo.WebhookEdit{
+		Content:         &content,
+		Embeds:          &embeds,
+		Components:      &components,
+		AllowedMentions: noMentions(),
+	})
+
+	return err
+}
+
+// Enqueues the result picked from a search message. Returns false if the interaction
+// is not a pick of a search, in which case it is not responded to
+func (picker *SearchPicker) HandleComponent(responder InteractionResponder, interaction *discordgo.InteractionCreate) (bool, error) {
+	if interaction.Type != discordgo.InteractionMessageComponent {
+		return false, nil
+	}
+
+	data := interaction.MessageComponentData()
+	searchID, index, ok := parseCustomID(data)
+
+	if !ok {
+		return false, nil
+	}
+
+	search, err := picker.takeSearch(searchID, interactionUserID(interaction.Interaction), index)
+
+	if err != nil {
+		return true, respondError(responder, interaction.Interaction, err)
+	}
+
+	media := search.results[index]
+	session := picker.sessions.GetMusicSession(search.guildID)
+
+	if session == nil {
+		picker.putBackSearch(search)
+		return true, respondError(responder, interaction.Interaction, ErrorNoSession)
+	}
+
+	if err := session.EnqueueMedia(media); err != nil {
+		// Such as a full queue, the user can pick again
+		picker.putBackSearch(search)
+		return true, respondError(responder, interaction.Interaction, err)
+	}
+
+	if !session.IsWorkerActive() {
+		if _, err := session.Start(); err != nil && !errors.Is(err, discordplayer.ErrorWorkerAlreadyActive) {
+			return true, respondError(responder, interaction.Interaction, err)
+		}
+	}
+
+	return true, responder.InteractionRespond(interaction.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Content:         "Enqueued **" + escapeMarkdown(media.Title()) + "**",
+			Embeds:          []*discordgo.MessageEmbed{renderResult(-1, media)},
+			Components:      []discordgo.MessageComponent{},
+			AllowedMentions: noMentions(),
+		},
+	})
+}
+
+func (picker *SearchPicker) addSearch(
+	responder InteractionResponder,
+	interaction *discordgo.InteractionCreate,
+	results []*youtubeapi.YoutubeMedia,
+) *userSearch {
+	picker.mutex.Lock()
+	defer picker.mutex.Unlock()
+
+	userID := interactionUserID(interaction.Interaction)
+
+	if previousID, ok := picker.userSearches[userID]; ok {
+		picker.removeSearch(picker.searches[previousID])
+	}
+
+	search := &userSearch{
+		id:          newSearchID(),
+		userID:      userID,
+		guildID:     interaction.GuildID,
+		interaction: interaction.Interaction,
+		results:     results,
+		expiresAt:   time.Now().Add(picker.timeout),
+	}
+
+	search.timer = time.AfterFunc(picker.timeout, func() {
+		picker.expireSearch(responder, search)
+	})
+
+	picker.searches[search.id] = search
+	picker.userSearches[userID] = search.id
+
+	return search
+}
+
+// Removes the search, so that a result can be picked only once. Put back with
+// putBackSearch if the pick fails
+func (picker *SearchPicker) takeSearch(searchID string, userID string, index int) (*userSearch, error) {
+	picker.mutex.Lock()
+	defer picker.mutex.Unlock()
+
+	search, ok := picker.searches[searchID]
+
+	if !ok {
+		return nil, ErrorSearchExpired
+	}
+
+	if search.userID != userID {
+		return nil, ErrorNotSearchOwner
+	}
+
+	if index < 0 || index >= len(search.results) {
+		return nil, ErrorInvalidPick
+	}
+
+	picker.removeSearch(search)
+	return search, nil
+}
+
+// Makes a taken search pickable again until it expires, unless the user has started
+// another search meanwhile
+func (picker *SearchPicker) putBackSearch(search *userSearch) {
+	picker.mutex.Lock()
+	defer picker.mutex.Unlock()
+
+	if _, ok := picker.userSearches[search.userID]; ok {
+		return
+	}
+
+	picker.searches[search.id] = search
+	picker.userSearches[search.userID] = search.id
+	search.timer.Reset(max(time.Until(search.expiresAt), 0))
+}
+
+func (picker *SearchPicker) expireSearch(responder InteractionResponder, search *userSearch) {
+	picker.mutex.Lock()
+
+	if picker.searches[search.id] != search {
+		// Picked or replaced
+		picker.mutex.Unlock()
+		return
+	}
+
+	picker.removeSearch(search)
+	picker.mutex.Unlock()
+
+	content := "Search timed out"
+	components := []discordgo.MessageComponent{}
+
+	responder.InteractionResponseEdit(search.interaction, &discordgo.WebhookEdit{
+		Content:         &content,
+		Components:      &components,
+		AllowedMentions: noMentions(),
+	})
+}
+
+// mutex needs to be locked
+func (picker *SearchPicker) removeSearch(search *userSearch) {
+	if search == nil {
+		return
+	}
+
+	search.timer.Stop()
+	delete(picker.searches, search.id)
+
+	if picker.userSearches[search.userID] == search.id {
+		delete(picker.userSearches, search.userID)
+	}
+}
+
+// Random, so that buttons of searches from before a restart do not pick results of new searches
+func newSearchID() string {
+	id := make([]byte, 8)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// Returns the search id & the index of the picked result
+func parseCustomID(data discordgo.MessageComponentInteractionData) (string, int, bool) {
+	parts := strings.Split(data.CustomID, ":")
+
+	if len(parts) < 2 || parts[0] != customIDPrefix {
+		return "", 0, false
+	}
+
+	value := ""
+
+	switch {
+	case len(parts) == 3:
+		// Button
+		value = parts[2]
+	case len(data.Values) == 1:
+		// Select menu
+		value = data.Values[0]
+	default:
+		return "", 0, false
+	}
+
+	index, err := strconv.Atoi(value)
+
+	if err != nil {
+		return "", 0, false
+	}
+
+	return parts[1], index, true
+}
+
+func interactionUserID(interaction *discordgo.Interaction) string {
+	if interaction.Member != nil && interaction.Member.User != nil {
+		return interaction.Member.User.ID
+	}
+
+	if interaction.User != nil {
+		return interaction.User.ID
+	}
+
+	return ""
+}
+
+// Responds with a message visible only to the user. Returns err
+func respondError(responder InteractionResponder, interaction *discordgo.Interaction, err error) error {
+	responder.InteractionRespond(interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content:         "Error: " + escapeMarkdown(err.Error()),
+			Flags:           discordgo.MessageFlagsEphemeral,
+			AllowedMentions: noMentions(),
+		},
+	})
+
+	return err
+}
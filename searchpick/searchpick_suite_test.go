@@ -0,0 +1,13 @@
+package searchpick_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestSearchPick(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "SearchPick Suite")
+}
@@ -0,0 +1,345 @@
+package searchpick_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/mock/gomock"
+
+	"github.com/fakelag/streaming-music-bot/discordplayer"
+	. "github.com/fakelag/streaming-music-bot/discordplayer/mocks"
+	"github.com/fakelag/streaming-music-bot/searchpick"
+	"github.com/fakelag/streaming-music-bot/youtubeapi"
+)
+
+const (
+	gID = "xxx-guild-id"
+	cID = "xxx-channel-id"
+)
+
+type MockSessionManager struct {
+	sessions map[string]*discordplayer.DiscordMusicSession
+}
+
+func (msm *MockSessionManager) GetMusicSession(guildID string) *discordplayer.DiscordMusicSession {
+	return msm.sessions[guildID]
+}
+
+// Records responses & edits of interactions
+type MockResponder struct {
+	sync.Mutex
+	responses []*discordgo.InteractionResponse
+	edits     []*discordgo.WebhookEdit
+}
+
+func (mr *MockResponder) InteractionRespond(interaction *discordgo.Interaction, resp *discordgo.InteractionResponse, options ...discordgo.RequestOption) error {
+	mr.Lock()
+	defer mr.Unlock()
+	mr.responses = append(mr.responses, resp)
+	return nil
+}
+
+func (mr *MockResponder) InteractionResponseEdit(interaction *discordgo.Interaction, newresp *discordgo.WebhookEdit, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	mr.Lock()
+	defer mr.Unlock()
+	mr.edits = append(mr.edits, newresp)
+	return &discordgo.Message{}, nil
+}
+
+func (mr *MockResponder) LastResponse() *discordgo.InteractionResponse {
+	mr.Lock()
+	defer mr.Unlock()
+	return mr.responses[len(mr.responses)-1]
+}
+
+func (mr *MockResponder) LastEdit() *discordgo.WebhookEdit {
+	mr.Lock()
+	defer mr.Unlock()
+
+	if len(mr.edits) == 0 {
+		return nil
+	}
+
+	return mr.edits[len(mr.edits)-1]
+}
+
+func makeMockResults(numResults int) []*youtubeapi.YoutubeMedia {
+	results := make([]*youtubeapi.YoutubeMedia, numResults)
+
+	for index := range results {
+		results[index] = &youtubeapi.YoutubeMedia{
+			ID:             fmt.Sprintf("%d", index),
+			VideoTitle:     fmt.Sprintf("Result %d", index+1),
+			VideoLink:      fmt.Sprintf("https://www.youtube.com/watch?v=%d", index),
+			VideoThumbnail: fmt.Sprintf("https://i.ytimg.com/vi/%d/hq.jpg", index),
+			VideoDuration:  time.Duration(index+1) * 65 * time.Second,
+			StreamURL:      "streamurl",
+		}
+	}
+
+	return results
+}
+
+func makeCommand(userID string) *discordgo.InteractionCreate {
+	return &discordgo.InteractionCreate{Interaction: &discordgo.Interaction{
+		Type:    discordgo.InteractionApplicationCommand,
+		GuildID: gID,
+		Member:  &discordgo.Member{User: &discordgo.User{ID: userID}},
+	}}
+}
+
+func makePick(userID string, customID string, values ...string) *discordgo.InteractionCreate {
+	return &discordgo.InteractionCreate{Interaction: &discordgo.Interaction{
+		Type:    discordgo.InteractionMessageComponent,
+		GuildID: gID,
+		Member:  &discordgo.Member{User: &discordgo.User{ID: userID}},
+		Data:    discordgo.MessageComponentInteractionData{CustomID: customID, Values: values},
+	}}
+}
+
+type PickerTestContext struct {
+	picker    *searchpick.SearchPicker
+	responder *MockResponder
+	dms       *discordplayer.DiscordMusicSession
+}
+
+func NewPickerTestContext(ctrl *gomock.Controller, numResults int, timeout time.Duration) *PickerTestContext {
+	mockDiscordSession := NewMockDiscordSession(ctrl)
+	mockDiscordSession.EXPECT().
+		ChannelVoiceJoin(gID, cID, false, false).
+		Return(nil, errors.New("no voice in tests")).
+		AnyTimes()
+
+	dms, err := discordplayer.NewDiscordMusicSessionEx(context.TODO(), NewMockDiscordAudio(ctrl), mockDiscordSession, 100*time.Millisecond, &discordplayer.DiscordMusicSessionOptions{
+		GuildID:           gID,
+		VoiceChannelID:    cID,
+		MediaQueueMaxSize: 10,
+	})
+	Expect(err).NotTo(HaveOccurred())
+	DeferCleanup(func() { dms.Leave() })
+
+	picker, err := searchpick.NewSearchPicker(&searchpick.SearchPickerOptions{
+		Sessions: &MockSessionManager{sessions: map[string]*discordplayer.DiscordMusicSession{gID: dms}},
+		Search: func(ctx context.Context, n int, searchTerm string) ([]*youtubeapi.YoutubeMedia, error) {
+			if searchTerm == "nothing" {
+				return nil, nil
+			}
+
+			return makeMockResults(n), nil
+		},
+		NumResults: numResults,
+		Timeout:    timeout,
+	})
+	Expect(err).NotTo(HaveOccurred())
+
+	return &PickerTestContext{
+		picker:    picker,
+		responder: &MockResponder{},
+		dms:       dms,
+	}
+}
+
+func (ptc *PickerTestContext) Search(userID string, searchTerm string) (*discordgo.WebhookEdit, error) {
+	err := ptc.picker.HandleSearchCommand(context.Background(), ptc.responder, makeCommand(userID), searchTerm)
+	return ptc.responder.LastEdit(), err
+}
+
+func customIDs(edit *discordgo.WebhookEdit) []string {
+	ids := make([]string, 0)
+
+	for _, row := range *edit.Components {
+		for _, component := range row.(discordgo.ActionsRow).Components {
+			switch component := component.(type) {
+			case discordgo.Button:
+				ids = append(ids, component.CustomID)
+			case discordgo.SelectMenu:
+				ids = append(ids, component.CustomID)
+			}
+		}
+	}
+
+	return ids
+}
+
+var _ = Describe("Search picker", func() {
+	It("Requires a session manager & a search function", func() {
+		_, err := searchpick.NewSearchPicker(&searchpick.SearchPickerOptions{})
+		Expect(err).To(MatchError(searchpick.ErrorMissingSessions))
+
+		_, err = searchpick.NewSearchPicker(&searchpick.SearchPickerOptions{Sessions: &MockSessionManager{}})
+		Expect(err).To(MatchError(searchpick.ErrorMissingSearch))
+	})
+
+	It("Shows results with buttons & enqueues the picked result", func() {
+		ctrl := gomock.NewController(GinkgoT())
+		pickerContext := NewPickerTestContext(ctrl, 0, time.Minute)
+
+		edit, err := pickerContext.Search("user", "lofi")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pickerContext.responder.responses[0].Type).To(Equal(discordgo.InteractionResponseDeferredChannelMessageWithSource))
+		Expect(*edit.Content).To(Equal("Results for **lofi**"))
+		Expect(*edit.Embeds).To(HaveLen(5))
+		Expect((*edit.Embeds)[1].Title).To(Equal("2. Result 2"))
+		Expect((*edit.Embeds)[1].Description).To(Equal("2:10"))
+		Expect((*edit.Embeds)[1].Thumbnail.URL).To(Equal("https://i.ytimg.com/vi/1/hq.jpg"))
+
+		ids := customIDs(edit)
+		Expect(ids).To(HaveLen(5))
+
+		handled, err := pickerContext.picker.HandleComponent(pickerContext.responder, makePick("another-user", ids[1]))
+		Expect(handled).To(BeTrue())
+		Expect(err).To(MatchError(searchpick.ErrorNotSearchOwner))
+		Expect(pickerContext.responder.LastResponse().Data.Flags).To(Equal(discordgo.MessageFlagsEphemeral))
+
+		handled, err = pickerContext.picker.HandleComponent(pickerContext.responder, makePick("user", ids[1]))
+		Expect(handled).To(BeTrue())
+		Expect(err).NotTo(HaveOccurred())
+
+		response := pickerContext.responder.LastResponse()
+		Expect(response.Type).To(Equal(discordgo.InteractionResponseUpdateMessage))
+		Expect(response.Data.Content).To(Equal("Enqueued **Result 2**"))
+		Expect(response.Data.Components).To(BeEmpty())
+		Expect(pickerContext.dms.IsWorkerActive()).To(BeTrue())
+
+		// A result can be picked once
+		_, err = pickerContext.picker.HandleComponent(pickerContext.responder, makePick("user", ids[0]))
+		Expect(err).To(MatchError(searchpick.ErrorSearchExpired))
+	})
+
+	It("Escapes markdown & allows no mentions in messages", func() {
+		ctrl := gomock.NewController(GinkgoT())
+		pickerContext := NewPickerTestContext(ctrl, 0, time.Minute)
+
+		edit, err := pickerContext.Search("user", "@everyone **lofi**")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(*edit.Content).To(Equal(`Results for **@everyone \*\*lofi\*\***`))
+		Expect(edit.AllowedMentions).To(Equal(&discordgo.MessageAllowedMentions{}))
+
+		ids := customIDs(edit)
+		Expect(ids[0]).To(MatchRegexp(`^searchpick:[0-9a-f]{16}:0$`))
+
+		// Search ids are not reused by other searches
+		otherEdit, err := pickerContext.Search("another-user", "lofi")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(customIDs(otherEdit)[0]).NotTo(Equal(ids[0]))
+
+		_, err = pickerContext.picker.HandleComponent(pickerContext.responder, makePick("user", ids[0]))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pickerContext.responder.LastResponse().Data.AllowedMentions).To(Equal(&discordgo.MessageAllowedMentions{}))
+
+		_, err = pickerContext.picker.HandleComponent(pickerContext.responder, makePick("user", ids[0]))
+		Expect(err).To(MatchError(searchpick.ErrorSearchExpired))
+		Expect(pickerContext.responder.LastResponse().Data.AllowedMentions).To(Equal(&discordgo.MessageAllowedMentions{}))
+	})
+
+	It("Shows a select menu for more than 5 results", func() {
+		ctrl := gomock.NewController(GinkgoT())
+		pickerContext := NewPickerTestContext(ctrl, 8, time.Minute)
+
+		edit, err := pickerContext.Search("user", "lofi")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(*edit.Embeds).To(HaveLen(8))
+
+		ids := customIDs(edit)
+		Expect(ids).To(HaveLen(1))
+
+		handled, err := pickerContext.picker.HandleComponent(pickerContext.responder, makePick("user", ids[0], "8"))
+		Expect(handled).To(BeTrue())
+		Expect(err).To(MatchError(searchpick.ErrorInvalidPick))
+
+		_, err = pickerContext.picker.HandleComponent(pickerContext.responder, makePick("user", ids[0], "7"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pickerContext.responder.LastResponse().Data.Content).To(Equal("Enqueued **Result 8**"))
+	})
+
+	It("Replaces the previous search of the user", func() {
+		ctrl := gomock.NewController(GinkgoT())
+		pickerContext := NewPickerTestContext(ctrl, 0, time.Minute)
+
+		edit, err := pickerContext.Search("user", "lofi")
+		Expect(err).NotTo(HaveOccurred())
+		previousIDs := customIDs(edit)
+
+		edit, err = pickerContext.Search("user", "jazz")
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = pickerContext.picker.HandleComponent(pickerContext.responder, makePick("user", previousIDs[0]))
+		Expect(err).To(MatchError(searchpick.ErrorSearchExpired))
+
+		_, err = pickerContext.picker.HandleComponent(pickerContext.responder, makePick("user", customIDs(edit)[0]))
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("Keeps the search when enqueueing the picked result fails", func() {
+		ctrl := gomock.NewController(GinkgoT())
+		pickerContext := NewPickerTestContext(ctrl, 0, time.Minute)
+
+		for _, media := range makeMockResults(10) {
+			Expect(pickerContext.dms.EnqueueMedia(media)).To(Succeed())
+		}
+
+		edit, err := pickerContext.Search("user", "lofi")
+		Expect(err).NotTo(HaveOccurred())
+		ids := customIDs(edit)
+
+		handled, err := pickerContext.picker.HandleComponent(pickerContext.responder, makePick("user", ids[0]))
+		Expect(handled).To(BeTrue())
+		Expect(err).To(MatchError(discordplayer.ErrorMediaQueueFull))
+
+		pickerContext.dms.ClearMediaQueue()
+
+		_, err = pickerContext.picker.HandleComponent(pickerContext.responder, makePick("user", ids[0]))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pickerContext.responder.LastResponse().Data.Content).To(Equal("Enqueued **Result 1**"))
+	})
+
+	It("Times out searches", func() {
+		ctrl := gomock.NewController(GinkgoT())
+		pickerContext := NewPickerTestContext(ctrl, 0, 100*time.Millisecond)
+
+		edit, err := pickerContext.Search("user", "lofi")
+		Expect(err).NotTo(HaveOccurred())
+		ids := customIDs(edit)
+
+		Eventually(func() string {
+			return *pickerContext.responder.LastEdit().Content
+		}).WithTimeout(2 * time.Second).WithPolling(20 * time.Millisecond).Should(Equal("Search timed out"))
+
+		Expect(*pickerContext.responder.LastEdit().Components).To(BeEmpty())
+
+		_, err = pickerContext.picker.HandleComponent(pickerContext.responder, makePick("user", ids[0]))
+		Expect(err).To(MatchError(searchpick.ErrorSearchExpired))
+	})
+
+	It("Returns errors of searches without results", func() {
+		ctrl := gomock.NewController(GinkgoT())
+		pickerContext := NewPickerTestContext(ctrl, 0, time.Minute)
+
+		edit, err := pickerContext.Search("user", "nothing")
+		Expect(err).To(MatchError(searchpick.ErrorNoResults))
+		Expect(*edit.Content).To(ContainSubstring("no search results"))
+
+		_, err = pickerContext.Search("user", "  ")
+		Expect(err).To(MatchError(searchpick.ErrorEmptySearch))
+	})
+
+	It("Ignores other interactions", func() {
+		ctrl := gomock.NewController(GinkgoT())
+		pickerContext := NewPickerTestContext(ctrl, 0, time.Minute)
+
+		handled, err := pickerContext.picker.HandleComponent(pickerContext.responder, makePick("user", "other:1"))
+		Expect(handled).To(BeFalse())
+		Expect(err).NotTo(HaveOccurred())
+
+		handled, err = pickerContext.picker.HandleComponent(pickerContext.responder, makeCommand("user"))
+		Expect(handled).To(BeFalse())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pickerContext.responder.responses).To(BeEmpty())
+	})
+})
@@ -0,0 +1,187 @@
+package sponsorblock
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/fakelag/streaming-music-bot/entities"
+	"github.com/fakelag/streaming-music-bot/youtubeapi"
+)
+
+// Segment categories of the SponsorBlock API
+const (
+	CategorySponsor       = "sponsor"
+	CategorySelfPromotion = "selfpromo"
+	CategoryInteraction   = "interaction"
+	CategoryIntro         = "intro"
+	CategoryOutro         = "outro"
+	CategoryPreview       = "preview"
+	CategoryFiller        = "filler"
+	// Non-music section of a music video
+	CategoryMusicOffTopic = "music_offtopic"
+)
+
+const (
+	DefaultBaseURL = "https://sponsor.ajay.app"
+
+	actionTypeSkip = "skip"
+)
+
+var (
+	ErrorUnexpectedStatus = errors.New("unexpected sponsorblock api status")
+)
+
+type SponsorBlockOptions struct {
+	// Url of the SponsorBlock API. Defaults to DefaultBaseURL
+	BaseURL string
+	// Categories requested from the API. Defaults to all categories
+	Categories []string
+	// Client used for API requests. Defaults to a client with a 10 second timeout
+	HTTPClient *http.Client
+}
+
+// Segment provider for YouTube videos using the SponsorBlock API (https://sponsor.ajay.app).
+// Implements entities.SegmentProvider
+type SponsorBlock struct {
+	baseURL    string
+	categories []string
+	httpClient *http.Client
+}
+
+type skipSegment struct {
+	Category   string     `json:"category"`
+	ActionType string     `json:"actionType"`
+	Segment    [2]float64 `json:"segment"`
+}
+
+func NewSponsorBlock(options *SponsorBlockOptions) *SponsorBlock {
+	baseURL := options.BaseURL
+
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+
+	categories := options.Categories
+
+	if len(categories) == 0 {
+		categories = AllCategories()
+	}
+
+	httpClient := options.HTTPClient
+
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	return &SponsorBlock{
+		baseURL:    baseURL,
+		categories: slices.Clone(categories),
+		httpClient: httpClient,
+	}
+}
+
+// Categories skipped by SponsorBlock clients, excluding highlights & chapters
+func AllCategories() []string {
+	return []string{
+		CategorySponsor,
+		CategorySelfPromotion,
+		CategoryInteraction,
+		CategoryIntro,
+		CategoryOutro,
+		CategoryPreview,
+		CategoryFiller,
+		CategoryMusicOffTopic,
+	}
+}
+
+// Returns the skip segments of a YouTube video. Media that is not a YouTube video has no segments
+func (sb *SponsorBlock) Segments(ctx context.Context, media entities.Media) ([]entities.Segment, error) {
+	videoID := mediaVideoID(media)
+
+	if videoID == "" {
+		return []entities.Segment{}, nil
+	}
+
+	categoriesJson, err := json.Marshal(sb.categories)
+
+	if err != nil {
+		return nil, err
+	}
+
+	query := url.Values{}
+	query.Set("videoID", videoID)
+	query.Set("categories", string(categoriesJson))
+	query.Set("actionType", actionTypeSkip)
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, sb.baseURL+"/api/skipSegments?"+query.Encode(), nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := sb.httpClient.Do(request)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer response.Body.Close()
+
+	switch response.StatusCode {
+	case http.StatusOK:
+		break
+	case http.StatusNotFound:
+		// No segments submitted for the video
+		return []entities.Segment{}, nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrorUnexpectedStatus, response.Status)
+	}
+
+	var skipSegments []*skipSegment
+
+	if err := json.NewDecoder(response.Body).Decode(&skipSegments); err != nil {
+		return nil, err
+	}
+
+	segments := make([]entities.Segment, 0, len(skipSegments))
+
+	for _, skipSegment := range skipSegments {
+		if skipSegment.ActionType != "" && skipSegment.ActionType != actionTypeSkip {
+			continue
+		}
+
+		start := time.Duration(skipSegment.Segment[0] * float64(time.Second))
+		end := time.Duration(skipSegment.Segment[1] * float64(time.Second))
+
+		if end <= start {
+			continue
+		}
+
+		segments = append(segments, entities.Segment{
+			Category: skipSegment.Category,
+			Start:    start,
+			End:      end,
+		})
+	}
+
+	slices.SortStableFunc(segments, func(a entities.Segment, b entities.Segment) int {
+		return cmp.Compare(a.Start, b.Start)
+	})
+
+	return segments, nil
+}
+
+func mediaVideoID(media entities.Media) string {
+	if youtubeMedia, ok := media.(*youtubeapi.YoutubeMedia); ok && youtubeMedia.ID != "" {
+		return youtubeMedia.ID
+	}
+
+	return youtubeapi.GetVideoIDFromURL(media.Link())
+}
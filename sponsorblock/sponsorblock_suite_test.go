@@ -0,0 +1,13 @@
+package sponsorblock_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestSponsorBlock(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "SponsorBlock Suite")
+}
@@ -0,0 +1,109 @@
+package sponsorblock_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/fakelag/streaming-music-bot/entities"
+	"github.com/fakelag/streaming-music-bot/sponsorblock"
+	"github.com/fakelag/streaming-music-bot/youtubeapi"
+)
+
+const segmentsJson = `[
+	{"category": "outro", "actionType": "skip", "segment": [280.5, 300.0], "UUID": "c", "videoDuration": 300.0},
+	{"category": "music_offtopic", "actionType": "skip", "segment": [0.0, 12.25], "UUID": "a", "videoDuration": 300.0},
+	{"category": "sponsor", "actionType": "mute", "segment": [100.0, 110.0], "UUID": "b", "videoDuration": 300.0}
+]`
+
+var _ = Describe("SponsorBlock", func() {
+	var server *httptest.Server
+	var requests chan *url.URL
+	var status int
+
+	BeforeEach(func() {
+		requests = make(chan *url.URL, 10)
+		status = http.StatusOK
+
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests <- r.URL
+
+			if status != http.StatusOK {
+				w.WriteHeader(status)
+				return
+			}
+
+			_, _ = w.Write([]byte(segmentsJson))
+		}))
+
+		DeferCleanup(server.Close)
+	})
+
+	It("Returns skip segments of a video in playback order", func() {
+		sb := sponsorblock.NewSponsorBlock(&sponsorblock.SponsorBlockOptions{
+			BaseURL:    server.URL,
+			Categories: []string{sponsorblock.CategoryMusicOffTopic, sponsorblock.CategoryOutro},
+		})
+
+		segments, err := sb.Segments(context.Background(), &youtubeapi.YoutubeMedia{ID: "dQw4w9WgXcQ"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(segments).To(Equal([]entities.Segment{
+			{Category: sponsorblock.CategoryMusicOffTopic, Start: 0, End: 12250 * time.Millisecond},
+			{Category: sponsorblock.CategoryOutro, Start: 280500 * time.Millisecond, End: 300 * time.Second},
+		}))
+
+		var requestURL *url.URL
+		Expect(requests).To(Receive(&requestURL))
+		Expect(requestURL.Path).To(Equal("/api/skipSegments"))
+		Expect(requestURL.Query().Get("videoID")).To(Equal("dQw4w9WgXcQ"))
+		Expect(requestURL.Query().Get("actionType")).To(Equal("skip"))
+
+		var categories []string
+		Expect(json.Unmarshal([]byte(requestURL.Query().Get("categories")), &categories)).To(Succeed())
+		Expect(categories).To(Equal([]string{"music_offtopic", "outro"}))
+	})
+
+	It("Reads the video id from the link of other media", func() {
+		sb := sponsorblock.NewSponsorBlock(&sponsorblock.SponsorBlockOptions{BaseURL: server.URL})
+
+		_, err := sb.Segments(context.Background(), &youtubeapi.YoutubeMedia{VideoLink: "https://youtu.be/dQw4w9WgXcQ"})
+		Expect(err).NotTo(HaveOccurred())
+
+		var requestURL *url.URL
+		Expect(requests).To(Receive(&requestURL))
+		Expect(requestURL.Query().Get("videoID")).To(Equal("dQw4w9WgXcQ"))
+
+		var categories []string
+		Expect(json.Unmarshal([]byte(requestURL.Query().Get("categories")), &categories)).To(Succeed())
+		Expect(categories).To(Equal(sponsorblock.AllCategories()))
+	})
+
+	It("Returns no segments for videos without submissions or media that is not a video", func() {
+		sb := sponsorblock.NewSponsorBlock(&sponsorblock.SponsorBlockOptions{BaseURL: server.URL})
+		status = http.StatusNotFound
+
+		segments, err := sb.Segments(context.Background(), &youtubeapi.YoutubeMedia{ID: "dQw4w9WgXcQ"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(segments).To(BeEmpty())
+		Expect(requests).To(HaveLen(1))
+
+		segments, err = sb.Segments(context.Background(), &youtubeapi.YoutubeMedia{VideoLink: "https://example.com/song.opus"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(segments).To(BeEmpty())
+		Expect(requests).To(HaveLen(1))
+	})
+
+	It("Returns an error for unexpected statuses", func() {
+		sb := sponsorblock.NewSponsorBlock(&sponsorblock.SponsorBlockOptions{BaseURL: server.URL})
+		status = http.StatusBadRequest
+
+		_, err := sb.Segments(context.Background(), &youtubeapi.YoutubeMedia{ID: "dQw4w9WgXcQ"})
+		Expect(err).To(MatchError(sponsorblock.ErrorUnexpectedStatus))
+	})
+})
@@ -1,31 +1,101 @@
 package testutils
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"time"
+	"slices"
+	"strings"
+	"sync"
+
+	cmd "github.com/fakelag/streaming-music-bot/command"
 )
 
 type MockCommandExecutor struct {
 	MockStdoutResult string
+	// Returns the stdout of each command by its arguments. Overrides MockStdoutResult if set
+	MockStdoutFunc   func(args []string) string
+	MockStderrResult string
 	MockExitCode     int
+	// Blocks the command until ctx is done, as if the process never exited. In streaming
+	// mode stdout lines are emitted before blocking
+	MockBlockUntilDone bool
+
+	mutex sync.Mutex
+	args  [][]string
+}
+
+// Returns the arguments of each command run, in order
+func (command *MockCommandExecutor) RecordedArgs() [][]string {
+	command.mutex.Lock()
+	defer command.mutex.Unlock()
+	return slices.Clone(command.args)
 }
 
-func (command *MockCommandExecutor) RunCommandWithTimeout(
+func (command *MockCommandExecutor) RunCommand(
+	ctx context.Context,
 	executable string,
-	timeout time.Duration,
 	args ...string,
-) (chan *string, chan error) {
-	resultChannel := make(chan *string, 1)
-	errorChannel := make(chan error, 1)
-
-	go func() {
-		if command.MockExitCode != 0 {
-			errorChannel <- errors.New(fmt.Sprintf("exit status %d", command.MockExitCode))
-		} else {
-			resultChannel <- &command.MockStdoutResult
+) (*cmd.CommandResult, error) {
+	command.mutex.Lock()
+	command.args = append(command.args, args)
+	command.mutex.Unlock()
+
+	result := &cmd.CommandResult{
+		Stdout:   command.stdout(args),
+		Stderr:   command.MockStderrResult,
+		ExitCode: command.MockExitCode,
+	}
+
+	if command.MockBlockUntilDone {
+		<-ctx.Done()
+		result.ExitCode = -1
+
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return result, fmt.Errorf("%w: %w", cmd.ErrorCommandTimeout, ctx.Err())
 		}
-	}()
 
-	return resultChannel, errorChannel
+		return result, ctx.Err()
+	}
+
+	if command.MockExitCode != 0 {
+		return result, &cmd.CommandError{
+			ExitCode: command.MockExitCode,
+			Stderr:   command.MockStderrResult,
+			Err:      errors.New(fmt.Sprintf("exit status %d", command.MockExitCode)),
+		}
+	}
+
+	return result, nil
+}
+
+func (command *MockCommandExecutor) RunCommandStreaming(
+	ctx context.Context,
+	onStdoutLine func(line string) error,
+	executable string,
+	args ...string,
+) (*cmd.CommandResult, error) {
+	if stdout := command.stdout(args); stdout != "" {
+		for _, line := range strings.Split(stdout, "\n") {
+			if err := onStdoutLine(line); err != nil {
+				return &cmd.CommandResult{ExitCode: -1}, err
+			}
+		}
+	}
+
+	result, err := command.RunCommand(ctx, executable, args...)
+
+	if result != nil {
+		result.Stdout = ""
+	}
+
+	return result, err
+}
+
+func (command *MockCommandExecutor) stdout(args []string) string {
+	if command.MockStdoutFunc != nil {
+		return command.MockStdoutFunc(args)
+	}
+
+	return command.MockStdoutResult
 }
@@ -0,0 +1,11 @@
+package utils
+
+import (
+	"io"
+	"log/slog"
+)
+
+// Logger that discards all records, used when no logger is configured
+func NewDiscardLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelError + 1}))
+}
@@ -1,6 +1,10 @@
 package utils
 
-import "unicode"
+import (
+	"net/url"
+	"strings"
+	"unicode"
+)
 
 func TruncateString(str string, maxLen int, suffix string) string {
 	currentIndex := 0
@@ -19,3 +23,16 @@ func TruncateString(str string, maxLen int, suffix string) string {
 
 	return str
 }
+
+// Non-empty segments of the url path
+func PathSegments(inputUrl *url.URL) []string {
+	segments := make([]string, 0)
+
+	for _, segment := range strings.Split(inputUrl.Path, "/") {
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+
+	return segments
+}
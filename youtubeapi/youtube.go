@@ -1,19 +1,24 @@
 package youtubeapi
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log/slog"
 	"math/rand"
 	"net/url"
 	"os/exec"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	cmd "github.com/fakelag/streaming-music-bot/command"
 	"github.com/fakelag/streaming-music-bot/entities"
+	"github.com/fakelag/streaming-music-bot/metrics"
+	"github.com/fakelag/streaming-music-bot/utils"
 )
 
 var (
@@ -23,6 +28,9 @@ var (
 	ErrorNoPlaylistFound    = errors.New("no playlist found")
 )
 
+// yt-dlp extractor key of YouTube videos
+const youtubeExtractorKey = "Youtube"
+
 type YtDlpObject struct {
 	// "playlist", "video"
 	Type string `json:"_type"`
@@ -37,6 +45,16 @@ type YtDlpVideoFormat struct {
 	Resolution     string  `json:"resolution"`
 	FileSize       int     `json:"filesize"`
 	FileSizeApprox int     `json:"filesize_approx"`
+	// "none" for formats without audio
+	Acodec string `json:"acodec"`
+	// "none" for formats without video
+	Vcodec string `json:"vcodec"`
+	// Audio bitrate in kbit/s
+	Abr float64 `json:"abr"`
+	// Total bitrate in kbit/s
+	Tbr             float64 `json:"tbr"`
+	Protocol        string  `json:"protocol"`
+	FragmentBaseURL string  `json:"fragment_base_url"`
 }
 
 type YtDlpVideo struct {
@@ -46,6 +64,37 @@ type YtDlpVideo struct {
 	Duration     int    `json:"duration"`
 	Thumbnail    string `json:"thumbnail"`
 	IsLiveStream bool   `json:"is_live"`
+	Channel      string `json:"channel"`
+	ChannelURL   string `json:"channel_url"`
+	Uploader     string `json:"uploader"`
+	UploaderURL  string `json:"uploader_url"`
+	// YYYYMMDD
+	UploadDate  string          `json:"upload_date"`
+	ViewCount   int64           `json:"view_count"`
+	LikeCount   int64           `json:"like_count"`
+	Description string          `json:"description"`
+	Tags        []string        `json:"tags"`
+	Chapters    []*YtDlpChapter `json:"chapters"`
+	// Music metadata, available for some songs. Older yt-dlp versions set only artist
+	Artists []string `json:"artists"`
+	Artist  string   `json:"artist"`
+	Album   string   `json:"album"`
+	// Details of the format selected by yt-dlp
+	FormatID string  `json:"format_id"`
+	Ext      string  `json:"ext"`
+	Acodec   string  `json:"acodec"`
+	Abr      float64 `json:"abr"`
+	Tbr      float64 `json:"tbr"`
+	// yt-dlp extractor of the video, such as "Youtube" or "Soundcloud"
+	ExtractorKey string `json:"extractor_key"`
+	WebpageURL   string `json:"webpage_url"`
+}
+
+type YtDlpChapter struct {
+	Title string `json:"title"`
+	// Seconds
+	StartTime float64 `json:"start_time"`
+	EndTime   float64 `json:"end_time"`
 }
 
 type YtDlpVideoWithFormats struct {
@@ -66,6 +115,22 @@ type YtDlpPlayListEntry struct {
 	Duration   int                      `json:"duration"`
 	LiveStatus string                   `json:"live_status"`
 	Thumbnails []YtDlpPlayListThumbnail `json:"thumbnails"`
+	Channel    string                   `json:"channel"`
+	ChannelURL string                   `json:"channel_url"`
+	Uploader   string                   `json:"uploader"`
+	ViewCount  int64                    `json:"view_count"`
+	URL        string                   `json:"url"`
+	// yt-dlp extractor of the entry, such as "Youtube" or "Soundcloud"
+	IEKey string `json:"ie_key"`
+}
+
+// Entry printed by yt-dlp for each video with --flat-playlist --dump-json
+type YtDlpFlatPlayListEntry struct {
+	YtDlpPlayListEntry
+	PlaylistID    string `json:"playlist_id"`
+	PlaylistTitle string `json:"playlist_title"`
+	PlaylistCount int    `json:"playlist_count"`
+	PlaylistURL   string `json:"playlist_webpage_url"`
 }
 
 type YtDlpPlayList struct {
@@ -80,16 +145,29 @@ type YtDlpPlayList struct {
 type Youtube struct {
 	executor             cmd.CommandExecutor
 	streamUrlTimeout     time.Duration
+	playlistLoadTimeout  time.Duration
 	streamUrlExpireRegex *regexp.Regexp
 	ytdlpArgs            []string
+	metrics              metrics.Metrics
+	logger               *slog.Logger
+	cache                *MediaCache
+	scheduler            *YtDlpScheduler
+	retryPolicy          *RetryPolicy
+	circuitBreaker       *CircuitBreaker
+	formatPolicy         *FormatPolicy
+	searchOptions        *SearchOptions
 }
 
 func NewYoutubeAPI() *Youtube {
 	yt := &Youtube{
 		executor:             &cmd.DefaultCommandExecutor{},
 		streamUrlTimeout:     time.Second * 30,
+		playlistLoadTimeout:  time.Minute * 10,
 		streamUrlExpireRegex: regexp.MustCompile("(expire)(\\/|=)(\\d+)(\\/|=|&|$)"),
 		ytdlpArgs:            make([]string, 0),
+		metrics:              &metrics.NoopMetrics{},
+		logger:               utils.NewDiscardLogger(),
+		scheduler:            NewYtDlpScheduler(nil),
 	}
 
 	return yt
@@ -103,7 +181,87 @@ func (yt *Youtube) SetYtDlpArgs(extraArgs []string) {
 	yt.ytdlpArgs = extraArgs
 }
 
-func (yt *Youtube) SearchYoutubeMedia(numSearchResults int, videoIdOrSearchTerm string) ([]*YoutubeMedia, error) {
+func (yt *Youtube) SetMetrics(m metrics.Metrics) {
+	yt.metrics = m
+}
+
+// Caches media resolved by video id, so that replaying recent media does not run yt-dlp.
+// Caching is disabled by default, pass nil to disable it again
+func (yt *Youtube) SetCache(cache *MediaCache) {
+	yt.cache = cache
+}
+
+func (yt *Youtube) GetCache() *MediaCache {
+	return yt.cache
+}
+
+// Limits concurrency & rate of yt-dlp processes. Identical concurrent invocations, such as
+// lookups of the same video, share one process. Defaults to a scheduler running at most 4
+// processes at once, one of them kept free for interactive lookups, without a rate limit.
+// Pass nil to run every invocation immediately
+func (yt *Youtube) SetScheduler(scheduler *YtDlpScheduler) {
+	yt.scheduler = scheduler
+}
+
+func (yt *Youtube) GetScheduler() *YtDlpScheduler {
+	return yt.scheduler
+}
+
+// Retries transient yt-dlp failures, such as DefaultRetryPolicy(). Disabled by default
+func (yt *Youtube) SetRetryPolicy(policy *RetryPolicy) {
+	yt.retryPolicy = policy
+}
+
+// Fast-fails yt-dlp invocations with ErrorCircuitOpen while yt-dlp is failing consistently.
+// Disabled by default
+func (yt *Youtube) SetCircuitBreaker(breaker *CircuitBreaker) {
+	yt.circuitBreaker = breaker
+}
+
+// Returns nil if no circuit breaker is set. The state of the breaker can be used for health checks
+func (yt *Youtube) GetCircuitBreaker() *CircuitBreaker {
+	return yt.circuitBreaker
+}
+
+// Selects the played stream from the formats of a video instead of using the stream
+// yt-dlp selects, such as DefaultFormatPolicy(). If no format is suitable, the stream
+// selected by yt-dlp is used. Disabled by default
+func (yt *Youtube) SetFormatPolicy(policy *FormatPolicy) {
+	yt.formatPolicy = policy
+}
+
+func (yt *Youtube) GetFormatPolicy() *FormatPolicy {
+	return yt.formatPolicy
+}
+
+// Logs yt-dlp command lines with credentials redacted, failures and their stderr output
+func (yt *Youtube) SetLogger(logger *slog.Logger) {
+	yt.logger = logger
+}
+
+func (yt *Youtube) SearchYoutubeMedia(ctx context.Context, numSearchResults int, videoIdOrSearchTerm string) ([]*YoutubeMedia, error) {
+	searchResults := make([]*YoutubeMedia, 0)
+
+	err := yt.SearchYoutubeMediaStreaming(ctx, numSearchResults, videoIdOrSearchTerm, func(media *YoutubeMedia) error {
+		searchResults = append(searchResults, media)
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return searchResults, nil
+}
+
+// Calls onMedia for each search result as soon as yt-dlp has resolved it. Searching
+// is stopped if onMedia returns an error, which is then returned
+func (yt *Youtube) SearchYoutubeMediaStreaming(
+	ctx context.Context,
+	numSearchResults int,
+	videoIdOrSearchTerm string,
+	onMedia func(media *YoutubeMedia) error,
+) error {
 	replacer := strings.NewReplacer(
 		"\"", "",
 		"'", "",
@@ -129,73 +287,66 @@ func (yt *Youtube) SearchYoutubeMedia(numSearchResults int, videoIdOrSearchTerm
 		args = append(args, yt.ytdlpArgs...)
 	}
 
-	stdout, err := yt.YtDlpExec(yt.streamUrlTimeout, args)
-
-	if err != nil {
-		return nil, err
-	}
-
-	searchResults := make([]*YoutubeMedia, 0)
-
-	if len(*stdout) == 0 {
-		return searchResults, nil
-	}
-
-	jsonLines := strings.Split(*stdout, "\n")
-
-	if len(jsonLines) < 2 {
-		return searchResults, nil
-	}
-
-	for i := 0; i < len(jsonLines); i += 2 {
-		videoStreamURL := jsonLines[i]
-
-		if videoStreamURL == "" {
-			continue
-		}
-
-		videoJson := jsonLines[i+1]
-
-		if videoJson == "" {
-			continue
+	parser := newYtDlpOutputParser(yt, func(media *YoutubeMedia) error {
+		if yt.cache != nil {
+			yt.cache.Set(media)
 		}
+		return onMedia(media)
+	})
+	return yt.YtDlpExecStreaming(ctx, yt.streamUrlTimeout, args, parser.parseLine)
+}
 
-		var object YtDlpObject
-		if err := json.Unmarshal([]byte(videoJson), &object); err != nil {
-			return nil, err
-		}
+func (yt *Youtube) GetYoutubeMedia(ctx context.Context, videoIdOrSearchTerm string) (*YoutubeMedia, error) {
+	videoArg := videoIdOrSearchTerm
 
-		if object.Type != "video" {
-			continue
-		}
+	videoID := GetVideoIDFromURL(videoIdOrSearchTerm)
 
-		media, _, err := yt.getMediaOrPlaylistFromJsonAndStreamURL(&object, videoJson, videoStreamURL)
+	if videoID == "" && yt.searchOptions != nil {
+		results, err := yt.SearchRankedYoutubeMedia(ctx, yt.searchOptions, videoIdOrSearchTerm)
 
 		if err != nil {
 			return nil, err
 		}
 
-		if media == nil {
-			continue
+		if len(results) == 0 {
+			return nil, ErrorNoVideoFound
 		}
 
-		searchResults = append(searchResults, media)
+		return results[0], nil
 	}
 
-	return searchResults, nil
-}
-
-func (yt *Youtube) GetYoutubeMedia(videoIdOrSearchTerm string) (*YoutubeMedia, error) {
-	videoArg := videoIdOrSearchTerm
-
-	videoID := getYoutubeUrlVideoId(videoIdOrSearchTerm)
-
 	if videoID == "" {
 		videoArg = "ytsearch:" + videoIdOrSearchTerm
 	} else {
 		videoArg = "https://www.youtube.com/watch?v=" + videoID
 	}
 
+	if videoID != "" && yt.cache != nil {
+		if entry := yt.cache.Get(videoID, true); entry != nil {
+			return entry.toMedia(yt), nil
+		}
+	}
+
+	media, err := yt.getMedia(ctx, videoArg)
+
+	if err == nil && yt.cache != nil {
+		yt.cache.Set(media)
+	}
+
+	return media, err
+}
+
+// Returns the media of a url of any site supported by yt-dlp, such as SoundCloud or Vimeo.
+// YouTube urls are loaded with GetYoutubeMedia. Media of other sites is not cached
+func (yt *Youtube) GetMediaFromURL(ctx context.Context, mediaUrl string) (*YoutubeMedia, error) {
+	if GetVideoIDFromURL(mediaUrl) != "" {
+		return yt.GetYoutubeMedia(ctx, mediaUrl)
+	}
+
+	return yt.getMedia(ctx, mediaUrl)
+}
+
+func (yt *Youtube) getMedia(ctx context.Context, videoArg string) (*YoutubeMedia, error) {
 	replacer := strings.NewReplacer(
 		"\"", "",
 		"'", "",
@@ -219,7 +370,7 @@ func (yt *Youtube) GetYoutubeMedia(videoIdOrSearchTerm string) (*YoutubeMedia, e
 		args = append(args, yt.ytdlpArgs...)
 	}
 
-	stdout, err := yt.YtDlpExec(yt.streamUrlTimeout, args)
+	stdout, err := yt.YtDlpExec(ctx, yt.streamUrlTimeout, args)
 
 	if err != nil {
 		return nil, err
@@ -251,7 +402,15 @@ func (yt *Youtube) GetYoutubeMedia(videoIdOrSearchTerm string) (*YoutubeMedia, e
 	return media, err
 }
 
-func (yt *Youtube) GetYoutubePlaylist(playlistIdOrUrl string) (*YoutubePlaylist, error) {
+// Loads all entries of a playlist, streaming them in the background with GetYoutubePlaylistStreaming
+// so that playback of large playlists can start right away. Use GetYoutubePlaylistWithOptions to
+// select the entries to load
+func (yt *Youtube) GetYoutubePlaylist(ctx context.Context, playlistIdOrUrl string) (*YoutubePlaylist, error) {
+	return yt.GetYoutubePlaylistStreaming(ctx, playlistIdOrUrl)
+}
+
+// Loads the flat playlist. If items is not empty, only the entries in it are loaded, such as "1:50"
+func (yt *Youtube) getYtDlpPlaylist(ctx context.Context, playlistIdOrUrl string, items string) (*YtDlpPlayList, error) {
 	replacer := strings.NewReplacer(
 		"\"", "",
 		"'", "",
@@ -269,11 +428,15 @@ func (yt *Youtube) GetYoutubePlaylist(playlistIdOrUrl string) (*YoutubePlaylist,
 		"--flat-playlist",
 	}
 
+	if items != "" {
+		args = append(args, "--playlist-items", items)
+	}
+
 	if len(yt.ytdlpArgs) > 0 {
 		args = append(args, yt.ytdlpArgs...)
 	}
 
-	stdout, err := yt.YtDlpExec(yt.streamUrlTimeout, args)
+	stdout, err := yt.YtDlpExec(ctx, yt.streamUrlTimeout, args)
 
 	if err != nil {
 		return nil, err
@@ -292,13 +455,99 @@ func (yt *Youtube) GetYoutubePlaylist(playlistIdOrUrl string) (*YoutubePlaylist,
 		return nil, ErrorUnrecognisedObject
 	}
 
-	_, playList, err := yt.getMediaOrPlaylistFromJsonAndStreamURL(&object, *stdout, "")
-	return playList, err
+	var ytDlpPlaylist YtDlpPlayList
+	if err := json.Unmarshal([]byte(*stdout), &ytDlpPlaylist); err != nil {
+		return nil, err
+	}
+
+	return &ytDlpPlaylist, nil
+}
+
+// Loads a playlist entry by entry in the background and returns it as soon as its first entry
+// has been loaded, so that playback can start before the rest of a large playlist is loaded.
+// Loading stops when ctx is done, see YoutubePlaylist.IsLoading and YoutubePlaylist.LoadError
+func (yt *Youtube) GetYoutubePlaylistStreaming(ctx context.Context, playlistIdOrUrl string) (*YoutubePlaylist, error) {
+	replacer := strings.NewReplacer(
+		"\"", "",
+		"'", "",
+	)
+
+	args := []string{
+		replacer.Replace(playlistIdOrUrl),
+		"--quiet",
+		"--ignore-errors",
+		"--no-color",
+		"--dump-json",
+		"--flat-playlist",
+	}
+
+	if len(yt.ytdlpArgs) > 0 {
+		args = append(args, yt.ytdlpArgs...)
+	}
+
+	rngSource := rand.NewSource(time.Now().Unix())
+	rng := rand.New(rngSource)
+
+	playList := NewYoutubePlaylist("", "", playlistIdOrUrl, rng, 0)
+	playList.loading = true
+
+	// Closed when the first entry has been added or loading has finished
+	firstEntryLoaded := make(chan struct{})
+	closeFirstEntryLoaded := sync.OnceFunc(func() { close(firstEntryLoaded) })
+
+	var parser *ytDlpOutputParser
+	isFirstEntry := true
+
+	parser = newYtDlpOutputParser(yt, func(media *YoutubeMedia) error {
+		if isFirstEntry {
+			// Playlist details are only written before the playlist is returned
+			playList.ID = parser.playlistID
+			playList.PlaylistTitle = parser.playlistTitle
+
+			if parser.playlistURL != "" {
+				playList.PlaylistLink = parser.playlistURL
+			}
+
+			isFirstEntry = false
+		}
+
+		playList.appendMedia(media)
+		closeFirstEntryLoaded()
+		return nil
+	})
+
+	loadCtx := ctx
+
+	if _, ok := ytDlpPriorityFromContext(ctx); !ok {
+		loadCtx = WithYtDlpPriority(ctx, YtDlpPriorityBackground)
+	}
+
+	go func() {
+		err := yt.YtDlpExecStreaming(loadCtx, yt.playlistLoadTimeout, args, parser.parseLine)
+		playList.finishLoading(err)
+		closeFirstEntryLoaded()
+	}()
+
+	select {
+	case <-firstEntryLoaded:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	if playList.GetMediaCount() == 0 && !playList.IsLoading() {
+		if err := playList.LoadError(); err != nil {
+			return nil, err
+		}
+
+		return nil, ErrorNoPlaylistFound
+	}
+
+	return playList, nil
 }
 
-func (yt *Youtube) ListFormats(videoIdOrUrl string) ([]*YtDlpVideoFormat, error) {
+func (yt *Youtube) ListFormats(ctx context.Context, videoIdOrUrl string) ([]*YtDlpVideoFormat, error) {
 	videoArg := videoIdOrUrl
-	videoID := getYoutubeUrlVideoId(videoIdOrUrl)
+	videoID := GetVideoIDFromURL(videoIdOrUrl)
 
 	if videoID == "" {
 		videoArg = videoIdOrUrl
@@ -326,7 +575,7 @@ func (yt *Youtube) ListFormats(videoIdOrUrl string) ([]*YtDlpVideoFormat, error)
 		args = append(args, yt.ytdlpArgs...)
 	}
 
-	stdout, err := yt.YtDlpExec(yt.streamUrlTimeout, args)
+	stdout, err := yt.YtDlpExec(ctx, yt.streamUrlTimeout, args)
 
 	if err != nil {
 		return nil, err
@@ -361,21 +610,199 @@ func (yt *Youtube) ListFormats(videoIdOrUrl string) ([]*YtDlpVideoFormat, error)
 	return videoWithFormats.Formats, nil
 }
 
-func (yt *Youtube) YtDlpExec(timeout time.Duration, args []string) (*string, error) {
+// Runs yt-dlp with args until it exits, timeout elapses or ctx is done, killing the process
+// if it is still running
+func (yt *Youtube) YtDlpExec(ctx context.Context, timeout time.Duration, args []string) (*string, error) {
+	result, err := yt.ytDlpRun(ctx, timeout, args, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &result.Stdout, nil
+}
+
+// Like YtDlpExec, but calls onStdoutLine for each line of output as soon as yt-dlp prints it.
+// yt-dlp is killed if onStdoutLine returns an error
+func (yt *Youtube) YtDlpExecStreaming(
+	ctx context.Context,
+	timeout time.Duration,
+	args []string,
+	onStdoutLine func(line string) error,
+) error {
+	_, err := yt.ytDlpRun(ctx, timeout, args, onStdoutLine)
+	return err
+}
+
+func (yt *Youtube) ytDlpRun(
+	ctx context.Context,
+	timeout time.Duration,
+	args []string,
+	onStdoutLine func(line string) error,
+) (*cmd.CommandResult, error) {
+	run := func(ctx context.Context) (*cmd.CommandResult, error) {
+		return yt.ytDlpRunWithRetries(ctx, timeout, args, onStdoutLine)
+	}
+
+	// Output of streaming invocations goes to the callback of a single caller
+	if yt.scheduler == nil || onStdoutLine != nil {
+		return run(ctx)
+	}
+
+	return yt.scheduler.coalesce(ctx, strings.Join(args, "\x00"), run)
+}
+
+func (yt *Youtube) ytDlpRunWithRetries(
+	ctx context.Context,
+	timeout time.Duration,
+	args []string,
+	onStdoutLine func(line string) error,
+) (*cmd.CommandResult, error) {
+	retryPolicy := yt.retryPolicy
+	hasOutput := false
+
+	if onStdoutLine != nil {
+		callerOnStdoutLine := onStdoutLine
+		onStdoutLine = func(line string) error {
+			hasOutput = true
+			return callerOnStdoutLine(line)
+		}
+	}
+
+	for attempt := 1; ; attempt++ {
+		result, err := yt.ytDlpRunAttempt(ctx, timeout, args, onStdoutLine)
+
+		if err == nil ||
+			retryPolicy == nil ||
+			attempt >= retryPolicy.MaxAttempts ||
+			hasOutput ||
+			ctx.Err() != nil ||
+			!retryPolicy.isRetryable(err) {
+			return result, err
+		}
+
+		backoff := retryPolicy.backoff(attempt)
+
+		yt.logger.Info(
+			"retrying yt-dlp",
+			slog.Int("attempt", attempt),
+			slog.Duration("backoff", backoff),
+			slog.Any("error", err),
+		)
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (yt *Youtube) ytDlpRunAttempt(
+	ctx context.Context,
+	timeout time.Duration,
+	args []string,
+	onStdoutLine func(line string) error,
+) (*cmd.CommandResult, error) {
+	breaker := yt.circuitBreaker
+	var probe uint64
+
+	if breaker != nil {
+		var err error
+		if probe, err = breaker.allow(); err != nil {
+			return nil, err
+		}
+	}
+
+	if yt.scheduler != nil {
+		release, err := yt.scheduler.acquire(ctx)
+
+		if err != nil {
+			// Queueing for a slot says nothing about yt-dlp
+			if breaker != nil {
+				breaker.cancel(probe)
+			}
+			return nil, err
+		}
+
+		defer release()
+	}
+
+	result, err := yt.ytDlpRunNow(ctx, timeout, args, onStdoutLine)
+
+	if breaker != nil {
+		if ctx.Err() != nil {
+			// yt-dlp was stopped by the caller
+			breaker.cancel(probe)
+		} else {
+			breaker.record(probe, err)
+		}
+	}
+
+	return result, err
+}
+
+func (yt *Youtube) ytDlpRunNow(
+	ctx context.Context,
+	timeout time.Duration,
+	args []string,
+	onStdoutLine func(line string) error,
+) (*cmd.CommandResult, error) {
 	ytDlp, err := getYtDlpPath()
 
 	if err != nil {
 		return nil, err
 	}
 
-	resultChannel, errorChannel := yt.executor.RunCommandWithTimeout(ytDlp, timeout, args...)
+	commandLine := strings.Join(redactYtDlpArgs(args), " ")
+	yt.logger.Debug("running yt-dlp", slog.String("args", commandLine))
 
-	select {
-	case result := <-resultChannel:
+	execCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	startedAt := time.Now()
+
+	var result *cmd.CommandResult
+
+	if onStdoutLine != nil {
+		result, err = yt.executor.RunCommandStreaming(execCtx, onStdoutLine, ytDlp, args...)
+	} else {
+		result, err = yt.executor.RunCommand(execCtx, ytDlp, args...)
+	}
+
+	if err == nil {
+		yt.metrics.YtDlpCall(time.Since(startedAt), metrics.YtDlpResultSuccess)
+		yt.logger.Debug("yt-dlp finished", slog.String("args", commandLine), slog.Duration("duration", time.Since(startedAt)))
 		return result, nil
-	case err := <-errorChannel:
+	}
+
+	if errors.Is(err, cmd.ErrorCommandTimeout) {
+		yt.metrics.YtDlpCall(time.Since(startedAt), metrics.YtDlpResultTimeout)
+	} else {
+		yt.metrics.YtDlpCall(time.Since(startedAt), metrics.YtDlpResultFailure)
+	}
+
+	if errors.Is(err, context.Canceled) {
+		yt.logger.Debug("yt-dlp cancelled", slog.String("args", commandLine), slog.Duration("duration", time.Since(startedAt)))
 		return nil, err
 	}
+
+	stderr := ""
+
+	if result != nil {
+		stderr = strings.TrimSpace(result.Stderr)
+	}
+
+	err = classifyYtDlpError(err)
+
+	yt.logger.Warn(
+		"yt-dlp failed",
+		slog.String("args", commandLine),
+		slog.Duration("duration", time.Since(startedAt)),
+		slog.String("stderr", stderr),
+		slog.Any("error", err),
+	)
+	return nil, err
 }
 
 func NewYoutubePlaylist(
@@ -390,10 +817,11 @@ func NewYoutubePlaylist(
 		ID:                   playlistID,
 		PlaylistTitle:        playlistTitle,
 		PlaylistLink:         playlistLink,
-		rng:                  rng,
+		picker:               entities.NewConsumeOrderPicker[*YoutubeMedia](rng),
 		removeMediaOnConsume: true,
 		consumeOrder:         entities.ConsumeOrderFromStart,
 		mediaList:            make([]*YoutubeMedia, numEntries),
+		playedMedia:          make(map[*YoutubeMedia]bool),
 	}
 
 	for index, entry := range entries {
@@ -403,7 +831,8 @@ func NewYoutubePlaylist(
 	return pl
 }
 
-func getYoutubeUrlVideoId(urlString string) string {
+// Returns the video id of a YouTube video url, or an empty string if the url is not one
+func GetVideoIDFromURL(urlString string) string {
 	parsedUrl, err := url.Parse(urlString)
 
 	if err != nil {
@@ -431,7 +860,7 @@ func (yt *Youtube) getMediaOrPlaylistFromJsonAndStreamURL(
 	videoStreamURL string,
 ) (*YoutubeMedia, *YoutubePlaylist, error) {
 	if object.Type == "video" {
-		var ytDlpVideo YtDlpVideo
+		var ytDlpVideo YtDlpVideoWithFormats
 		if err := json.Unmarshal([]byte(ytdlpJson), &ytDlpVideo); err != nil {
 			return nil, nil, err
 		}
@@ -442,12 +871,25 @@ func (yt *Youtube) getMediaOrPlaylistFromJsonAndStreamURL(
 			VideoThumbnail:    ytDlpVideo.Thumbnail,
 			VideoIsLiveStream: ytDlpVideo.IsLiveStream,
 			VideoDuration:     time.Duration(ytDlpVideo.Duration) * time.Second,
-			VideoLink:         "https://www.youtube.com/watch?v=" + ytDlpVideo.ID,
+			VideoLink:         videoLink(ytDlpVideo.ID, ytDlpVideo.ExtractorKey, ytDlpVideo.WebpageURL),
+			Extractor:         ytDlpVideo.ExtractorKey,
 			StreamURL:         videoStreamURL,
+			FormatID:          ytDlpVideo.FormatID,
+			AudioCodec:        ytDlpVideo.Acodec,
+			AudioContainer:    ytDlpVideo.Ext,
+			AudioBitrate:      ytDlpVideo.Abr,
 			ytAPI:             yt,
 		}
 
-		streamExpireUnixSecondsMatch := yt.streamUrlExpireRegex.FindStringSubmatch(videoStreamURL)
+		if media.AudioBitrate <= 0 {
+			media.AudioBitrate = ytDlpVideo.Tbr
+		}
+
+		setMediaMetadata(media, &ytDlpVideo.YtDlpVideo)
+
+		yt.applyFormatPolicy(media, ytDlpVideo.Formats)
+
+		streamExpireUnixSecondsMatch := yt.streamUrlExpireRegex.FindStringSubmatch(media.StreamURL)
 
 		if len(streamExpireUnixSecondsMatch) >= 4 {
 			unixSeconds, err := strconv.ParseInt(streamExpireUnixSecondsMatch[3], 10, 64)
@@ -471,26 +913,7 @@ func (yt *Youtube) getMediaOrPlaylistFromJsonAndStreamURL(
 		playList := NewYoutubePlaylist(ytDlpPlaylist.ID, ytDlpPlaylist.Title, ytDlpPlaylist.PlaylistURL, rng, len(ytDlpPlaylist.Entries))
 
 		for index, video := range ytDlpPlaylist.Entries {
-			thumbnailUrl := ""
-			thumbnailWidth := 0
-
-			for _, thumbnail := range video.Thumbnails {
-				if thumbnail.Width > thumbnailWidth {
-					thumbnailUrl = thumbnail.URL
-					thumbnailWidth = thumbnail.Width
-				}
-			}
-
-			playList.mediaList[index] = &YoutubeMedia{
-				ID:                video.ID,
-				VideoTitle:        video.Title,
-				VideoThumbnail:    thumbnailUrl,
-				VideoIsLiveStream: video.LiveStatus == "is_live",
-				VideoDuration:     time.Duration(video.Duration) * time.Second,
-				VideoLink:         "https://www.youtube.com/watch?v=" + video.ID,
-				StreamURL:         "",
-				ytAPI:             yt,
-			}
+			playList.mediaList[index] = yt.getMediaFromPlaylistEntry(video)
 		}
 
 		return nil, playList, nil
@@ -499,6 +922,160 @@ func (yt *Youtube) getMediaOrPlaylistFromJsonAndStreamURL(
 	}
 }
 
+// Replaces the stream selected by yt-dlp with the format selected by the format policy
+func (yt *Youtube) applyFormatPolicy(media *YoutubeMedia, formats []*YtDlpVideoFormat) {
+	if yt.formatPolicy == nil {
+		return
+	}
+
+	format, err := yt.formatPolicy.SelectFormat(formats)
+
+	if err != nil {
+		yt.logger.Debug(
+			"no format matches format policy, using format selected by yt-dlp",
+			slog.String("media_id", media.ID),
+			slog.String("format_id", media.FormatID),
+		)
+		return
+	}
+
+	media.StreamURL = format.Url
+	media.FormatID = format.FormatID
+	media.AudioCodec = format.Acodec
+	media.AudioContainer = format.Ext
+	media.AudioBitrate = format.AudioBitrate()
+
+	yt.logger.Debug(
+		"selected format",
+		slog.String("media_id", media.ID),
+		slog.String("format_id", format.FormatID),
+		slog.String("codec", format.Acodec),
+		slog.Float64("bitrate", media.AudioBitrate),
+	)
+}
+
+// Media from a flat playlist entry has no stream url, it is loaded with EnsureLoaded before playing
+func (yt *Youtube) getMediaFromPlaylistEntry(video *YtDlpPlayListEntry) *YoutubeMedia {
+	thumbnailUrl := ""
+	thumbnailWidth := 0
+
+	for _, thumbnail := range video.Thumbnails {
+		if thumbnail.Width > thumbnailWidth {
+			thumbnailUrl = thumbnail.URL
+			thumbnailWidth = thumbnail.Width
+		}
+	}
+
+	channelName := video.Channel
+
+	if channelName == "" {
+		channelName = video.Uploader
+	}
+
+	return &YoutubeMedia{
+		ID:                video.ID,
+		VideoTitle:        video.Title,
+		VideoThumbnail:    thumbnailUrl,
+		VideoIsLiveStream: video.LiveStatus == "is_live",
+		VideoDuration:     time.Duration(video.Duration) * time.Second,
+		VideoLink:         videoLink(video.ID, video.IEKey, video.URL),
+		Extractor:         video.IEKey,
+		StreamURL:         "",
+		ChannelName:       channelName,
+		ChannelURL:        video.ChannelURL,
+		ViewCount:         video.ViewCount,
+		ytAPI:             yt,
+	}
+}
+
+// Links of YouTube videos are built from their id, other sites link to the page of the video
+func videoLink(videoID string, extractorKey string, webpageURL string) string {
+	if extractorKey == "" || extractorKey == youtubeExtractorKey || webpageURL == "" {
+		return "https://www.youtube.com/watch?v=" + videoID
+	}
+
+	return webpageURL
+}
+
+// Copies the details of a video other than its title, duration & stream to media
+func setMediaMetadata(media *YoutubeMedia, video *YtDlpVideo) {
+	media.ChannelName = video.Channel
+	media.ChannelURL = video.ChannelURL
+
+	// Channel fields are missing for some older videos
+	if media.ChannelName == "" {
+		media.ChannelName = video.Uploader
+	}
+
+	if media.ChannelURL == "" {
+		media.ChannelURL = video.UploaderURL
+	}
+
+	if uploadDate, err := time.Parse("20060102", video.UploadDate); err == nil {
+		media.UploadDate = &uploadDate
+	}
+
+	media.ViewCount = video.ViewCount
+	media.LikeCount = video.LikeCount
+	media.Description = video.Description
+	media.Tags = video.Tags
+	media.MusicArtist = video.Artist
+	media.MusicAlbum = video.Album
+
+	if len(video.Artists) > 0 {
+		media.MusicArtist = strings.Join(video.Artists, ", ")
+	}
+
+	media.VideoChapters = nil
+
+	for _, chapter := range video.Chapters {
+		media.VideoChapters = append(media.VideoChapters, entities.Chapter{
+			Title: chapter.Title,
+			Start: time.Duration(chapter.StartTime * float64(time.Second)),
+			End:   time.Duration(chapter.EndTime * float64(time.Second)),
+		})
+	}
+}
+
+// yt-dlp options whose values are credentials or may contain them
+var ytDlpSecretArgs = map[string]bool{
+	"-u":               true,
+	"--username":       true,
+	"-p":               true,
+	"--password":       true,
+	"-2":               true,
+	"--twofactor":      true,
+	"--video-password": true,
+	"--ap-username":    true,
+	"--ap-password":    true,
+	"--add-header":     true,
+	"--proxy":          true,
+	"--cookies":        true,
+}
+
+func redactYtDlpArgs(args []string) []string {
+	redacted := make([]string, len(args))
+	redactNext := false
+
+	for index, arg := range args {
+		if redactNext {
+			redacted[index] = "<redacted>"
+			redactNext = false
+			continue
+		}
+
+		if option, _, hasValue := strings.Cut(arg, "="); hasValue && ytDlpSecretArgs[option] {
+			redacted[index] = option + "=<redacted>"
+			continue
+		}
+
+		redacted[index] = arg
+		redactNext = ytDlpSecretArgs[arg]
+	}
+
+	return redacted
+}
+
 func getYtDlpPath() (string, error) {
 	path, err := exec.LookPath("yt-dlp")
 
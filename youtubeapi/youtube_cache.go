@@ -0,0 +1,443 @@
+package youtubeapi
+
+import (
+	"container/list"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/fakelag/streaming-music-bot/entities"
+)
+
+const (
+	// Stream urls expiring sooner than this are not used, and are reloaded by EnsureLoaded
+	streamURLExpiryMargin = 5 * time.Minute
+)
+
+// Cached details of a video. Metadata is kept until evicted, the stream url until it expires
+type MediaCacheEntry struct {
+	ID              string        `json:"id"`
+	Title           string        `json:"title"`
+	IsLiveStream    bool          `json:"is_live_stream"`
+	Thumbnail       string        `json:"thumbnail"`
+	Duration        time.Duration `json:"duration"`
+	Link            string        `json:"link"`
+	StreamURL       string        `json:"stream_url"`
+	StreamExpiresAt *time.Time    `json:"stream_expires_at"`
+	FormatID        string        `json:"format_id"`
+	AudioCodec      string        `json:"audio_codec"`
+	AudioContainer  string        `json:"audio_container"`
+	AudioBitrate    float64       `json:"audio_bitrate"`
+	CachedAt        time.Time     `json:"cached_at"`
+
+	ChannelName string             `json:"channel_name"`
+	ChannelURL  string             `json:"channel_url"`
+	UploadDate  *time.Time         `json:"upload_date"`
+	ViewCount   int64              `json:"view_count"`
+	LikeCount   int64              `json:"like_count"`
+	Description string             `json:"description"`
+	Tags        []string           `json:"tags"`
+	Chapters    []entities.Chapter `json:"chapters"`
+	MusicArtist string             `json:"music_artist"`
+	MusicAlbum  string             `json:"music_album"`
+}
+
+// Persistent storage for cache entries, such as DiskMediaCacheStore. Entries evicted from
+// memory are loaded back from the store when requested again
+type MediaCacheStore interface {
+	// Returns nil without an error if there is no entry for the video
+	Load(videoID string) (*MediaCacheEntry, error)
+	Save(entry *MediaCacheEntry) error
+	Delete(videoID string) error
+}
+
+type MediaCacheOptions struct {
+	// Maximum number of entries kept in memory. Defaults to 1000
+	MaxEntries int
+	// How long stream urls without an expiration time are used for. Defaults to 1 hour
+	StreamURLMaxAge time.Duration
+	// Optional persistent store
+	Store MediaCacheStore
+}
+
+type MediaCacheStats struct {
+	// Lookups that found the requested data, including entries loaded from the store
+	Hits int
+	// Lookups that found nothing, or only metadata when a stream url was requested
+	Misses int
+	// Entries removed from memory to stay within MaxEntries
+	Evictions int
+	// Stream urls removed with Invalidate
+	Invalidations int
+	// Failed store operations
+	StoreErrors int
+}
+
+// LRU cache of video metadata & stream urls keyed by video id. Safe for concurrent use
+type MediaCache struct {
+	mutex           sync.Mutex
+	maxEntries      int
+	streamURLMaxAge time.Duration
+	store           MediaCacheStore
+	entries         map[string]*list.Element
+	lru             *list.List
+	stats           MediaCacheStats
+}
+
+func NewMediaCache(options *MediaCacheOptions) *MediaCache {
+	maxEntries := 1000
+	streamURLMaxAge := time.Hour
+	var store MediaCacheStore
+
+	if options != nil {
+		if options.MaxEntries > 0 {
+			maxEntries = options.MaxEntries
+		}
+
+		if options.StreamURLMaxAge > 0 {
+			streamURLMaxAge = options.StreamURLMaxAge
+		}
+
+		store = options.Store
+	}
+
+	return &MediaCache{
+		maxEntries:      maxEntries,
+		streamURLMaxAge: streamURLMaxAge,
+		store:           store,
+		entries:         make(map[string]*list.Element),
+		lru:             list.New(),
+	}
+}
+
+// Returns a copy of the cached entry for the video. If requireStreamURL is set, entries
+// without a valid stream url are treated as misses
+func (cache *MediaCache) Get(videoID string, requireStreamURL bool) *MediaCacheEntry {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	entry := cache.getEntry(videoID)
+
+	if entry == nil || (requireStreamURL && !cache.hasValidStreamURL(entry)) {
+		cache.stats.Misses += 1
+		return nil
+	}
+
+	cache.stats.Hits += 1
+
+	entryCopy := *entry
+
+	if !cache.hasValidStreamURL(entry) {
+		entryCopy.clearStream()
+	}
+
+	return &entryCopy
+}
+
+// Adds media to the cache. An existing stream url is kept if the media has none,
+// such as with media from a playlist
+func (cache *MediaCache) Set(media *YoutubeMedia) {
+	if media == nil || media.ID == "" {
+		return
+	}
+
+	entry := &MediaCacheEntry{
+		ID:              media.ID,
+		Title:           media.VideoTitle,
+		IsLiveStream:    media.VideoIsLiveStream,
+		Thumbnail:       media.VideoThumbnail,
+		Duration:        media.VideoDuration,
+		Link:            media.VideoLink,
+		StreamURL:       media.StreamURL,
+		StreamExpiresAt: media.StreamExpiresAt,
+		FormatID:        media.FormatID,
+		AudioCodec:      media.AudioCodec,
+		AudioContainer:  media.AudioContainer,
+		AudioBitrate:    media.AudioBitrate,
+		CachedAt:        time.Now(),
+		ChannelName:     media.ChannelName,
+		ChannelURL:      media.ChannelURL,
+		UploadDate:      media.UploadDate,
+		ViewCount:       media.ViewCount,
+		LikeCount:       media.LikeCount,
+		Description:     media.Description,
+		Tags:            media.Tags,
+		Chapters:        media.VideoChapters,
+		MusicArtist:     media.MusicArtist,
+		MusicAlbum:      media.MusicAlbum,
+	}
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	existing := cache.getEntry(media.ID)
+
+	if entry.UploadDate == nil && existing != nil && existing.UploadDate != nil {
+		// Media from a playlist has only some of the metadata, keep the full metadata
+		entry.ChannelName = existing.ChannelName
+		entry.ChannelURL = existing.ChannelURL
+		entry.UploadDate = existing.UploadDate
+		entry.LikeCount = existing.LikeCount
+		entry.Description = existing.Description
+		entry.Tags = existing.Tags
+		entry.Chapters = existing.Chapters
+		entry.MusicArtist = existing.MusicArtist
+		entry.MusicAlbum = existing.MusicAlbum
+	}
+
+	if entry.StreamURL == "" {
+		if existing != nil && cache.hasValidStreamURL(existing) {
+			entry.StreamURL = existing.StreamURL
+			entry.StreamExpiresAt = existing.StreamExpiresAt
+			entry.CachedAt = existing.CachedAt
+		}
+	}
+
+	cache.putEntry(entry)
+	cache.saveEntry(entry)
+}
+
+// Removes the stream url of a video, for example after a playback error suggesting
+// that the url is no longer valid. Metadata is kept
+func (cache *MediaCache) Invalidate(videoID string) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	entry := cache.getEntry(videoID)
+
+	if entry == nil || entry.StreamURL == "" {
+		return
+	}
+
+	entryCopy := *entry
+	entryCopy.clearStream()
+
+	cache.stats.Invalidations += 1
+	cache.putEntry(&entryCopy)
+	cache.saveEntry(&entryCopy)
+}
+
+// Removes a video from the cache and the store
+func (cache *MediaCache) Delete(videoID string) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	if element, ok := cache.entries[videoID]; ok {
+		cache.lru.Remove(element)
+		delete(cache.entries, videoID)
+	}
+
+	if cache.store != nil {
+		if err := cache.store.Delete(videoID); err != nil {
+			cache.stats.StoreErrors += 1
+		}
+	}
+}
+
+func (cache *MediaCache) Len() int {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	return cache.lru.Len()
+}
+
+func (cache *MediaCache) Stats() MediaCacheStats {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	return cache.stats
+}
+
+// Caller must hold the lock. Loads the entry from the store if it is not in memory
+func (cache *MediaCache) getEntry(videoID string) *MediaCacheEntry {
+	if element, ok := cache.entries[videoID]; ok {
+		cache.lru.MoveToFront(element)
+		return element.Value.(*MediaCacheEntry)
+	}
+
+	if cache.store == nil {
+		return nil
+	}
+
+	entry, err := cache.store.Load(videoID)
+
+	if err != nil {
+		cache.stats.StoreErrors += 1
+		return nil
+	}
+
+	if entry == nil {
+		return nil
+	}
+
+	cache.putEntry(entry)
+	return entry
+}
+
+// Caller must hold the lock
+func (cache *MediaCache) putEntry(entry *MediaCacheEntry) {
+	if element, ok := cache.entries[entry.ID]; ok {
+		element.Value = entry
+		cache.lru.MoveToFront(element)
+		return
+	}
+
+	cache.entries[entry.ID] = cache.lru.PushFront(entry)
+
+	for cache.lru.Len() > cache.maxEntries {
+		oldest := cache.lru.Back()
+		cache.lru.Remove(oldest)
+		delete(cache.entries, oldest.Value.(*MediaCacheEntry).ID)
+		cache.stats.Evictions += 1
+	}
+}
+
+// Caller must hold the lock
+func (cache *MediaCache) saveEntry(entry *MediaCacheEntry) {
+	if cache.store == nil {
+		return
+	}
+
+	if err := cache.store.Save(entry); err != nil {
+		cache.stats.StoreErrors += 1
+	}
+}
+
+func (cache *MediaCache) hasValidStreamURL(entry *MediaCacheEntry) bool {
+	if entry.StreamURL == "" {
+		return false
+	}
+
+	if entry.StreamExpiresAt == nil {
+		return time.Since(entry.CachedAt) < cache.streamURLMaxAge
+	}
+
+	return time.Until(*entry.StreamExpiresAt) > streamURLExpiryMargin
+}
+
+// Removes the stream url & the details of its format
+func (entry *MediaCacheEntry) clearStream() {
+	entry.StreamURL = ""
+	entry.StreamExpiresAt = nil
+	entry.FormatID = ""
+	entry.AudioCodec = ""
+	entry.AudioContainer = ""
+	entry.AudioBitrate = 0
+}
+
+func (entry *MediaCacheEntry) toMedia(yt *Youtube) *YoutubeMedia {
+	return &YoutubeMedia{
+		ID:                entry.ID,
+		VideoTitle:        entry.Title,
+		VideoIsLiveStream: entry.IsLiveStream,
+		VideoThumbnail:    entry.Thumbnail,
+		VideoDuration:     entry.Duration,
+		VideoLink:         entry.Link,
+		StreamURL:         entry.StreamURL,
+		StreamExpiresAt:   entry.StreamExpiresAt,
+		FormatID:          entry.FormatID,
+		AudioCodec:        entry.AudioCodec,
+		AudioContainer:    entry.AudioContainer,
+		AudioBitrate:      entry.AudioBitrate,
+		ChannelName:       entry.ChannelName,
+		ChannelURL:        entry.ChannelURL,
+		UploadDate:        entry.UploadDate,
+		ViewCount:         entry.ViewCount,
+		LikeCount:         entry.LikeCount,
+		Description:       entry.Description,
+		Tags:              entry.Tags,
+		VideoChapters:     entry.Chapters,
+		MusicArtist:       entry.MusicArtist,
+		MusicAlbum:        entry.MusicAlbum,
+		ytAPI:             yt,
+	}
+}
+
+// Stores cache entries as JSON files in a directory, one file per video
+type DiskMediaCacheStore struct {
+	directory string
+}
+
+var cacheFileNameRegex = regexp.MustCompile("^[A-Za-z0-9_-]+$")
+
+// Creates the directory if it does not exist
+func NewDiskMediaCacheStore(directory string) (*DiskMediaCacheStore, error) {
+	if err := os.MkdirAll(directory, 0o755); err != nil {
+		return nil, err
+	}
+
+	return &DiskMediaCacheStore{directory: directory}, nil
+}
+
+func (store *DiskMediaCacheStore) Load(videoID string) (*MediaCacheEntry, error) {
+	data, err := os.ReadFile(store.entryPath(videoID))
+
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var entry MediaCacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, err
+	}
+
+	return &entry, nil
+}
+
+func (store *DiskMediaCacheStore) Save(entry *MediaCacheEntry) error {
+	data, err := json.Marshal(entry)
+
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first, so that readers never see a partially written entry
+	tempFile, err := os.CreateTemp(store.directory, ".entry-*")
+
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(tempFile.Name())
+
+	if _, err := tempFile.Write(data); err != nil {
+		tempFile.Close()
+		return err
+	}
+
+	if err := tempFile.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tempFile.Name(), store.entryPath(entry.ID))
+}
+
+func (store *DiskMediaCacheStore) Delete(videoID string) error {
+	err := os.Remove(store.entryPath(videoID))
+
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
+
+func (store *DiskMediaCacheStore) entryPath(videoID string) string {
+	fileName := videoID
+
+	if !cacheFileNameRegex.MatchString(videoID) {
+		fileName = "~" + hex.EncodeToString([]byte(videoID))
+	}
+
+	return filepath.Join(store.directory, fileName+".json")
+}
+
+// Verify implements MediaCacheStore
+var _ MediaCacheStore = (*DiskMediaCacheStore)(nil)
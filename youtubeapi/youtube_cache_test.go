@@ -0,0 +1,182 @@
+package youtubeapi_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fakelag/streaming-music-bot/entities"
+	"github.com/fakelag/streaming-music-bot/testutils"
+	"github.com/fakelag/streaming-music-bot/youtubeapi"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func NewCachedMockMedia(id string, streamExpiresIn time.Duration) *youtubeapi.YoutubeMedia {
+	expireAt := time.Now().Add(streamExpiresIn)
+	return &youtubeapi.YoutubeMedia{
+		ID:              id,
+		VideoTitle:      "Mock Media " + id,
+		VideoDuration:   60 * time.Second,
+		VideoLink:       "https://www.youtube.com/watch?v=" + id,
+		StreamURL:       "streamurl" + id,
+		StreamExpiresAt: &expireAt,
+	}
+}
+
+var _ = Describe("YT Media Cache", func() {
+	It("Evicts least recently used entries", func() {
+		cache := youtubeapi.NewMediaCache(&youtubeapi.MediaCacheOptions{MaxEntries: 2})
+
+		cache.Set(NewCachedMockMedia("1", time.Hour))
+		cache.Set(NewCachedMockMedia("2", time.Hour))
+		Expect(cache.Get("1", true)).NotTo(BeNil())
+
+		cache.Set(NewCachedMockMedia("3", time.Hour))
+
+		Expect(cache.Len()).To(Equal(2))
+		Expect(cache.Get("2", false)).To(BeNil())
+		Expect(cache.Get("1", false)).NotTo(BeNil())
+		Expect(cache.Get("3", false)).NotTo(BeNil())
+
+		Expect(cache.Stats()).To(Equal(youtubeapi.MediaCacheStats{
+			Hits:      3,
+			Misses:    1,
+			Evictions: 1,
+		}))
+	})
+
+	It("Keeps metadata but not stream urls that are about to expire", func() {
+		cache := youtubeapi.NewMediaCache(nil)
+
+		cache.Set(NewCachedMockMedia("1", 2*time.Minute))
+
+		Expect(cache.Get("1", true)).To(BeNil())
+
+		entry := cache.Get("1", false)
+		Expect(entry).NotTo(BeNil())
+		Expect(entry.Title).To(Equal("Mock Media 1"))
+		Expect(entry.StreamURL).To(Equal(""))
+		Expect(entry.StreamExpiresAt).To(BeNil())
+	})
+
+	It("Keeps an existing stream url when adding media without one", func() {
+		cache := youtubeapi.NewMediaCache(nil)
+
+		cache.Set(NewCachedMockMedia("1", time.Hour))
+
+		playlistMedia := NewCachedMockMedia("1", time.Hour)
+		playlistMedia.VideoTitle = "Title From Playlist"
+		playlistMedia.StreamURL = ""
+		playlistMedia.StreamExpiresAt = nil
+		cache.Set(playlistMedia)
+
+		entry := cache.Get("1", true)
+		Expect(entry).NotTo(BeNil())
+		Expect(entry.Title).To(Equal("Title From Playlist"))
+		Expect(entry.StreamURL).To(Equal("streamurl1"))
+	})
+
+	It("Keeps the full metadata when adding media from a playlist", func() {
+		cache := youtubeapi.NewMediaCache(nil)
+
+		uploadDate := time.Date(2024, time.January, 31, 0, 0, 0, 0, time.UTC)
+		media := NewCachedMockMedia("1", time.Hour)
+		media.ChannelName = "Mock Channel"
+		media.UploadDate = &uploadDate
+		media.ViewCount = 100
+		media.Description = "Mock description"
+		media.VideoChapters = []entities.Chapter{{Title: "Chapter", Start: 0, End: time.Minute}}
+		cache.Set(media)
+
+		playlistMedia := NewCachedMockMedia("1", time.Hour)
+		playlistMedia.StreamURL = ""
+		playlistMedia.ChannelName = "Mock Channel"
+		playlistMedia.ViewCount = 200
+		cache.Set(playlistMedia)
+
+		entry := cache.Get("1", true)
+		Expect(entry).NotTo(BeNil())
+		Expect(entry.ViewCount).To(Equal(int64(200)))
+		Expect(*entry.UploadDate).To(Equal(uploadDate))
+		Expect(entry.Description).To(Equal("Mock description"))
+		Expect(entry.Chapters).To(HaveLen(1))
+	})
+
+	It("Invalidates stream urls", func() {
+		cache := youtubeapi.NewMediaCache(nil)
+
+		cache.Set(NewCachedMockMedia("1", time.Hour))
+		cache.Invalidate("1")
+
+		Expect(cache.Get("1", true)).To(BeNil())
+		Expect(cache.Get("1", false)).NotTo(BeNil())
+		Expect(cache.Stats().Invalidations).To(Equal(1))
+
+		cache.Delete("1")
+		Expect(cache.Get("1", false)).To(BeNil())
+	})
+
+	It("Loads entries evicted from memory from the disk store", func() {
+		directory := filepath.Join(GinkgoT().TempDir(), "cache")
+		store, err := youtubeapi.NewDiskMediaCacheStore(directory)
+		Expect(err).NotTo(HaveOccurred())
+
+		cache := youtubeapi.NewMediaCache(&youtubeapi.MediaCacheOptions{MaxEntries: 1, Store: store})
+		cache.Set(NewCachedMockMedia("1", time.Hour))
+		cache.Set(NewCachedMockMedia("weird/id", time.Hour))
+
+		files, err := os.ReadDir(directory)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(files).To(HaveLen(2))
+
+		entry := cache.Get("1", true)
+		Expect(entry).NotTo(BeNil())
+		Expect(entry.StreamURL).To(Equal("streamurl1"))
+
+		// A new cache with the same store, such as after a restart
+		cache = youtubeapi.NewMediaCache(&youtubeapi.MediaCacheOptions{Store: store})
+		entry = cache.Get("weird/id", true)
+		Expect(entry).NotTo(BeNil())
+		Expect(entry.Title).To(Equal("Mock Media weird/id"))
+
+		cache.Delete("weird/id")
+		Expect(cache.Get("weird/id", false)).To(BeNil())
+		Expect(cache.Stats().StoreErrors).To(Equal(0))
+	})
+
+	It("Resolves cached media without running yt-dlp", func() {
+		mockExecutor := &testutils.MockCommandExecutor{
+			MockStdoutResult: "url123\n" + makeMockVideoJson("123", "Mock Title"),
+		}
+
+		yt := youtubeapi.NewYoutubeAPI()
+		yt.SetCmdExecutor(mockExecutor)
+		yt.SetCache(youtubeapi.NewMediaCache(nil))
+
+		media, err := yt.GetYoutubeMedia(context.Background(), "https://www.youtube.com/watch?v=123")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(media.FileURL()).To(Equal("url123"))
+
+		// yt-dlp would fail if it was run again
+		mockExecutor.MockExitCode = 1
+
+		media, err = yt.GetYoutubeMedia(context.Background(), "https://www.youtube.com/watch?v=123")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(media.Title()).To(Equal("Mock Title"))
+		Expect(media.FileURL()).To(Equal("url123"))
+		Expect(media.EnsureLoaded(context.Background())).To(Succeed())
+
+		media.InvalidateFileURL()
+		Expect(media.FileURL()).To(Equal(""))
+		Expect(media.EnsureLoaded(context.Background())).To(MatchError("exit status 1"))
+
+		Expect(yt.GetCache().Stats()).To(Equal(youtubeapi.MediaCacheStats{
+			Hits:          1,
+			Misses:        2,
+			Invalidations: 1,
+		}))
+	})
+})
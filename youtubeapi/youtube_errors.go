@@ -0,0 +1,149 @@
+package youtubeapi
+
+import (
+	"errors"
+	"strings"
+
+	cmd "github.com/fakelag/streaming-music-bot/command"
+)
+
+// Failure reasons classified from yt-dlp error output. Errors returned from the
+// api can be compared against these with errors.Is
+var (
+	ErrorAgeRestricted  = errors.New("video is age restricted")
+	ErrorGeoBlocked     = errors.New("video is not available in this country")
+	ErrorPrivateVideo   = errors.New("video is private")
+	ErrorVideoRemoved   = errors.New("video is unavailable")
+	ErrorSignInRequired = errors.New("sign in required")
+	ErrorRateLimited    = errors.New("rate limited")
+	ErrorUnsupportedURL = errors.New("unsupported url")
+	ErrorNetwork        = errors.New("network error")
+)
+
+// Error from a failed yt-dlp invocation with a recognised failure reason
+type YtDlpError struct {
+	// One of the classified errors, such as ErrorAgeRestricted
+	Reason error
+	// Error message printed by yt-dlp
+	Message string
+	Err     error
+}
+
+func (ye *YtDlpError) Error() string {
+	if ye.Message == "" {
+		return ye.Reason.Error()
+	}
+
+	return ye.Reason.Error() + ": " + ye.Message
+}
+
+func (ye *YtDlpError) Is(target error) bool {
+	return target == ye.Reason
+}
+
+func (ye *YtDlpError) Unwrap() error {
+	return ye.Err
+}
+
+// Checked in order, first match wins. Patterns are matched case-insensitively
+var ytDlpErrorPatterns = []struct {
+	reason   error
+	patterns []string
+}{
+	{ErrorAgeRestricted, []string{
+		"confirm your age",
+		"age-restricted",
+		"age restricted",
+		"inappropriate for some users",
+	}},
+	{ErrorRateLimited, []string{
+		"http error 429",
+		"too many requests",
+		"rate-limit",
+		"rate limit",
+	}},
+	{ErrorGeoBlocked, []string{
+		"not available in your country",
+		"not made this video available in your country",
+		"geo restriction",
+		"geo-restrict",
+		"blocked it in your country",
+	}},
+	{ErrorPrivateVideo, []string{
+		"private video",
+		"video is private",
+	}},
+	{ErrorSignInRequired, []string{
+		"sign in to confirm",
+		"sign in to view",
+		"members-only",
+		"available to this channel's members",
+		"join this channel to get access",
+		"login required",
+		"use --cookies",
+	}},
+	{ErrorVideoRemoved, []string{
+		"video unavailable",
+		"video has been removed",
+		"video is no longer available",
+		"video is unavailable",
+		"account associated with this video has been terminated",
+		"does not exist",
+	}},
+	{ErrorUnsupportedURL, []string{
+		"unsupported url",
+		"is not a valid url",
+	}},
+	{ErrorNetwork, []string{
+		"unable to download webpage",
+		"unable to download api page",
+		"urlopen error",
+		"connection reset",
+		"connection refused",
+		"timed out",
+		"name resolution",
+		"network is unreachable",
+		"failed to resolve",
+		"remote end closed connection",
+		"ssl:",
+	}},
+}
+
+// Returns a *YtDlpError if the stderr of a failed command has a recognised
+// failure reason, otherwise the error is returned as is
+func classifyYtDlpError(err error) error {
+	var commandErr *cmd.CommandError
+	if !errors.As(err, &commandErr) {
+		return err
+	}
+
+	message := ytDlpErrorMessage(commandErr.Stderr)
+	lowerStderr := strings.ToLower(commandErr.Stderr)
+
+	for _, errorPattern := range ytDlpErrorPatterns {
+		for _, pattern := range errorPattern.patterns {
+			if strings.Contains(lowerStderr, pattern) {
+				return &YtDlpError{
+					Reason:  errorPattern.reason,
+					Message: message,
+					Err:     err,
+				}
+			}
+		}
+	}
+
+	return err
+}
+
+// Last "ERROR:" line printed by yt-dlp, without the prefix
+func ytDlpErrorMessage(stderr string) string {
+	lines := strings.Split(strings.TrimSpace(stderr), "\n")
+
+	for index := len(lines) - 1; index >= 0; index-- {
+		if message, isError := strings.CutPrefix(strings.TrimSpace(lines[index]), "ERROR:"); isError {
+			return strings.TrimSpace(message)
+		}
+	}
+
+	return ""
+}
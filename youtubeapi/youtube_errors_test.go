@@ -0,0 +1,98 @@
+package youtubeapi_test
+
+import (
+	"context"
+	"errors"
+
+	cmd "github.com/fakelag/streaming-music-bot/command"
+	"github.com/fakelag/streaming-music-bot/testutils"
+	"github.com/fakelag/streaming-music-bot/youtubeapi"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("YT Errors", func() {
+	DescribeTable("Classifies yt-dlp failures from stderr",
+		func(stderr string, expectedErr error, expectedMessage string) {
+			mockExecutor := &testutils.MockCommandExecutor{
+				MockStderrResult: stderr,
+				MockExitCode:     1,
+			}
+
+			yt := youtubeapi.NewYoutubeAPI()
+			yt.SetCmdExecutor(mockExecutor)
+
+			_, err := yt.GetYoutubeMedia(context.Background(), "https://www.youtube.com/watch?v=abc")
+			Expect(errors.Is(err, expectedErr)).To(BeTrue())
+
+			var ytDlpErr *youtubeapi.YtDlpError
+			Expect(errors.As(err, &ytDlpErr)).To(BeTrue())
+			Expect(ytDlpErr.Message).To(Equal(expectedMessage))
+
+			var commandErr *cmd.CommandError
+			Expect(errors.As(err, &commandErr)).To(BeTrue())
+			Expect(commandErr.ExitCode).To(Equal(1))
+		},
+		Entry("age restricted",
+			"WARNING: foo\nERROR: [youtube] abc: Sign in to confirm your age. This video may be inappropriate for some users.\n",
+			youtubeapi.ErrorAgeRestricted,
+			"[youtube] abc: Sign in to confirm your age. This video may be inappropriate for some users.",
+		),
+		Entry("geo blocked",
+			"ERROR: [youtube] abc: The uploader has not made this video available in your country\n",
+			youtubeapi.ErrorGeoBlocked,
+			"[youtube] abc: The uploader has not made this video available in your country",
+		),
+		Entry("private video",
+			"ERROR: [youtube] abc: Private video. Sign in if you've been granted access to this video\n",
+			youtubeapi.ErrorPrivateVideo,
+			"[youtube] abc: Private video. Sign in if you've been granted access to this video",
+		),
+		Entry("removed video",
+			"ERROR: [youtube] abc: Video unavailable. This video has been removed by the uploader\n",
+			youtubeapi.ErrorVideoRemoved,
+			"[youtube] abc: Video unavailable. This video has been removed by the uploader",
+		),
+		Entry("sign in required",
+			"ERROR: [youtube] abc: Sign in to confirm you're not a bot. Use --cookies-from-browser or --cookies for the authentication.\n",
+			youtubeapi.ErrorSignInRequired,
+			"[youtube] abc: Sign in to confirm you're not a bot. Use --cookies-from-browser or --cookies for the authentication.",
+		),
+		Entry("rate limited",
+			"ERROR: [youtube] abc: Unable to download webpage: HTTP Error 429: Too Many Requests\n",
+			youtubeapi.ErrorRateLimited,
+			"[youtube] abc: Unable to download webpage: HTTP Error 429: Too Many Requests",
+		),
+		Entry("unsupported url",
+			"ERROR: Unsupported URL: https://example.com/\n",
+			youtubeapi.ErrorUnsupportedURL,
+			"Unsupported URL: https://example.com/",
+		),
+		Entry("network error",
+			"ERROR: [youtube] abc: Unable to download webpage: <urlopen error [Errno -3] Temporary failure in name resolution>\n",
+			youtubeapi.ErrorNetwork,
+			"[youtube] abc: Unable to download webpage: <urlopen error [Errno -3] Temporary failure in name resolution>",
+		),
+	)
+
+	It("Returns unrecognised failures as is", func() {
+		mockExecutor := &testutils.MockCommandExecutor{
+			MockStderrResult: "ERROR: something unexpected happened\n",
+			MockExitCode:     2,
+		}
+
+		yt := youtubeapi.NewYoutubeAPI()
+		yt.SetCmdExecutor(mockExecutor)
+
+		_, err := yt.GetYoutubeMedia(context.Background(), "foo")
+		Expect(err).To(MatchError("exit status 2"))
+
+		var ytDlpErr *youtubeapi.YtDlpError
+		Expect(errors.As(err, &ytDlpErr)).To(BeFalse())
+
+		var commandErr *cmd.CommandError
+		Expect(errors.As(err, &commandErr)).To(BeTrue())
+		Expect(commandErr.Stderr).To(ContainSubstring("something unexpected happened"))
+	})
+})
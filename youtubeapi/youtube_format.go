@@ -0,0 +1,165 @@
+package youtubeapi
+
+import (
+	"errors"
+	"slices"
+	"strings"
+)
+
+var (
+	ErrorNoSuitableFormat = errors.New("no suitable audio format found")
+)
+
+// Selects the audio stream played from the formats yt-dlp lists for a video. Formats are
+// ranked with a fallback chain: audio-only formats first, then preferred codecs, preferred
+// containers, formats within MaxBitrate and finally the highest bitrate
+type FormatPolicy struct {
+	// Audio codecs in order of preference, such as "opus". A codec matches the
+	// codec of a format exactly or as a prefix, "mp4a" matches "mp4a.40.2"
+	PreferredCodecs []string
+	// Containers in order of preference, such as "webm"
+	PreferredContainers []string
+	// Maximum audio bitrate in kbit/s. Formats above it are used only if there are no
+	// formats within it, lowest bitrate first. Defaults to 0, no limit
+	MaxBitrate float64
+	// Allow formats that are downloaded in fragments, such as DASH & HLS formats
+	AllowFragmented bool
+	// Allow formats that also contain video, used only if there are no audio-only formats
+	AllowVideo bool
+}
+
+// Prefers Opus in WebM, which can be played without transcoding. Formats with
+// video are allowed as a last resort, fragmented formats are not
+func DefaultFormatPolicy() *FormatPolicy {
+	return &FormatPolicy{
+		PreferredCodecs:     []string{"opus"},
+		PreferredContainers: []string{"webm"},
+		AllowVideo:          true,
+	}
+}
+
+// Returns the best format according to the policy, or ErrorNoSuitableFormat
+func (policy *FormatPolicy) SelectFormat(formats []*YtDlpVideoFormat) (*YtDlpVideoFormat, error) {
+	candidates := make([]*YtDlpVideoFormat, 0, len(formats))
+
+	for _, format := range formats {
+		if format == nil || format.Url == "" || !format.HasAudio() {
+			continue
+		}
+
+		if format.HasVideo() && !policy.AllowVideo {
+			continue
+		}
+
+		if format.IsFragmented() && !policy.AllowFragmented {
+			continue
+		}
+
+		candidates = append(candidates, format)
+	}
+
+	if len(candidates) == 0 {
+		return nil, ErrorNoSuitableFormat
+	}
+
+	// Stable, so that equally ranked formats keep the order yt-dlp listed them in
+	slices.SortStableFunc(candidates, policy.compareFormats)
+
+	return candidates[0], nil
+}
+
+// Orders a before b if a is the better format
+func (policy *FormatPolicy) compareFormats(a *YtDlpVideoFormat, b *YtDlpVideoFormat) int {
+	if a.HasVideo() != b.HasVideo() {
+		return compareBool(!a.HasVideo(), !b.HasVideo())
+	}
+
+	if rankA, rankB := codecRank(policy.PreferredCodecs, a.Acodec), codecRank(policy.PreferredCodecs, b.Acodec); rankA != rankB {
+		return rankA - rankB
+	}
+
+	if rankA, rankB := containerRank(policy.PreferredContainers, a.Ext), containerRank(policy.PreferredContainers, b.Ext); rankA != rankB {
+		return rankA - rankB
+	}
+
+	bitrateA, bitrateB := a.AudioBitrate(), b.AudioBitrate()
+
+	if policy.MaxBitrate > 0 {
+		withinA, withinB := bitrateA <= policy.MaxBitrate, bitrateB <= policy.MaxBitrate
+
+		if withinA != withinB {
+			return compareBool(withinA, withinB)
+		}
+
+		if !withinA {
+			return compareFloat(bitrateA, bitrateB)
+		}
+	}
+
+	return compareFloat(bitrateB, bitrateA)
+}
+
+// Formats without audio have an acodec of "none". Formats without the field, such as
+// formats of some extractors other than YouTube, are assumed to have audio
+func (format *YtDlpVideoFormat) HasAudio() bool {
+	return format.Acodec != "none"
+}
+
+func (format *YtDlpVideoFormat) HasVideo() bool {
+	return format.Vcodec != "" && format.Vcodec != "none"
+}
+
+func (format *YtDlpVideoFormat) IsFragmented() bool {
+	return format.FragmentBaseURL != "" ||
+		strings.Contains(format.Protocol, "dash") ||
+		strings.Contains(format.Protocol, "m3u8") ||
+		strings.Contains(format.Protocol, "ism") ||
+		strings.Contains(format.Protocol, "f4m")
+}
+
+// Audio bitrate in kbit/s, or the total bitrate if the audio bitrate is unknown
+func (format *YtDlpVideoFormat) AudioBitrate() float64 {
+	if format.Abr > 0 {
+		return format.Abr
+	}
+
+	return format.Tbr
+}
+
+func codecRank(preferredCodecs []string, codec string) int {
+	for index, preferredCodec := range preferredCodecs {
+		if codec == preferredCodec || strings.HasPrefix(codec, preferredCodec+".") {
+			return index
+		}
+	}
+
+	return len(preferredCodecs)
+}
+
+func containerRank(preferredContainers []string, container string) int {
+	if index := slices.Index(preferredContainers, container); index != -1 {
+		return index
+	}
+
+	return len(preferredContainers)
+}
+
+func compareBool(a bool, b bool) int {
+	if a == b {
+		return 0
+	} else if a {
+		return -1
+	}
+
+	return 1
+}
+
+func compareFloat(a float64, b float64) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+
+	return 0
+}
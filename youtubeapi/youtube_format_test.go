@@ -0,0 +1,147 @@
+package youtubeapi_test
+
+import (
+	"context"
+	"strings"
+
+	"github.com/fakelag/streaming-music-bot/testutils"
+	"github.com/fakelag/streaming-music-bot/youtubeapi"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var (
+	formatOpusHigh = &youtubeapi.YtDlpVideoFormat{FormatID: "251", Url: "url/251", Ext: "webm", Acodec: "opus", Vcodec: "none", Abr: 130, Protocol: "https"}
+	formatOpusLow  = &youtubeapi.YtDlpVideoFormat{FormatID: "249", Url: "url/249", Ext: "webm", Acodec: "opus", Vcodec: "none", Abr: 50, Protocol: "https"}
+	formatAac      = &youtubeapi.YtDlpVideoFormat{FormatID: "140", Url: "url/140", Ext: "m4a", Acodec: "mp4a.40.2", Vcodec: "none", Abr: 129, Protocol: "https"}
+	formatOpusDash = &youtubeapi.YtDlpVideoFormat{FormatID: "251-dash", Url: "url/251-dash", Ext: "webm", Acodec: "opus", Vcodec: "none", Abr: 160, Protocol: "http_dash_segments"}
+	formatMuxed    = &youtubeapi.YtDlpVideoFormat{FormatID: "18", Url: "url/18", Ext: "mp4", Acodec: "mp4a.40.2", Vcodec: "avc1.42001E", Tbr: 500, Protocol: "https"}
+	formatVideo    = &youtubeapi.YtDlpVideoFormat{FormatID: "137", Url: "url/137", Ext: "mp4", Acodec: "none", Vcodec: "avc1.640028", Tbr: 4000, Protocol: "https"}
+)
+
+var _ = Describe("YT Format Policy", func() {
+	DescribeTable("Selecting a format",
+		func(policy *youtubeapi.FormatPolicy, formats []*youtubeapi.YtDlpVideoFormat, expectedFormatID string) {
+			format, err := policy.SelectFormat(formats)
+
+			if expectedFormatID == "" {
+				Expect(err).To(MatchError(youtubeapi.ErrorNoSuitableFormat))
+				return
+			}
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(format.FormatID).To(Equal(expectedFormatID))
+		},
+		Entry("Prefers opus in webm",
+			youtubeapi.DefaultFormatPolicy(),
+			[]*youtubeapi.YtDlpVideoFormat{formatVideo, formatMuxed, formatAac, formatOpusLow, formatOpusHigh},
+			"251",
+		),
+		Entry("Prefers audio-only formats over formats with video",
+			youtubeapi.DefaultFormatPolicy(),
+			[]*youtubeapi.YtDlpVideoFormat{formatMuxed, formatAac},
+			"140",
+		),
+		Entry("Falls back to formats with video",
+			youtubeapi.DefaultFormatPolicy(),
+			[]*youtubeapi.YtDlpVideoFormat{formatVideo, formatMuxed},
+			"18",
+		),
+		Entry("Excludes formats with video if not allowed",
+			&youtubeapi.FormatPolicy{},
+			[]*youtubeapi.YtDlpVideoFormat{formatVideo, formatMuxed},
+			"",
+		),
+		Entry("Avoids fragmented formats",
+			youtubeapi.DefaultFormatPolicy(),
+			[]*youtubeapi.YtDlpVideoFormat{formatOpusDash, formatAac},
+			"140",
+		),
+		Entry("Uses fragmented formats if allowed",
+			&youtubeapi.FormatPolicy{PreferredCodecs: []string{"opus"}, AllowFragmented: true},
+			[]*youtubeapi.YtDlpVideoFormat{formatAac, formatOpusHigh, formatOpusDash},
+			"251-dash",
+		),
+		Entry("Stays within the max bitrate",
+			&youtubeapi.FormatPolicy{PreferredCodecs: []string{"opus"}, MaxBitrate: 64},
+			[]*youtubeapi.YtDlpVideoFormat{formatOpusHigh, formatOpusLow},
+			"249",
+		),
+		Entry("Uses the lowest bitrate above the max bitrate if there is nothing within it",
+			&youtubeapi.FormatPolicy{MaxBitrate: 32},
+			[]*youtubeapi.YtDlpVideoFormat{formatOpusHigh, formatAac},
+			"140",
+		),
+		Entry("Matches codecs by prefix",
+			&youtubeapi.FormatPolicy{PreferredCodecs: []string{"mp4a", "opus"}},
+			[]*youtubeapi.YtDlpVideoFormat{formatOpusHigh, formatAac},
+			"140",
+		),
+		Entry("Selects nothing from formats without audio",
+			youtubeapi.DefaultFormatPolicy(),
+			[]*youtubeapi.YtDlpVideoFormat{formatVideo},
+			"",
+		),
+	)
+
+	It("Plays the selected format and records its codec & bitrate", func() {
+		videoJson := strings.ReplaceAll(`{
+			"id": "123",
+			"fulltitle": "Mock Title",
+			"duration": 70,
+			"format_id": "140",
+			"ext": "m4a",
+			"acodec": "mp4a.40.2",
+			"abr": 129.5,
+			"formats": [
+				{"format_id": "140", "url": "url/140", "ext": "m4a", "acodec": "mp4a.40.2", "vcodec": "none", "abr": 129.5, "protocol": "https"},
+				{"format_id": "251", "url": "url/251?expire=1706280000&foo=bar", "ext": "webm", "acodec": "opus", "vcodec": "none", "abr": 135.1, "protocol": "https"}
+			],
+			"_type": "video"
+		}`, "\n", "")
+
+		yt := youtubeapi.NewYoutubeAPI()
+		yt.SetCmdExecutor(&testutils.MockCommandExecutor{MockStdoutResult: "url/140\n" + videoJson})
+
+		media, err := yt.GetYoutubeMedia(context.Background(), "foo")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(media.FileURL()).To(Equal("url/140"))
+		Expect(media.AudioCodec).To(Equal("mp4a.40.2"))
+		Expect(media.AudioContainer).To(Equal("m4a"))
+		Expect(media.AudioBitrate).To(Equal(129.5))
+
+		yt.SetFormatPolicy(youtubeapi.DefaultFormatPolicy())
+
+		media, err = yt.GetYoutubeMedia(context.Background(), "foo")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(media.FileURL()).To(Equal("url/251?expire=1706280000&foo=bar"))
+		Expect(media.FileURLExpiresAt()).NotTo(BeNil())
+		Expect(media.FileURLExpiresAt().Unix()).To(Equal(int64(1706280000)))
+		Expect(media.FormatID).To(Equal("251"))
+		Expect(media.AudioCodec).To(Equal("opus"))
+		Expect(media.AudioContainer).To(Equal("webm"))
+		Expect(media.AudioBitrate).To(Equal(135.1))
+	})
+
+	It("Uses the stream selected by yt-dlp if no format is suitable", func() {
+		videoJson := strings.ReplaceAll(`{
+			"id": "123",
+			"fulltitle": "Mock Title",
+			"format_id": "18",
+			"formats": [
+				{"format_id": "137", "url": "url/137", "ext": "mp4", "acodec": "none", "vcodec": "avc1.640028", "protocol": "https"}
+			],
+			"_type": "video"
+		}`, "\n", "")
+
+		yt := youtubeapi.NewYoutubeAPI()
+		yt.SetCmdExecutor(&testutils.MockCommandExecutor{MockStdoutResult: "url/18\n" + videoJson})
+		yt.SetFormatPolicy(youtubeapi.DefaultFormatPolicy())
+
+		media, err := yt.GetYoutubeMedia(context.Background(), "foo")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(media.FileURL()).To(Equal("url/18"))
+		Expect(media.FormatID).To(Equal("18"))
+	})
+})
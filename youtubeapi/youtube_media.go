@@ -1,6 +1,9 @@
 package youtubeapi
 
 import (
+	"context"
+	"log/slog"
+	"strings"
 	"time"
 
 	"github.com/fakelag/streaming-music-bot/entities"
@@ -13,11 +16,38 @@ type YoutubeMedia struct {
 	VideoThumbnail    string
 	VideoDuration     time.Duration
 	VideoLink         string
+	// yt-dlp extractor of the media, such as "Youtube" or "Soundcloud". Empty for YouTube
+	// media loaded before extractors were recorded
+	Extractor string
+
+	// Name & url of the channel that uploaded the video
+	ChannelName string
+	ChannelURL  string
+	// Nil if unknown, such as for media from a playlist that has not been loaded yet
+	UploadDate  *time.Time
+	ViewCount   int64
+	LikeCount   int64
+	Description string
+	Tags        []string
+	// Empty if the video has no chapters
+	VideoChapters []entities.Chapter
+	// Music metadata YouTube provides for some songs
+	MusicArtist string
+	MusicAlbum  string
 
 	// TODO Lock for StreamURL & StreamExpiresAt
 	StreamURL       string
 	StreamExpiresAt *time.Time
-	ytAPI           *Youtube
+
+	// Format of the stream, empty or zero if unknown. Opus audio in a WebM
+	// container can be played without transcoding
+	FormatID       string
+	AudioCodec     string
+	AudioContainer string
+	// Audio bitrate in kbit/s
+	AudioBitrate float64
+
+	ytAPI *Youtube
 }
 
 func (ytm *YoutubeMedia) Title() string {
@@ -51,9 +81,10 @@ func (ytm *YoutubeMedia) Duration() *time.Duration {
 	return &ytm.VideoDuration
 }
 
-func (ytm *YoutubeMedia) EnsureLoaded() error {
-	if ytm.StreamURL == "" || (ytm.StreamExpiresAt != nil && time.Since(*ytm.StreamExpiresAt) > -5*time.Minute) {
-		media, err := ytm.ytAPI.GetYoutubeMedia(ytm.Link())
+func (ytm *YoutubeMedia) EnsureLoaded(ctx context.Context) error {
+	if ytm.StreamURL == "" || (ytm.StreamExpiresAt != nil && time.Until(*ytm.StreamExpiresAt) < streamURLExpiryMargin) {
+		ytm.ytAPI.logger.Debug("loading stream url", slog.String("media_id", ytm.ID))
+		media, err := ytm.ytAPI.GetMediaFromURL(ctx, ytm.Link())
 
 		if err != nil {
 			return err
@@ -61,11 +92,63 @@ func (ytm *YoutubeMedia) EnsureLoaded() error {
 
 		ytm.StreamURL = media.StreamURL
 		ytm.StreamExpiresAt = media.StreamExpiresAt
+		ytm.FormatID = media.FormatID
+		ytm.AudioCodec = media.AudioCodec
+		ytm.AudioContainer = media.AudioContainer
+		ytm.AudioBitrate = media.AudioBitrate
+		ytm.copyMetadata(media)
 	}
 
 	return nil
 }
 
+// Media from a playlist has only some of the metadata until it is loaded
+func (ytm *YoutubeMedia) copyMetadata(media *YoutubeMedia) {
+	ytm.ChannelName = media.ChannelName
+	ytm.ChannelURL = media.ChannelURL
+	ytm.UploadDate = media.UploadDate
+	ytm.ViewCount = media.ViewCount
+	ytm.LikeCount = media.LikeCount
+	ytm.Description = media.Description
+	ytm.Tags = media.Tags
+	ytm.VideoChapters = media.VideoChapters
+	ytm.MusicArtist = media.MusicArtist
+	ytm.MusicAlbum = media.MusicAlbum
+}
+
+// Drops the stream url so that it is reloaded on the next EnsureLoaded,
+// also removing it from the cache of the api
+func (ytm *YoutubeMedia) InvalidateFileURL() {
+	ytm.StreamURL = ""
+	ytm.StreamExpiresAt = nil
+
+	if ytm.ytAPI != nil && ytm.ytAPI.cache != nil {
+		ytm.ytAPI.cache.Invalidate(ytm.ID)
+	}
+}
+
+func (ytm *YoutubeMedia) FileAudioFormat() (codec string, container string) {
+	return ytm.AudioCodec, ytm.AudioContainer
+}
+
+// Artist of a song, or the channel that uploaded the video if YouTube does not
+// know the artist. " - Topic" is removed from the names of auto-generated channels
+func (ytm *YoutubeMedia) Artist() string {
+	if ytm.MusicArtist != "" {
+		return ytm.MusicArtist
+	}
+
+	return strings.TrimSuffix(ytm.ChannelName, " - Topic")
+}
+
+func (ytm *YoutubeMedia) Album() string {
+	return ytm.MusicAlbum
+}
+
+func (ytm *YoutubeMedia) Chapters() []entities.Chapter {
+	return ytm.VideoChapters
+}
+
 func (ytm *YoutubeMedia) IsLiveStream() bool {
 	return ytm.VideoIsLiveStream
 }
@@ -74,5 +157,23 @@ func (ytm *YoutubeMedia) SetYtAPI(ytAPI *Youtube) {
 	ytm.ytAPI = ytAPI
 }
 
+// Implements slog.LogValuer for logging media as structured attributes
+func (ytm *YoutubeMedia) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("id", ytm.ID),
+		slog.String("title", ytm.VideoTitle),
+		slog.String("link", ytm.VideoLink),
+	)
+}
+
 // Verify implements entities.Media
 var _ entities.Media = (*YoutubeMedia)(nil)
+
+// Verify implements entities.InvalidatableMedia
+var _ entities.InvalidatableMedia = (*YoutubeMedia)(nil)
+
+// Verify implements entities.AudioFormatMedia
+var _ entities.AudioFormatMedia = (*YoutubeMedia)(nil)
+
+// Verify implements entities.MediaMetadata
+var _ entities.MediaMetadata = (*YoutubeMedia)(nil)
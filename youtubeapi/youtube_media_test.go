@@ -1,10 +1,12 @@
 package youtubeapi_test
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"time"
 
+	"github.com/fakelag/streaming-music-bot/entities"
 	"github.com/fakelag/streaming-music-bot/testutils"
 	"github.com/fakelag/streaming-music-bot/youtubeapi"
 
@@ -55,7 +57,7 @@ var _ = Describe("YT Media", func() {
 			media.StreamExpiresAt = nil
 			media.StreamURL = ""
 
-			Expect(media.EnsureLoaded()).To(Succeed())
+			Expect(media.EnsureLoaded(context.Background())).To(Succeed())
 			Expect(media.FileURLExpiresAt()).NotTo(BeNil())
 			Expect(*media.FileURLExpiresAt()).To(BeTemporally("~", time.Unix(expireTimeUnix, 0), time.Second))
 			Expect(media.FileURL()).To(Equal(streamUrl))
@@ -78,7 +80,7 @@ var _ = Describe("YT Media", func() {
 			media.StreamExpiresAt = &expireAt
 			media.StreamURL = streamUrl
 
-			Expect(media.EnsureLoaded()).To(Succeed())
+			Expect(media.EnsureLoaded(context.Background())).To(Succeed())
 
 			Expect(media.FileURLExpiresAt()).NotTo(BeNil())
 			Expect(*media.FileURLExpiresAt()).To(BeTemporally("~", time.Unix(newExpireTime, 0), time.Second))
@@ -97,7 +99,79 @@ var _ = Describe("YT Media", func() {
 			media.StreamExpiresAt = nil
 			media.StreamURL = ""
 
-			Expect(media.EnsureLoaded()).To(MatchError(youtubeapi.ErrorUnrecognisedObject))
+			Expect(media.EnsureLoaded(context.Background())).To(MatchError(youtubeapi.ErrorUnrecognisedObject))
+		})
+	})
+
+	When("Reading metadata", func() {
+		metadataJson := strings.ReplaceAll(`{
+			"id": "1",
+			"fulltitle": "Mock Media 1",
+			"duration": 300,
+			"channel": "Mock Artist - Topic",
+			"channel_url": "https://www.youtube.com/channel/UC123",
+			"upload_date": "20240131",
+			"view_count": 1234567,
+			"like_count": 890,
+			"description": "Mock description",
+			"tags": ["lofi", "beats"],
+			"chapters": [
+				{"start_time": 0.0, "end_time": 95.5, "title": "First Song"},
+				{"start_time": 95.5, "end_time": 300.0, "title": "Second Song"}
+			],
+			"album": "Mock Album",
+			"_type": "video"
+		}`, "\n", "")
+
+		It("Reads channel, upload date, counts, tags & chapters", func() {
+			yt := youtubeapi.NewYoutubeAPI()
+			yt.SetCmdExecutor(&testutils.MockCommandExecutor{MockStdoutResult: streamUrl + "\n" + metadataJson})
+
+			media, err := yt.GetYoutubeMedia(context.Background(), "foo")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(media.ChannelName).To(Equal("Mock Artist - Topic"))
+			Expect(media.ChannelURL).To(Equal("https://www.youtube.com/channel/UC123"))
+			Expect(*media.UploadDate).To(Equal(time.Date(2024, time.January, 31, 0, 0, 0, 0, time.UTC)))
+			Expect(media.ViewCount).To(Equal(int64(1234567)))
+			Expect(media.LikeCount).To(Equal(int64(890)))
+			Expect(media.Description).To(Equal("Mock description"))
+			Expect(media.Tags).To(Equal([]string{"lofi", "beats"}))
+
+			var metadata entities.MediaMetadata = media
+			Expect(metadata.Artist()).To(Equal("Mock Artist"))
+			Expect(metadata.Album()).To(Equal("Mock Album"))
+			Expect(metadata.Chapters()).To(Equal([]entities.Chapter{
+				{Title: "First Song", Start: 0, End: 95500 * time.Millisecond},
+				{Title: "Second Song", Start: 95500 * time.Millisecond, End: 300 * time.Second},
+			}))
+		})
+
+		It("Prefers the artists of a song over the channel", func() {
+			artistsJson := strings.Replace(metadataJson, `"album"`, `"artists": ["Artist A", "Artist B"], "artist": "Artist A", "album"`, 1)
+
+			yt := youtubeapi.NewYoutubeAPI()
+			yt.SetCmdExecutor(&testutils.MockCommandExecutor{MockStdoutResult: streamUrl + "\n" + artistsJson})
+
+			media, err := yt.GetYoutubeMedia(context.Background(), "foo")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(media.Artist()).To(Equal("Artist A, Artist B"))
+		})
+
+		It("Loads the full metadata of playlist media with EnsureLoaded", func() {
+			yt := youtubeapi.NewYoutubeAPI()
+			yt.SetCmdExecutor(&testutils.MockCommandExecutor{MockStdoutResult: streamUrl + "\n" + metadataJson})
+
+			media := NewYoutubeMedia(yt)
+			media.StreamExpiresAt = nil
+			media.StreamURL = ""
+			Expect(media.Chapters()).To(BeEmpty())
+			Expect(media.UploadDate).To(BeNil())
+
+			Expect(media.EnsureLoaded(context.Background())).To(Succeed())
+			Expect(media.Chapters()).To(HaveLen(2))
+			Expect(media.UploadDate).NotTo(BeNil())
+			Expect(media.Description).To(Equal("Mock description"))
 		})
 	})
 })
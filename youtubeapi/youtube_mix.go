@@ -0,0 +1,187 @@
+package youtubeapi
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+var (
+	ErrorNotAMix     = errors.New("not a youtube mix")
+	ErrorNotAChannel = errors.New("not a youtube channel")
+)
+
+const (
+	// Refilling a mix stops after this many pages in a row without new videos
+	maxEmptyMixPages = 2
+	// Page size of channel uploads if not set in the options
+	defaultChannelPageSize = 50
+)
+
+// Tabs of a channel that list videos. Other tabs & channel home pages are loaded as the videos tab
+var channelVideoTabs = []string{"videos", "shorts", "streams"}
+
+// Refills a mix from the mix of the last new video of the previous page, so that
+// the mix continues as long as it is played. Videos already in the mix are skipped
+type mixPager struct {
+	yt      *Youtube
+	mixUrl  string
+	seenIDs map[string]bool
+	// Consecutive pages without new videos
+	emptyPages int
+}
+
+// Returns true for radio mixes, which have a playlist id starting with "RD". Album
+// playlists of YouTube Music also start with "RD", but are not mixes
+func IsYoutubeMixUrl(inputUrl string) bool {
+	listID := youtubeListID(inputUrl)
+	return strings.HasPrefix(listID, "RD") && !strings.HasPrefix(listID, "RDCLAK")
+}
+
+// Returns true for channel urls, such as https://www.youtube.com/@name or /channel/<id>/videos
+func IsYoutubeChannelUrl(inputUrl string) bool {
+	_, ok := youtubeChannelPath(inputUrl)
+	return ok
+}
+
+// Loads a radio mix, a watch?v=...&list=RD... url, as a playlist that is refilled as it is
+// consumed, until ctx is done, so ctx must live as long as the playlist. Videos are never
+// repeated. The mix ends when no new videos are found
+func (yt *Youtube) GetYoutubeMix(ctx context.Context, mixUrl string) (*YoutubePlaylist, error) {
+	if !IsYoutubeMixUrl(mixUrl) {
+		return nil, ErrorNotAMix
+	}
+
+	pager := &mixPager{
+		yt:      yt,
+		mixUrl:  mixUrl,
+		seenIDs: make(map[string]bool),
+	}
+
+	ytDlpPlaylist, entries, err := pager.loadPage(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(entries) == 0 {
+		return nil, ErrorNoPlaylistFound
+	}
+
+	rng := rand.New(rand.NewSource(time.Now().Unix()))
+	playList := NewYoutubePlaylist(ytDlpPlaylist.ID, ytDlpPlaylist.Title, mixUrl, rng, len(entries), entries...)
+	playList.setPager(ctx, pager)
+
+	return playList, nil
+}
+
+// Loads the uploads of a channel page by page. Channel home pages & tabs other than
+// the videos, shorts & streams tabs are loaded as the videos tab. PageSize of the
+// options defaults to 50, options can be nil for the defaults. Like with
+// GetYoutubePlaylistWithOptions, ctx must live as long as the playlist
+func (yt *Youtube) GetYoutubeChannelUploads(ctx context.Context, channelUrl string, options *PlaylistOptions) (*YoutubePlaylist, error) {
+	channelPath, ok := youtubeChannelPath(channelUrl)
+
+	if !ok {
+		return nil, ErrorNotAChannel
+	}
+
+	uploadsOptions := PlaylistOptions{}
+
+	if options != nil {
+		uploadsOptions = *options
+	}
+
+	if uploadsOptions.PageSize <= 0 {
+		uploadsOptions.PageSize = defaultChannelPageSize
+	}
+
+	return yt.GetYoutubePlaylistWithOptions(ctx, "https://www.youtube.com"+channelPath, &uploadsOptions)
+}
+
+func (pager *mixPager) loadPage(ctx context.Context) (*YtDlpPlayList, []*YoutubeMedia, error) {
+	ytDlpPlaylist, err := pager.yt.getYtDlpPlaylist(ctx, pager.mixUrl, "")
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	entries := make([]*YoutubeMedia, 0, len(ytDlpPlaylist.Entries))
+
+	for _, entry := range ytDlpPlaylist.Entries {
+		if entry.ID == "" || pager.seenIDs[entry.ID] {
+			continue
+		}
+
+		pager.seenIDs[entry.ID] = true
+		entries = append(entries, pager.yt.getMediaFromPlaylistEntry(entry))
+	}
+
+	if len(entries) == 0 {
+		pager.emptyPages += 1
+		return ytDlpPlaylist, entries, nil
+	}
+
+	pager.emptyPages = 0
+
+	// Mixes of videos are lists with the id of the video prefixed with "RD"
+	lastID := entries[len(entries)-1].ID
+	pager.mixUrl = "https://www.youtube.com/watch?v=" + lastID + "&list=RD" + lastID
+
+	return ytDlpPlaylist, entries, nil
+}
+
+func (pager *mixPager) isDone() bool {
+	return pager.emptyPages >= maxEmptyMixPages
+}
+
+func youtubeListID(inputUrl string) string {
+	parsedUrl, err := url.Parse(inputUrl)
+
+	if err != nil || !isYoutubeHost(parsedUrl) {
+		return ""
+	}
+
+	return parsedUrl.Query().Get("list")
+}
+
+// Returns the path of the channel with a tab listing videos, such as /@name/videos
+func youtubeChannelPath(inputUrl string) (string, bool) {
+	parsedUrl, err := url.Parse(inputUrl)
+
+	if err != nil || !isYoutubeHost(parsedUrl) {
+		return "", false
+	}
+
+	segments := strings.FieldsFunc(parsedUrl.Path, func(r rune) bool { return r == '/' })
+	numChannelSegments := 0
+
+	switch {
+	case len(segments) >= 1 && strings.HasPrefix(segments[0], "@"):
+		numChannelSegments = 1
+	case len(segments) >= 2 && slices.Contains([]string{"channel", "c", "user"}, segments[0]):
+		numChannelSegments = 2
+	default:
+		return "", false
+	}
+
+	tab := "videos"
+
+	if len(segments) > numChannelSegments && slices.Contains(channelVideoTabs, segments[numChannelSegments]) {
+		tab = segments[numChannelSegments]
+	}
+
+	return "/" + strings.Join(segments[:numChannelSegments], "/") + "/" + tab, true
+}
+
+func isYoutubeHost(parsedUrl *url.URL) bool {
+	host := strings.ToLower(parsedUrl.Hostname())
+	return host == "youtube.com" || strings.HasSuffix(host, ".youtube.com")
+}
+
+// Verify implements playlistPageLoader
+var _ playlistPageLoader = (*mixPager)(nil)
@@ -0,0 +1,121 @@
+package youtubeapi_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/fakelag/streaming-music-bot/testutils"
+	"github.com/fakelag/streaming-music-bot/youtubeapi"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func makeMockFlatPlaylistJson(id string, title string, entryIDs ...string) string {
+	entries := make([]string, 0, len(entryIDs))
+
+	for _, entryID := range entryIDs {
+		entries = append(entries, fmt.Sprintf(
+			`{"_type": "url", "id": "%s", "title": "Video %s", "duration": 60, "ie_key": "Youtube"}`,
+			entryID, entryID,
+		))
+	}
+
+	return fmt.Sprintf(`{"_type": "playlist", "id": "%s", "title": "%s", "entries": [%s]}`, id, title, strings.Join(entries, ","))
+}
+
+var _ = Describe("YT Mixes & channels", func() {
+	DescribeTable("Recognising mix & channel urls",
+		func(inputUrl string, isMix bool, isChannel bool) {
+			Expect(youtubeapi.IsYoutubeMixUrl(inputUrl)).To(Equal(isMix))
+			Expect(youtubeapi.IsYoutubeChannelUrl(inputUrl)).To(Equal(isChannel))
+		},
+		Entry("Mix", "https://www.youtube.com/watch?v=aaa&list=RDaaa", true, false),
+		Entry("My mix", "https://www.youtube.com/watch?v=aaa&list=RDMMaaa", true, false),
+		Entry("YouTube Music album", "https://music.youtube.com/playlist?list=RDCLAK5uy_abc", false, false),
+		Entry("Playlist", "https://www.youtube.com/playlist?list=PL123", false, false),
+		Entry("Handle", "https://www.youtube.com/@artist", false, true),
+		Entry("Channel tab", "https://www.youtube.com/channel/UC123/shorts", false, true),
+		Entry("Legacy user", "https://youtube.com/user/artist", false, true),
+		Entry("Video", "https://www.youtube.com/watch?v=aaa", false, false),
+		Entry("Other site", "https://example.com/@artist", false, false),
+	)
+
+	It("Refills a mix from its last new video without repeating videos", func() {
+		pages := map[string]string{
+			"https://www.youtube.com/watch?v=a&list=RDa": makeMockFlatPlaylistJson("RDa", "Mix - Video a", "a", "b", "c"),
+			"https://www.youtube.com/watch?v=c&list=RDc": makeMockFlatPlaylistJson("RDc", "Mix - Video c", "c", "d", "b", "e"),
+			"https://www.youtube.com/watch?v=e&list=RDe": makeMockFlatPlaylistJson("RDe", "Mix - Video e", "e", "c"),
+		}
+
+		mockExecutor := &testutils.MockCommandExecutor{MockStdoutFunc: func(args []string) string {
+			return pages[args[0]]
+		}}
+
+		yt := youtubeapi.NewYoutubeAPI()
+		yt.SetCmdExecutor(mockExecutor)
+
+		mix, err := yt.GetYoutubeMix(context.Background(), "https://www.youtube.com/watch?v=a&list=RDa")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(mix.Title()).To(Equal("Mix - Video a"))
+		Expect(mix.Link()).To(Equal("https://www.youtube.com/watch?v=a&list=RDa"))
+		Expect(mix.GetMediaCount()).To(Equal(3))
+
+		Expect(consumeIDs(mix)).To(Equal([]string{"a", "b", "c", "d", "e"}))
+
+		// Refilling stops after pages without new videos
+		recordedArgs := mockExecutor.RecordedArgs()
+		Expect(recordedArgs).To(HaveLen(4))
+		Expect(recordedArgs[3][0]).To(Equal("https://www.youtube.com/watch?v=e&list=RDe"))
+	})
+
+	It("Returns an error for urls that are not mixes", func() {
+		yt := youtubeapi.NewYoutubeAPI()
+		yt.SetCmdExecutor(&testutils.MockCommandExecutor{})
+
+		_, err := yt.GetYoutubeMix(context.Background(), "https://www.youtube.com/playlist?list=PL123")
+		Expect(err).To(MatchError(youtubeapi.ErrorNotAMix))
+
+		_, err = yt.GetYoutubeChannelUploads(context.Background(), "https://www.youtube.com/watch?v=a", &youtubeapi.PlaylistOptions{})
+		Expect(err).To(MatchError(youtubeapi.ErrorNotAChannel))
+	})
+
+	DescribeTable("Loading the uploads of a channel",
+		func(channelUrl string, expectedUrl string) {
+			mockExecutor := &testutils.MockCommandExecutor{
+				MockStdoutResult: makeMockFlatPlaylistJson("UC123", "Artist - Videos", "a", "b"),
+			}
+
+			yt := youtubeapi.NewYoutubeAPI()
+			yt.SetCmdExecutor(mockExecutor)
+
+			uploads, err := yt.GetYoutubeChannelUploads(context.Background(), channelUrl, &youtubeapi.PlaylistOptions{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(uploads.Title()).To(Equal("Artist - Videos"))
+			Expect(consumeIDs(uploads)).To(Equal([]string{"a", "b"}))
+
+			args := mockExecutor.RecordedArgs()[0]
+			Expect(args[0]).To(Equal(expectedUrl))
+			Expect(args).To(ContainElements("--playlist-items", "1:50"))
+		},
+		Entry("Handle", "https://www.youtube.com/@artist", "https://www.youtube.com/@artist/videos"),
+		Entry("Featured tab", "https://m.youtube.com/@artist/featured", "https://www.youtube.com/@artist/videos"),
+		Entry("Shorts tab", "https://www.youtube.com/channel/UC123/shorts", "https://www.youtube.com/channel/UC123/shorts"),
+		Entry("Legacy custom url", "https://www.youtube.com/c/artist/streams?view=0", "https://www.youtube.com/c/artist/streams"),
+	)
+
+	It("Loads the uploads of a channel without options", func() {
+		mockExecutor := &testutils.MockCommandExecutor{
+			MockStdoutResult: makeMockFlatPlaylistJson("UC123", "Artist - Videos", "a", "b"),
+		}
+
+		yt := youtubeapi.NewYoutubeAPI()
+		yt.SetCmdExecutor(mockExecutor)
+
+		uploads, err := yt.GetYoutubeChannelUploads(context.Background(), "https://www.youtube.com/@artist", nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(consumeIDs(uploads)).To(Equal([]string{"a", "b"}))
+		Expect(mockExecutor.RecordedArgs()[0]).To(ContainElements("--playlist-items", "1:50"))
+	})
+})
@@ -0,0 +1,87 @@
+package youtubeapi
+
+import (
+	"encoding/json"
+	"log/slog"
+	"strings"
+)
+
+// Parses yt-dlp output line by line as it is printed. Stream urls printed with --get-url
+// precede the JSON document of their video and are paired with the next JSON line, so that
+// entries skipped by yt-dlp don't shift the pairing of the entries after them
+type ytDlpOutputParser struct {
+	yt      *Youtube
+	onMedia func(media *YoutubeMedia) error
+
+	// First stream url printed since the previous JSON line
+	pendingStreamURL string
+
+	// Details of the playlist flat playlist entries belong to
+	playlistID    string
+	playlistTitle string
+	playlistURL   string
+}
+
+func newYtDlpOutputParser(yt *Youtube, onMedia func(media *YoutubeMedia) error) *ytDlpOutputParser {
+	return &ytDlpOutputParser{
+		yt:      yt,
+		onMedia: onMedia,
+	}
+}
+
+func (parser *ytDlpOutputParser) parseLine(line string) error {
+	line = strings.TrimSpace(line)
+
+	if line == "" {
+		return nil
+	}
+
+	if !strings.HasPrefix(line, "{") {
+		if parser.pendingStreamURL == "" {
+			parser.pendingStreamURL = line
+		}
+		return nil
+	}
+
+	streamURL := parser.pendingStreamURL
+	parser.pendingStreamURL = ""
+
+	var object YtDlpObject
+	if err := json.Unmarshal([]byte(line), &object); err != nil {
+		// Such as a truncated line, skipped like entries yt-dlp fails to load
+		parser.yt.logger.Warn("skipping unparseable yt-dlp output line", slog.String("line", line), slog.Any("error", err))
+		return nil
+	}
+
+	switch object.Type {
+	case "video":
+		if streamURL == "" {
+			return nil
+		}
+
+		media, _, err := parser.yt.getMediaOrPlaylistFromJsonAndStreamURL(&object, line, streamURL)
+
+		if err != nil {
+			return err
+		}
+
+		return parser.onMedia(media)
+	case "url":
+		var entry YtDlpFlatPlayListEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			return err
+		}
+
+		if entry.ID == "" {
+			return nil
+		}
+
+		parser.playlistID = entry.PlaylistID
+		parser.playlistTitle = entry.PlaylistTitle
+		parser.playlistURL = entry.PlaylistURL
+
+		return parser.onMedia(parser.yt.getMediaFromPlaylistEntry(&entry.YtDlpPlayListEntry))
+	default:
+		return nil
+	}
+}
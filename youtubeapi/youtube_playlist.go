@@ -1,7 +1,8 @@
 package youtubeapi
 
 import (
-	"math/rand"
+	"context"
+	"slices"
 	"sync"
 	"time"
 
@@ -20,8 +21,19 @@ type YoutubePlaylist struct {
 	mediaList            []*YoutubeMedia
 	nextMediaIndex       int
 
-	// mutex needs to be write-locked for rng
-	rng *rand.Rand
+	// Set while entries are being added by GetYoutubePlaylistStreaming
+	loading bool
+	loadErr error
+	// Loads further pages of a playlist as it is consumed, nil once all pages are loaded
+	pager    playlistPageLoader
+	pagerCtx context.Context
+	// Page loads failed in a row, paging stops after playlistPageMaxFailures
+	pageFailures int
+	// Media consumed without removal, to load the next page when few media are left unplayed
+	playedMedia map[*YoutubeMedia]bool
+
+	// mutex needs to be write-locked for picker
+	picker *entities.ConsumeOrderPicker[*YoutubeMedia]
 }
 
 func (ypl *YoutubePlaylist) Title() string {
@@ -33,28 +45,37 @@ func (ypl *YoutubePlaylist) Link() string {
 }
 
 func (ypl *YoutubePlaylist) ConsumeNextMedia() (entities.Media, error) {
-	mediaIndex := -1
-
 	ypl.Lock()
 	defer ypl.Unlock()
 
+	ypl.prefetchNextPage()
+
 	if len(ypl.mediaList) == 0 {
+		if ypl.loading {
+			return nil, entities.ErrorPlaylistLoading
+		}
 		return nil, entities.ErrorPlaylistEmpty
 	}
 
 	switch ypl.consumeOrder {
 	case entities.ConsumeOrderFromStart:
-		mediaIndex = ypl.nextMediaIndex % len(ypl.mediaList)
-		ypl.nextMediaIndex += 1
-	case entities.ConsumeOrderShuffle:
-		mediaIndex = ypl.rng.Intn(len(ypl.mediaList))
-	default:
-		break
+		if ypl.loading && ypl.nextMediaIndex >= len(ypl.mediaList) {
+			// Wait for the rest of the playlist instead of starting over
+			return nil, entities.ErrorPlaylistLoading
+		}
+	case entities.ConsumeOrderReverse:
+		if ypl.loading {
+			// The last media is not known until the whole playlist is loaded
+			return nil, entities.ErrorPlaylistLoading
+		}
 	}
 
+	mediaIndex := ypl.picker.PickIndex(ypl.consumeOrder, ypl.mediaList, &ypl.nextMediaIndex, ypl.removeMediaOnConsume)
+
 	selectedMediaFile := ypl.mediaList[mediaIndex]
 
 	if !ypl.removeMediaOnConsume {
+		ypl.playedMedia[selectedMediaFile] = true
 		return selectedMediaFile, nil
 	}
 
@@ -71,12 +92,14 @@ func (ypl *YoutubePlaylist) ConsumeNextMedia() (entities.Media, error) {
 	}
 
 	ypl.mediaList = newMediaList
+	ypl.picker.Remove(selectedMediaFile)
+	delete(ypl.playedMedia, selectedMediaFile)
 
 	return selectedMediaFile, nil
 }
 
 func (ypl *YoutubePlaylist) SetConsumeOrder(order entities.PlaylistConsumeOrder) error {
-	if order != entities.ConsumeOrderFromStart && order != entities.ConsumeOrderShuffle {
+	if !slices.Contains(ypl.GetAvailableConsumeOrders(), order) {
 		return entities.ErrorConsumeOrderNotSupported
 	}
 
@@ -93,7 +116,7 @@ func (ypl *YoutubePlaylist) SetRemoveOnConsume(removeMediaOnConsume bool) {
 }
 
 func (ypl *YoutubePlaylist) GetAvailableConsumeOrders() []entities.PlaylistConsumeOrder {
-	return []entities.PlaylistConsumeOrder{entities.ConsumeOrderFromStart, entities.ConsumeOrderShuffle}
+	return entities.PickerConsumeOrders()
 }
 
 func (ypl *YoutubePlaylist) GetMediaCount() int {
@@ -130,5 +153,33 @@ func (ypl *YoutubePlaylist) GetDurationLeft() *time.Duration {
 	return &durationLeft
 }
 
+// True while more entries are being loaded into the playlist in the background. Entries
+// of pages that have not been loaded are not counted by GetMediaCount
+func (ypl *YoutubePlaylist) IsLoading() bool {
+	ypl.RLock()
+	defer ypl.RUnlock()
+	return ypl.loading
+}
+
+// Error that stopped loading the playlist, if any. Entries loaded before the error are kept
+func (ypl *YoutubePlaylist) LoadError() error {
+	ypl.RLock()
+	defer ypl.RUnlock()
+	return ypl.loadErr
+}
+
+func (ypl *YoutubePlaylist) appendMedia(media *YoutubeMedia) {
+	ypl.Lock()
+	defer ypl.Unlock()
+	ypl.mediaList = append(ypl.mediaList, media)
+}
+
+func (ypl *YoutubePlaylist) finishLoading(err error) {
+	ypl.Lock()
+	defer ypl.Unlock()
+	ypl.loading = false
+	ypl.loadErr = err
+}
+
 // Verify implements entities.Playlist
 var _ entities.Playlist = (*YoutubePlaylist)(nil)
@@ -0,0 +1,188 @@
+package youtubeapi
+
+import (
+	"slices"
+
+	"github.com/fakelag/streaming-music-bot/entities"
+)
+
+func (ypl *YoutubePlaylist) Peek(n int) []entities.Media {
+	ypl.RLock()
+	defer ypl.RUnlock()
+
+	position := ypl.position()
+
+	if position == -1 || n <= 0 {
+		return nil
+	}
+
+	count := min(n, len(ypl.mediaList))
+	step := 1
+
+	switch ypl.consumeOrder {
+	case entities.ConsumeOrderFromStart:
+		// The playlist starts over only once all of it has been loaded
+		if ypl.loading {
+			count = min(count, len(ypl.mediaList)-position)
+		}
+	case entities.ConsumeOrderReverse:
+		step = -1
+	}
+
+	mediaList := make([]entities.Media, 0, count)
+
+	for offset := range count {
+		index := (position + offset*step + len(ypl.mediaList)) % len(ypl.mediaList)
+		mediaList = append(mediaList, ypl.mediaList[index])
+	}
+
+	return mediaList
+}
+
+func (ypl *YoutubePlaylist) List(offset int, limit int) []entities.Media {
+	ypl.RLock()
+	defer ypl.RUnlock()
+
+	offset = max(offset, 0)
+	end := min(len(ypl.mediaList), offset+max(limit, 0))
+	mediaList := make([]entities.Media, 0, max(end-offset, 0))
+
+	for index := offset; index < end; index++ {
+		mediaList = append(mediaList, ypl.mediaList[index])
+	}
+
+	return mediaList
+}
+
+func (ypl *YoutubePlaylist) RemoveAt(index int) (entities.Media, error) {
+	ypl.Lock()
+	defer ypl.Unlock()
+
+	if index < 0 || index >= len(ypl.mediaList) {
+		return nil, entities.ErrorPlaylistIndexOutOfRange
+	}
+
+	media := ypl.removeAt(index)
+	ypl.picker.Remove(media)
+	delete(ypl.playedMedia, media)
+	return media, nil
+}
+
+func (ypl *YoutubePlaylist) Insert(index int, media ...entities.Media) error {
+	youtubeMedia := make([]*YoutubeMedia, len(media))
+
+	for mediaIndex, m := range media {
+		ytMedia, ok := m.(*YoutubeMedia)
+
+		if !ok || ytMedia == nil {
+			return entities.ErrorPlaylistMediaNotSupported
+		}
+
+		youtubeMedia[mediaIndex] = ytMedia
+	}
+
+	ypl.Lock()
+	defer ypl.Unlock()
+
+	if index < 0 || index > len(ypl.mediaList) {
+		return entities.ErrorPlaylistIndexOutOfRange
+	}
+
+	ypl.insertAt(index, youtubeMedia...)
+	return nil
+}
+
+func (ypl *YoutubePlaylist) Move(from int, to int) error {
+	ypl.Lock()
+	defer ypl.Unlock()
+
+	if from < 0 || from >= len(ypl.mediaList) || to < 0 || to >= len(ypl.mediaList) {
+		return entities.ErrorPlaylistIndexOutOfRange
+	}
+
+	ypl.insertAt(to, ypl.removeAt(from))
+	return nil
+}
+
+func (ypl *YoutubePlaylist) Position() int {
+	ypl.RLock()
+	defer ypl.RUnlock()
+	return ypl.position()
+}
+
+// mutex needs to be held
+func (ypl *YoutubePlaylist) position() int {
+	if len(ypl.mediaList) == 0 {
+		return -1
+	}
+
+	switch ypl.consumeOrder {
+	case entities.ConsumeOrderFromStart:
+		if ypl.loading && ypl.nextMediaIndex >= len(ypl.mediaList) {
+			// The next media has not been loaded yet
+			return -1
+		}
+
+		return ypl.nextMediaIndex % len(ypl.mediaList)
+	case entities.ConsumeOrderReverse:
+		if ypl.loading {
+			return -1
+		}
+
+		return len(ypl.mediaList) - 1 - ypl.nextMediaIndex%len(ypl.mediaList)
+	default:
+		return -1
+	}
+}
+
+// Removes the media at index, keeping the next media of ordered consume orders the
+// same unless it is the removed one. mutex needs to be write-locked
+func (ypl *YoutubePlaylist) removeAt(index int) *YoutubeMedia {
+	ypl.normalizeNextMediaIndex()
+	media := ypl.mediaList[index]
+
+	switch ypl.consumeOrder {
+	case entities.ConsumeOrderFromStart:
+		if index < ypl.nextMediaIndex {
+			ypl.nextMediaIndex -= 1
+		}
+	case entities.ConsumeOrderReverse:
+		if index > len(ypl.mediaList)-1-ypl.nextMediaIndex {
+			ypl.nextMediaIndex -= 1
+		}
+	}
+
+	ypl.mediaList = slices.Delete(ypl.mediaList, index, index+1)
+	return media
+}
+
+// Inserts media before index, keeping the next media of ordered consume orders the
+// same unless the media is inserted right before it in consume order. mutex needs to be write-locked
+func (ypl *YoutubePlaylist) insertAt(index int, media ...*YoutubeMedia) {
+	ypl.normalizeNextMediaIndex()
+
+	switch ypl.consumeOrder {
+	case entities.ConsumeOrderFromStart:
+		if index < ypl.nextMediaIndex {
+			ypl.nextMediaIndex += len(media)
+		}
+	case entities.ConsumeOrderReverse:
+		if index > len(ypl.mediaList)-ypl.nextMediaIndex {
+			ypl.nextMediaIndex += len(media)
+		}
+	}
+
+	ypl.mediaList = slices.Insert(ypl.mediaList, index, media...)
+}
+
+// Wraps nextMediaIndex, which counts the media consumed without removal, to an index of the
+// playlist. Left as is while loading so that consuming from the start waits for the rest of
+// the playlist. mutex needs to be write-locked
+func (ypl *YoutubePlaylist) normalizeNextMediaIndex() {
+	if len(ypl.mediaList) > 0 && !ypl.loading {
+		ypl.nextMediaIndex %= len(ypl.mediaList)
+	}
+}
+
+// Verify implements entities.EditablePlaylist
+var _ entities.EditablePlaylist = (*YoutubePlaylist)(nil)
@@ -0,0 +1,128 @@
+package youtubeapi_test
+
+import (
+	"slices"
+
+	"github.com/fakelag/streaming-music-bot/entities"
+	"github.com/fakelag/streaming-music-bot/youtubeapi"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func mediaIDs(mediaList []entities.Media) []string {
+	ids := make([]string, len(mediaList))
+
+	for index, media := range mediaList {
+		ids[index] = media.(*youtubeapi.YoutubeMedia).ID
+	}
+
+	return ids
+}
+
+var _ = Describe("YT Playlist editing", func() {
+	It("Lists media in playlist order", func() {
+		playList := NewPlaylistWithArtists("a", "b", "c", "d")
+
+		Expect(mediaIDs(playList.List(0, 10))).To(Equal([]string{"1", "2", "3", "4"}))
+		Expect(mediaIDs(playList.List(1, 2))).To(Equal([]string{"2", "3"}))
+		Expect(playList.List(4, 2)).To(BeEmpty())
+		Expect(playList.List(0, 0)).To(BeEmpty())
+	})
+
+	It("Peeks media in consume order", func() {
+		playList := NewPlaylistWithArtists("a", "b", "c", "d")
+		playList.SetRemoveOnConsume(false)
+
+		Expect(playList.Position()).To(Equal(0))
+		Expect(mediaIDs(playList.Peek(2))).To(Equal([]string{"1", "2"}))
+
+		consumeMediaIDs(playList, 3)
+		Expect(playList.Position()).To(Equal(3))
+		Expect(mediaIDs(playList.Peek(10))).To(Equal([]string{"4", "1", "2", "3"}))
+
+		Expect(playList.SetConsumeOrder(entities.ConsumeOrderReverse)).To(Succeed())
+		Expect(playList.Position()).To(Equal(0))
+		Expect(mediaIDs(playList.Peek(3))).To(Equal([]string{"1", "4", "3"}))
+
+		Expect(playList.SetConsumeOrder(entities.ConsumeOrderShuffle)).To(Succeed())
+		Expect(playList.Position()).To(Equal(-1))
+		Expect(playList.Peek(3)).To(BeNil())
+	})
+
+	It("Keeps the next media when editing media before it", func() {
+		playList := NewPlaylistWithArtists("a", "b", "c", "d", "e")
+		playList.SetRemoveOnConsume(false)
+		consumeMediaIDs(playList, 2)
+
+		media, err := playList.RemoveAt(0)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(media.(*youtubeapi.YoutubeMedia).ID).To(Equal("1"))
+		Expect(mediaIDs(playList.Peek(1))).To(Equal([]string{"3"}))
+
+		Expect(playList.Insert(0, &youtubeapi.YoutubeMedia{ID: "6"}, &youtubeapi.YoutubeMedia{ID: "7"})).To(Succeed())
+		Expect(mediaIDs(playList.List(0, 10))).To(Equal([]string{"6", "7", "2", "3", "4", "5"}))
+		Expect(playList.Position()).To(Equal(3))
+
+		Expect(playList.Move(5, 0)).To(Succeed())
+		Expect(mediaIDs(playList.List(0, 10))).To(Equal([]string{"5", "6", "7", "2", "3", "4"}))
+		Expect(consumeMediaIDs(playList, 2)).To(Equal([]string{"3", "4"}))
+	})
+
+	It("Consumes media inserted at the position next", func() {
+		playList := NewPlaylistWithArtists("a", "b", "c")
+		consumeMediaIDs(playList, 1)
+
+		Expect(playList.Insert(playList.Position(), &youtubeapi.YoutubeMedia{ID: "4"})).To(Succeed())
+		Expect(consumeIDs(playList)).To(Equal([]string{"4", "2", "3"}))
+
+		playList = NewPlaylistWithArtists("a", "b", "c")
+		Expect(playList.SetConsumeOrder(entities.ConsumeOrderReverse)).To(Succeed())
+		consumeMediaIDs(playList, 1)
+
+		Expect(playList.Insert(playList.Position()+1, &youtubeapi.YoutubeMedia{ID: "4"})).To(Succeed())
+		Expect(consumeIDs(playList)).To(Equal([]string{"4", "2", "1"}))
+	})
+
+	It("Skips removed media when consuming in reverse", func() {
+		playList := NewPlaylistWithArtists("a", "b", "c", "d")
+		playList.SetRemoveOnConsume(false)
+		Expect(playList.SetConsumeOrder(entities.ConsumeOrderReverse)).To(Succeed())
+		consumeMediaIDs(playList, 1)
+
+		_, err := playList.RemoveAt(2)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(consumeMediaIDs(playList, 3)).To(Equal([]string{"2", "1", "4"}))
+	})
+
+	It("Skips removed media in a no-repeat shuffle", func() {
+		playList := NewPlaylistWithArtists("a", "b", "c", "d", "e")
+		playList.SetRemoveOnConsume(false)
+		Expect(playList.SetConsumeOrder(entities.ConsumeOrderShuffleNoRepeat)).To(Succeed())
+		consumed := consumeMediaIDs(playList, 1)
+
+		removeIndex := slices.IndexFunc(playList.List(0, 5), func(media entities.Media) bool {
+			return media.(*youtubeapi.YoutubeMedia).ID != consumed[0]
+		})
+		removed, err := playList.RemoveAt(removeIndex)
+		Expect(err).NotTo(HaveOccurred())
+
+		// The rest of the round, then a full round of the remaining media
+		ids := consumeMediaIDs(playList, 7)
+		Expect(ids).NotTo(ContainElement(removed.(*youtubeapi.YoutubeMedia).ID))
+		remaining := mediaIDs(playList.List(0, 5))
+		Expect(append(consumed, ids[:3]...)).To(ConsistOf(remaining))
+		Expect(ids[3:]).To(ConsistOf(remaining))
+	})
+
+	It("Gives sensible errors when editing invalidly", func() {
+		playList := NewPlaylistWithArtists("a", "b")
+
+		_, err := playList.RemoveAt(2)
+		Expect(err).To(MatchError(entities.ErrorPlaylistIndexOutOfRange))
+		Expect(playList.Insert(-1, &youtubeapi.YoutubeMedia{ID: "3"})).To(MatchError(entities.ErrorPlaylistIndexOutOfRange))
+		Expect(playList.Move(0, 2)).To(MatchError(entities.ErrorPlaylistIndexOutOfRange))
+		Expect(playList.Insert(0, (*youtubeapi.YoutubeMedia)(nil))).To(MatchError(entities.ErrorPlaylistMediaNotSupported))
+		Expect(playList.GetMediaCount()).To(Equal(2))
+	})
+})
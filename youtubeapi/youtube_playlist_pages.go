@@ -0,0 +1,289 @@
+package youtubeapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/fakelag/streaming-music-bot/entities"
+)
+
+const (
+	// The next page of a paged playlist is loaded when this many entries or fewer are left to consume
+	playlistPrefetchRemaining = 2
+	// Loading a page is retried as the playlist is consumed until it has failed this many times in a row
+	playlistPageMaxFailures = 3
+)
+
+// Selects the entries of a playlist loaded by GetYoutubePlaylistWithOptions
+type PlaylistOptions struct {
+	// 1-based index of the first entry. Defaults to 1
+	StartIndex int
+	// 1-based index of the last entry, 0 for the end of the playlist
+	EndIndex int
+	// Max number of entries, 0 for no limit
+	MaxItems int
+	// Loads the entries in reverse order. Reversed playlists are loaded at once, ignoring PageSize
+	Reverse bool
+	// Starts from the video of a watch?v=...&list=... url, found by the index parameter
+	// of the url or by its v parameter. Overrides StartIndex. If the video is not in the
+	// playlist, the playlist starts from StartIndex
+	StartFromURLVideo bool
+	// Number of entries loaded at a time. Further pages are loaded in the background
+	// as the playlist is consumed, until the ctx the playlist was loaded with is done.
+	// 0 loads all entries at once
+	PageSize int
+}
+
+// Loads further entries of a playlist as it is consumed
+type playlistPageLoader interface {
+	// Returns the entries of the next page, which can be empty
+	loadPage(ctx context.Context) (*YtDlpPlayList, []*YoutubeMedia, error)
+	// True once there are no more pages
+	isDone() bool
+}
+
+// Loads the entries of a playlist a page at a time
+type playlistPager struct {
+	yt          *Youtube
+	playlistUrl string
+	startIndex  int
+	endIndex    int
+	maxItems    int
+	// 0 if the entries are loaded with a single page
+	pageSize int
+	// Entries before this video are skipped, cleared once the video is found
+	startVideoID string
+
+	// 1-based index of the first entry of the next page
+	nextIndex   int
+	loadedItems int
+	done        bool
+}
+
+// Loads the entries of a playlist selected by options. Large playlists can be loaded
+// page by page with PageSize, the first page is loaded before the playlist is returned.
+// Further pages are loaded with ctx, so ctx must live as long as the playlist, such as
+// the context of the music session rather than one with the timeout of a command. nil
+// options load the whole playlist at once
+func (yt *Youtube) GetYoutubePlaylistWithOptions(ctx context.Context, playlistIdOrUrl string, options *PlaylistOptions) (*YoutubePlaylist, error) {
+	if options == nil {
+		options = &PlaylistOptions{}
+	}
+
+	pager := newPlaylistPager(yt, playlistIdOrUrl, options)
+
+	var ytDlpPlaylist *YtDlpPlayList
+	entries := make([]*YoutubeMedia, 0)
+
+	// Pages before the start video have no entries
+	for len(entries) == 0 && !pager.done {
+		var err error
+		ytDlpPlaylist, entries, err = pager.loadPage(ctx)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if pager.done && len(entries) == 0 && pager.startVideoID != "" {
+			pager.restartWithoutStartVideo()
+		}
+	}
+
+	if options.Reverse {
+		slices.Reverse(entries)
+	}
+
+	rng := rand.New(rand.NewSource(time.Now().Unix()))
+	playList := NewYoutubePlaylist(ytDlpPlaylist.ID, ytDlpPlaylist.Title, ytDlpPlaylist.PlaylistURL, rng, len(entries), entries...)
+
+	if !pager.done {
+		playList.setPager(ctx, pager)
+	}
+
+	return playList, nil
+}
+
+func newPlaylistPager(yt *Youtube, playlistUrl string, options *PlaylistOptions) *playlistPager {
+	pager := &playlistPager{
+		yt:          yt,
+		playlistUrl: playlistUrl,
+		startIndex:  max(options.StartIndex, 1),
+		endIndex:    max(options.EndIndex, 0),
+		maxItems:    max(options.MaxItems, 0),
+	}
+
+	if !options.Reverse {
+		pager.pageSize = max(options.PageSize, 0)
+	}
+
+	if options.StartFromURLVideo {
+		if parsedUrl, err := url.Parse(playlistUrl); err == nil {
+			query := parsedUrl.Query()
+
+			if index, err := strconv.Atoi(query.Get("index")); err == nil && index > 0 {
+				pager.startIndex = index
+			} else {
+				pager.startVideoID = query.Get("v")
+			}
+		}
+	}
+
+	pager.nextIndex = pager.startIndex
+	return pager
+}
+
+// Loads the next page. Entries before the start video & beyond MaxItems are left out
+func (pager *playlistPager) loadPage(ctx context.Context) (*YtDlpPlayList, []*YoutubeMedia, error) {
+	start, end := pager.nextRange()
+	ytDlpPlaylist, err := pager.yt.getYtDlpPlaylist(ctx, pager.playlistUrl, playlistItems(start, end))
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pager.nextIndex = end + 1
+
+	switch {
+	case end == 0, pager.endIndex > 0 && end >= pager.endIndex:
+		pager.done = true
+	case ytDlpPlaylist.PlaylistCount > 0:
+		pager.done = end >= ytDlpPlaylist.PlaylistCount
+	default:
+		// Pages past the end of the playlist are short
+		pager.done = len(ytDlpPlaylist.Entries) < end-start+1
+	}
+
+	entries := make([]*YoutubeMedia, 0, len(ytDlpPlaylist.Entries))
+
+	for _, entry := range ytDlpPlaylist.Entries {
+		if pager.startVideoID != "" {
+			if entry.ID != pager.startVideoID {
+				continue
+			}
+
+			pager.startVideoID = ""
+		}
+
+		if pager.maxItems > 0 && pager.loadedItems >= pager.maxItems {
+			pager.done = true
+			break
+		}
+
+		entries = append(entries, pager.yt.getMediaFromPlaylistEntry(entry))
+		pager.loadedItems += 1
+	}
+
+	if pager.maxItems > 0 && pager.loadedItems >= pager.maxItems {
+		pager.done = true
+	}
+
+	return ytDlpPlaylist, entries, nil
+}
+
+func (pager *playlistPager) isDone() bool {
+	return pager.done
+}
+
+// Returns the 1-based range of the next page. end is 0 for the end of the playlist
+func (pager *playlistPager) nextRange() (int, int) {
+	start := pager.nextIndex
+	end := pager.endIndex
+
+	if pager.pageSize > 0 {
+		if pageEnd := start + pager.pageSize - 1; end == 0 || pageEnd < end {
+			end = pageEnd
+		}
+	}
+
+	// The range can be limited by MaxItems only when no entries are skipped
+	if pager.maxItems > 0 && pager.startVideoID == "" {
+		if limitEnd := start + pager.maxItems - pager.loadedItems - 1; end == 0 || limitEnd < end {
+			end = limitEnd
+		}
+	}
+
+	return start, end
+}
+
+// Loads the playlist from StartIndex when the start video is not in it
+func (pager *playlistPager) restartWithoutStartVideo() {
+	pager.startVideoID = ""
+	pager.nextIndex = pager.startIndex
+	pager.done = false
+}
+
+// Value of --playlist-items, empty for the whole playlist
+func playlistItems(start int, end int) string {
+	switch {
+	case start <= 1 && end == 0:
+		return ""
+	case end == 0:
+		return fmt.Sprintf("%d:", start)
+	default:
+		return fmt.Sprintf("%d:%d", start, end)
+	}
+}
+
+// Further pages are loaded with ctx, in the background priority unless ctx has a priority.
+// Paging stops for good once ctx is done
+func (ypl *YoutubePlaylist) setPager(ctx context.Context, pager playlistPageLoader) {
+	if _, ok := ytDlpPriorityFromContext(ctx); !ok {
+		ctx = WithYtDlpPriority(ctx, YtDlpPriorityBackground)
+	}
+
+	ypl.pager = pager
+	ypl.pagerCtx = ctx
+}
+
+// Starts loading the next page in the background if few entries are left unplayed.
+// mutex needs to be write-locked
+func (ypl *YoutubePlaylist) prefetchNextPage() {
+	if ypl.pager == nil || ypl.loading {
+		return
+	}
+
+	// Reverse order starts from the last page
+	if len(ypl.mediaList)-len(ypl.playedMedia) > playlistPrefetchRemaining && ypl.consumeOrder != entities.ConsumeOrderReverse {
+		return
+	}
+
+	ypl.loading = true
+	go ypl.loadNextPage(ypl.pagerCtx, ypl.pager)
+}
+
+func (ypl *YoutubePlaylist) loadNextPage(ctx context.Context, pager playlistPageLoader) {
+	_, entries, err := pager.loadPage(ctx)
+
+	ypl.Lock()
+	defer ypl.Unlock()
+
+	ypl.mediaList = append(ypl.mediaList, entries...)
+	ypl.loading = false
+	ypl.loadErr = err
+
+	if err == nil {
+		ypl.pageFailures = 0
+	} else {
+		ypl.pageFailures += 1
+	}
+
+	// Transient errors such as rate limiting are retried by the next prefetch
+	if pager.isDone() || ctx.Err() != nil || isPermanentYtDlpError(err) || ypl.pageFailures >= playlistPageMaxFailures {
+		ypl.pager = nil
+	}
+}
+
+// Errors about the requested playlist, such as ErrorPrivateVideo, which loading again won't fix
+func isPermanentYtDlpError(err error) bool {
+	var ytDlpErr *YtDlpError
+	return errors.As(err, &ytDlpErr) && !IsRetryableYtDlpError(err)
+}
+
+// Verify implements playlistPageLoader
+var _ playlistPageLoader = (*playlistPager)(nil)
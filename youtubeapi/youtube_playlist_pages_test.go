@@ -0,0 +1,288 @@
+package youtubeapi_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/fakelag/streaming-music-bot/entities"
+	"github.com/fakelag/streaming-music-bot/testutils"
+	"github.com/fakelag/streaming-music-bot/youtubeapi"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+const mockPlaylistSize = 7
+
+// Prints the entries of a playlist of mockPlaylistSize videos in the range of --playlist-items
+func mockPlaylistPage(args []string) string {
+	start, end := 1, mockPlaylistSize
+
+	if index := slices.Index(args, "--playlist-items"); index != -1 {
+		startString, endString, _ := strings.Cut(args[index+1], ":")
+		start, _ = strconv.Atoi(startString)
+
+		if endString != "" {
+			end, _ = strconv.Atoi(endString)
+		}
+	}
+
+	entries := make([]string, 0)
+
+	for index := start; index <= min(end, mockPlaylistSize); index++ {
+		entries = append(entries, fmt.Sprintf(
+			`{"_type": "url", "id": "v%d", "title": "Video %d", "duration": 60, "ie_key": "Youtube"}`,
+			index, index,
+		))
+	}
+
+	return fmt.Sprintf(
+		`{"_type": "playlist", "id": "PL1", "title": "Paged Playlist", "playlist_count": %d, "webpage_url": "https://www.youtube.com/playlist?list=PL1", "entries": [%s]}`,
+		mockPlaylistSize, strings.Join(entries, ","),
+	)
+}
+
+func playlistItemsArgs(mockExecutor *testutils.MockCommandExecutor) []string {
+	items := make([]string, 0)
+
+	for _, args := range mockExecutor.RecordedArgs() {
+		if index := slices.Index(args, "--playlist-items"); index != -1 {
+			items = append(items, args[index+1])
+		} else {
+			items = append(items, "")
+		}
+	}
+
+	return items
+}
+
+func consumeIDs(playList *youtubeapi.YoutubePlaylist) []string {
+	ids := make([]string, 0)
+
+	for {
+		media, err := playList.ConsumeNextMedia()
+
+		if err == entities.ErrorPlaylistEmpty {
+			return ids
+		}
+
+		if err == entities.ErrorPlaylistLoading {
+			time.Sleep(10 * time.Millisecond)
+			continue
+		}
+
+		Expect(err).NotTo(HaveOccurred())
+		ids = append(ids, media.(*youtubeapi.YoutubeMedia).ID)
+	}
+}
+
+var _ = Describe("YT Playlist pages", func() {
+	DescribeTable("Selecting entries",
+		func(playlistUrl string, options *youtubeapi.PlaylistOptions, expectedItems []string, expectedIDs []string) {
+			mockExecutor := &testutils.MockCommandExecutor{MockStdoutFunc: mockPlaylistPage}
+
+			yt := youtubeapi.NewYoutubeAPI()
+			yt.SetCmdExecutor(mockExecutor)
+
+			playList, err := yt.GetYoutubePlaylistWithOptions(context.Background(), playlistUrl, options)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(playList.Title()).To(Equal("Paged Playlist"))
+			Expect(consumeIDs(playList)).To(Equal(expectedIDs))
+			Expect(playlistItemsArgs(mockExecutor)).To(Equal(expectedItems))
+		},
+		Entry("Whole playlist",
+			"PL1", &youtubeapi.PlaylistOptions{},
+			[]string{""},
+			[]string{"v1", "v2", "v3", "v4", "v5", "v6", "v7"},
+		),
+		Entry("Range",
+			"PL1", &youtubeapi.PlaylistOptions{StartIndex: 2, EndIndex: 4},
+			[]string{"2:4"},
+			[]string{"v2", "v3", "v4"},
+		),
+		Entry("Max items",
+			"PL1", &youtubeapi.PlaylistOptions{StartIndex: 3, MaxItems: 2},
+			[]string{"3:4"},
+			[]string{"v3", "v4"},
+		),
+		Entry("Reverse",
+			"PL1", &youtubeapi.PlaylistOptions{EndIndex: 3, Reverse: true, PageSize: 2},
+			[]string{"1:3"},
+			[]string{"v3", "v2", "v1"},
+		),
+		Entry("Pages",
+			"PL1", &youtubeapi.PlaylistOptions{PageSize: 3},
+			[]string{"1:3", "4:6", "7:9"},
+			[]string{"v1", "v2", "v3", "v4", "v5", "v6", "v7"},
+		),
+		Entry("Pages with max items",
+			"PL1", &youtubeapi.PlaylistOptions{PageSize: 3, MaxItems: 5},
+			[]string{"1:3", "4:5"},
+			[]string{"v1", "v2", "v3", "v4", "v5"},
+		),
+		Entry("Start from the index of the url",
+			"https://www.youtube.com/watch?v=v5&list=PL1&index=5", &youtubeapi.PlaylistOptions{StartFromURLVideo: true, PageSize: 2},
+			[]string{"5:6", "7:8"},
+			[]string{"v5", "v6", "v7"},
+		),
+		Entry("Start from the video of the url",
+			"https://www.youtube.com/watch?v=v4&list=PL1", &youtubeapi.PlaylistOptions{StartFromURLVideo: true, PageSize: 2, MaxItems: 3},
+			[]string{"1:2", "3:4", "5:6"},
+			[]string{"v4", "v5", "v6"},
+		),
+		Entry("Start from the start if the video of the url is not in the playlist",
+			"https://www.youtube.com/watch?v=other&list=PL1", &youtubeapi.PlaylistOptions{StartFromURLVideo: true, EndIndex: 2},
+			[]string{"1:2", "1:2"},
+			[]string{"v1", "v2"},
+		),
+	)
+
+	It("Loads the whole playlist without options", func() {
+		mockExecutor := &testutils.MockCommandExecutor{MockStdoutFunc: mockPlaylistPage}
+
+		yt := youtubeapi.NewYoutubeAPI()
+		yt.SetCmdExecutor(mockExecutor)
+
+		playList, err := yt.GetYoutubePlaylistWithOptions(context.Background(), "PL1", nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(playList.GetMediaCount()).To(Equal(mockPlaylistSize))
+		Expect(playlistItemsArgs(mockExecutor)).To(Equal([]string{""}))
+	})
+
+	It("Loads the next page only when the playlist is running low", func() {
+		mockExecutor := &testutils.MockCommandExecutor{MockStdoutFunc: mockPlaylistPage}
+
+		yt := youtubeapi.NewYoutubeAPI()
+		yt.SetCmdExecutor(mockExecutor)
+
+		playList, err := yt.GetYoutubePlaylistWithOptions(context.Background(), "PL1", &youtubeapi.PlaylistOptions{PageSize: 4})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(playList.GetMediaCount()).To(Equal(4))
+
+		_, err = playList.ConsumeNextMedia()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(mockExecutor.RecordedArgs()).To(HaveLen(1))
+
+		_, err = playList.ConsumeNextMedia()
+		Expect(err).NotTo(HaveOccurred())
+
+		// 3 entries were left before consuming, 2 are left now
+		_, err = playList.ConsumeNextMedia()
+		Expect(err).NotTo(HaveOccurred())
+
+		Eventually(playList.GetMediaCount).Should(Equal(4))
+		Expect(playList.IsLoading()).To(BeFalse())
+		Expect(playlistItemsArgs(mockExecutor)).To(Equal([]string{"1:4", "5:8"}))
+	})
+
+	It("Loads the next page when few entries are left unplayed in a shuffle", func() {
+		mockExecutor := &testutils.MockCommandExecutor{MockStdoutFunc: mockPlaylistPage}
+
+		yt := youtubeapi.NewYoutubeAPI()
+		yt.SetCmdExecutor(mockExecutor)
+
+		playList, err := yt.GetYoutubePlaylistWithOptions(context.Background(), "PL1", &youtubeapi.PlaylistOptions{PageSize: 4})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(playList.SetConsumeOrder(entities.ConsumeOrderShuffleNoRepeat)).To(Succeed())
+		playList.SetRemoveOnConsume(false)
+
+		consumeMediaIDs(playList, 2)
+		Expect(mockExecutor.RecordedArgs()).To(HaveLen(1))
+
+		// 2 entries are left unplayed
+		consumeMediaIDs(playList, 1)
+
+		Eventually(playList.GetMediaCount).Should(Equal(7))
+		Expect(playlistItemsArgs(mockExecutor)).To(Equal([]string{"1:4", "5:8"}))
+	})
+
+	It("Stops loading pages once the context of the playlist is done", func() {
+		mockExecutor := &testutils.MockCommandExecutor{MockStdoutFunc: mockPlaylistPage}
+
+		yt := youtubeapi.NewYoutubeAPI()
+		yt.SetCmdExecutor(mockExecutor)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		playList, err := yt.GetYoutubePlaylistWithOptions(ctx, "PL1", &youtubeapi.PlaylistOptions{PageSize: 2})
+		Expect(err).NotTo(HaveOccurred())
+
+		mockExecutor.MockBlockUntilDone = true
+		_, err = playList.ConsumeNextMedia()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(playList.IsLoading()).To(BeTrue())
+
+		cancel()
+
+		Eventually(playList.IsLoading).Should(BeFalse())
+		Expect(playList.LoadError()).To(MatchError(context.Canceled))
+		Expect(consumeIDs(playList)).To(Equal([]string{"v2"}))
+	})
+
+	It("Keeps the loaded entries if loading a page fails", func() {
+		mockExecutor := &testutils.MockCommandExecutor{MockStdoutFunc: func(args []string) string {
+			if slices.Contains(args, "3:4") {
+				return "{"
+			}
+
+			return mockPlaylistPage(args)
+		}}
+
+		yt := youtubeapi.NewYoutubeAPI()
+		yt.SetCmdExecutor(mockExecutor)
+
+		playList, err := yt.GetYoutubePlaylistWithOptions(context.Background(), "PL1", &youtubeapi.PlaylistOptions{PageSize: 2})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(consumeIDs(playList)).To(Equal([]string{"v1", "v2"}))
+
+		var syntaxError *json.SyntaxError
+		Expect(playList.LoadError()).To(BeAssignableToTypeOf(syntaxError))
+
+		// Retried as the playlist is consumed, until it fails too many times in a row
+		Expect(playlistItemsArgs(mockExecutor)).To(Equal([]string{"1:2", "3:4", "3:4", "3:4"}))
+	})
+
+	It("Retries loading a page on the next prefetch", func() {
+		var failed atomic.Bool
+
+		mockExecutor := &testutils.MockCommandExecutor{MockStdoutFunc: func(args []string) string {
+			if slices.Contains(args, "3:4") && !failed.Swap(true) {
+				return "{"
+			}
+
+			return mockPlaylistPage(args)
+		}}
+
+		yt := youtubeapi.NewYoutubeAPI()
+		yt.SetCmdExecutor(mockExecutor)
+
+		playList, err := yt.GetYoutubePlaylistWithOptions(context.Background(), "PL1", &youtubeapi.PlaylistOptions{PageSize: 2})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(consumeIDs(playList)).To(Equal([]string{"v1", "v2", "v3", "v4", "v5", "v6", "v7"}))
+		Expect(playList.LoadError()).To(BeNil())
+	})
+
+	It("Stops loading pages after an error about the playlist", func() {
+		mockExecutor := &testutils.MockCommandExecutor{MockStdoutFunc: mockPlaylistPage}
+
+		yt := youtubeapi.NewYoutubeAPI()
+		yt.SetCmdExecutor(mockExecutor)
+
+		playList, err := yt.GetYoutubePlaylistWithOptions(context.Background(), "PL1", &youtubeapi.PlaylistOptions{PageSize: 2})
+		Expect(err).NotTo(HaveOccurred())
+
+		mockExecutor.MockExitCode = 1
+		mockExecutor.MockStderrResult = "ERROR: [youtube:tab] PL1: This video is private"
+
+		Expect(consumeIDs(playList)).To(Equal([]string{"v1", "v2"}))
+		Expect(playList.LoadError()).To(MatchError(youtubeapi.ErrorPrivateVideo))
+		Expect(playlistItemsArgs(mockExecutor)).To(Equal([]string{"1:2", "3:4"}))
+	})
+})
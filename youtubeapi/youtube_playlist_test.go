@@ -2,6 +2,7 @@ package youtubeapi_test
 
 import (
 	"math/rand"
+	"strconv"
 	"time"
 
 	"github.com/fakelag/streaming-music-bot/entities"
@@ -39,6 +40,34 @@ func NewPlaylistWithMedia() *youtubeapi.YoutubePlaylist {
 	return youtubeapi.NewYoutubePlaylist("3", "Mock Playlist", "listurl", rng, len(mediaList), mediaList...)
 }
 
+func NewPlaylistWithArtists(artists ...string) *youtubeapi.YoutubePlaylist {
+	rng := rand.New(rand.NewSource(GinkgoRandomSeed()))
+	mediaList := make([]*youtubeapi.YoutubeMedia, len(artists))
+
+	for index, artist := range artists {
+		mediaList[index] = &youtubeapi.YoutubeMedia{
+			ID:            strconv.Itoa(index + 1),
+			VideoTitle:    "Mock Media " + strconv.Itoa(index+1),
+			VideoDuration: 60 * time.Second,
+			MusicArtist:   artist,
+		}
+	}
+
+	return youtubeapi.NewYoutubePlaylist("4", "Mock Artist Playlist", "listurl", rng, len(mediaList), mediaList...)
+}
+
+func consumeMediaIDs(playList *youtubeapi.YoutubePlaylist, count int) []string {
+	ids := make([]string, count)
+
+	for index := range ids {
+		media, err := playList.ConsumeNextMedia()
+		Expect(err).NotTo(HaveOccurred())
+		ids[index] = media.(*youtubeapi.YoutubeMedia).ID
+	}
+
+	return ids
+}
+
 var _ = Describe("YT Playlists", func() {
 	When("Consuming media from a playlist", func() {
 		It("Consumes media from the start & removes on consumption", func() {
@@ -74,6 +103,34 @@ var _ = Describe("YT Playlists", func() {
 			Expect(media).To(BeNil())
 		})
 
+		It("Consumes every media in order from the start when removing on consumption", func() {
+			mediaList := []*youtubeapi.YoutubeMedia{{ID: "1"}, {ID: "2"}, {ID: "3"}}
+			playList := youtubeapi.NewYoutubePlaylist("3", "Mock Playlist", "listurl", nil, len(mediaList), mediaList...)
+
+			for _, expectedMedia := range mediaList {
+				media, err := playList.ConsumeNextMedia()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(media).To(Equal(expectedMedia))
+			}
+
+			_, err := playList.ConsumeNextMedia()
+			Expect(err).To(MatchError(entities.ErrorPlaylistEmpty))
+		})
+
+		It("Continues from the next media when removal on consumption is turned on midway", func() {
+			playList := NewPlaylistWithArtists("a", "b", "c", "d")
+			Expect(playList.SetConsumeOrder(entities.ConsumeOrderFromStart)).To(Succeed())
+
+			playList.SetRemoveOnConsume(false)
+			Expect(consumeMediaIDs(playList, 1)).To(Equal([]string{"1"}))
+
+			// Removing the media moves the next one to the same index
+			playList.SetRemoveOnConsume(true)
+			Expect(consumeMediaIDs(playList, 3)).To(Equal([]string{"2", "3", "4"}))
+			Expect(consumeMediaIDs(playList, 1)).To(Equal([]string{"1"}))
+			Expect(playList.GetMediaCount()).To(Equal(0))
+		})
+
 		It("Consumes media from the start without removal", func() {
 			playList := NewPlaylistWithMedia()
 
@@ -146,6 +203,84 @@ var _ = Describe("YT Playlists", func() {
 			Expect(playList.GetMediaCount()).To(Equal(2))
 		})
 
+		It("Consumes media in reverse", func() {
+			playList := NewPlaylistWithArtists("a", "b", "c")
+			Expect(playList.SetConsumeOrder(entities.ConsumeOrderReverse)).To(Succeed())
+
+			playList.SetRemoveOnConsume(false)
+			Expect(consumeMediaIDs(playList, 4)).To(Equal([]string{"3", "2", "1", "3"}))
+
+			playList = NewPlaylistWithArtists("a", "b", "c")
+			Expect(playList.SetConsumeOrder(entities.ConsumeOrderReverse)).To(Succeed())
+			Expect(consumeIDs(playList)).To(Equal([]string{"3", "2", "1"}))
+		})
+
+		It("Consumes every media once before repeating with a no-repeat shuffle", func() {
+			playList := NewPlaylistWithArtists("a", "b", "c", "d", "e")
+			Expect(playList.SetConsumeOrder(entities.ConsumeOrderShuffleNoRepeat)).To(Succeed())
+			playList.SetRemoveOnConsume(false)
+
+			ids := consumeMediaIDs(playList, 15)
+
+			for round := 0; round < 3; round++ {
+				Expect(ids[round*5 : round*5+5]).To(ConsistOf("1", "2", "3", "4", "5"))
+			}
+
+			for index := 1; index < len(ids); index++ {
+				Expect(ids[index]).NotTo(Equal(ids[index-1]))
+			}
+		})
+
+		It("Spreads the media of the same artist with an artist spread shuffle", func() {
+			playList := NewPlaylistWithArtists("a", "a", "a", "b", "b", "b")
+			Expect(playList.SetConsumeOrder(entities.ConsumeOrderArtistSpread)).To(Succeed())
+
+			artists := make([]string, 0)
+
+			for range 6 {
+				media, err := playList.ConsumeNextMedia()
+				Expect(err).NotTo(HaveOccurred())
+				artists = append(artists, media.(*youtubeapi.YoutubeMedia).Artist())
+			}
+
+			for index := 1; index < len(artists); index++ {
+				Expect(artists[index]).NotTo(Equal(artists[index-1]))
+			}
+		})
+
+		It("Favours media consumed less often with weighted random", func() {
+			playList := NewPlaylistWithArtists("a", "b", "c", "d")
+			Expect(playList.SetConsumeOrder(entities.ConsumeOrderWeightedRandom)).To(Succeed())
+			playList.SetRemoveOnConsume(false)
+
+			playCounts := make(map[string]int)
+
+			for _, id := range consumeMediaIDs(playList, 400) {
+				playCounts[id] += 1
+			}
+
+			// Weighting by play count keeps the counts close to each other
+			for _, id := range []string{"1", "2", "3", "4"} {
+				Expect(playCounts[id]).To(BeNumerically("~", 100, 20))
+			}
+		})
+
+		It("Lists every supported consume order", func() {
+			playList := NewPlaylistWithMedia()
+			Expect(playList.GetAvailableConsumeOrders()).To(ConsistOf(
+				entities.ConsumeOrderFromStart,
+				entities.ConsumeOrderShuffle,
+				entities.ConsumeOrderReverse,
+				entities.ConsumeOrderShuffleNoRepeat,
+				entities.ConsumeOrderArtistSpread,
+				entities.ConsumeOrderWeightedRandom,
+			))
+
+			for _, order := range playList.GetAvailableConsumeOrders() {
+				Expect(playList.SetConsumeOrder(order)).To(Succeed())
+			}
+		})
+
 		It("Gives sensible errors when attempting to configure playlist invalidly", func() {
 			playList := NewPlaylistWithMedia()
 			Expect(playList.SetConsumeOrder(entities.PlaylistConsumeOrder("nonexistent_consume_order"))).
@@ -0,0 +1,281 @@
+package youtubeapi
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	cmd "github.com/fakelag/streaming-music-bot/command"
+)
+
+var (
+	ErrorCircuitOpen = errors.New("yt-dlp is failing consistently, circuit breaker is open")
+)
+
+// Retries of failed yt-dlp invocations. Invocations are not retried once ctx is done,
+// or if a streaming invocation has already printed output
+type RetryPolicy struct {
+	// Total number of attempts including the first one. Values below 2 disable retries
+	MaxAttempts int
+	// Delay before the first retry. Defaults to 1s
+	InitialBackoff time.Duration
+	// Upper bound for the delay between attempts. Defaults to 30s
+	MaxBackoff time.Duration
+	// Factor the delay grows by after each attempt. Defaults to 2
+	Multiplier float64
+	// Random fraction of the delay, 0.2 varies delays by ±20%. Defaults to 0
+	Jitter float64
+	// Decides whether an error should be retried. Defaults to IsRetryableYtDlpError
+	IsRetryable func(err error) bool
+}
+
+// Retries up to 3 attempts with exponential backoff starting at 1s and ±20% jitter
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: time.Second,
+		MaxBackoff:     30 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
+	}
+}
+
+// Network errors, rate limiting and timeouts are transient, while errors about
+// the requested video such as ErrorPrivateVideo are not
+func IsRetryableYtDlpError(err error) bool {
+	return errors.Is(err, ErrorNetwork) ||
+		errors.Is(err, ErrorRateLimited) ||
+		errors.Is(err, cmd.ErrorCommandTimeout)
+}
+
+func (policy *RetryPolicy) isRetryable(err error) bool {
+	if policy.IsRetryable != nil {
+		return policy.IsRetryable(err)
+	}
+
+	return IsRetryableYtDlpError(err)
+}
+
+// Delay after the given failed attempt, starting from 1
+func (policy *RetryPolicy) backoff(attempt int) time.Duration {
+	initialBackoff := policy.InitialBackoff
+	if initialBackoff <= 0 {
+		initialBackoff = time.Second
+	}
+
+	maxBackoff := policy.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = 30 * time.Second
+	}
+
+	multiplier := policy.Multiplier
+	if multiplier < 1 {
+		multiplier = 2
+	}
+
+	backoff := math.Min(float64(initialBackoff)*math.Pow(multiplier, float64(attempt-1)), float64(maxBackoff))
+
+	if policy.Jitter > 0 {
+		backoff += backoff * policy.Jitter * (2*rand.Float64() - 1)
+	}
+
+	return time.Duration(backoff)
+}
+
+type CircuitBreakerState = string
+
+const (
+	// yt-dlp is invoked normally
+	CircuitBreakerClosed CircuitBreakerState = "closed"
+	// Invocations fail immediately with ErrorCircuitOpen
+	CircuitBreakerOpen CircuitBreakerState = "open"
+	// A single probe invocation is allowed to decide whether to close the circuit again
+	CircuitBreakerHalfOpen CircuitBreakerState = "half_open"
+)
+
+type CircuitBreakerOptions struct {
+	// Consecutive failures that open the circuit. Defaults to 5
+	FailureThreshold int
+	// Time the circuit stays open before a probe invocation is allowed. Defaults to 30s
+	OpenDuration time.Duration
+	// Decides whether an error means yt-dlp is failing. Defaults to IsYtDlpFailure
+	IsFailure func(err error) bool
+}
+
+type CircuitBreakerStats struct {
+	State               CircuitBreakerState
+	ConsecutiveFailures int
+	// Time the circuit was last opened, zero if it has never been opened
+	OpenedAt time.Time
+	// Invocations rejected with ErrorCircuitOpen
+	Rejected int
+}
+
+// Errors about the requested video, such as ErrorVideoRemoved, mean that yt-dlp is working
+// and are not failures. Neither are cancellations
+func IsYtDlpFailure(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var ytDlpErr *YtDlpError
+	if errors.As(err, &ytDlpErr) {
+		return errors.Is(err, ErrorNetwork) || errors.Is(err, ErrorRateLimited)
+	}
+
+	return true
+}
+
+// Fast-fails yt-dlp invocations while yt-dlp is failing consistently. Safe for concurrent use
+type CircuitBreaker struct {
+	mutex            sync.Mutex
+	failureThreshold int
+	openDuration     time.Duration
+	isFailure        func(err error) bool
+	state            CircuitBreakerState
+	failures         int
+	openedAt         time.Time
+	probeRunning     bool
+	// Token of the running probe, incremented for every probe
+	probeToken uint64
+	rejected   int
+}
+
+func NewCircuitBreaker(options *CircuitBreakerOptions) *CircuitBreaker {
+	breaker := &CircuitBreaker{
+		failureThreshold: 5,
+		openDuration:     30 * time.Second,
+		isFailure:        IsYtDlpFailure,
+		state:            CircuitBreakerClosed,
+	}
+
+	if options != nil {
+		if options.FailureThreshold > 0 {
+			breaker.failureThreshold = options.FailureThreshold
+		}
+
+		if options.OpenDuration > 0 {
+			breaker.openDuration = options.OpenDuration
+		}
+
+		if options.IsFailure != nil {
+			breaker.isFailure = options.IsFailure
+		}
+	}
+
+	return breaker
+}
+
+func (breaker *CircuitBreaker) State() CircuitBreakerState {
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+	return breaker.currentState()
+}
+
+func (breaker *CircuitBreaker) Stats() CircuitBreakerStats {
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+
+	return CircuitBreakerStats{
+		State:               breaker.currentState(),
+		ConsecutiveFailures: breaker.failures,
+		OpenedAt:            breaker.openedAt,
+		Rejected:            breaker.rejected,
+	}
+}
+
+// Closes the circuit and resets the failure count
+func (breaker *CircuitBreaker) Reset() {
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+
+	breaker.state = CircuitBreakerClosed
+	breaker.failures = 0
+	breaker.probeRunning = false
+}
+
+// Returns ErrorCircuitOpen if the invocation should not run. Otherwise the result of the
+// invocation must be passed to record, or the invocation to cancel if it did not run yt-dlp,
+// along with the returned probe token. The token is 0 for invocations that are not probes
+func (breaker *CircuitBreaker) allow() (uint64, error) {
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+
+	switch breaker.currentState() {
+	case CircuitBreakerOpen:
+		breaker.rejected += 1
+		return 0, ErrorCircuitOpen
+	case CircuitBreakerHalfOpen:
+		if breaker.probeRunning {
+			breaker.rejected += 1
+			return 0, ErrorCircuitOpen
+		}
+
+		breaker.state = CircuitBreakerHalfOpen
+		breaker.probeRunning = true
+		breaker.probeToken += 1
+		return breaker.probeToken, nil
+	}
+
+	return 0, nil
+}
+
+// Records the result of a yt-dlp invocation. Only the probe decides the state of a half-open
+// circuit, invocations allowed before the circuit opened are ignored
+func (breaker *CircuitBreaker) record(probe uint64, err error) {
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+
+	isProbe := breaker.endProbe(probe)
+
+	if errors.Is(err, context.Canceled) {
+		// Says nothing about yt-dlp, let the next invocation probe instead
+		return
+	}
+
+	if !isProbe && breaker.currentState() != CircuitBreakerClosed {
+		return
+	}
+
+	if !breaker.isFailure(err) {
+		breaker.state = CircuitBreakerClosed
+		breaker.failures = 0
+		return
+	}
+
+	breaker.failures += 1
+
+	if isProbe || breaker.failures >= breaker.failureThreshold {
+		breaker.state = CircuitBreakerOpen
+		breaker.openedAt = time.Now()
+	}
+}
+
+// Ends an invocation that did not run yt-dlp, letting the next invocation probe instead
+func (breaker *CircuitBreaker) cancel(probe uint64) {
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+	breaker.endProbe(probe)
+}
+
+// Caller must hold the lock. Returns true if probe is the token of the running probe
+func (breaker *CircuitBreaker) endProbe(probe uint64) bool {
+	if probe == 0 || !breaker.probeRunning || probe != breaker.probeToken {
+		return false
+	}
+
+	breaker.probeRunning = false
+	return true
+}
+
+// Caller must hold the lock. An open circuit turns half-open once OpenDuration has passed
+func (breaker *CircuitBreaker) currentState() CircuitBreakerState {
+	if breaker.state == CircuitBreakerOpen && time.Since(breaker.openedAt) >= breaker.openDuration {
+		return CircuitBreakerHalfOpen
+	}
+
+	return breaker.state
+}
@@ -0,0 +1,346 @@
+package youtubeapi_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	cmd "github.com/fakelag/streaming-music-bot/command"
+	"github.com/fakelag/streaming-music-bot/testutils"
+	"github.com/fakelag/streaming-music-bot/youtubeapi"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+const networkErrorStderr = "ERROR: [youtube] 123: Unable to download webpage: <urlopen error [Errno 104] Connection reset by peer>\n"
+
+// Fails the first numFailures invocations with the given stderr
+type FlakyCommandExecutor struct {
+	testutils.MockCommandExecutor
+	mutex       sync.Mutex
+	numFailures int
+	failStderr  string
+	calls       int
+}
+
+func (executor *FlakyCommandExecutor) RunCommand(ctx context.Context, executable string, args ...string) (*cmd.CommandResult, error) {
+	executor.mutex.Lock()
+	executor.calls += 1
+	shouldFail := executor.calls <= executor.numFailures
+	executor.mutex.Unlock()
+
+	if shouldFail {
+		return &cmd.CommandResult{Stderr: executor.failStderr, ExitCode: 1}, &cmd.CommandError{
+			ExitCode: 1,
+			Stderr:   executor.failStderr,
+			Err:      errors.New("exit status 1"),
+		}
+	}
+
+	return executor.MockCommandExecutor.RunCommand(ctx, executable, args...)
+}
+
+func (executor *FlakyCommandExecutor) Calls() int {
+	executor.mutex.Lock()
+	defer executor.mutex.Unlock()
+	return executor.calls
+}
+
+func NewFlakyCommandExecutor(numFailures int, failStderr string) *FlakyCommandExecutor {
+	return &FlakyCommandExecutor{
+		MockCommandExecutor: testutils.MockCommandExecutor{
+			MockStdoutResult: "url123\n" + makeMockVideoJson("123", "Mock Title"),
+		},
+		numFailures: numFailures,
+		failStderr:  failStderr,
+	}
+}
+
+var fastRetryPolicy = &youtubeapi.RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: 10 * time.Millisecond,
+	MaxBackoff:     50 * time.Millisecond,
+	Jitter:         0.5,
+}
+
+var _ = Describe("YT Retries", func() {
+	It("Retries transient failures", func() {
+		executor := NewFlakyCommandExecutor(2, networkErrorStderr)
+
+		yt := youtubeapi.NewYoutubeAPI()
+		yt.SetCmdExecutor(executor)
+		yt.SetRetryPolicy(fastRetryPolicy)
+
+		media, err := yt.GetYoutubeMedia(context.Background(), "foo")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(media.Title()).To(Equal("Mock Title"))
+		Expect(executor.Calls()).To(Equal(3))
+	})
+
+	It("Gives up after max attempts", func() {
+		executor := NewFlakyCommandExecutor(5, networkErrorStderr)
+
+		yt := youtubeapi.NewYoutubeAPI()
+		yt.SetCmdExecutor(executor)
+		yt.SetRetryPolicy(fastRetryPolicy)
+
+		_, err := yt.GetYoutubeMedia(context.Background(), "foo")
+		Expect(err).To(MatchError(youtubeapi.ErrorNetwork))
+		Expect(executor.Calls()).To(Equal(3))
+	})
+
+	It("Does not retry errors about the requested video", func() {
+		executor := NewFlakyCommandExecutor(5, "ERROR: [youtube] 123: Private video. Sign in if you've been granted access to this video\n")
+
+		yt := youtubeapi.NewYoutubeAPI()
+		yt.SetCmdExecutor(executor)
+		yt.SetRetryPolicy(fastRetryPolicy)
+
+		_, err := yt.GetYoutubeMedia(context.Background(), "foo")
+		Expect(err).To(MatchError(youtubeapi.ErrorPrivateVideo))
+		Expect(executor.Calls()).To(Equal(1))
+	})
+
+	It("Grows backoff exponentially up to the max backoff", func() {
+		policy := &youtubeapi.RetryPolicy{
+			MaxAttempts:    5,
+			InitialBackoff: 100 * time.Millisecond,
+			MaxBackoff:     300 * time.Millisecond,
+		}
+
+		executor := NewFlakyCommandExecutor(4, networkErrorStderr)
+
+		yt := youtubeapi.NewYoutubeAPI()
+		yt.SetCmdExecutor(executor)
+		yt.SetRetryPolicy(policy)
+
+		startedAt := time.Now()
+		_, err := yt.GetYoutubeMedia(context.Background(), "foo")
+		Expect(err).NotTo(HaveOccurred())
+
+		// 100ms + 200ms + 300ms + 300ms
+		Expect(time.Since(startedAt)).To(BeNumerically(">=", 900*time.Millisecond))
+		Expect(time.Since(startedAt)).To(BeNumerically("<", 3*time.Second))
+	})
+})
+
+// Holds invocations of the search terms in gates until the gate is closed & fails the search terms in failures
+type GatedCommandExecutor struct {
+	testutils.MockCommandExecutor
+	gates    map[string]chan struct{}
+	failures map[string]bool
+	mutex    sync.Mutex
+	started  []string
+}
+
+func NewGatedCommandExecutor(gatedTerms []string, failingTerms []string) *GatedCommandExecutor {
+	executor := &GatedCommandExecutor{
+		MockCommandExecutor: testutils.MockCommandExecutor{
+			MockStdoutResult: "url123\n" + makeMockVideoJson("123", "Mock Title"),
+		},
+		gates:    make(map[string]chan struct{}),
+		failures: make(map[string]bool),
+	}
+
+	for _, term := range gatedTerms {
+		executor.gates["ytsearch:"+term] = make(chan struct{})
+	}
+
+	for _, term := range failingTerms {
+		executor.failures["ytsearch:"+term] = true
+	}
+
+	return executor
+}
+
+func (executor *GatedCommandExecutor) RunCommand(ctx context.Context, executable string, args ...string) (*cmd.CommandResult, error) {
+	executor.mutex.Lock()
+	executor.started = append(executor.started, strings.TrimPrefix(args[0], "ytsearch:"))
+	executor.mutex.Unlock()
+
+	if gate, ok := executor.gates[args[0]]; ok {
+		select {
+		case <-gate:
+		case <-ctx.Done():
+			return &cmd.CommandResult{ExitCode: -1}, ctx.Err()
+		}
+	}
+
+	if executor.failures[args[0]] {
+		return &cmd.CommandResult{Stderr: networkErrorStderr, ExitCode: 1}, &cmd.CommandError{
+			ExitCode: 1,
+			Stderr:   networkErrorStderr,
+			Err:      errors.New("exit status 1"),
+		}
+	}
+
+	return executor.MockCommandExecutor.RunCommand(ctx, executable, args...)
+}
+
+func (executor *GatedCommandExecutor) Started() []string {
+	executor.mutex.Lock()
+	defer executor.mutex.Unlock()
+	return slices.Clone(executor.started)
+}
+
+func (executor *GatedCommandExecutor) Open(term string) {
+	close(executor.gates["ytsearch:"+term])
+}
+
+var _ = Describe("YT Circuit Breaker", func() {
+	It("Opens after consecutive failures and closes after a successful probe", func() {
+		executor := NewFlakyCommandExecutor(3, networkErrorStderr)
+		breaker := youtubeapi.NewCircuitBreaker(&youtubeapi.CircuitBreakerOptions{
+			FailureThreshold: 3,
+			OpenDuration:     200 * time.Millisecond,
+		})
+
+		yt := youtubeapi.NewYoutubeAPI()
+		yt.SetCmdExecutor(executor)
+		yt.SetCircuitBreaker(breaker)
+
+		for i := 0; i < 3; i++ {
+			Expect(yt.GetCircuitBreaker().State()).To(Equal(youtubeapi.CircuitBreakerClosed))
+			_, err := yt.GetYoutubeMedia(context.Background(), "foo")
+			Expect(err).To(MatchError(youtubeapi.ErrorNetwork))
+		}
+
+		Expect(breaker.State()).To(Equal(youtubeapi.CircuitBreakerOpen))
+
+		_, err := yt.GetYoutubeMedia(context.Background(), "foo")
+		Expect(err).To(MatchError(youtubeapi.ErrorCircuitOpen))
+		Expect(executor.Calls()).To(Equal(3))
+
+		Eventually(breaker.State).Should(Equal(youtubeapi.CircuitBreakerHalfOpen))
+
+		_, err = yt.GetYoutubeMedia(context.Background(), "foo")
+		Expect(err).NotTo(HaveOccurred())
+
+		stats := breaker.Stats()
+		Expect(stats.State).To(Equal(youtubeapi.CircuitBreakerClosed))
+		Expect(stats.ConsecutiveFailures).To(Equal(0))
+		Expect(stats.Rejected).To(Equal(1))
+		Expect(stats.OpenedAt).NotTo(BeZero())
+	})
+
+	It("Reopens when the probe fails", func() {
+		executor := NewFlakyCommandExecutor(5, networkErrorStderr)
+		breaker := youtubeapi.NewCircuitBreaker(&youtubeapi.CircuitBreakerOptions{
+			FailureThreshold: 2,
+			OpenDuration:     100 * time.Millisecond,
+		})
+
+		yt := youtubeapi.NewYoutubeAPI()
+		yt.SetCmdExecutor(executor)
+		yt.SetCircuitBreaker(breaker)
+
+		for i := 0; i < 2; i++ {
+			_, err := yt.GetYoutubeMedia(context.Background(), "foo")
+			Expect(err).To(MatchError(youtubeapi.ErrorNetwork))
+		}
+
+		Eventually(breaker.State).Should(Equal(youtubeapi.CircuitBreakerHalfOpen))
+
+		_, err := yt.GetYoutubeMedia(context.Background(), "foo")
+		Expect(err).To(MatchError(youtubeapi.ErrorNetwork))
+		Expect(breaker.State()).To(Equal(youtubeapi.CircuitBreakerOpen))
+
+		breaker.Reset()
+		Expect(breaker.State()).To(Equal(youtubeapi.CircuitBreakerClosed))
+	})
+
+	It("Does not count errors about the requested video as failures", func() {
+		executor := NewFlakyCommandExecutor(5, "ERROR: [youtube] 123: Video unavailable. This video has been removed by the uploader\n")
+		breaker := youtubeapi.NewCircuitBreaker(&youtubeapi.CircuitBreakerOptions{FailureThreshold: 2})
+
+		yt := youtubeapi.NewYoutubeAPI()
+		yt.SetCmdExecutor(executor)
+		yt.SetCircuitBreaker(breaker)
+
+		for i := 0; i < 3; i++ {
+			_, err := yt.GetYoutubeMedia(context.Background(), "foo")
+			Expect(err).To(MatchError(youtubeapi.ErrorVideoRemoved))
+		}
+
+		Expect(breaker.State()).To(Equal(youtubeapi.CircuitBreakerClosed))
+	})
+	It("Lets only the probe decide the state of a half-open circuit", func() {
+		executor := NewGatedCommandExecutor([]string{"slow", "probe"}, []string{"fail", "probe"})
+		breaker := youtubeapi.NewCircuitBreaker(&youtubeapi.CircuitBreakerOptions{
+			FailureThreshold: 1,
+			OpenDuration:     100 * time.Millisecond,
+		})
+
+		yt := youtubeapi.NewYoutubeAPI()
+		yt.SetCmdExecutor(executor)
+		yt.SetCircuitBreaker(breaker)
+
+		slowDone := make(chan error)
+		go func() {
+			_, err := yt.GetYoutubeMedia(context.Background(), "slow")
+			slowDone <- err
+		}()
+
+		Eventually(executor.Started).Should(ContainElement("slow"))
+		_, err := yt.GetYoutubeMedia(context.Background(), "fail")
+		Expect(err).To(MatchError(youtubeapi.ErrorNetwork))
+		Expect(breaker.State()).To(Equal(youtubeapi.CircuitBreakerOpen))
+
+		Eventually(breaker.State).Should(Equal(youtubeapi.CircuitBreakerHalfOpen))
+
+		probeDone := make(chan error)
+		go func() {
+			_, err := yt.GetYoutubeMedia(context.Background(), "probe")
+			probeDone <- err
+		}()
+
+		Eventually(executor.Started).Should(ContainElement("probe"))
+		_, err = yt.GetYoutubeMedia(context.Background(), "other")
+		Expect(err).To(MatchError(youtubeapi.ErrorCircuitOpen))
+
+		// Succeeds while the probe is running, started before the circuit opened
+		executor.Open("slow")
+		Expect(<-slowDone).NotTo(HaveOccurred())
+		Expect(breaker.State()).To(Equal(youtubeapi.CircuitBreakerHalfOpen))
+
+		executor.Open("probe")
+		Expect(<-probeDone).To(MatchError(youtubeapi.ErrorNetwork))
+		Expect(breaker.State()).To(Equal(youtubeapi.CircuitBreakerOpen))
+	})
+
+	It("Does not count queueing for the scheduler or cancellations as failures", func() {
+		executor := NewGatedCommandExecutor([]string{"slow"}, nil)
+		breaker := youtubeapi.NewCircuitBreaker(&youtubeapi.CircuitBreakerOptions{FailureThreshold: 1})
+
+		yt := youtubeapi.NewYoutubeAPI()
+		yt.SetCmdExecutor(executor)
+		yt.SetCircuitBreaker(breaker)
+		yt.SetScheduler(youtubeapi.NewYtDlpScheduler(&youtubeapi.YtDlpSchedulerOptions{MaxConcurrent: 1}))
+
+		slowCtx, cancelSlow := context.WithTimeout(context.Background(), 500*time.Millisecond)
+		defer cancelSlow()
+
+		slowDone := make(chan error)
+		go func() {
+			_, err := yt.GetYoutubeMedia(slowCtx, "slow")
+			slowDone <- err
+		}()
+
+		Eventually(func() int { return yt.GetScheduler().Stats().Running }).Should(Equal(1))
+
+		queuedCtx, cancelQueued := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancelQueued()
+
+		_, err := yt.GetYoutubeMedia(queuedCtx, "queued")
+		Expect(err).To(MatchError(context.DeadlineExceeded))
+		Expect(breaker.State()).To(Equal(youtubeapi.CircuitBreakerClosed))
+
+		Expect(<-slowDone).To(HaveOccurred())
+		Expect(breaker.Stats().ConsecutiveFailures).To(BeZero())
+		Expect(breaker.State()).To(Equal(youtubeapi.CircuitBreakerClosed))
+	})
+})
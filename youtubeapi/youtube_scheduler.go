@@ -0,0 +1,334 @@
+package youtubeapi
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	cmd "github.com/fakelag/streaming-music-bot/command"
+)
+
+// Priority lane of a yt-dlp invocation. Queued invocations with a higher priority are
+// started first. Set with WithYtDlpPriority
+type YtDlpPriority int
+
+const (
+	// Work nobody is waiting on yet, such as loading the rest of a playlist
+	YtDlpPriorityBackground YtDlpPriority = iota
+	// Searches & lookups a user is waiting on. Default priority
+	YtDlpPriorityInteractive
+
+	numYtDlpPriorities = int(YtDlpPriorityInteractive) + 1
+)
+
+type ytDlpPriorityKey struct{}
+
+// Returns a context that runs yt-dlp invocations with the given priority
+func WithYtDlpPriority(ctx context.Context, priority YtDlpPriority) context.Context {
+	return context.WithValue(ctx, ytDlpPriorityKey{}, priority)
+}
+
+func ytDlpPriorityFromContext(ctx context.Context) (YtDlpPriority, bool) {
+	priority, ok := ctx.Value(ytDlpPriorityKey{}).(YtDlpPriority)
+
+	if !ok || priority < 0 || int(priority) >= numYtDlpPriorities {
+		return YtDlpPriorityInteractive, false
+	}
+
+	return priority, true
+}
+
+type YtDlpSchedulerOptions struct {
+	// Maximum number of yt-dlp processes running at once. Defaults to 4
+	MaxConcurrent int
+	// Maximum number of yt-dlp processes started per second on average. Defaults to 0, no rate limit
+	RatePerSecond float64
+	// Number of processes that can be started at once before the rate limit applies. Defaults to 1
+	Burst int
+	// Slots only interactive invocations may use, so that long background work such as
+	// streaming playlist loads can't hold every slot. Defaults to 1, at most MaxConcurrent - 1
+	ReservedInteractive int
+}
+
+type YtDlpSchedulerStats struct {
+	Running int
+	Queued  int
+	// Invocations that shared the process of an identical invocation
+	Coalesced int
+}
+
+// Limits concurrency & rate of yt-dlp invocations and coalesces identical invocations.
+// Safe for concurrent use
+type YtDlpScheduler struct {
+	mutex         sync.Mutex
+	maxConcurrent int
+	// Most slots background invocations may hold at once
+	maxBackground int
+	ratePerSecond float64
+	burst         float64
+	tokens        float64
+	lastRefill    time.Time
+	timerPending  bool
+	running       int
+	// Running invocations by priority
+	runningLanes [numYtDlpPriorities]int
+	lanes        [numYtDlpPriorities][]*ytDlpSchedulerWaiter
+	calls        map[string]*ytDlpCoalescedCall
+	coalesced    int
+}
+
+type ytDlpSchedulerWaiter struct {
+	ready   chan struct{}
+	granted bool
+}
+
+type ytDlpCoalescedCall struct {
+	done    chan struct{}
+	result  *cmd.CommandResult
+	err     error
+	waiters int
+	cancel  context.CancelFunc
+}
+
+func NewYtDlpScheduler(options *YtDlpSchedulerOptions) *YtDlpScheduler {
+	maxConcurrent := 4
+	ratePerSecond := float64(0)
+	burst := 1
+	reservedInteractive := 1
+
+	if options != nil {
+		if options.MaxConcurrent > 0 {
+			maxConcurrent = options.MaxConcurrent
+		}
+
+		if options.RatePerSecond > 0 {
+			ratePerSecond = options.RatePerSecond
+		}
+
+		if options.Burst > 0 {
+			burst = options.Burst
+		}
+
+		if options.ReservedInteractive > 0 {
+			reservedInteractive = options.ReservedInteractive
+		}
+	}
+
+	return &YtDlpScheduler{
+		maxConcurrent: maxConcurrent,
+		maxBackground: maxConcurrent - min(reservedInteractive, maxConcurrent-1),
+		ratePerSecond: ratePerSecond,
+		burst:         float64(burst),
+		tokens:        float64(burst),
+		lastRefill:    time.Now(),
+		calls:         make(map[string]*ytDlpCoalescedCall),
+	}
+}
+
+func (scheduler *YtDlpScheduler) Stats() YtDlpSchedulerStats {
+	scheduler.mutex.Lock()
+	defer scheduler.mutex.Unlock()
+
+	queued := 0
+	for _, lane := range scheduler.lanes {
+		queued += len(lane)
+	}
+
+	return YtDlpSchedulerStats{
+		Running:   scheduler.running,
+		Queued:    queued,
+		Coalesced: scheduler.coalesced,
+	}
+}
+
+// Waits until an invocation with the priority of ctx may start. The returned function
+// must be called once the invocation has finished
+func (scheduler *YtDlpScheduler) acquire(ctx context.Context) (func(), error) {
+	priority, _ := ytDlpPriorityFromContext(ctx)
+	waiter := &ytDlpSchedulerWaiter{ready: make(chan struct{})}
+
+	scheduler.mutex.Lock()
+	scheduler.lanes[priority] = append(scheduler.lanes[priority], waiter)
+	scheduler.dispatch()
+	scheduler.mutex.Unlock()
+
+	select {
+	case <-waiter.ready:
+		return scheduler.releaseFunc(priority), nil
+	case <-ctx.Done():
+	}
+
+	scheduler.mutex.Lock()
+	defer scheduler.mutex.Unlock()
+
+	if waiter.granted {
+		// Granted concurrently with the cancellation, pass the slot on
+		scheduler.release(priority)
+		return nil, ctx.Err()
+	}
+
+	lane := scheduler.lanes[priority]
+	for index, queuedWaiter := range lane {
+		if queuedWaiter == waiter {
+			scheduler.lanes[priority] = append(lane[:index], lane[index+1:]...)
+			break
+		}
+	}
+
+	return nil, ctx.Err()
+}
+
+func (scheduler *YtDlpScheduler) releaseFunc(priority YtDlpPriority) func() {
+	var once sync.Once
+
+	return func() {
+		once.Do(func() {
+			scheduler.mutex.Lock()
+			defer scheduler.mutex.Unlock()
+
+			scheduler.release(priority)
+		})
+	}
+}
+
+// Caller must hold the lock
+func (scheduler *YtDlpScheduler) release(priority YtDlpPriority) {
+	scheduler.running -= 1
+	scheduler.runningLanes[priority] -= 1
+	scheduler.dispatch()
+}
+
+// Starts queued invocations, highest priority first, while concurrency & rate limits allow.
+// Caller must hold the lock
+func (scheduler *YtDlpScheduler) dispatch() {
+	for scheduler.running < scheduler.maxConcurrent {
+		waiter, priority := scheduler.nextWaiter()
+
+		if waiter == nil {
+			return
+		}
+
+		if scheduler.ratePerSecond > 0 {
+			scheduler.refillTokens()
+
+			if scheduler.tokens < 1 {
+				scheduler.dispatchAfter(time.Duration(math.Ceil((1 - scheduler.tokens) / scheduler.ratePerSecond * float64(time.Second))))
+				return
+			}
+
+			scheduler.tokens -= 1
+		}
+
+		scheduler.lanes[priority] = scheduler.lanes[priority][1:]
+		scheduler.running += 1
+		scheduler.runningLanes[priority] += 1
+		waiter.granted = true
+		close(waiter.ready)
+	}
+}
+
+// Returns the first waiter of the highest priority lane that may start. Background
+// waiters wait while the slots left are reserved for interactive invocations.
+// Caller must hold the lock
+func (scheduler *YtDlpScheduler) nextWaiter() (*ytDlpSchedulerWaiter, YtDlpPriority) {
+	for priority := YtDlpPriority(numYtDlpPriorities - 1); priority >= 0; priority-- {
+		if priority == YtDlpPriorityBackground && scheduler.runningLanes[priority] >= scheduler.maxBackground {
+			continue
+		}
+
+		if len(scheduler.lanes[priority]) > 0 {
+			return scheduler.lanes[priority][0], priority
+		}
+	}
+
+	return nil, 0
+}
+
+// Caller must hold the lock
+func (scheduler *YtDlpScheduler) refillTokens() {
+	now := time.Now()
+	scheduler.tokens = math.Min(scheduler.burst, scheduler.tokens+now.Sub(scheduler.lastRefill).Seconds()*scheduler.ratePerSecond)
+	scheduler.lastRefill = now
+}
+
+// Caller must hold the lock
+func (scheduler *YtDlpScheduler) dispatchAfter(delay time.Duration) {
+	if scheduler.timerPending {
+		return
+	}
+
+	scheduler.timerPending = true
+
+	time.AfterFunc(delay, func() {
+		scheduler.mutex.Lock()
+		defer scheduler.mutex.Unlock()
+
+		scheduler.timerPending = false
+		scheduler.dispatch()
+	})
+}
+
+// Runs fn once for concurrent calls with the same key, sharing its result. fn runs with a
+// context that is cancelled only once every caller waiting for the result has given up
+func (scheduler *YtDlpScheduler) coalesce(
+	ctx context.Context,
+	key string,
+	fn func(ctx context.Context) (*cmd.CommandResult, error),
+) (*cmd.CommandResult, error) {
+	scheduler.mutex.Lock()
+
+	call, ok := scheduler.calls[key]
+
+	if ok {
+		scheduler.coalesced += 1
+	} else {
+		callCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		call = &ytDlpCoalescedCall{
+			done:   make(chan struct{}),
+			cancel: cancel,
+		}
+		scheduler.calls[key] = call
+
+		go func() {
+			defer cancel()
+
+			result, err := fn(callCtx)
+
+			scheduler.mutex.Lock()
+			if scheduler.calls[key] == call {
+				delete(scheduler.calls, key)
+			}
+			scheduler.mutex.Unlock()
+
+			call.result = result
+			call.err = err
+			close(call.done)
+		}()
+	}
+
+	call.waiters += 1
+	scheduler.mutex.Unlock()
+
+	select {
+	case <-call.done:
+		return call.result, call.err
+	case <-ctx.Done():
+	}
+
+	scheduler.mutex.Lock()
+	defer scheduler.mutex.Unlock()
+
+	call.waiters -= 1
+
+	if call.waiters == 0 {
+		// New callers start a new call instead of joining the cancelled one
+		if scheduler.calls[key] == call {
+			delete(scheduler.calls, key)
+		}
+
+		call.cancel()
+	}
+
+	return nil, ctx.Err()
+}
@@ -0,0 +1,278 @@
+package youtubeapi_test
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	cmd "github.com/fakelag/streaming-music-bot/command"
+	"github.com/fakelag/streaming-music-bot/youtubeapi"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// Records invocations and keeps them running until released
+type TrackingCommandExecutor struct {
+	mutex         sync.Mutex
+	running       int
+	maxRunning    int
+	startedArgs   []string
+	startedTimes  []time.Time
+	release       chan struct{}
+	runDuration   time.Duration
+	stdoutForArgs func(firstArg string) string
+}
+
+func NewTrackingCommandExecutor(runDuration time.Duration) *TrackingCommandExecutor {
+	return &TrackingCommandExecutor{
+		runDuration: runDuration,
+		stdoutForArgs: func(firstArg string) string {
+			return "url123\n" + makeMockVideoJson("123", firstArg)
+		},
+	}
+}
+
+func (executor *TrackingCommandExecutor) RunCommand(ctx context.Context, executable string, args ...string) (*cmd.CommandResult, error) {
+	executor.mutex.Lock()
+	executor.running += 1
+	executor.maxRunning = max(executor.maxRunning, executor.running)
+	executor.startedArgs = append(executor.startedArgs, args[0])
+	executor.startedTimes = append(executor.startedTimes, time.Now())
+	release := executor.release
+	executor.mutex.Unlock()
+
+	defer func() {
+		executor.mutex.Lock()
+		executor.running -= 1
+		executor.mutex.Unlock()
+	}()
+
+	if release != nil {
+		select {
+		case <-release:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	select {
+	case <-time.After(executor.runDuration):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	return &cmd.CommandResult{Stdout: executor.stdoutForArgs(args[0])}, nil
+}
+
+func (executor *TrackingCommandExecutor) RunCommandStreaming(
+	ctx context.Context,
+	onStdoutLine func(line string) error,
+	executable string,
+	args ...string,
+) (*cmd.CommandResult, error) {
+	result, err := executor.RunCommand(ctx, executable, args...)
+
+	if err != nil {
+		return result, err
+	}
+
+	for _, line := range strings.Split(result.Stdout, "\n") {
+		if err := onStdoutLine(line); err != nil {
+			return result, err
+		}
+	}
+
+	result.Stdout = ""
+	return result, nil
+}
+
+func (executor *TrackingCommandExecutor) StartedArgs() []string {
+	executor.mutex.Lock()
+	defer executor.mutex.Unlock()
+	return append([]string{}, executor.startedArgs...)
+}
+
+func RunConcurrently(count int, fn func(index int)) {
+	var wg sync.WaitGroup
+
+	for index := 0; index < count; index++ {
+		wg.Add(1)
+		go func(index int) {
+			defer GinkgoRecover()
+			defer wg.Done()
+			fn(index)
+		}(index)
+	}
+
+	wg.Wait()
+}
+
+var _ = Describe("YT Scheduler", func() {
+	It("Limits the number of concurrent yt-dlp processes", func() {
+		executor := NewTrackingCommandExecutor(100 * time.Millisecond)
+
+		yt := youtubeapi.NewYoutubeAPI()
+		yt.SetCmdExecutor(executor)
+		yt.SetScheduler(youtubeapi.NewYtDlpScheduler(&youtubeapi.YtDlpSchedulerOptions{MaxConcurrent: 2}))
+
+		RunConcurrently(6, func(index int) {
+			_, err := yt.GetYoutubeMedia(context.Background(), "search "+string(rune('a'+index)))
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		Expect(executor.StartedArgs()).To(HaveLen(6))
+		Expect(executor.maxRunning).To(Equal(2))
+		Expect(yt.GetScheduler().Stats()).To(Equal(youtubeapi.YtDlpSchedulerStats{}))
+	})
+
+	It("Rate limits starting yt-dlp processes", func() {
+		executor := NewTrackingCommandExecutor(0)
+
+		yt := youtubeapi.NewYoutubeAPI()
+		yt.SetCmdExecutor(executor)
+		yt.SetScheduler(youtubeapi.NewYtDlpScheduler(&youtubeapi.YtDlpSchedulerOptions{
+			MaxConcurrent: 10,
+			RatePerSecond: 10,
+			Burst:         2,
+		}))
+
+		startedAt := time.Now()
+
+		RunConcurrently(5, func(index int) {
+			_, err := yt.GetYoutubeMedia(context.Background(), "search "+string(rune('a'+index)))
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		// 2 start immediately with the burst, the other 3 100ms apart
+		Expect(time.Since(startedAt)).To(BeNumerically(">=", 250*time.Millisecond))
+		Expect(time.Since(startedAt)).To(BeNumerically("<", 2*time.Second))
+	})
+
+	It("Starts queued interactive invocations before background ones", func() {
+		executor := NewTrackingCommandExecutor(0)
+		executor.release = make(chan struct{})
+
+		yt := youtubeapi.NewYoutubeAPI()
+		yt.SetCmdExecutor(executor)
+		yt.SetScheduler(youtubeapi.NewYtDlpScheduler(&youtubeapi.YtDlpSchedulerOptions{MaxConcurrent: 1}))
+
+		var wg sync.WaitGroup
+		lookup := func(ctx context.Context, searchTerm string) {
+			wg.Add(1)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+				_, err := yt.GetYoutubeMedia(ctx, searchTerm)
+				Expect(err).NotTo(HaveOccurred())
+			}()
+		}
+
+		lookup(context.Background(), "first")
+		Eventually(executor.StartedArgs).Should(HaveLen(1))
+
+		lookup(youtubeapi.WithYtDlpPriority(context.Background(), youtubeapi.YtDlpPriorityBackground), "background")
+		Eventually(func() int { return yt.GetScheduler().Stats().Queued }).Should(Equal(1))
+
+		lookup(context.Background(), "interactive")
+		Eventually(func() int { return yt.GetScheduler().Stats().Queued }).Should(Equal(2))
+
+		close(executor.release)
+		wg.Wait()
+
+		Expect(executor.StartedArgs()).To(Equal([]string{
+			"ytsearch:first",
+			"ytsearch:interactive",
+			"ytsearch:background",
+		}))
+	})
+
+	It("Keeps a slot free for interactive invocations", func() {
+		executor := NewTrackingCommandExecutor(0)
+		executor.release = make(chan struct{})
+
+		yt := youtubeapi.NewYoutubeAPI()
+		yt.SetCmdExecutor(executor)
+		yt.SetScheduler(youtubeapi.NewYtDlpScheduler(&youtubeapi.YtDlpSchedulerOptions{MaxConcurrent: 3}))
+
+		var wg sync.WaitGroup
+		lookup := func(ctx context.Context, searchTerm string) {
+			wg.Add(1)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+				_, err := yt.GetYoutubeMedia(ctx, searchTerm)
+				Expect(err).NotTo(HaveOccurred())
+			}()
+		}
+
+		backgroundCtx := youtubeapi.WithYtDlpPriority(context.Background(), youtubeapi.YtDlpPriorityBackground)
+
+		for _, searchTerm := range []string{"background 1", "background 2", "background 3"} {
+			lookup(backgroundCtx, searchTerm)
+		}
+
+		Eventually(func() youtubeapi.YtDlpSchedulerStats { return yt.GetScheduler().Stats() }).
+			Should(Equal(youtubeapi.YtDlpSchedulerStats{Running: 2, Queued: 1}))
+
+		lookup(context.Background(), "interactive")
+		Eventually(executor.StartedArgs).Should(ContainElement("ytsearch:interactive"))
+		Expect(yt.GetScheduler().Stats()).To(Equal(youtubeapi.YtDlpSchedulerStats{Running: 3, Queued: 1}))
+
+		close(executor.release)
+		wg.Wait()
+
+		Expect(executor.StartedArgs()).To(HaveLen(4))
+	})
+
+	It("Coalesces concurrent lookups of the same video into one process", func() {
+		executor := NewTrackingCommandExecutor(200 * time.Millisecond)
+
+		yt := youtubeapi.NewYoutubeAPI()
+		yt.SetCmdExecutor(executor)
+
+		RunConcurrently(5, func(index int) {
+			media, err := yt.GetYoutubeMedia(context.Background(), "https://www.youtube.com/watch?v=123")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(media.ID).To(Equal("123"))
+		})
+
+		Expect(executor.StartedArgs()).To(HaveLen(1))
+		Expect(yt.GetScheduler().Stats().Coalesced).To(Equal(4))
+	})
+
+	It("Keeps a coalesced process running while any caller is waiting for it", func() {
+		executor := NewTrackingCommandExecutor(300 * time.Millisecond)
+
+		yt := youtubeapi.NewYoutubeAPI()
+		yt.SetCmdExecutor(executor)
+
+		ctx, cancel := context.WithCancel(context.Background())
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer GinkgoRecover()
+			defer wg.Done()
+			_, err := yt.GetYoutubeMedia(ctx, "https://www.youtube.com/watch?v=123")
+			Expect(err).To(MatchError(context.Canceled))
+		}()
+
+		Eventually(executor.StartedArgs).Should(HaveLen(1))
+
+		wg.Add(1)
+		go func() {
+			defer GinkgoRecover()
+			defer wg.Done()
+			_, err := yt.GetYoutubeMedia(context.Background(), "https://www.youtube.com/watch?v=123")
+			Expect(err).NotTo(HaveOccurred())
+		}()
+
+		Eventually(func() int { return yt.GetScheduler().Stats().Coalesced }).Should(Equal(1))
+		cancel()
+
+		wg.Wait()
+		Expect(executor.StartedArgs()).To(HaveLen(1))
+	})
+})
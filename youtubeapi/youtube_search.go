@@ -0,0 +1,136 @@
+package youtubeapi
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Filters & ranks YouTube search results, so that searching for a song picks the song
+// rather than a live stream or a 10 hour loop of it
+type SearchOptions struct {
+	// Number of search results ranked. Defaults to 5
+	NumResults int
+	// Exclude live streams
+	ExcludeLive bool
+	// Exclude videos shorter or longer than these. Zero for no limit. Videos of
+	// unknown duration are not excluded
+	MinDuration time.Duration
+	MaxDuration time.Duration
+	// Rank songs uploaded by "- Topic" channels & titled "official audio" or
+	// "official video" before other results
+	PreferOfficial bool
+	// Exclude videos with any of these in the title, case insensitive
+	BlockedKeywords []string
+}
+
+// Excludes live streams, videos over an hour & loops, and prefers official uploads
+func DefaultSearchOptions() *SearchOptions {
+	return &SearchOptions{
+		NumResults:      5,
+		ExcludeLive:     true,
+		MaxDuration:     time.Hour,
+		PreferOfficial:  true,
+		BlockedKeywords: []string{"10 hours", "hour loop", "hours loop"},
+	}
+}
+
+// Searches with the options, such as DefaultSearchOptions(), for search terms passed to
+// GetYoutubeMedia. Disabled by default, the first result of yt-dlp is used
+func (yt *Youtube) SetSearchOptions(options *SearchOptions) {
+	yt.searchOptions = options
+}
+
+func (yt *Youtube) GetSearchOptions() *SearchOptions {
+	return yt.searchOptions
+}
+
+// Searches YouTube & returns the results accepted by the options, best first
+func (yt *Youtube) SearchRankedYoutubeMedia(ctx context.Context, options *SearchOptions, searchTerm string) ([]*YoutubeMedia, error) {
+	results, err := yt.SearchYoutubeMedia(ctx, options.numResults(), searchTerm)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return options.Rank(results), nil
+}
+
+// Returns the results accepted by the options ordered by score. Results with
+// equal scores keep the order of the search
+func (options *SearchOptions) Rank(results []*YoutubeMedia) []*YoutubeMedia {
+	ranked := make([]*YoutubeMedia, 0, len(results))
+
+	for _, media := range results {
+		if options.Accepts(media) {
+			ranked = append(ranked, media)
+		}
+	}
+
+	slices.SortStableFunc(ranked, func(a *YoutubeMedia, b *YoutubeMedia) int {
+		return cmp.Compare(options.Score(b), options.Score(a))
+	})
+
+	return ranked
+}
+
+// Returns false if the media is excluded by the options
+func (options *SearchOptions) Accepts(media *YoutubeMedia) bool {
+	if options.ExcludeLive && media.VideoIsLiveStream {
+		return false
+	}
+
+	if duration := media.VideoDuration; duration > 0 && !media.VideoIsLiveStream {
+		if options.MinDuration > 0 && duration < options.MinDuration {
+			return false
+		}
+
+		if options.MaxDuration > 0 && duration > options.MaxDuration {
+			return false
+		}
+	}
+
+	title := strings.ToLower(media.VideoTitle)
+
+	for _, keyword := range options.BlockedKeywords {
+		if keyword != "" && strings.Contains(title, strings.ToLower(keyword)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Higher scores are ranked first
+func (options *SearchOptions) Score(media *YoutubeMedia) int {
+	if !options.PreferOfficial {
+		return 0
+	}
+
+	score := 0
+	title := strings.ToLower(media.VideoTitle)
+
+	// Auto-generated channels of artists, uploading the album version of songs
+	if strings.HasSuffix(media.ChannelName, " - Topic") {
+		score += 2
+	}
+
+	switch {
+	case strings.Contains(title, "official audio"):
+		score += 2
+	case strings.Contains(title, "official video"), strings.Contains(title, "official music video"):
+		score += 1
+	}
+
+	return score
+}
+
+func (options *SearchOptions) numResults() int {
+	if options.NumResults <= 0 {
+		return 5
+	}
+
+	return options.NumResults
+}
@@ -0,0 +1,120 @@
+package youtubeapi_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/fakelag/streaming-music-bot/testutils"
+	"github.com/fakelag/streaming-music-bot/youtubeapi"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func makeMockSearchResult(id string, title string, channel string, durationSeconds int, isLive bool) string {
+	return fmt.Sprintf(
+		"url4%s\n"+`{"_type": "video", "id": "%s", "fulltitle": "%s", "channel": "%s", "duration": %d, "is_live": %t}`,
+		id, id, title, channel, durationSeconds, isLive,
+	)
+}
+
+func rankedIDs(results []*youtubeapi.YoutubeMedia) []string {
+	ids := make([]string, 0, len(results))
+
+	for _, media := range results {
+		ids = append(ids, media.ID)
+	}
+
+	return ids
+}
+
+var _ = Describe("YT Search Options", func() {
+	results := []*youtubeapi.YoutubeMedia{
+		{ID: "video", VideoTitle: "Artist - Song (Official Video)", ChannelName: "ArtistVEVO", VideoDuration: 4 * time.Minute},
+		{ID: "loop", VideoTitle: "Artist - Song [10 HOURS]", ChannelName: "Loops", VideoDuration: 10 * time.Hour},
+		{ID: "live", VideoTitle: "Artist - Song live now", ChannelName: "Artist", VideoIsLiveStream: true},
+		{ID: "lyrics", VideoTitle: "Artist - Song (Lyrics)", ChannelName: "Lyrics Channel", VideoDuration: 3 * time.Minute},
+		{ID: "topic", VideoTitle: "Song", ChannelName: "Artist - Topic", VideoDuration: 3 * time.Minute},
+		{ID: "short", VideoTitle: "Artist - Song #shorts", ChannelName: "Artist", VideoDuration: 30 * time.Second},
+	}
+
+	DescribeTable("Ranking search results",
+		func(options *youtubeapi.SearchOptions, expectedIDs []string) {
+			Expect(rankedIDs(options.Rank(results))).To(Equal(expectedIDs))
+		},
+		Entry("Keeps the order without options",
+			&youtubeapi.SearchOptions{},
+			[]string{"video", "loop", "live", "lyrics", "topic", "short"},
+		),
+		Entry("Excludes live streams",
+			&youtubeapi.SearchOptions{ExcludeLive: true},
+			[]string{"video", "loop", "lyrics", "topic", "short"},
+		),
+		Entry("Excludes videos outside the duration limits",
+			&youtubeapi.SearchOptions{MinDuration: time.Minute, MaxDuration: time.Hour},
+			[]string{"video", "live", "lyrics", "topic"},
+		),
+		Entry("Excludes blocked keywords",
+			&youtubeapi.SearchOptions{BlockedKeywords: []string{"10 hours", "#SHORTS"}},
+			[]string{"video", "live", "lyrics", "topic"},
+		),
+		Entry("Prefers official uploads",
+			&youtubeapi.SearchOptions{PreferOfficial: true},
+			[]string{"topic", "video", "loop", "live", "lyrics", "short"},
+		),
+		Entry("Default options",
+			youtubeapi.DefaultSearchOptions(),
+			[]string{"topic", "video", "lyrics", "short"},
+		),
+	)
+
+	It("Picks the best result of a search term in GetYoutubeMedia", func() {
+		mockExecutor := &testutils.MockCommandExecutor{
+			MockStdoutResult: strings.Join([]string{
+				makeMockSearchResult("live", "Song live", "Artist", 0, true),
+				makeMockSearchResult("loop", "Song 10 hours", "Loops", 36000, false),
+				makeMockSearchResult("audio", "Song (Official Audio)", "Artist", 200, false),
+			}, "\n"),
+		}
+
+		yt := youtubeapi.NewYoutubeAPI()
+		yt.SetCmdExecutor(mockExecutor)
+		yt.SetSearchOptions(&youtubeapi.SearchOptions{NumResults: 3, ExcludeLive: true, MaxDuration: time.Hour})
+
+		media, err := yt.GetYoutubeMedia(context.Background(), "song")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(media.ID).To(Equal("audio"))
+		Expect(media.FileURL()).To(Equal("url4audio"))
+		Expect(mockExecutor.RecordedArgs()[0][0]).To(Equal("ytsearch3:song"))
+	})
+
+	It("Returns an error if no search result is accepted", func() {
+		mockExecutor := &testutils.MockCommandExecutor{
+			MockStdoutResult: makeMockSearchResult("live", "Song live", "Artist", 0, true),
+		}
+
+		yt := youtubeapi.NewYoutubeAPI()
+		yt.SetCmdExecutor(mockExecutor)
+		yt.SetSearchOptions(youtubeapi.DefaultSearchOptions())
+
+		_, err := yt.GetYoutubeMedia(context.Background(), "song")
+		Expect(err).To(MatchError(youtubeapi.ErrorNoVideoFound))
+	})
+
+	It("Does not search for video links", func() {
+		mockExecutor := &testutils.MockCommandExecutor{
+			MockStdoutResult: makeMockSearchResult("dQw4w9WgXcQ", "Song", "Artist", 200, false),
+		}
+
+		yt := youtubeapi.NewYoutubeAPI()
+		yt.SetCmdExecutor(mockExecutor)
+		yt.SetSearchOptions(youtubeapi.DefaultSearchOptions())
+
+		media, err := yt.GetYoutubeMedia(context.Background(), "https://youtu.be/dQw4w9WgXcQ")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(media.ID).To(Equal("dQw4w9WgXcQ"))
+		Expect(mockExecutor.RecordedArgs()[0][0]).To(Equal("https://www.youtube.com/watch?v=dQw4w9WgXcQ"))
+	})
+})
@@ -1,11 +1,18 @@
 package youtubeapi_test
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"log/slog"
 	"strings"
+	"sync"
 	"time"
 
+	cmd "github.com/fakelag/streaming-music-bot/command"
 	"github.com/fakelag/streaming-music-bot/entities"
+	"github.com/fakelag/streaming-music-bot/metrics"
 	"github.com/fakelag/streaming-music-bot/testutils"
 	"github.com/fakelag/streaming-music-bot/youtubeapi"
 
@@ -40,57 +47,27 @@ func makeMockVideoJson(id string, title string) string {
 	}`, id, title), "\n", "")
 }
 
-var mockPlaylistJson string = strings.ReplaceAll(`{
-	"id": "1234",
-	"title": "Playlist Title",
-	"thumbnails": [
-		{
-			"url": "thumbnail123",
-			"height": 64,
-			"width": 64,
-			"id": "0",
-			"resolution": "64x64"
-		}
-	],
-	"playlist_count": 2,
-	"webpage_url": "playlist_url",
-	"entries": [
-		{
-			"id": "0",
-			"title": "foobar",
-			"fulltitle": "foobar",
-			"duration": 60,
-			"live_status": "not_live",
-			"thumbnails": [
-				{
-					"url": "thumbnail1234",
-					"height": 32,
-					"width": 32
-				},
-				{
-					"url": "thumbnail1234",
-					"height": 64,
-					"width": 64
-				}
-			]
-		},
-		{
-			"id": "1",
-			"title": "foobar 2 live",
-			"fulltitle": "foobar 2 live",
-			"duration": 0,
-			"live_status": "is_live",
-			"thumbnails": [
-				{
-					"url": "thumbnail1234",
-					"height": 64,
-					"width": 64
-				}
-			]
-		}
-	],
-	"_type": "playlist"
-}`, "\n", "")
+// Flat playlist entries as printed by yt-dlp with --dump-json, one per line
+var mockPlaylistLines string = strings.Join([]string{
+	`{"_type": "url", "id": "0", "title": "foobar", "duration": 60, "live_status": "not_live", ` +
+		`"thumbnails": [{"url": "thumbnail1234", "height": 32, "width": 32}], ` +
+		`"playlist_id": "1234", "playlist_title": "Playlist Title", "playlist_webpage_url": "playlist_url"}`,
+	`{"_type": "url", "id": "1", "title": "foobar 2 live", "duration": 0, "live_status": "is_live", ` +
+		`"thumbnails": [{"url": "thumbnail1234", "height": 64, "width": 64}], ` +
+		`"playlist_id": "1234", "playlist_title": "Playlist Title", "playlist_webpage_url": "playlist_url"}`,
+}, "\n")
+
+type MockMetrics struct {
+	metrics.NoopMetrics
+	sync.Mutex
+	YtDlpResults []metrics.YtDlpResult
+}
+
+func (mm *MockMetrics) YtDlpCall(latency time.Duration, result metrics.YtDlpResult) {
+	mm.Lock()
+	defer mm.Unlock()
+	mm.YtDlpResults = append(mm.YtDlpResults, result)
+}
 
 var _ = Describe("YT Download", func() {
 	When("Downloading a singular video", func() {
@@ -102,14 +79,14 @@ var _ = Describe("YT Download", func() {
 			yt := youtubeapi.NewYoutubeAPI()
 			yt.SetCmdExecutor(mockExecutor)
 
-			media, err := yt.GetYoutubeMedia("foo")
+			media, err := yt.GetYoutubeMedia(context.Background(), "foo")
 			Expect(err).To(BeNil())
 			Expect(media.ID).To(Equal("123"))
 			Expect(media.Title()).To(Equal("Mock Title"))
 			Expect(media.FileURL()).To(Equal("url123"))
 			Expect(media.Thumbnail()).To(Equal("foo"))
 
-			mediaFromVideoLink, err := yt.GetYoutubeMedia("https://www.youtube.com/watch?v=foo")
+			mediaFromVideoLink, err := yt.GetYoutubeMedia(context.Background(), "https://www.youtube.com/watch?v=foo")
 			Expect(err).To(BeNil())
 			Expect(mediaFromVideoLink.ID).To(Equal("123"))
 			Expect(mediaFromVideoLink.Title()).To(Equal("Mock Title"))
@@ -130,7 +107,7 @@ var _ = Describe("YT Download", func() {
 				yt := youtubeapi.NewYoutubeAPI()
 				yt.SetCmdExecutor(mockExecutor)
 
-				media, err := yt.GetYoutubeMedia("foo")
+				media, err := yt.GetYoutubeMedia(context.Background(), "foo")
 				Expect(err).To(BeNil())
 				Expect(mockExecutor.MockStdoutResult).To(ContainSubstring(media.StreamURL))
 				Expect(media.StreamExpiresAt).NotTo(BeNil())
@@ -147,7 +124,7 @@ var _ = Describe("YT Download", func() {
 			yt := youtubeapi.NewYoutubeAPI()
 			yt.SetCmdExecutor(mockExecutor)
 
-			_, err := yt.GetYoutubeMedia("foo")
+			_, err := yt.GetYoutubeMedia(context.Background(), "foo")
 			Expect(err).To(MatchError("exit status 1"))
 		})
 
@@ -159,22 +136,22 @@ var _ = Describe("YT Download", func() {
 			yt := youtubeapi.NewYoutubeAPI()
 			yt.SetCmdExecutor(mockExecutor)
 
-			_, err := yt.GetYoutubeMedia("foo")
+			_, err := yt.GetYoutubeMedia(context.Background(), "foo")
 			Expect(err).To(MatchError("unexpected end of JSON input"))
 
 			mockExecutor.MockStdoutResult = "url123\n{}"
 
-			_, err = yt.GetYoutubeMedia("foo")
+			_, err = yt.GetYoutubeMedia(context.Background(), "foo")
 			Expect(err).To(MatchError(youtubeapi.ErrorUnrecognisedObject))
 
 			mockExecutor.MockStdoutResult = "url123"
 
-			_, err = yt.GetYoutubeMedia("foo")
+			_, err = yt.GetYoutubeMedia(context.Background(), "foo")
 			Expect(err).To(MatchError(youtubeapi.ErrorInvalidYtdlpData))
 
 			mockExecutor.MockStdoutResult = ""
 
-			_, err = yt.GetYoutubeMedia("foo")
+			_, err = yt.GetYoutubeMedia(context.Background(), "foo")
 			Expect(err).To(MatchError(youtubeapi.ErrorNoVideoFound))
 		})
 	})
@@ -182,18 +159,24 @@ var _ = Describe("YT Download", func() {
 	When("Downloading a playlist", func() {
 		It("Downloads a playlist & its videos", func() {
 			mockExecutor := &testutils.MockCommandExecutor{
-				MockStdoutResult: mockPlaylistJson,
+				MockStdoutResult: mockPlaylistLines,
 			}
 
 			yt := youtubeapi.NewYoutubeAPI()
 			yt.SetCmdExecutor(mockExecutor)
 
-			playList, err := yt.GetYoutubePlaylist("foo")
+			playList, err := yt.GetYoutubePlaylist(context.Background(), "foo")
+			Expect(err).To(BeNil())
 			playList.SetConsumeOrder(entities.ConsumeOrderFromStart)
 
-			Expect(err).To(BeNil())
+			// Entries are streamed rather than loaded with the playlist at once
+			Expect(mockExecutor.RecordedArgs()[0]).To(ContainElement("--dump-json"))
+
+			Eventually(playList.IsLoading).Should(BeFalse())
+			Expect(playList.LoadError()).To(BeNil())
 			Expect(playList.ID).To(Equal("1234"))
 			Expect(playList.Title()).To(Equal("Playlist Title"))
+			Expect(playList.Link()).To(Equal("playlist_url"))
 			Expect(playList.GetMediaCount()).To(Equal(2))
 
 			media0, err := playList.ConsumeNextMedia()
@@ -231,17 +214,127 @@ var _ = Describe("YT Download", func() {
 			yt := youtubeapi.NewYoutubeAPI()
 			yt.SetCmdExecutor(mockExecutor)
 
-			_, err := yt.GetYoutubePlaylist("foo")
-			Expect(err).To(MatchError("unexpected end of JSON input"))
+			_, err := yt.GetYoutubePlaylist(context.Background(), "foo")
+			Expect(err).To(MatchError(youtubeapi.ErrorNoPlaylistFound))
 
 			mockExecutor.MockStdoutResult = "{\"_type\":\"something\"}"
 
-			_, err = yt.GetYoutubePlaylist("foo")
-			Expect(err).To(MatchError(youtubeapi.ErrorUnrecognisedObject))
+			_, err = yt.GetYoutubePlaylist(context.Background(), "foo")
+			Expect(err).To(MatchError(youtubeapi.ErrorNoPlaylistFound))
 
 			mockExecutor.MockStdoutResult = ""
 
-			_, err = yt.GetYoutubePlaylist("foo")
+			_, err = yt.GetYoutubePlaylist(context.Background(), "foo")
+			Expect(err).To(MatchError(youtubeapi.ErrorNoPlaylistFound))
+		})
+	})
+
+	When("Streaming a playlist", func() {
+		makeMockFlatEntryJson := func(id string, title string) string {
+			return fmt.Sprintf(
+				`{"_type": "url", "id": "%s", "title": "%s", "duration": 60, "live_status": null, `+
+					`"playlist_id": "1234", "playlist_title": "Playlist Title", "playlist_count": 3, `+
+					`"playlist_webpage_url": "https://www.youtube.com/playlist?list=1234"}`,
+				id, title,
+			)
+		}
+
+		It("Returns the playlist after its first entry & keeps loading the rest", func() {
+			mockExecutor := &testutils.MockCommandExecutor{
+				MockStdoutResult: strings.Join([]string{
+					makeMockFlatEntryJson("0", "Video 0"),
+					makeMockFlatEntryJson("1", "Video 1"),
+				}, "\n"),
+				MockBlockUntilDone: true,
+			}
+
+			yt := youtubeapi.NewYoutubeAPI()
+			yt.SetCmdExecutor(mockExecutor)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			playList, err := yt.GetYoutubePlaylistStreaming(ctx, "foo")
+			Expect(err).To(BeNil())
+			Expect(playList.ID).To(Equal("1234"))
+			Expect(playList.Title()).To(Equal("Playlist Title"))
+			Expect(playList.Link()).To(Equal("https://www.youtube.com/playlist?list=1234"))
+
+			Eventually(playList.GetMediaCount).Should(Equal(2))
+			Expect(playList.IsLoading()).To(BeTrue())
+
+			media0, err := playList.ConsumeNextMedia()
+			Expect(err).To(BeNil())
+			Expect(media0.(*youtubeapi.YoutubeMedia).ID).To(Equal("0"))
+			Expect(media0.Link()).To(Equal("https://www.youtube.com/watch?v=0"))
+			Expect(media0.FileURL()).To(Equal(""))
+
+			media1, err := playList.ConsumeNextMedia()
+			Expect(err).To(BeNil())
+			Expect(media1.(*youtubeapi.YoutubeMedia).ID).To(Equal("1"))
+
+			_, err = playList.ConsumeNextMedia()
+			Expect(err).To(MatchError(entities.ErrorPlaylistLoading))
+
+			cancel()
+
+			Eventually(playList.IsLoading).Should(BeFalse())
+			Expect(playList.LoadError()).To(MatchError(context.Canceled))
+
+			_, err = playList.ConsumeNextMedia()
+			Expect(err).To(MatchError(entities.ErrorPlaylistEmpty))
+		})
+
+		It("Skips malformed lines & keeps loading the rest", func() {
+			mockExecutor := &testutils.MockCommandExecutor{
+				MockStdoutResult: strings.Join([]string{
+					makeMockFlatEntryJson("0", "Video 0"),
+					`{"_type": "url", "id": "trunc`,
+					makeMockFlatEntryJson("1", "Video 1"),
+				}, "\n"),
+			}
+
+			yt := youtubeapi.NewYoutubeAPI()
+			yt.SetCmdExecutor(mockExecutor)
+
+			playList, err := yt.GetYoutubePlaylistStreaming(context.Background(), "foo")
+			Expect(err).To(BeNil())
+
+			Eventually(playList.IsLoading).Should(BeFalse())
+			Expect(playList.LoadError()).To(BeNil())
+			Expect(playList.GetMediaCount()).To(Equal(2))
+
+			playList.SetConsumeOrder(entities.ConsumeOrderFromStart)
+
+			media0, err := playList.ConsumeNextMedia()
+			Expect(err).To(BeNil())
+			Expect(media0.(*youtubeapi.YoutubeMedia).ID).To(Equal("0"))
+
+			media1, err := playList.ConsumeNextMedia()
+			Expect(err).To(BeNil())
+			Expect(media1.(*youtubeapi.YoutubeMedia).ID).To(Equal("1"))
+		})
+
+		It("Fails with a sensible error when the playlist has no entries", func() {
+			mockExecutor := &testutils.MockCommandExecutor{
+				MockStdoutResult: "",
+			}
+
+			yt := youtubeapi.NewYoutubeAPI()
+			yt.SetCmdExecutor(mockExecutor)
+
+			_, err := yt.GetYoutubePlaylistStreaming(context.Background(), "foo")
+			Expect(err).To(MatchError(youtubeapi.ErrorNoPlaylistFound))
+
+			mockExecutor.MockExitCode = 1
+
+			_, err = yt.GetYoutubePlaylistStreaming(context.Background(), "foo")
+			Expect(err).To(MatchError("exit status 1"))
+
+			mockExecutor.MockExitCode = 0
+			mockExecutor.MockStdoutResult = "{"
+
+			_, err = yt.GetYoutubePlaylistStreaming(context.Background(), "foo")
 			Expect(err).To(MatchError(youtubeapi.ErrorNoPlaylistFound))
 		})
 	})
@@ -263,7 +356,7 @@ var _ = Describe("YT Download", func() {
 			yt := youtubeapi.NewYoutubeAPI()
 			yt.SetCmdExecutor(mockExecutor)
 
-			searchResults, err := yt.SearchYoutubeMedia(3, "foo")
+			searchResults, err := yt.SearchYoutubeMedia(context.Background(), 3, "foo")
 
 			Expect(err).To(BeNil())
 			Expect(searchResults).NotTo(BeNil())
@@ -291,6 +384,60 @@ var _ = Describe("YT Download", func() {
 			Expect(vid.Thumbnail()).To(Equal("foo"))
 		})
 
+		It("Pairs stream urls with their videos when yt-dlp skips entries", func() {
+			lines := []string{
+				"url4video1",
+				makeMockVideoJson("1", "Video 1"),
+				// Video 2 failed after printing its stream url
+				"url4video2",
+				"url4video3",
+				makeMockVideoJson("3", "Video 3"),
+				// Video 4 without a stream url
+				makeMockVideoJson("4", "Video 4"),
+			}
+			mockExecutor := &testutils.MockCommandExecutor{
+				MockStdoutResult: strings.Join(lines, "\n"),
+			}
+
+			yt := youtubeapi.NewYoutubeAPI()
+			yt.SetCmdExecutor(mockExecutor)
+
+			searchResults, err := yt.SearchYoutubeMedia(context.Background(), 4, "foo")
+			Expect(err).To(BeNil())
+			Expect(searchResults).To(HaveLen(2))
+			Expect(searchResults[0].ID).To(Equal("1"))
+			Expect(searchResults[0].FileURL()).To(Equal("url4video1"))
+			Expect(searchResults[1].ID).To(Equal("3"))
+			Expect(searchResults[1].FileURL()).To(Equal("url4video2"))
+		})
+
+		It("Stops searching when the callback returns an error", func() {
+			lines := []string{
+				"url4video1",
+				makeMockVideoJson("1", "Video 1"),
+				"url4video2",
+				makeMockVideoJson("2", "Video 2"),
+			}
+			mockExecutor := &testutils.MockCommandExecutor{
+				MockStdoutResult: strings.Join(lines, "\n"),
+			}
+
+			yt := youtubeapi.NewYoutubeAPI()
+			yt.SetCmdExecutor(mockExecutor)
+
+			errStop := errors.New("stop")
+			searchResults := make([]*youtubeapi.YoutubeMedia, 0)
+
+			err := yt.SearchYoutubeMediaStreaming(context.Background(), 2, "foo", func(media *youtubeapi.YoutubeMedia) error {
+				searchResults = append(searchResults, media)
+				return errStop
+			})
+
+			Expect(err).To(MatchError(errStop))
+			Expect(searchResults).To(HaveLen(1))
+			Expect(searchResults[0].ID).To(Equal("1"))
+		})
+
 		It("Returns sensible results when receiving an invalid response from ytdlp", func() {
 			mockExecutor := &testutils.MockCommandExecutor{
 				MockStdoutResult: "streamurl\n{",
@@ -299,25 +446,25 @@ var _ = Describe("YT Download", func() {
 			yt := youtubeapi.NewYoutubeAPI()
 			yt.SetCmdExecutor(mockExecutor)
 
-			searchResults, err := yt.SearchYoutubeMedia(5, "foo")
-			Expect(err).To(MatchError("unexpected end of JSON input"))
-			Expect(searchResults).To(BeNil())
+			searchResults, err := yt.SearchYoutubeMedia(context.Background(), 5, "foo")
+			Expect(err).To(BeNil())
+			Expect(searchResults).To(HaveLen(0))
 
 			mockExecutor.MockStdoutResult = "streamurl\n{\"_type\":\"something\"}"
 
-			searchResults, err = yt.SearchYoutubeMedia(5, "foo")
+			searchResults, err = yt.SearchYoutubeMedia(context.Background(), 5, "foo")
 			Expect(err).To(BeNil())
 			Expect(searchResults).To(HaveLen(0))
 
 			mockExecutor.MockStdoutResult = "streamurl"
 
-			searchResults, err = yt.SearchYoutubeMedia(5, "foo")
+			searchResults, err = yt.SearchYoutubeMedia(context.Background(), 5, "foo")
 			Expect(err).To(BeNil())
 			Expect(searchResults).To(HaveLen(0))
 
 			mockExecutor.MockStdoutResult = ""
 
-			searchResults, err = yt.SearchYoutubeMedia(5, "foo")
+			searchResults, err = yt.SearchYoutubeMedia(context.Background(), 5, "foo")
 			Expect(err).To(BeNil())
 			Expect(searchResults).To(HaveLen(0))
 		})
@@ -335,7 +482,7 @@ var _ = Describe("YT Download", func() {
 			yt := youtubeapi.NewYoutubeAPI()
 			yt.SetCmdExecutor(mockExecutor)
 
-			formatList, err := yt.ListFormats("123")
+			formatList, err := yt.ListFormats(context.Background(), "123")
 
 			Expect(err).To(BeNil())
 			Expect(formatList).To(HaveLen(2))
@@ -362,21 +509,108 @@ var _ = Describe("YT Download", func() {
 			yt := youtubeapi.NewYoutubeAPI()
 			yt.SetCmdExecutor(mockExecutor)
 
-			formatList, err := yt.ListFormats("foo")
+			formatList, err := yt.ListFormats(context.Background(), "foo")
 			Expect(err).To(MatchError("unexpected end of JSON input"))
 			Expect(formatList).To(BeNil())
 
 			mockExecutor.MockStdoutResult = "{\"_type\":\"something\"}"
 
-			formatList, err = yt.ListFormats("foo")
+			formatList, err = yt.ListFormats(context.Background(), "foo")
 			Expect(err).To(MatchError(youtubeapi.ErrorUnrecognisedObject))
 			Expect(formatList).To(BeNil())
 
 			mockExecutor.MockStdoutResult = ""
 
-			formatList, err = yt.ListFormats("foo")
+			formatList, err = yt.ListFormats(context.Background(), "foo")
 			Expect(err).To(MatchError(youtubeapi.ErrorNoVideoFound))
 			Expect(formatList).To(BeNil())
 		})
 	})
+
+	When("Recording metrics", func() {
+		It("Records the result of yt-dlp calls", func() {
+			mockExecutor := &testutils.MockCommandExecutor{
+				MockStdoutResult: "url123\n" + makeMockVideoJson("123", "Mock Title"),
+			}
+			mockMetrics := &MockMetrics{}
+
+			yt := youtubeapi.NewYoutubeAPI()
+			yt.SetCmdExecutor(mockExecutor)
+			yt.SetMetrics(mockMetrics)
+
+			_, err := yt.GetYoutubeMedia(context.Background(), "foo")
+			Expect(err).To(BeNil())
+
+			mockExecutor.MockExitCode = 1
+
+			_, err = yt.GetYoutubeMedia(context.Background(), "foo")
+			Expect(err).NotTo(BeNil())
+
+			Expect(mockMetrics.YtDlpResults).To(Equal([]metrics.YtDlpResult{
+				metrics.YtDlpResultSuccess,
+				metrics.YtDlpResultFailure,
+			}))
+		})
+	})
+
+	When("Cancelling yt-dlp invocations", func() {
+		It("Aborts the invocation when the context is cancelled or times out", func() {
+			mockExecutor := &testutils.MockCommandExecutor{
+				MockBlockUntilDone: true,
+			}
+			mockMetrics := &MockMetrics{}
+
+			yt := youtubeapi.NewYoutubeAPI()
+			yt.SetCmdExecutor(mockExecutor)
+			yt.SetMetrics(mockMetrics)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			go func() {
+				time.Sleep(50 * time.Millisecond)
+				cancel()
+			}()
+
+			_, err := yt.GetYoutubeMedia(ctx, "foo")
+			Expect(err).To(MatchError(context.Canceled))
+
+			ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+
+			_, err = yt.SearchYoutubeMedia(ctx, 5, "foo")
+			Expect(err).To(MatchError(cmd.ErrorCommandTimeout))
+
+			Expect(mockMetrics.YtDlpResults).To(Equal([]metrics.YtDlpResult{
+				metrics.YtDlpResultFailure,
+				metrics.YtDlpResultTimeout,
+			}))
+		})
+	})
+
+	When("Logging yt-dlp invocations", func() {
+		It("Logs command lines with credentials redacted", func() {
+			mockExecutor := &testutils.MockCommandExecutor{
+				MockStdoutResult: "url123\n" + makeMockVideoJson("123", "Mock Title"),
+			}
+
+			logBuffer := &bytes.Buffer{}
+
+			yt := youtubeapi.NewYoutubeAPI()
+			yt.SetCmdExecutor(mockExecutor)
+			yt.SetLogger(slog.New(slog.NewTextHandler(logBuffer, &slog.HandlerOptions{Level: slog.LevelDebug})))
+			yt.SetYtDlpArgs([]string{"--username", "user123", "--password", "hunter2", "--add-header=Cookie: secret", "--verbose"})
+
+			_, err := yt.GetYoutubeMedia(context.Background(), "foo")
+			Expect(err).To(BeNil())
+
+			logOutput := logBuffer.String()
+			Expect(logOutput).To(ContainSubstring("running yt-dlp"))
+			Expect(logOutput).To(ContainSubstring("ytsearch:foo"))
+			Expect(logOutput).To(ContainSubstring("--password <redacted>"))
+			Expect(logOutput).To(ContainSubstring("--add-header=<redacted>"))
+			Expect(logOutput).To(ContainSubstring("--verbose"))
+			Expect(logOutput).NotTo(ContainSubstring("user123"))
+			Expect(logOutput).NotTo(ContainSubstring("hunter2"))
+			Expect(logOutput).NotTo(ContainSubstring("secret"))
+		})
+	})
 })